@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Address Book Configuration
+const (
+	AddressBookVersion = 1 // Format version written by export and accepted by import
+)
+
+// addressBook is the routing configuration of an instance as a portable file: fan-out aliases,
+// address macros with their table rows, and destination options
+type addressBook struct {
+	Version            int                 `json:"version"`
+	FanoutAliases      map[string][]string `json:"fanout_aliases,omitempty"`
+	AddressMacros      []addressBookMacro  `json:"address_macros,omitempty"`
+	DestinationOptions map[string]string   `json:"destination_options,omitempty"` // platform:id to option+option
+}
+
+// addressBookMacro is an address macro with its table inlined
+type addressBookMacro struct {
+	Pattern string            `json:"pattern"`
+	File    string            `json:"file"` // Base name of the table file
+	Rows    map[string]string `json:"rows"`
+}
+
+// runAddressBook implements `email2dm address-book export|import`
+func runAddressBook(args []string) error {
+	if len(args) == 0 {
+		return errors.New("use address-book export or address-book import <file>")
+	}
+	switch args[0] {
+	case "export":
+		return runAddressBookExport(args[1:])
+	case "import":
+		return runAddressBookImport(args[1:])
+	default:
+		return fmt.Errorf("unknown command '%s': use export or import", args[0])
+	}
+}
+
+// runAddressBookExport writes the address book of the current environment as JSON
+func runAddressBookExport(args []string) error {
+	flags := flag.NewFlagSet("address-book export", flag.ContinueOnError)
+	output := flags.String("o", "", "write the address book to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	book, err := readAddressBook(os.Getenv("FANOUT_ALIASES"), os.Getenv("ADDRESS_MACROS"), os.Getenv("DESTINATION_OPTIONS"))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(book); err != nil {
+		return fmt.Errorf("failed to write address book: %w", err)
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d aliases, %d macros and %d destination options to %s\n",
+			len(book.FanoutAliases), len(book.AddressMacros), len(book.DestinationOptions), *output)
+	}
+	return nil
+}
+
+// readAddressBook collects the address book from FANOUT_ALIASES, ADDRESS_MACROS and
+// DESTINATION_OPTIONS values, reading the macro tables
+func readAddressBook(aliases, macros, options string) (*addressBook, error) {
+	book := &addressBook{Version: AddressBookVersion}
+
+	var err error
+	if book.FanoutAliases, err = parseFanoutAliases(aliases); err != nil {
+		return nil, err
+	}
+
+	addressMacros, err := parseAddressMacros(macros)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]bool)
+	for _, macro := range addressMacros {
+		// Tables from different directories may share a base name
+		file := filepath.Base(macro.File)
+		for i := 2; files[file]; i++ {
+			file = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(filepath.Base(macro.File), filepath.Ext(macro.File)), i, filepath.Ext(macro.File))
+		}
+		files[file] = true
+		book.AddressMacros = append(book.AddressMacros, addressBookMacro{Pattern: macro.Pattern, File: file, Rows: macro.table})
+	}
+
+	// Options are kept as written; parsing checks them
+	if _, err := parseDestinationOptions(options); err != nil {
+		return nil, err
+	}
+	for _, entry := range strings.Split(options, ";") {
+		destination, list, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		if book.DestinationOptions == nil {
+			book.DestinationOptions = make(map[string]string)
+		}
+		if previous := book.DestinationOptions[destination]; previous != "" {
+			list = previous + "+" + list
+		}
+		book.DestinationOptions[destination] = list
+	}
+	return book, nil
+}
+
+// runAddressBookImport writes the macro tables of an exported address book to a directory and
+// prints the environment variables that use them
+func runAddressBookImport(args []string) error {
+	flags := flag.NewFlagSet("address-book import", flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory to write the address macro tables to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("name the exported address book file, e.g. address-book import -dir /etc/email2dm book.json")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var book addressBook
+	if err := json.Unmarshal(data, &book); err != nil {
+		return fmt.Errorf("invalid address book %s: %w", flags.Arg(0), err)
+	}
+	if book.Version != AddressBookVersion {
+		return fmt.Errorf("unsupported address book version %d, this build reads version %d", book.Version, AddressBookVersion)
+	}
+
+	env, err := writeAddressBook(&book, *dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"FANOUT_ALIASES", "ADDRESS_MACROS", "DESTINATION_OPTIONS"} {
+		if env[name] != "" {
+			fmt.Printf("export %s=%s\n", name, shellQuote(env[name]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d aliases, %d macros and %d destination options; set the variables above\n",
+		len(book.FanoutAliases), len(book.AddressMacros), len(book.DestinationOptions))
+	return nil
+}
+
+// writeAddressBook writes the macro tables to new files in dir and returns the environment
+// variable values for the address book, checked as the bridge would at startup
+func writeAddressBook(book *addressBook, dir string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	var aliases []string
+	for _, name := range sortedKeys(book.FanoutAliases) {
+		aliases = append(aliases, name+"="+strings.Join(book.FanoutAliases[name], ","))
+	}
+	env["FANOUT_ALIASES"] = strings.Join(aliases, ";")
+	if _, err := parseFanoutAliases(env["FANOUT_ALIASES"]); err != nil {
+		return nil, err
+	}
+
+	var options []string
+	for _, destination := range sortedKeys(book.DestinationOptions) {
+		options = append(options, destination+"="+book.DestinationOptions[destination])
+	}
+	env["DESTINATION_OPTIONS"] = strings.Join(options, ";")
+	if _, err := parseDestinationOptions(env["DESTINATION_OPTIONS"]); err != nil {
+		return nil, err
+	}
+
+	var macros []string
+	for _, macro := range book.AddressMacros {
+		if macro.File == "" || macro.File != filepath.Base(macro.File) || macro.File == ".." {
+			return nil, fmt.Errorf("invalid table file name '%s' for %s", macro.File, macro.Pattern)
+		}
+		path := filepath.Join(dir, macro.File)
+		if err := writeAddressMacroTable(path, macro.Rows); err != nil {
+			return nil, err
+		}
+		macros = append(macros, macro.Pattern+"="+path)
+	}
+	env["ADDRESS_MACROS"] = strings.Join(macros, ";")
+	if _, err := parseAddressMacros(env["ADDRESS_MACROS"]); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// writeAddressMacroTable writes the rows to a new table file, the default row last
+func writeAddressMacroTable(path string, rows map[string]string) error {
+	var table strings.Builder
+	table.WriteString("# name destination\n")
+	for _, name := range sortedKeys(rows) {
+		if name != AddressMacroDefaultRow {
+			fmt.Fprintf(&table, "%s %s\n", name, rows[name])
+		}
+	}
+	if destination, exists := rows[AddressMacroDefaultRow]; exists {
+		fmt.Fprintf(&table, "%s %s\n", AddressMacroDefaultRow, destination)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := io.WriteString(file, table.String()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// sortedKeys returns the keys of a map in order, so imports are reproducible
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote quotes a value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Address Token Configuration
+const (
+	DefaultAddressTokenDomain = "bridge"
+	AddressTokenSignatureLen  = 16 // Hex characters of the HMAC kept in an address
+	AddressTokenExpiryLayout  = "20060102"
+)
+
+// addressTokenAliases are short platform names accepted in signed addresses
+var addressTokenAliases = map[string]string{
+	"tg": "telegram",
+}
+
+// AddressTokens issues and verifies signed addresses such as 123456789.tg.1f0c9a2b7d3e4a5c@bridge,
+// which name a destination together with an HMAC over it, so only holders of an issued address can use it
+type AddressTokens struct {
+	Secret   []byte
+	Domain   string // Domain of signed addresses
+	Required bool   // Reject plain platform addresses
+}
+
+// parseAddressTokens reads ADDRESS_TOKEN_SECRET, ADDRESS_TOKEN_DOMAIN and ADDRESS_TOKENS_REQUIRED
+func parseAddressTokens() (*AddressTokens, error) {
+	secret := os.Getenv("ADDRESS_TOKEN_SECRET")
+	required, err := parseBoolEnv("ADDRESS_TOKENS_REQUIRED", false)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		if required {
+			return nil, fmt.Errorf("ADDRESS_TOKENS_REQUIRED requires ADDRESS_TOKEN_SECRET")
+		}
+		return nil, nil
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(os.Getenv("ADDRESS_TOKEN_DOMAIN")))
+	if domain == "" {
+		domain = DefaultAddressTokenDomain
+	}
+	if builtinPlatform(domain) {
+		return nil, fmt.Errorf("invalid ADDRESS_TOKEN_DOMAIN '%s': it is a platform domain", domain)
+	}
+
+	return &AddressTokens{Secret: []byte(secret), Domain: domain, Required: required}, nil
+}
+
+// sign computes the truncated HMAC-SHA256 over platform, ID and expiry
+func (t *AddressTokens) sign(platform, id, expiry string) string {
+	mac := hmac.New(sha256.New, t.Secret)
+	mac.Write([]byte(platform + "\n" + id + "\n" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))[:AddressTokenSignatureLen]
+}
+
+// Issue returns the signed local part for a destination; a zero expiry never expires
+func (t *AddressTokens) Issue(platform, id string, expires time.Time) string {
+	expiry := ""
+	if !expires.IsZero() {
+		expiry = expires.UTC().Format(AddressTokenExpiryLayout)
+	}
+
+	name := platform
+	for alias, target := range addressTokenAliases {
+		if target == platform {
+			name = alias
+		}
+	}
+
+	parts := []string{id, name}
+	if expiry != "" {
+		parts = append(parts, expiry)
+	}
+	return strings.Join(append(parts, t.sign(platform, id, expiry)), ".")
+}
+
+// Verify checks a signed local part and returns the destination it names. The platform
+// and ID are validated by the caller like those of a plain address
+func (t *AddressTokens) Verify(localPart string, now time.Time) (platform, id string, err error) {
+	fields := strings.Split(localPart, ".")
+	if len(fields) < 3 {
+		return "", "", fmt.Errorf("signed address must be <id>.<platform>[.<expiry>].<signature>")
+	}
+
+	signature := strings.ToLower(fields[len(fields)-1])
+	fields = fields[:len(fields)-1]
+
+	// The optional expiry is a date; platform names never start with a digit
+	expiry := ""
+	if last := fields[len(fields)-1]; len(fields) >= 3 && len(last) == len(AddressTokenExpiryLayout) && last[0] >= '0' && last[0] <= '9' {
+		expiry = last
+		fields = fields[:len(fields)-1]
+	}
+
+	platform = strings.ToLower(fields[len(fields)-1])
+	if target, ok := addressTokenAliases[platform]; ok {
+		platform = target
+	}
+	id = strings.Join(fields[:len(fields)-1], ".")
+
+	if !hmac.Equal([]byte(signature), []byte(t.sign(platform, id, expiry))) {
+		return "", "", fmt.Errorf("signature does not match")
+	}
+
+	if expiry != "" {
+		date, err := time.Parse(AddressTokenExpiryLayout, expiry)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid expiry '%s'", expiry)
+		}
+		// Addresses stay valid through the whole expiry day
+		if !now.UTC().Before(date.AddDate(0, 0, 1)) {
+			return "", "", fmt.Errorf("address expired on %s", date.Format("2006-01-02"))
+		}
+	}
+
+	return platform, id, nil
+}
+
+// runAddressToken prints a signed address for a platform:id destination
+func runAddressToken(args []string) error {
+	flags := flag.NewFlagSet("address-token", flag.ContinueOnError)
+	days := flags.Int("days", 0, "days the address stays valid (default: no expiry)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: email2dm address-token [-days n] platform:id")
+	}
+
+	tokens, err := parseAddressTokens()
+	if err != nil {
+		return err
+	}
+	if tokens == nil {
+		return fmt.Errorf("ADDRESS_TOKEN_SECRET is not set")
+	}
+
+	platform, id, found := strings.Cut(flags.Arg(0), ":")
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	if target, ok := addressTokenAliases[platform]; ok {
+		platform = target
+	}
+	if !found || platform == "" || id == "" {
+		return fmt.Errorf("invalid destination '%s': use platform:id", flags.Arg(0))
+	}
+
+	// Check the ID like delivery would, without any platform clients. Custom and plugin
+	// platforms are not configured here, so only built-in IDs are checked
+	log.SetOutput(io.Discard)
+	_, _, err = (&EmailProcessor{}).validateDestination(platform, id)
+	log.SetOutput(os.Stderr)
+	if err != nil && builtinPlatform(platform) {
+		return err
+	}
+
+	var expires time.Time
+	if *days > 0 {
+		expires = time.Now().AddDate(0, 0, *days)
+	}
+
+	localPart := tokens.Issue(platform, id, expires)
+	if strings.ContainsAny(localPart, "@ \"") {
+		localPart = `"` + strings.ReplaceAll(localPart, `"`, `\"`) + `"`
+	}
+	fmt.Printf("%s@%s\n", localPart, tokens.Domain)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddressTokensRoundTrip(t *testing.T) {
+	tokens := &AddressTokens{Secret: []byte("test secret"), Domain: DefaultAddressTokenDomain}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		platform string
+		id       string
+		expires  time.Time
+	}{
+		{"telegram alias", "telegram", "123456789", time.Time{}},
+		{"negative chat id", "telegram", "-1001234567890", time.Time{}},
+		{"slack", "slack", "C0123456789", time.Time{}},
+		{"id with dots", "mastodon", "@user@mastodon.social", time.Time{}},
+		{"expiry later today", "telegram", "42", now},
+		{"expiry next year", "slack", "U0123456789", now.AddDate(1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPart := tokens.Issue(tt.platform, tt.id, tt.expires)
+			platform, id, err := tokens.Verify(localPart, now)
+			if err != nil {
+				t.Fatalf("Verify(%s) error = %v", localPart, err)
+			}
+			if platform != tt.platform || id != tt.id {
+				t.Fatalf("Verify(%s) = %s, %s, want %s, %s", localPart, platform, id, tt.platform, tt.id)
+			}
+
+			// Uppercase signatures are accepted, as mail clients may change the case
+			signature := localPart[strings.LastIndex(localPart, ".")+1:]
+			if _, _, err := tokens.Verify(strings.TrimSuffix(localPart, signature)+strings.ToUpper(signature), now); err != nil {
+				t.Errorf("Verify() of uppercase signature error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAddressTokensVerifyRejects(t *testing.T) {
+	tokens := &AddressTokens{Secret: []byte("test secret"), Domain: DefaultAddressTokenDomain}
+	other := &AddressTokens{Secret: []byte("other secret"), Domain: DefaultAddressTokenDomain}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	valid := tokens.Issue("telegram", "123456789", time.Time{})
+	expiring := tokens.Issue("telegram", "123456789", now)
+
+	tests := []struct {
+		name      string
+		localPart string
+		now       time.Time
+		wantErr   string
+	}{
+		{"other secret", other.Issue("telegram", "123456789", time.Time{}), now, "signature does not match"},
+		{"other id", strings.Replace(valid, "123456789", "987654321", 1), now, "signature does not match"},
+		{"other platform", strings.Replace(valid, ".tg.", ".slack.", 1), now, "signature does not match"},
+		{"expiry removed", strings.Replace(expiring, ".20261017.", ".", 1), now, "signature does not match"},
+		{"expiry extended", strings.Replace(expiring, ".20261017.", ".20271017.", 1), now, "signature does not match"},
+		{"expired", expiring, now.AddDate(0, 0, 1), "address expired on 2026-10-17"},
+		{"truncated signature", valid[:len(valid)-1], now, "signature does not match"},
+		{"too few fields", "123456789.tg", now, "signed address must be"},
+		{"plain address", "123456789", now, "signed address must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			platform, id, err := tokens.Verify(tt.localPart, tt.now)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify(%s) = %s, %s, %v, want error %s", tt.localPart, platform, id, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Admin API Configuration
+const (
+	AdminPingPath       = "/admin/ping"
+	AdminHistoryPath    = "/admin/history"
+	AdminUsagePath      = "/admin/usage"
+	MinAdminTokenLength = 16
+	AdminReadTimeout    = 10 * time.Second
+	AdminWriteTimeout   = PingTimeout + 10*time.Second // A ping may wait out rate limits
+)
+
+// AdminServer serves operator endpoints, authenticated with a bearer token
+type AdminServer struct {
+	emailProcessor *EmailProcessor
+	listenAddr     string
+	token          string
+	server         *http.Server
+}
+
+// NewAdminServer creates an admin server answering requests that carry token
+func NewAdminServer(emailProcessor *EmailProcessor, listenAddr, token string) *AdminServer {
+	as := &AdminServer{
+		emailProcessor: emailProcessor,
+		listenAddr:     listenAddr,
+		token:          token,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminPingPath, as.authenticated(as.handlePing))
+	mux.HandleFunc(AdminHistoryPath, as.authenticated(as.handleHistory))
+	mux.HandleFunc(AdminUsagePath, as.authenticated(as.handleUsage))
+
+	as.server = &http.Server{
+		Addr:         listenAddr,
+		Handler:      mux,
+		ReadTimeout:  AdminReadTimeout,
+		WriteTimeout: AdminWriteTimeout,
+	}
+	return as
+}
+
+// Start starts the admin server
+func (as *AdminServer) Start() error {
+	log.Printf("Starting admin API on %s", as.listenAddr)
+	err := as.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop stops the admin server, letting running pings finish
+func (as *AdminServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), AdminWriteTimeout)
+	defer cancel()
+	return as.server.Shutdown(ctx)
+}
+
+// authenticated rejects requests without the admin token as "Authorization: Bearer <token>"
+func (as *AdminServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(as.token)) != 1 {
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or wrong admin token"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handlePing sends a canary message to the destination in the "to" parameter and returns the result
+func (as *AdminServer) handlePing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	to := strings.TrimSpace(r.FormValue("to"))
+	if to == "" {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "missing to parameter, e.g. to=123456789@telegram"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), PingTimeout)
+	defer cancel()
+	result, err := as.emailProcessor.Ping(ctx, to)
+	switch {
+	case errors.Is(err, ErrInvalidDestination):
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeAdminJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	default:
+		writeAdminJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleHistory exports the deliveries between the "since" and "until" parameters as CSV or JSON
+func (as *AdminServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	if as.emailProcessor.History == nil {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "no history is kept: set HISTORY_SIZE or HISTORY_FILE"})
+		return
+	}
+	query := r.URL.Query()
+	historyRange, err := parseHistoryRange(query.Get("since"), query.Get("until"))
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	format, err := parseHistoryFormat(query.Get("format"))
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	entries, err := as.emailProcessor.History.Export(historyRange)
+	if err != nil {
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if format == HistoryExportJSON {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="email2dm-history.csv"`)
+	}
+	if err := writeHistoryExport(w, format, entries); err != nil {
+		log.Printf("Error writing history export: %v", err)
+	}
+}
+
+// handleUsage returns the bytes each destination accepted today with its size quota
+func (as *AdminServer) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	if as.emailProcessor.SizeQuotas == nil {
+		writeAdminJSON(w, http.StatusOK, []SizeQuotaUsage{})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, as.emailProcessor.SizeQuotas.Usage())
+}
+
+// writeAdminJSON writes a JSON response
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
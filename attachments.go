@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Attachment represents a decoded MIME attachment
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte // nil when the content was spooled to disk
+	Size        int64
+	SpoolPath   string // Temporary file holding the content, see AttachmentSpool
+	Inline      bool   // Image shown in the message body, such as a camera snapshot, rather than attached
+}
+
+// Compressed attachment defaults
+const (
+	DefaultCompressedAttachmentMaxBytes = 256 * 1024 // Largest compressed attachment that is inlined
+	DefaultCompressedAttachmentLines    = 50         // Lines inlined from each decompressed attachment
+	MaxInlinedLineLength                = 1000       // Longer lines are truncated
+)
+
+// isCompressedLog reports whether an attachment name looks like a compressed log we can inline
+func isCompressedLog(filename string) bool {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".gz", ".zst", ".zip":
+		return true
+	default:
+		return false
+	}
+}
+
+// decompressAttachment returns a reader over the decompressed content of a .gz, .zst or single-file .zip attachment
+func decompressAttachment(attachment Attachment) (io.Reader, string, error) {
+	data, err := attachment.Content()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := attachment.Filename
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gz":
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid gzip data: %w", err)
+		}
+		return reader, strings.TrimSuffix(name, path.Ext(name)), nil
+
+	case ".zst":
+		decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid zstd data: %w", err)
+		}
+		return decoder.IOReadCloser(), strings.TrimSuffix(name, path.Ext(name)), nil
+
+	case ".zip":
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid zip data: %w", err)
+		}
+		if len(archive.File) != 1 || archive.File[0].FileInfo().IsDir() {
+			return nil, "", fmt.Errorf("zip archive contains %d entries, only single-file archives are inlined", len(archive.File))
+		}
+		reader, err := archive.File[0].Open()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open zip entry: %w", err)
+		}
+		return reader, archive.File[0].Name, nil
+
+	default:
+		return nil, "", fmt.Errorf("unsupported compression format: %s", name)
+	}
+}
+
+// inlineCompressedAttachment decompresses an attachment and returns its first maxLines lines,
+// reading at most maxBytes of decompressed data so archive bombs stay harmless
+func inlineCompressedAttachment(attachment Attachment, maxLines int, maxBytes int64) (string, error) {
+	reader, innerName, err := decompressAttachment(attachment)
+	if err != nil {
+		return "", err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	buffered := bufio.NewReader(io.LimitReader(reader, maxBytes))
+	var content strings.Builder
+	lines := 0
+	truncated := false
+
+	for lines < maxLines {
+		line, err := buffered.ReadString('\n')
+		if line != "" {
+			line = strings.TrimRight(line, "\r\n")
+			if len(line) > MaxInlinedLineLength {
+				line = line[:MaxInlinedLineLength] + "…"
+			}
+			content.WriteString(line)
+			content.WriteString("\n")
+			lines++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress %s: %w", attachment.Filename, err)
+		}
+	}
+
+	// Anything left over means the preview is partial
+	if _, err := buffered.Peek(1); err == nil {
+		truncated = true
+	}
+
+	header := fmt.Sprintf("--- %s (from %s) ---", innerName, attachment.Filename)
+	if truncated {
+		header = fmt.Sprintf("--- %s (from %s, first %d lines) ---", innerName, attachment.Filename, lines)
+	}
+
+	return header + "\n" + strings.TrimRight(content.String(), "\n"), nil
+}
+
+// inlineCompressedAttachments appends previews of small compressed log attachments to the body
+func (ep *EmailProcessor) inlineCompressedAttachments(body string, attachments []Attachment) string {
+	if ep.Config == nil || !ep.Config.InlineCompressedAttachments {
+		return body
+	}
+
+	for _, attachment := range attachments {
+		if !isCompressedLog(attachment.Filename) {
+			continue
+		}
+		if attachment.Size > int64(ep.Config.CompressedAttachmentMaxBytes) {
+			log.Printf("Skipping compressed attachment %s: %d bytes exceeds limit of %d",
+				attachment.Filename, attachment.Size, ep.Config.CompressedAttachmentMaxBytes)
+			continue
+		}
+
+		preview, err := inlineCompressedAttachment(attachment, ep.Config.CompressedAttachmentLines, ep.parseLimits().MaxBodyBytes)
+		if err != nil {
+			log.Printf("Warning: could not inline attachment %s: %v", attachment.Filename, err)
+			continue
+		}
+
+		log.Printf("Inlined compressed attachment %s", attachment.Filename)
+		body = strings.TrimRight(body, "\n") + "\n\n" + preview
+	}
+
+	return body
+}
+
+// attachmentTypeAllowed reports whether a content type matches an allowlist of types such as
+// "application/pdf" or "image/*". An empty allowlist allows every type
+func attachmentTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, pattern := range allowed {
+		if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard {
+			if strings.HasPrefix(contentType, prefix) {
+				return true
+			}
+		} else if contentType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// splitInlineImages separates the images embedded in the message body from the attachments
+func splitInlineImages(all []Attachment) (attachments, inlineImages []Attachment) {
+	for _, attachment := range all {
+		if attachment.Inline {
+			inlineImages = append(inlineImages, attachment)
+		} else {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, inlineImages
+}
+
+// imageExtension returns the usual file extension of an image type, such as ".jpg"
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ""
+	}
+}
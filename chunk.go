@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunking Configuration
+const (
+	TruncatedMarker  = "\n[truncated]" // Ends the last message when a destination's message limit cut the text short
+	HTMLChunkReserve = 100             // Bytes kept free in each HTML chunk for tags closed and reopened at its boundaries
+)
+
+// messageBudgetKey is the context key under which the destination's MessageBudget is stored
+type messageBudgetKey struct{}
+
+// withMessageBudget returns a context that applies budget when messages are split
+func withMessageBudget(ctx context.Context, budget MessageBudget) context.Context {
+	return context.WithValue(ctx, messageBudgetKey{}, budget)
+}
+
+// messageBudgetFrom returns the budget carried by ctx, or an empty budget for platform defaults
+func messageBudgetFrom(ctx context.Context) MessageBudget {
+	budget, _ := ctx.Value(messageBudgetKey{}).(MessageBudget)
+	return budget
+}
+
+// chunkForDestination splits text into messages of at most platformLimit bytes, or the smaller
+// per-destination limit, and drops messages beyond the destination's message count
+func chunkForDestination(ctx context.Context, text string, platformLimit int) []string {
+	budget := messageBudgetFrom(ctx)
+	limit := platformLimit
+	if budget.MaxChars > 0 && budget.MaxChars < limit {
+		limit = budget.MaxChars
+	}
+
+	chunks := []string{text}
+	if len(text) > limit {
+		chunks = splitMessage(text, limit)
+	}
+
+	if budget.MaxMessages > 0 && len(chunks) > budget.MaxMessages {
+		chunks = chunks[:budget.MaxMessages]
+		last := chunks[len(chunks)-1]
+		if len(last)+len(TruncatedMarker) > limit {
+			cut := max(limit-len(TruncatedMarker), 0)
+			for cut > 0 && !utf8.RuneStart(last[cut]) {
+				cut--
+			}
+			last = last[:cut]
+		}
+		chunks[len(chunks)-1] = last + TruncatedMarker
+	}
+
+	return chunks
+}
+
+// chunkHTMLForDestination is chunkForDestination for HTML markup: no chunk ends inside a tag or
+// an entity, and elements still open at a boundary are closed there and reopened in the next chunk
+func chunkHTMLForDestination(ctx context.Context, text string, platformLimit int) []string {
+	budget := messageBudgetFrom(ctx)
+	limit := platformLimit
+	if budget.MaxChars > 0 && budget.MaxChars < limit {
+		limit = budget.MaxChars
+	}
+	if len(text) <= limit {
+		return []string{text}
+	}
+
+	// Split short of the limit to leave room for the closing and reopening tags
+	reserve := HTMLChunkReserve
+	if reserve > limit/4 {
+		reserve = limit / 4
+	}
+	budget.MaxChars = limit - reserve
+	return balanceHTMLChunks(chunkForDestination(withMessageBudget(ctx, budget), text, platformLimit))
+}
+
+// balanceHTMLChunks moves tags and entities cut by a chunk boundary into the next chunk, drops
+// fragments left by truncation, and closes the elements open at the end of each chunk, reopening
+// them at the start of the next
+func balanceHTMLChunks(chunks []string) []string {
+	var open []string // Opening tags in effect, outermost first
+	carry := ""
+	balanced := make([]string, 0, len(chunks))
+
+	for i, chunk := range chunks {
+		chunk = carry + chunk
+		carry = ""
+		if i < len(chunks)-1 {
+			chunk, carry = cutIncompleteHTMLTail(chunk)
+		}
+		chunk = dropIncompleteHTML(chunk)
+
+		reopen := strings.Join(open, "")
+		open = trackHTMLTags(open, chunk)
+
+		var closing strings.Builder
+		for j := len(open) - 1; j >= 0; j-- {
+			closing.WriteString("</" + htmlTagName(open[j]) + ">")
+		}
+		balanced = append(balanced, reopen+chunk+closing.String())
+	}
+	return balanced
+}
+
+// incompleteHTMLAt returns the end of a tag or entity starting at text[i] and whether it is
+// complete. Literal < and & are always escaped, so any that is not a whole tag or entity was cut
+func incompleteHTMLAt(text string, i int) (end int, complete bool) {
+	switch text[i] {
+	case '<':
+		for end = i + 1; end < len(text); end++ {
+			switch text[end] {
+			case '>':
+				return end + 1, true
+			case '<', '\n':
+				return end, false
+			}
+		}
+		return end, false
+	case '&':
+		for end = i + 1; end < len(text); end++ {
+			c := text[end]
+			if c == ';' {
+				return end + 1, end > i+1
+			}
+			if !(c == '#' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return end, false
+			}
+		}
+		return end, false
+	}
+	return i + 1, true
+}
+
+// cutIncompleteHTMLTail splits a tag or entity cut off at the end of chunk from the rest
+func cutIncompleteHTMLTail(chunk string) (string, string) {
+	start := strings.LastIndexAny(chunk, "<&")
+	if start < 0 {
+		return chunk, ""
+	}
+	if end, complete := incompleteHTMLAt(chunk, start); !complete && end == len(chunk) {
+		return chunk[:start], chunk[start:]
+	}
+	return chunk, ""
+}
+
+// dropIncompleteHTML removes tag and entity fragments, such as those left where truncation cut the text
+func dropIncompleteHTML(chunk string) string {
+	if !strings.ContainsAny(chunk, "<&") {
+		return chunk
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(chunk); {
+		if chunk[i] != '<' && chunk[i] != '&' {
+			result.WriteByte(chunk[i])
+			i++
+			continue
+		}
+		end, complete := incompleteHTMLAt(chunk, i)
+		if complete {
+			result.WriteString(chunk[i:end])
+		}
+		i = end
+	}
+	return result.String()
+}
+
+// trackHTMLTags returns the opening tags still in effect after chunk, given those open before it
+func trackHTMLTags(open []string, chunk string) []string {
+	open = append([]string(nil), open...)
+	for i := strings.IndexByte(chunk, '<'); i >= 0; {
+		end := strings.IndexByte(chunk[i:], '>')
+		if end < 0 {
+			break
+		}
+		tag := chunk[i : i+end+1]
+		if name, closing := strings.CutPrefix(htmlTagName(tag), "/"); closing {
+			for j := len(open) - 1; j >= 0; j-- {
+				if htmlTagName(open[j]) == name {
+					open = append(open[:j], open[j+1:]...)
+					break
+				}
+			}
+		} else {
+			open = append(open, tag)
+		}
+
+		next := strings.IndexByte(chunk[i+end:], '<')
+		if next < 0 {
+			break
+		}
+		i += end + next
+	}
+	return open
+}
+
+// htmlTagName returns the lowercase name of a tag such as <a href="..."> or </b>
+func htmlTagName(tag string) string {
+	name := strings.Trim(tag, "<>")
+	if space := strings.IndexAny(name, " \t"); space >= 0 {
+		name = name[:space]
+	}
+	return strings.ToLower(name)
+}
+
+// splitMessage splits a message into chunks of at most maxLength bytes,
+// preferring line boundaries and wrapping lines that are too long on their own
+func splitMessage(text string, maxLength int) []string {
+	var chunks []string
+	lines := strings.Split(text, "\n")
+	var currentChunk strings.Builder
+
+	// Long lines are wrapped short of the limit, but never below one byte for very small limits
+	wrapWidth := maxLength - 100
+	if wrapWidth < 1 {
+		wrapWidth = max(maxLength, 1)
+	}
+
+	for _, line := range lines {
+		// Check if adding this line would exceed the limit
+		if currentChunk.Len()+len(line)+1 > maxLength {
+			// Save current chunk if it has content
+			if currentChunk.Len() > 0 {
+				chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+				currentChunk.Reset()
+			}
+
+			// Handle very long lines by wrapping them
+			if len(line) > wrapWidth {
+				wrappedLines := wrapLongLine(line, wrapWidth)
+				for j, wrappedLine := range wrappedLines {
+					if j == 0 && currentChunk.Len() == 0 {
+						// First wrapped line can go in current chunk
+						currentChunk.WriteString(wrappedLine)
+					} else {
+						// Additional wrapped lines become separate chunks
+						if currentChunk.Len() > 0 {
+							chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+							currentChunk.Reset()
+						}
+						currentChunk.WriteString(wrappedLine)
+					}
+				}
+			} else {
+				currentChunk.WriteString(line)
+			}
+		} else {
+			// Add line to current chunk
+			if currentChunk.Len() > 0 {
+				currentChunk.WriteString("\n")
+			}
+			currentChunk.WriteString(line)
+		}
+	}
+
+	// Don't forget the last chunk
+	if currentChunk.Len() > 0 {
+		chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+	}
+
+	return chunks
+}
+
+// wrapLongLine wraps a single long line into multiple lines
+func wrapLongLine(line string, maxLength int) []string {
+	var wrapped []string
+
+	for len(line) > maxLength {
+		// Try to break at a space near the limit
+		breakPoint := maxLength
+
+		// Look for a space within the last 50 characters
+		for i := maxLength - 1; i >= maxLength-50 && i >= 0; i-- {
+			if line[i] == ' ' {
+				breakPoint = i
+				break
+			}
+		}
+
+		// Extract the chunk
+		chunk := line[:breakPoint]
+		wrapped = append(wrapped, chunk)
+
+		// Update remaining line
+		line = line[breakPoint:]
+		if len(line) > 0 && line[0] == ' ' {
+			line = line[1:] // Remove leading space
+		}
+	}
+
+	// Add remaining text
+	if len(line) > 0 {
+		wrapped = append(wrapped, line)
+	}
+
+	return wrapped
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessageSmallLimits(t *testing.T) {
+	texts := []string{
+		strings.Repeat("x", 600),
+		strings.Repeat("word ", 120),
+		"short\n" + strings.Repeat("y", 250) + "\n\nend",
+		strings.Repeat("line\n", 80),
+	}
+
+	for _, limit := range []int{1, 2, 10, 50, 99, 100, 101, 150, 500} {
+		for _, text := range texts {
+			chunks := splitMessage(text, limit)
+			if len(chunks) == 0 {
+				t.Fatalf("splitMessage(%d bytes, %d) returned no chunks", len(text), limit)
+			}
+			for _, chunk := range chunks {
+				if len(chunk) > limit {
+					t.Fatalf("splitMessage(%d bytes, %d) returned a chunk of %d bytes", len(text), limit, len(chunk))
+				}
+			}
+		}
+	}
+}
+
+func TestChunkForDestinationSmallLimits(t *testing.T) {
+	text := strings.Repeat("alert on host1 ", 40)
+
+	// Limits left after a long mention may be tiny or gone; splitting must not panic
+	for _, limit := range []int{-50, 0, 1, 5, 20} {
+		ctx := withMessageBudget(context.Background(), MessageBudget{MaxMessages: 2})
+		if chunks := chunkForDestination(ctx, text, limit); len(chunks) != 2 {
+			t.Errorf("chunkForDestination(limit %d) returned %d chunks, want 2", limit, len(chunks))
+		}
+	}
+}
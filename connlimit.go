@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Connection Limit Configuration
+const (
+	DefaultMaxConnections        = 100 // Concurrent SMTP connections from all clients
+	DefaultMaxConnectionsPerIP   = 20  // Concurrent SMTP connections from one client IP
+	LowMemoryMaxConnections      = 20
+	LowMemoryMaxConnectionsPerIP = 5
+	ConnectionRejectTimeout      = 1 * time.Second // For writing the 421 reply to a refused client
+)
+
+// ConnectionLimiter counts open SMTP connections overall and per client IP, so a scanner or a
+// runaway client cannot use up memory and file descriptors
+type ConnectionLimiter struct {
+	Max   int // 0 allows any number
+	PerIP int // 0 allows any number
+
+	mutex sync.Mutex
+	total int
+	ips   map[string]int
+}
+
+// NewConnectionLimiter creates a limiter; a limit of 0 disables it
+func NewConnectionLimiter(maxConns, perIP int) *ConnectionLimiter {
+	return &ConnectionLimiter{
+		Max:   maxConns,
+		PerIP: perIP,
+		ips:   make(map[string]int),
+	}
+}
+
+// errTooManyConnections is the reply to a client refused by a connection limit
+func errTooManyConnections(message string) *smtp.SMTPError {
+	return &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      message + ", try again later",
+	}
+}
+
+// acquire counts a new connection from ip, or returns the reply refusing it
+func (l *ConnectionLimiter) acquire(ip string) *smtp.SMTPError {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.Max > 0 && l.total >= l.Max {
+		return errTooManyConnections("Too many connections")
+	}
+	if l.PerIP > 0 && l.ips[ip] >= l.PerIP {
+		return errTooManyConnections("Too many connections from " + ip)
+	}
+	l.total++
+	l.ips[ip]++
+	return nil
+}
+
+// release forgets a closed connection from ip
+func (l *ConnectionLimiter) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.total--
+	if l.ips[ip]--; l.ips[ip] <= 0 {
+		delete(l.ips, ip)
+	}
+}
+
+// limitedListener refuses connections over the limits as they are accepted, before a session
+// or TLS handshake is started for them
+type limitedListener struct {
+	net.Listener
+	limiter *ConnectionLimiter
+	metrics *Metrics
+	reply   bool // Answer refused clients with 421; false for implicit TLS, where they expect a handshake
+}
+
+// Accept returns the next connection within the limits
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		// IPv6 clients share the slots of their /64, like their message rate
+		ip := clientNetwork(SessionInfo{RemoteAddr: conn.RemoteAddr().String()}.ClientIP())
+		if reply := l.limiter.acquire(ip); reply != nil {
+			log.Printf("Connection rejected from %s: %s", conn.RemoteAddr(), reply.Message)
+			l.metrics.Reject(RejectConnections)
+			if l.reply {
+				code := reply.EnhancedCode
+				conn.SetWriteDeadline(time.Now().Add(ConnectionRejectTimeout))
+				fmt.Fprintf(conn, "%d %d.%d.%d %s\r\n", reply.Code, code[0], code[1], code[2], reply.Message)
+			}
+			conn.Close()
+			continue
+		}
+		return &limitedConn{Conn: conn, release: func() { l.limiter.release(ip) }}, nil
+	}
+}
+
+// limitedConn gives its slot back when it is closed
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// Close closes the connection and releases its slot once
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// SetConnectionLimits limits the concurrent connections on the TCP listeners, overall and per
+// client IP; 0 disables a limit. Connections over a limit are refused with 421
+func (s *SMTPServer) SetConnectionLimits(maxConns, perIP int) {
+	s.connLimiter = NewConnectionLimiter(maxConns, perIP)
+	log.Printf("Connection limits: %d overall, %d per client IP (0 = unlimited)", maxConns, perIP)
+}
+
+// limitListener applies the connection limits, if any, to a TCP listener
+func (s *SMTPServer) limitListener(listener net.Listener, reply bool) net.Listener {
+	if s.connLimiter == nil {
+		return listener
+	}
+	return &limitedListener{Listener: listener, limiter: s.connLimiter, metrics: s.emailProcessor.Metrics, reply: reply}
+}
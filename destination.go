@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// MinMessageBudgetChars is the smallest per-destination message size accepted
+const MinMessageBudgetChars = 200
+
+// DestinationOptions holds per-destination delivery switches, e.g. "eml" or "max=4000"
+type DestinationOptions map[string]string
+
+// Has reports whether an option is set for the destination
+func (o DestinationOptions) Has(name string) bool {
+	_, exists := o[name]
+	return exists
+}
+
+// Get returns the value of an option, or "" when it is unset or a plain switch
+func (o DestinationOptions) Get(name string) string {
+	return o[name]
+}
+
+// MessageBudget caps how much of an email reaches a destination, overriding platform defaults
+type MessageBudget struct {
+	MaxChars    int // Characters per message ("max" option), 0 for the platform limit
+	MaxMessages int // Messages per email ("messages" option), 0 for no limit
+}
+
+// parseMessageBudget reads the "max" and "messages" options of a destination
+func parseMessageBudget(options DestinationOptions) (MessageBudget, error) {
+	var budget MessageBudget
+	if options.Has("max") {
+		value, err := strconv.Atoi(options.Get("max"))
+		if err != nil || value < MinMessageBudgetChars {
+			return budget, fmt.Errorf("invalid max option '%s': use at least %d characters", options.Get("max"), MinMessageBudgetChars)
+		}
+		budget.MaxChars = value
+	}
+	if options.Has("messages") {
+		value, err := strconv.Atoi(options.Get("messages"))
+		if err != nil || value < 1 {
+			return budget, fmt.Errorf("invalid messages option '%s': use a positive count", options.Get("messages"))
+		}
+		budget.MaxMessages = value
+	}
+	return budget, nil
+}
+
+// SenderIdentity overrides the name and icon a destination's messages are posted under,
+// on platforms that allow it
+type SenderIdentity struct {
+	Name string // Display name ("name" option)
+	Icon string // Emoji such as ":fire:" or an image URL ("icon" option)
+}
+
+// parseSenderIdentity reads the "name" and "icon" options of a destination
+func parseSenderIdentity(options DestinationOptions) (SenderIdentity, error) {
+	identity := SenderIdentity{
+		Name: strings.TrimSpace(options.Get("name")),
+		Icon: strings.TrimSpace(options.Get("icon")),
+	}
+	if options.Has("name") && identity.Name == "" {
+		return identity, fmt.Errorf("invalid name option: the display name is empty")
+	}
+	if options.Has("icon") && !identity.IsEmoji() && !identity.IsURL() {
+		return identity, fmt.Errorf("invalid icon option '%s': use an emoji such as :fire: or an http(s) image URL", identity.Icon)
+	}
+	return identity, nil
+}
+
+// IsEmoji reports whether the icon is an emoji code such as ":fire:"
+func (i SenderIdentity) IsEmoji() bool {
+	return len(i.Icon) > 2 && strings.HasPrefix(i.Icon, ":") && strings.HasSuffix(i.Icon, ":")
+}
+
+// IsURL reports whether the icon is an image URL
+func (i SenderIdentity) IsURL() bool {
+	return strings.HasPrefix(i.Icon, "https://") || strings.HasPrefix(i.Icon, "http://")
+}
+
+// senderIdentityKey is the context key under which the destination's SenderIdentity is stored
+type senderIdentityKey struct{}
+
+// withSenderIdentity returns a context that posts messages under identity
+func withSenderIdentity(ctx context.Context, identity SenderIdentity) context.Context {
+	return context.WithValue(ctx, senderIdentityKey{}, identity)
+}
+
+// senderIdentityFrom returns the identity carried by ctx, or an empty identity for the bot's own
+func senderIdentityFrom(ctx context.Context) SenderIdentity {
+	identity, _ := ctx.Value(senderIdentityKey{}).(SenderIdentity)
+	return identity
+}
+
+// parseReplyAddress reads the "reply" option of a destination: the address chat replies are
+// emailed from instead of SMTP_RELAY_FROM. It returns "" when the option is unset
+func parseReplyAddress(options DestinationOptions) (string, error) {
+	if !options.Has("reply") {
+		return "", nil
+	}
+	value := strings.TrimSpace(options.Get("reply"))
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Name != "" || address.Address != value {
+		return "", fmt.Errorf("invalid reply option '%s': use a plain address such as alerts-reply@example.com", value)
+	}
+	return address.Address, nil
+}
+
+// parseSwitchOption reads an on/off option of a destination, returning nil when it is unset
+func parseSwitchOption(options DestinationOptions, name string) (*bool, error) {
+	if !options.Has(name) {
+		return nil, nil
+	}
+	var enabled bool
+	switch strings.ToLower(options.Get(name)) {
+	case "on", "true", "yes":
+		enabled = true
+	case "off", "false", "no":
+		enabled = false
+	default:
+		return nil, fmt.Errorf("invalid %s option '%s': use on/off", name, options.Get(name))
+	}
+	return &enabled, nil
+}
+
+// parseOptionList parses "+"-separated options such as "eml+max=4000" into opts
+func parseOptionList(list string, opts DestinationOptions) {
+	for _, option := range strings.Split(list, "+") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(option, "=")
+		opts[strings.ToLower(name)] = value
+	}
+}
+
+// splitAddressModifiers separates "id+opt1+opt2" into the ID and its options.
+// A leading "+" belongs to the ID (international phone numbers)
+func splitAddressModifiers(localPart string) (string, DestinationOptions) {
+	opts := make(DestinationOptions)
+
+	prefix := ""
+	if strings.HasPrefix(localPart, "+") {
+		prefix = "+"
+		localPart = localPart[1:]
+	}
+
+	id, modifiers, found := strings.Cut(localPart, "+")
+	if found {
+		parseOptionList(modifiers, opts)
+	}
+
+	return prefix + id, opts
+}
+
+// parseDestinationOptions parses DESTINATION_OPTIONS entries of the form platform:id=opt1+opt2;...
+func parseDestinationOptions(optionsStr string) (map[string]DestinationOptions, error) {
+	destinations := make(map[string]DestinationOptions)
+	if optionsStr == "" {
+		return destinations, nil
+	}
+
+	for _, entry := range strings.Split(optionsStr, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		destination, list, found := strings.Cut(entry, "=")
+		platform, id, hasID := strings.Cut(destination, ":")
+		if !found || !hasID || platform == "" || id == "" {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': use platform:id=option+option", entry)
+		}
+
+		key := normalizeDestinationKey(platform, id)
+		if destinations[key] == nil {
+			destinations[key] = make(DestinationOptions)
+		}
+		parseOptionList(list, destinations[key])
+		if _, err := parseMessageBudget(destinations[key]); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := parseSenderIdentity(destinations[key]); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := parseSwitchOption(destinations[key], "unfurl"); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := telegramAckOption(destinations[key]); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := telegramPinOption(destinations[key]); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := slackReportOption(destinations[key]); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := staleGuardOptions(destinations[key], StaleGuard{}); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+		if _, err := parseReplyAddress(destinations[key]); err != nil {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS entry '%s': %w", entry, err)
+		}
+	}
+
+	return destinations, nil
+}
+
+// destinationKey builds the lookup key used for configured destination options
+func destinationKey(platform, id string) string {
+	return platform + ":" + id
+}
+
+// destinationOptions merges configured options for a destination with those given in the address
+func (ep *EmailProcessor) destinationOptions(platform, id string, addressOptions DestinationOptions) DestinationOptions {
+	merged := make(DestinationOptions)
+	if ep.Config != nil {
+		for name, value := range ep.Config.DestinationOptions[destinationKey(platform, id)] {
+			merged[name] = value
+		}
+	}
+
+	// Address modifiers win over configuration
+	for name, value := range addressOptions {
+		merged[name] = value
+	}
+
+	return merged
+}
@@ -0,0 +1,175 @@
+//go:build !minimal && !nodingtalk
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DingTalk Configuration
+const (
+	DingTalkAPIURL             = "https://oapi.dingtalk.com/robot/send"
+	DingTalkMaxMessageLength   = 18000                   // Markdown body limit is 20000 bytes, leave room for the title
+	DingTalkMessageSendDelay   = 3500 * time.Millisecond // Robots are limited to 20 messages per minute
+	DingTalkHTTPRequestTimeout = 10 * time.Second
+)
+
+// DingTalkRobot holds the credentials of a single custom robot
+type DingTalkRobot struct {
+	AccessToken string
+	Secret      string // Optional signing secret ("SEC...")
+}
+
+// DingTalkMarkdown represents the markdown section of a DingTalk robot message
+type DingTalkMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// DingTalkMessage represents a message payload for the DingTalk robot API
+type DingTalkMessage struct {
+	MsgType  string           `json:"msgtype"`
+	Markdown DingTalkMarkdown `json:"markdown"`
+}
+
+// DingTalkClient handles all DingTalk robot webhook interactions
+type DingTalkClient struct {
+	Robots     map[string]DingTalkRobot // Robot name -> credentials
+	HTTPClient *http.Client
+}
+
+// NewDingTalkClient creates a new DingTalk client
+func NewDingTalkClient(robots map[string]DingTalkRobot) *DingTalkClient {
+	return &DingTalkClient{
+		Robots: robots,
+		HTTPClient: &http.Client{
+			Timeout: DingTalkHTTPRequestTimeout,
+		},
+	}
+}
+
+// SendLongMarkdownToRobot handles long messages by splitting them into chunks for a specific robot
+func (dc *DingTalkClient) SendLongMarkdownToRobot(ctx context.Context, title, text, robotName string) error {
+	chunks := chunkForDestination(ctx, text, DingTalkMaxMessageLength)
+	if len(chunks) == 1 {
+		return dc.SendMarkdownToRobot(ctx, title, chunks[0], robotName)
+	}
+
+	log.Printf("Message too long (%d chars), splitting into %d chunks for DingTalk robot %s", len(text), len(chunks), robotName)
+
+	for i, chunk := range chunks {
+		// Add part number for continuation messages
+		if i > 0 {
+			chunk = fmt.Sprintf("**[Part %d]**\n\n%s", i+1, chunk)
+		}
+
+		if err := dc.SendMarkdownToRobot(ctx, title, chunk, robotName); err != nil {
+			return fmt.Errorf("failed to send chunk %d/%d to DingTalk robot %s: %w", i+1, len(chunks), robotName, err)
+		}
+
+		// Add delay between messages to avoid rate limiting
+		if i < len(chunks)-1 {
+			log.Printf("Sent chunk %d/%d to DingTalk robot %s, waiting before next...", i+1, len(chunks), robotName)
+			time.Sleep(DingTalkMessageSendDelay)
+		}
+	}
+
+	log.Printf("Successfully sent all %d message chunks to DingTalk robot %s", len(chunks), robotName)
+	return nil
+}
+
+// SendMarkdownToRobot sends a markdown message through a named robot
+func (dc *DingTalkClient) SendMarkdownToRobot(ctx context.Context, title, text, robotName string) error {
+	robot, exists := dc.Robots[robotName]
+	if !exists {
+		return fmt.Errorf("dingtalk robot '%s' not configured", robotName)
+	}
+
+	message := DingTalkMessage{
+		MsgType: "markdown",
+		Markdown: DingTalkMarkdown{
+			Title: title,
+			Text:  text,
+		},
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	log.Printf("Sending message to DingTalk robot %s (length: %d)", robotName, len(text))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", dc.webhookURL(robot, time.Now()), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := dc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dingtalk API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	// DingTalk reports failures with HTTP 200 and a non-zero errcode
+	var response struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if response.ErrCode != 0 {
+		return fmt.Errorf("dingtalk API error: %d - %s", response.ErrCode, response.ErrMsg)
+	}
+
+	// Robot webhooks do not return a message ID
+	deliveryReceiptFrom(ctx).recordMessage("")
+
+	log.Printf("Message sent successfully to DingTalk robot %s", robotName)
+	return nil
+}
+
+// webhookURL builds the robot webhook URL, adding the timestamp signature when a secret is set
+func (dc *DingTalkClient) webhookURL(robot DingTalkRobot, now time.Time) string {
+	params := url.Values{}
+	params.Set("access_token", robot.AccessToken)
+
+	if robot.Secret != "" {
+		timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+		params.Set("timestamp", timestamp)
+		params.Set("sign", dc.sign(timestamp, robot.Secret))
+	}
+
+	return DingTalkAPIURL + "?" + params.Encode()
+}
+
+// sign computes the HMAC-SHA256 signature DingTalk expects for "timestamp\nsecret"
+func (dc *DingTalkClient) sign(timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
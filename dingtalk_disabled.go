@@ -0,0 +1,33 @@
+//go:build minimal || nodingtalk
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func init() {
+	excludeFeature("dingtalk", "nodingtalk")
+}
+
+// DingTalkRobot holds the credentials of one custom robot
+type DingTalkRobot struct {
+	AccessToken string
+	Secret      string
+}
+
+// DingTalkClient is a placeholder for builds without DingTalk support
+type DingTalkClient struct {
+	HTTPClient *http.Client
+}
+
+// NewDingTalkClient creates a placeholder client whose calls all fail
+func NewDingTalkClient(robots map[string]DingTalkRobot) *DingTalkClient {
+	return &DingTalkClient{HTTPClient: &http.Client{}}
+}
+
+// SendLongMarkdownToRobot reports that DingTalk support was compiled out
+func (dc *DingTalkClient) SendLongMarkdownToRobot(ctx context.Context, title, text, robotName string) error {
+	return requireFeature("dingtalk")
+}
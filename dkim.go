@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM Configuration
+const (
+	DKIMMaxSignatures = 5    // Signatures verified per message; later ones are ignored
+	DKIMMinRSABits    = 1024 // Shorter keys are refused (RFC 8301)
+)
+
+// DKIM results (RFC 8601 2.7.1)
+const (
+	DKIMPass      = "pass"
+	DKIMFail      = "fail"
+	DKIMTempError = "temperror"
+	DKIMPermError = "permerror"
+)
+
+// DKIMResult is the outcome of verifying one DKIM-Signature header
+type DKIMResult struct {
+	Domain string // d= of the signature
+	Result string
+	Detail string
+}
+
+// errDKIMTemporary marks verification failures that may succeed later, such as DNS timeouts
+var errDKIMTemporary = errors.New("temporary DNS error")
+
+// dkimSignature is a parsed DKIM-Signature header
+type dkimSignature struct {
+	raw         string // The whole header field as received, for the header hash
+	algorithm   string // rsa-sha256 or ed25519-sha256
+	signature   []byte
+	bodyHash    []byte
+	headerCanon string
+	bodyCanon   string
+	domain      string
+	selector    string
+	headers     []string
+	length      int64 // l=, -1 for the whole body
+	expires     int64 // x=, 0 without expiry
+}
+
+// verifyDKIM verifies the DKIM signatures of a raw message, looking the keys up with resolver
+func verifyDKIM(ctx context.Context, resolver spfResolver, data []byte) []DKIMResult {
+	data = normalizeCRLF(data)
+	headerEnd := bytes.Index(data, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil
+	}
+	fields := splitHeaderFields(data[:headerEnd+2])
+	body := data[headerEnd+4:]
+
+	var results []DKIMResult
+	for _, field := range fields {
+		name, _, _ := strings.Cut(field, ":")
+		if !strings.EqualFold(strings.TrimSpace(name), "DKIM-Signature") {
+			continue
+		}
+		if len(results) == DKIMMaxSignatures {
+			break
+		}
+		sig, err := parseDKIMSignature(field)
+		if err != nil {
+			results = append(results, DKIMResult{Domain: sig.domain, Result: DKIMPermError, Detail: err.Error()})
+			continue
+		}
+		result := DKIMResult{Domain: sig.domain, Result: DKIMPass, Detail: "signature verified"}
+		if err := sig.verify(ctx, resolver, fields, body); err != nil {
+			result.Result, result.Detail = DKIMFail, err.Error()
+			if errors.Is(err, errDKIMTemporary) {
+				result.Result = DKIMTempError
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// normalizeCRLF turns bare LF line endings into CRLF, as they are on the wire
+func normalizeCRLF(data []byte) []byte {
+	if bytes.Count(data, []byte("\n")) == bytes.Count(data, []byte("\r\n")) {
+		return data
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// splitHeaderFields splits a header section into its fields, each with folding and final CRLF
+func splitHeaderFields(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// parseDKIMTags parses a tag=value list of a signature or key record
+func parseDKIMTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(list, ";") {
+		name, value, found := strings.Cut(tag, "=")
+		name = strings.TrimSpace(name)
+		if !found {
+			if strings.TrimSpace(tag) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("malformed tag '%s'", strings.TrimSpace(tag))
+		}
+		if _, duplicate := tags[name]; duplicate {
+			return nil, fmt.Errorf("duplicate tag '%s'", name)
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// stripFWS removes the folding whitespace inside a base64 value
+func stripFWS(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// parseDKIMSignature reads the tags of a DKIM-Signature header field
+func parseDKIMSignature(field string) (*dkimSignature, error) {
+	_, value, _ := strings.Cut(field, ":")
+	tags, err := parseDKIMTags(value)
+	sig := &dkimSignature{raw: field, length: -1}
+	if err != nil {
+		return sig, err
+	}
+	sig.domain = strings.ToLower(strings.TrimSuffix(tags["d"], "."))
+
+	for _, required := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if tags[required] == "" {
+			return sig, fmt.Errorf("missing %s= tag", required)
+		}
+	}
+	if tags["v"] != "1" {
+		return sig, fmt.Errorf("unsupported version %s", tags["v"])
+	}
+	sig.algorithm = strings.ToLower(tags["a"])
+	if sig.algorithm != "rsa-sha256" && sig.algorithm != "ed25519-sha256" {
+		return sig, fmt.Errorf("unsupported algorithm %s", tags["a"])
+	}
+	if sig.signature, err = base64.StdEncoding.DecodeString(stripFWS(tags["b"])); err != nil {
+		return sig, fmt.Errorf("invalid b= tag")
+	}
+	if sig.bodyHash, err = base64.StdEncoding.DecodeString(stripFWS(tags["bh"])); err != nil {
+		return sig, fmt.Errorf("invalid bh= tag")
+	}
+
+	sig.headerCanon, sig.bodyCanon = "simple", "simple"
+	if c := strings.ToLower(tags["c"]); c != "" {
+		header, body, hasBody := strings.Cut(c, "/")
+		sig.headerCanon = header
+		if hasBody {
+			sig.bodyCanon = body
+		}
+	}
+	for _, canon := range []string{sig.headerCanon, sig.bodyCanon} {
+		if canon != "simple" && canon != "relaxed" {
+			return sig, fmt.Errorf("unsupported canonicalization %s", tags["c"])
+		}
+	}
+
+	sig.selector = tags["s"]
+	for _, name := range strings.Split(tags["h"], ":") {
+		sig.headers = append(sig.headers, strings.ToLower(strings.TrimSpace(name)))
+	}
+	if !slices.Contains(sig.headers, "from") {
+		return sig, fmt.Errorf("h= does not include From")
+	}
+
+	if identity := tags["i"]; identity != "" {
+		_, identityDomain, _ := strings.Cut(identity, "@")
+		identityDomain = strings.ToLower(identityDomain)
+		if identityDomain != sig.domain && !strings.HasSuffix(identityDomain, "."+sig.domain) {
+			return sig, fmt.Errorf("i= is not within d=%s", sig.domain)
+		}
+	}
+	if l := tags["l"]; l != "" {
+		if sig.length, err = strconv.ParseInt(l, 10, 64); err != nil || sig.length < 0 {
+			return sig, fmt.Errorf("invalid l= tag")
+		}
+	}
+	if x := tags["x"]; x != "" {
+		if sig.expires, err = strconv.ParseInt(x, 10, 64); err != nil {
+			return sig, fmt.Errorf("invalid x= tag")
+		}
+	}
+	return sig, nil
+}
+
+// verify checks the body hash and the signature over the signed header fields
+func (sig *dkimSignature) verify(ctx context.Context, resolver spfResolver, fields []string, body []byte) error {
+	if sig.expires > 0 && time.Now().Unix() > sig.expires {
+		return fmt.Errorf("signature expired")
+	}
+
+	body = canonicalizeDKIMBody(body, sig.bodyCanon)
+	if sig.length >= 0 {
+		if sig.length > int64(len(body)) {
+			return fmt.Errorf("l= is longer than the body")
+		}
+		// Anyone could have appended the rest, such as a phishing link, so it does not pass
+		if sig.length < int64(len(body)) {
+			return fmt.Errorf("l= signs only %d of %d body bytes", sig.length, len(body))
+		}
+	}
+	bodyHash := sha256.Sum256(body)
+	if !bytes.Equal(bodyHash[:], sig.bodyHash) {
+		return fmt.Errorf("body hash does not match, the body was changed")
+	}
+
+	// Each name in h= signs the last unused instance of that field, bottom up
+	used := make(map[int]bool)
+	hash := sha256.New()
+	for _, name := range sig.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			fieldName, _, _ := strings.Cut(fields[i], ":")
+			if used[i] || !strings.EqualFold(strings.TrimSpace(fieldName), name) {
+				continue
+			}
+			used[i] = true
+			hash.Write([]byte(canonicalizeDKIMHeader(fields[i], sig.headerCanon)))
+			break
+		}
+	}
+	unsigned := strings.TrimSuffix(canonicalizeDKIMHeader(removeDKIMSignatureValue(sig.raw), sig.headerCanon), "\r\n")
+	hash.Write([]byte(unsigned))
+	digest := hash.Sum(nil)
+
+	key, err := lookupDKIMKey(ctx, resolver, sig.selector, sig.domain)
+	if err != nil {
+		return err
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if sig.algorithm != "rsa-sha256" {
+			return fmt.Errorf("key type does not match a=%s", sig.algorithm)
+		}
+		if key.N.BitLen() < DKIMMinRSABits {
+			return fmt.Errorf("RSA key shorter than %d bits", DKIMMinRSABits)
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig.signature); err != nil {
+			return fmt.Errorf("signature does not match, a signed header was changed")
+		}
+	case ed25519.PublicKey:
+		if sig.algorithm != "ed25519-sha256" {
+			return fmt.Errorf("key type does not match a=%s", sig.algorithm)
+		}
+		if !ed25519.Verify(key, digest, sig.signature) {
+			return fmt.Errorf("signature does not match, a signed header was changed")
+		}
+	}
+	return nil
+}
+
+// removeDKIMSignatureValue empties the b= tag of a DKIM-Signature field, keeping everything else
+func removeDKIMSignatureValue(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	tags := strings.Split(value, ";")
+	for i, tag := range tags {
+		if tagName, _, found := strings.Cut(tag, "="); found && strings.TrimSpace(tagName) == "b" {
+			equals := strings.Index(tag, "=")
+			tags[i] = tag[:equals+1]
+			if strings.HasSuffix(tag, "\r\n") && i == len(tags)-1 {
+				tags[i] += "\r\n"
+			}
+		}
+	}
+	return name + ":" + strings.Join(tags, ";")
+}
+
+// canonicalizeDKIMHeader applies the simple or relaxed header canonicalization to one field
+func canonicalizeDKIMHeader(field, canon string) string {
+	if canon == "simple" {
+		return field
+	}
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.Trim(collapseWSP(strings.ReplaceAll(value, "\r\n", "")), " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value + "\r\n"
+}
+
+// canonicalizeDKIMBody applies the simple or relaxed body canonicalization
+func canonicalizeDKIMBody(body []byte, canon string) []byte {
+	text := string(body)
+	if canon == "relaxed" {
+		lines := strings.Split(text, "\r\n")
+		for i, line := range lines {
+			lines[i] = collapseWSP(strings.TrimRight(line, " \t"))
+		}
+		text = strings.Join(lines, "\r\n")
+	}
+
+	// Empty lines at the end are ignored; an empty body is a single CRLF, or nothing when relaxed
+	for strings.HasSuffix(text, "\r\n") {
+		text = strings.TrimSuffix(text, "\r\n")
+	}
+	if text == "" && canon == "relaxed" {
+		return nil
+	}
+	return []byte(text + "\r\n")
+}
+
+// collapseWSP turns each run of spaces and tabs into a single space
+func collapseWSP(value string) string {
+	var collapsed strings.Builder
+	space := false
+	for _, r := range value {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			collapsed.WriteByte(' ')
+			space = false
+		}
+		collapsed.WriteRune(r)
+	}
+	if space {
+		collapsed.WriteByte(' ')
+	}
+	return collapsed.String()
+}
+
+// lookupDKIMKey fetches and parses the public key of a selector
+func lookupDKIMKey(ctx context.Context, resolver spfResolver, selector, domain string) (crypto.PublicKey, error) {
+	name := selector + "._domainkey." + domain
+	txts, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		if isDNSNotFound(err) {
+			return nil, fmt.Errorf("no key at %s", name)
+		}
+		return nil, fmt.Errorf("%w: %v", errDKIMTemporary, err)
+	}
+	if len(txts) == 0 {
+		return nil, fmt.Errorf("no key at %s", name)
+	}
+
+	tags, err := parseDKIMTags(strings.Join(txts, ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key at %s: %v", name, err)
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("invalid key at %s: unsupported version", name)
+	}
+	data := stripFWS(tags["p"])
+	if data == "" {
+		return nil, fmt.Errorf("key at %s was revoked", name)
+	}
+	der, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key at %s", name)
+	}
+
+	switch strings.ToLower(tags["k"]) {
+	case "", "rsa":
+		if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+			if rsaKey, ok := key.(*rsa.PublicKey); ok {
+				return rsaKey, nil
+			}
+		}
+		if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("invalid RSA key at %s", name)
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key at %s", name)
+		}
+		return ed25519.PublicKey(der), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s at %s", tags["k"], name)
+	}
+}
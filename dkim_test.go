@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeDKIMHeader(t *testing.T) {
+	tests := []struct {
+		field   string
+		simple  string
+		relaxed string
+	}{
+		// RFC 6376 3.4.5
+		{"A: X\r\n", "A: X\r\n", "a:X\r\n"},
+		{"B : Y\t\r\n\tZ  \r\n", "B : Y\t\r\n\tZ  \r\n", "b:Y Z\r\n"},
+		{"Subject:   Disk   full\r\n\t on host1\r\n", "Subject:   Disk   full\r\n\t on host1\r\n", "subject:Disk full on host1\r\n"},
+		{"X-Empty:\r\n", "X-Empty:\r\n", "x-empty:\r\n"},
+		{"X-Spaces:   \r\n", "X-Spaces:   \r\n", "x-spaces:\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalizeDKIMHeader(tt.field, "simple"); got != tt.simple {
+			t.Errorf("simple canonicalization of %q = %q, want %q", tt.field, got, tt.simple)
+		}
+		if got := canonicalizeDKIMHeader(tt.field, "relaxed"); got != tt.relaxed {
+			t.Errorf("relaxed canonicalization of %q = %q, want %q", tt.field, got, tt.relaxed)
+		}
+	}
+}
+
+func TestCanonicalizeDKIMBody(t *testing.T) {
+	tests := []struct {
+		body    string
+		simple  string
+		relaxed string
+	}{
+		// RFC 6376 3.4.5
+		{" C \r\nD \t E\r\n\r\n\r\n", " C \r\nD \t E\r\n", " C\r\nD E\r\n"},
+		{"", "\r\n", ""},
+		{"\r\n\r\n", "\r\n", ""},
+		{" \r\n", " \r\n", ""},
+		{"no final line break", "no final line break\r\n", "no final line break\r\n"},
+		{"a\r\n\r\nb\r\n", "a\r\n\r\nb\r\n", "a\r\n\r\nb\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := string(canonicalizeDKIMBody([]byte(tt.body), "simple")); got != tt.simple {
+			t.Errorf("simple canonicalization of %q = %q, want %q", tt.body, got, tt.simple)
+		}
+		if got := string(canonicalizeDKIMBody([]byte(tt.body), "relaxed")); got != tt.relaxed {
+			t.Errorf("relaxed canonicalization of %q = %q, want %q", tt.body, got, tt.relaxed)
+		}
+	}
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	// The messages in testdata/dkim were signed by another implementation, one per canonicalization
+	key, err := os.ReadFile(filepath.Join("testdata", "dkim", "sel._domainkey.example.com.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &fakeResolver{txt: map[string][]string{"sel._domainkey.example.com": {string(key)}}}
+
+	tests := []struct {
+		name   string
+		edit   func(string) string
+		result string
+	}{
+		{"unchanged", func(m string) string { return m }, DKIMPass},
+		{"bare line feeds", func(m string) string { return strings.ReplaceAll(m, "\r\n", "\n") }, DKIMPass},
+		{"body changed", func(m string) string { return strings.Replace(m, "The disk", "The dusk", 1) }, DKIMFail},
+		{"signed header changed", func(m string) string { return strings.Replace(m, "on host1", "on host2", 1) }, DKIMFail},
+		{"second subject above the signed one", func(m string) string { return "Subject: spoofed\r\n" + m }, DKIMPass},
+		{"unsigned header added", func(m string) string { return strings.Replace(m, "\r\n\r\n", "\r\nX-Note: added\r\n\r\n", 1) }, DKIMPass},
+		{"signature damaged", func(m string) string { return strings.Replace(m, "b=", "b=AAAA", 1) }, DKIMFail},
+		{"unknown selector", func(m string) string { return strings.Replace(m, "s=sel;", "s=other;", 1) }, DKIMFail},
+	}
+
+	for _, canon := range []string{"relaxed-relaxed", "simple-simple", "relaxed-simple", "simple-relaxed"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "dkim", canon+".eml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(canon+"/"+tt.name, func(t *testing.T) {
+				results := verifyDKIM(context.Background(), resolver, []byte(tt.edit(string(data))))
+				if len(results) != 1 || results[0].Result != tt.result || results[0].Domain != "example.com" {
+					t.Fatalf("verifyDKIM() = %+v, want one %s for example.com", results, tt.result)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyDKIMBodyLength(t *testing.T) {
+	// A signature over the first lines only does not vouch for text appended after them
+	signed := "The disk is full.\r\n"
+	bodyHash := sha256.Sum256([]byte(signed))
+	sig := &dkimSignature{bodyCanon: "simple", bodyHash: bodyHash[:], length: int64(len(signed))}
+
+	err := sig.verify(context.Background(), &fakeResolver{}, nil, []byte(signed+"Log in at https://example.net to fix it\r\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "l= signs only 19 of") {
+		t.Fatalf("verify() error = %v, want l= signs only 19 of ...", err)
+	}
+}
+
+func TestParseDKIMSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		wantErr string
+	}{
+		{"valid", "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=sel; h=from:to; bh=YQ==; b=YQ==", ""},
+		{"missing body hash", "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=sel; h=from; b=YQ==", "missing bh= tag"},
+		{"from not signed", "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=sel; h=to; bh=YQ==; b=YQ==", "h= does not include From"},
+		{"sha1", "DKIM-Signature: v=1; a=rsa-sha1; d=example.com; s=sel; h=from; bh=YQ==; b=YQ==", "unsupported algorithm rsa-sha1"},
+		{"unknown canonicalization", "DKIM-Signature: v=1; a=rsa-sha256; c=loose; d=example.com; s=sel; h=from; bh=YQ==; b=YQ==", "unsupported canonicalization loose"},
+		{"identity outside domain", "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; i=a@example.org; s=sel; h=from; bh=YQ==; b=YQ==", "i= is not within d=example.com"},
+		{"duplicate tag", "DKIM-Signature: v=1; v=1; a=rsa-sha256; d=example.com; s=sel; h=from; bh=YQ==; b=YQ==", "duplicate tag 'v'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDKIMSignature(tt.field + "\r\n")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseDKIMSignature() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parseDKIMSignature() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
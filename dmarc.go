@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/mail"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DMARC Enforcement
+const (
+	DMARCOff        = "off"        // Do not evaluate DMARC (default)
+	DMARCNone       = "none"       // Log the result and show it below the message
+	DMARCQuarantine = "quarantine" // Also tag the subject of messages that fail a quarantine or reject policy
+	DMARCReject     = "reject"     // Also refuse messages that fail a reject policy
+
+	DMARCQuarantineTag = "[DMARC FAIL]" // Put before the subject of quarantined messages
+)
+
+// DMARC results (RFC 8601 2.7.1)
+const (
+	DMARCResultPass      = "pass"
+	DMARCResultFail      = "fail"
+	DMARCResultNone      = "none"
+	DMARCResultTempError = "temperror"
+	DMARCResultPermError = "permerror"
+)
+
+// parseDMARCPolicy validates DMARC_POLICY
+func parseDMARCPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return DMARCOff, nil
+	case DMARCOff, DMARCNone, DMARCQuarantine, DMARCReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid DMARC_POLICY '%s': use off, none, quarantine or reject", value)
+	}
+}
+
+// DMARCCheck is the DMARC verdict on a message
+type DMARCCheck struct {
+	Result string // pass, fail, none, temperror or permerror
+	Domain string // Domain of the From header
+	Policy string // none, quarantine or reject as published for Domain; empty without a record
+	Detail string
+}
+
+// result returns the DMARC result, or "" when the message was not checked
+func (c *DMARCCheck) result() string {
+	if c == nil {
+		return ""
+	}
+	return c.Result
+}
+
+// dmarcRecord is the part of a DMARC record that decides the verdict
+type dmarcRecord struct {
+	policy          string
+	subdomainPolicy string
+	strictDKIM      bool
+	strictSPF       bool
+}
+
+// parseDMARCRecord reads a TXT record of the form v=DMARC1; p=reject; ...
+func parseDMARCRecord(txt string) (*dmarcRecord, error) {
+	tags := make(map[string]string)
+	for i, tag := range strings.Split(txt, ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if i == 0 && (name != "v" || value != "DMARC1") {
+			return nil, fmt.Errorf("not a DMARC record")
+		}
+		if name != "" {
+			tags[name] = value
+		}
+	}
+
+	record := &dmarcRecord{
+		policy:     strings.ToLower(tags["p"]),
+		strictDKIM: strings.EqualFold(tags["adkim"], "s"),
+		strictSPF:  strings.EqualFold(tags["aspf"], "s"),
+	}
+	switch record.policy {
+	case DMARCNone, DMARCQuarantine, DMARCReject:
+	case "":
+		// A record with reporting addresses but no policy is treated as p=none (RFC 7489 6.6.3)
+		if tags["rua"] == "" {
+			return nil, fmt.Errorf("no p= tag")
+		}
+		record.policy = DMARCNone
+	default:
+		return nil, fmt.Errorf("invalid policy p=%s", tags["p"])
+	}
+	record.subdomainPolicy = record.policy
+	switch sp := strings.ToLower(tags["sp"]); sp {
+	case DMARCNone, DMARCQuarantine, DMARCReject:
+		record.subdomainPolicy = sp
+	}
+	return record, nil
+}
+
+// organizationalDomain returns the registered domain a name belongs to, e.g. example.co.uk
+func organizationalDomain(domain string) string {
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return org
+}
+
+// dmarcAligned reports whether an authenticated domain is aligned with the From domain
+func dmarcAligned(authenticated, from string, strict bool) bool {
+	authenticated = strings.ToLower(strings.TrimSuffix(authenticated, "."))
+	if strict || authenticated == from {
+		return authenticated == from
+	}
+	return organizationalDomain(authenticated) == organizationalDomain(from)
+}
+
+// lookupDMARCRecord finds the record for domain, falling back to its organizational domain, and
+// returns the name it was published for
+func lookupDMARCRecord(ctx context.Context, resolver spfResolver, domain string) (*dmarcRecord, string, error) {
+	org := organizationalDomain(domain)
+	for _, name := range []string{domain, org} {
+		txts, err := resolver.LookupTXT(ctx, "_dmarc."+name)
+		if err != nil && !isDNSNotFound(err) {
+			return nil, "", err
+		}
+		var records []*dmarcRecord
+		for _, txt := range txts {
+			if record, err := parseDMARCRecord(txt); err == nil {
+				records = append(records, record)
+			}
+		}
+		if len(records) == 1 {
+			return records[0], name, nil
+		}
+		if name == org {
+			break
+		}
+	}
+	return nil, "", nil
+}
+
+// checkDMARC combines the SPF result of the envelope sender and the DKIM signatures of a message
+// into the DMARC verdict for its From domain (RFC 7489)
+func checkDMARC(ctx context.Context, resolver spfResolver, data []byte, spfResult SPFResult, envelopeFrom, helo string) DMARCCheck {
+	ctx, cancel := context.WithTimeout(ctx, SPFTimeout)
+	defer cancel()
+
+	data = normalizeCRLF(data)
+	headerEnd := bytes.Index(data, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return DMARCCheck{Result: DMARCResultPermError, Detail: "message has no header"}
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data[:headerEnd+4]))
+	if err != nil {
+		return DMARCCheck{Result: DMARCResultPermError, Detail: "unreadable header"}
+	}
+	if len(msg.Header["From"]) != 1 {
+		return DMARCCheck{Result: DMARCResultPermError, Detail: "message needs exactly one From header"}
+	}
+	addresses, err := mail.ParseAddressList(msg.Header.Get("From"))
+	if err != nil || len(addresses) != 1 {
+		return DMARCCheck{Result: DMARCResultPermError, Detail: "message needs exactly one From address"}
+	}
+	_, domain, _ := strings.Cut(addresses[0].Address, "@")
+	domain = strings.ToLower(domain)
+	check := DMARCCheck{Domain: domain}
+
+	record, recordDomain, err := lookupDMARCRecord(ctx, resolver, domain)
+	if err != nil {
+		check.Result, check.Detail = DMARCResultTempError, fmt.Sprintf("DNS error looking up the policy of %s", domain)
+		return check
+	}
+	if record == nil {
+		check.Result, check.Detail = DMARCResultNone, fmt.Sprintf("%s publishes no DMARC policy", domain)
+		return check
+	}
+	// sp= only covers subdomains that fell back to the organizational record; a subdomain
+	// publishing its own record is held to its p=
+	check.Policy = record.policy
+	if recordDomain != domain {
+		check.Policy = record.subdomainPolicy
+	}
+
+	// SPF authenticates the envelope sender, or the HELO name for bounces
+	spfDomain := helo
+	if _, senderDomain, found := strings.Cut(envelopeFrom, "@"); found && senderDomain != "" {
+		spfDomain = senderDomain
+	}
+	if spfResult == SPFPass && dmarcAligned(spfDomain, domain, record.strictSPF) {
+		check.Result, check.Detail = DMARCResultPass, fmt.Sprintf("SPF of %s is aligned with %s", spfDomain, domain)
+		return check
+	}
+	var signers []string
+	for _, dkim := range verifyDKIM(ctx, resolver, data) {
+		if dkim.Result != DKIMPass {
+			signers = append(signers, fmt.Sprintf("DKIM %s for %s: %s", dkim.Result, dkim.Domain, dkim.Detail))
+			continue
+		}
+		if dmarcAligned(dkim.Domain, domain, record.strictDKIM) {
+			check.Result, check.Detail = DMARCResultPass, fmt.Sprintf("DKIM signature of %s is aligned with %s", dkim.Domain, domain)
+			return check
+		}
+		signers = append(signers, fmt.Sprintf("DKIM pass for %s, not aligned", dkim.Domain))
+	}
+
+	check.Result = DMARCResultFail
+	check.Detail = fmt.Sprintf("no aligned SPF or DKIM pass for %s (SPF %s for %s", domain, spfResult, spfDomain)
+	if len(signers) == 0 {
+		check.Detail += ", no DKIM signature)"
+	} else {
+		check.Detail += "; " + strings.Join(signers, "; ") + ")"
+	}
+	return check
+}
+
+// CheckDMARC evaluates DMARC for a message received over SMTP under DMARC_POLICY and returns the
+// reply refusing it, if any. The verdict is recorded in the session for the annotations
+func (ep *EmailProcessor) CheckDMARC(data []byte, session *SessionInfo) error {
+	if ep.Config == nil || ep.Config.DMARCPolicy == "" || ep.Config.DMARCPolicy == DMARCOff || session.AuthUser != "" {
+		return nil
+	}
+	if net.ParseIP(session.ClientIP()) == nil {
+		return nil
+	}
+
+	check := checkDMARC(context.Background(), net.DefaultResolver, data, SPFResult(session.SPF), session.EnvelopeFrom, session.Helo)
+	log.Printf("DMARC %s for %s from %s: %s", check.Result, check.Domain, session.ClientIP(), check.Detail)
+	session.DMARC = &check
+
+	if check.Result == DMARCResultFail && check.Policy == DMARCReject && ep.Config.DMARCPolicy == DMARCReject {
+		ep.logToSyslog(session.RemoteAddr, session.EnvelopeFrom, "", "", fmt.Sprintf("Rejected: DMARC fail for %s", check.Domain))
+		ep.Metrics.Reject(RejectDMARC)
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      fmt.Sprintf("Message rejected by the DMARC policy of %s", check.Domain),
+		}
+	}
+	return nil
+}
+
+// applyDMARCAnnotation adds the DMARC verdict below the body. Under DMARC_POLICY=quarantine or
+// reject, the subject of a message that fails a quarantine or reject policy is tagged as well
+func (ep *EmailProcessor) applyDMARCAnnotation(email *ProcessedEmail) {
+	check := email.Session.DMARC
+	if check == nil {
+		return
+	}
+	note := fmt.Sprintf("DMARC: %s (%s)", check.Result, check.Detail)
+	if check.Result == DMARCResultFail {
+		note = "⚠️ " + note
+		enforced := ep.Config != nil && (ep.Config.DMARCPolicy == DMARCQuarantine || ep.Config.DMARCPolicy == DMARCReject)
+		if enforced && (check.Policy == DMARCQuarantine || check.Policy == DMARCReject) {
+			email.Subject = DMARCQuarantineTag + " " + email.Subject
+		}
+	}
+	if email.BodyHTML {
+		email.Body += "\n<p>" + html.EscapeString(note) + "</p>"
+	} else {
+		email.Body = strings.TrimLeft(strings.TrimRight(email.Body, " \n")+"\n\n"+note, "\n")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseDMARCRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		txt     string
+		want    dmarcRecord
+		wantErr bool
+	}{
+		{"reject", "v=DMARC1; p=reject", dmarcRecord{policy: DMARCReject, subdomainPolicy: DMARCReject}, false},
+		{"subdomain policy", "v=DMARC1; p=reject; sp=none", dmarcRecord{policy: DMARCReject, subdomainPolicy: DMARCNone}, false},
+		{"invalid subdomain policy is ignored", "v=DMARC1; p=quarantine; sp=bogus", dmarcRecord{policy: DMARCQuarantine, subdomainPolicy: DMARCQuarantine}, false},
+		{"strict alignment", "v=DMARC1; p=none; adkim=s; aspf=S", dmarcRecord{policy: DMARCNone, subdomainPolicy: DMARCNone, strictDKIM: true, strictSPF: true}, false},
+		{"relaxed alignment", "v=DMARC1; p=none; adkim=r; aspf=r", dmarcRecord{policy: DMARCNone, subdomainPolicy: DMARCNone}, false},
+		{"case and spaces", "v=DMARC1 ;  P = Quarantine ; ", dmarcRecord{policy: DMARCQuarantine, subdomainPolicy: DMARCQuarantine}, false},
+		{"reporting only is none", "v=DMARC1; rua=mailto:d@example.com", dmarcRecord{policy: DMARCNone, subdomainPolicy: DMARCNone}, false},
+		{"no policy", "v=DMARC1; pct=100", dmarcRecord{}, true},
+		{"invalid policy", "v=DMARC1; p=discard", dmarcRecord{}, true},
+		{"version not first", "p=reject; v=DMARC1", dmarcRecord{}, true},
+		{"wrong version", "v=DMARC2; p=reject", dmarcRecord{}, true},
+		{"spf record", "v=spf1 -all", dmarcRecord{}, true},
+		{"empty", "", dmarcRecord{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := parseDMARCRecord(tt.txt)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDMARCRecord(%q) = %+v, want an error", tt.txt, *record)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDMARCRecord(%q) error = %v", tt.txt, err)
+			}
+			if *record != tt.want {
+				t.Errorf("parseDMARCRecord(%q) = %+v, want %+v", tt.txt, *record, tt.want)
+			}
+		})
+	}
+}
+
+func TestDMARCAligned(t *testing.T) {
+	tests := []struct {
+		authenticated string
+		from          string
+		strict        bool
+		want          bool
+	}{
+		{"example.com", "example.com", false, true},
+		{"example.com", "example.com", true, true},
+		{"EXAMPLE.com.", "example.com", true, true},
+		{"mail.example.com", "example.com", false, true},
+		{"mail.example.com", "example.com", true, false},
+		{"example.com", "news.example.com", false, true},
+		{"a.example.com", "b.example.com", false, true},
+		{"a.example.com", "b.example.com", true, false},
+		{"example.org", "example.com", false, false},
+		{"example.co.uk", "other.co.uk", false, false},
+		{"mail.example.co.uk", "example.co.uk", false, true},
+		{"evil-example.com", "example.com", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := dmarcAligned(tt.authenticated, tt.from, tt.strict); got != tt.want {
+			t.Errorf("dmarcAligned(%q, %q, strict=%v) = %v, want %v", tt.authenticated, tt.from, tt.strict, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDMARC(t *testing.T) {
+	resolver := &fakeResolver{
+		txt: map[string][]string{
+			"_dmarc.example.com":     {"v=DMARC1; p=reject; sp=quarantine"},
+			"_dmarc.alerts.site.com": {"v=DMARC1; p=reject; sp=none"},
+			"_dmarc.strict.org":      {"v=DMARC1; p=reject; aspf=s"},
+			"_dmarc.two.net":         {"v=DMARC1; p=reject", "v=DMARC1; p=none"},
+		},
+		fail: map[string]bool{"_dmarc.slow.com": true},
+	}
+
+	tests := []struct {
+		name     string
+		from     string
+		spf      SPFResult
+		envelope string
+		result   string
+		policy   string
+	}{
+		{"aligned spf pass", "a@example.com", SPFPass, "bounce@mail.example.com", DMARCResultPass, DMARCReject},
+		{"unaligned spf pass", "a@example.com", SPFPass, "bounce@example.org", DMARCResultFail, DMARCReject},
+		{"spf fail", "a@example.com", SPFFail, "a@example.com", DMARCResultFail, DMARCReject},
+		{"subdomain policy from organizational record", "a@news.example.com", SPFFail, "a@news.example.com", DMARCResultFail, DMARCQuarantine},
+		{"subdomain with its own record", "a@alerts.site.com", SPFFail, "a@alerts.site.com", DMARCResultFail, DMARCReject},
+		{"strict spf alignment", "a@strict.org", SPFPass, "a@mail.strict.org", DMARCResultFail, DMARCReject},
+		{"no record", "a@example.org", SPFFail, "a@example.org", DMARCResultNone, ""},
+		{"two records count as none", "a@two.net", SPFFail, "a@two.net", DMARCResultNone, ""},
+		{"dns error", "a@slow.com", SPFPass, "a@slow.com", DMARCResultTempError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := []byte("From: Sender <" + tt.from + ">\r\nSubject: test\r\n\r\nbody\r\n")
+			check := checkDMARC(context.Background(), resolver, message, tt.spf, tt.envelope, "helo.example")
+			if check.Result != tt.result || check.Policy != tt.policy {
+				t.Errorf("checkDMARC() = %s with policy %q (%s), want %s with policy %q", check.Result, check.Policy, check.Detail, tt.result, tt.policy)
+			}
+		})
+	}
+
+	message := []byte("From: a@example.com\r\nFrom: b@example.com\r\n\r\nbody\r\n")
+	if check := checkDMARC(context.Background(), resolver, message, SPFPass, "a@example.com", ""); check.Result != DMARCResultPermError {
+		t.Errorf("checkDMARC() of two From headers = %s, want %s", check.Result, DMARCResultPermError)
+	}
+}
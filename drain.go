@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Shutdown Configuration
+const (
+	DefaultShutdownTimeout = 30 * time.Second // Wait for messages in progress before closing their connections
+)
+
+// errSMTPShuttingDown is the reply to clients that start a message while the server drains
+var errSMTPShuttingDown = &smtp.SMTPError{
+	Code:         421,
+	EnhancedCode: smtp.EnhancedCode{4, 3, 2},
+	Message:      "Shutting down, try again later",
+}
+
+// sessionDrain counts the mail transactions in progress, from MAIL FROM until the message is
+// delivered or the transaction is reset, so a shutdown can wait for them
+type sessionDrain struct {
+	mutex    sync.Mutex
+	draining bool
+	active   int
+	idle     chan struct{} // Closed once draining and no transaction is left
+}
+
+// closing reports whether new transactions are refused
+func (d *sessionDrain) closing() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.draining
+}
+
+// begin counts a new transaction, or returns false while draining
+func (d *sessionDrain) begin() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.draining {
+		return false
+	}
+	d.active++
+	return true
+}
+
+// end forgets a finished transaction
+func (d *sessionDrain) end() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.active--
+	if d.draining && d.active == 0 {
+		close(d.idle)
+	}
+}
+
+// start refuses new transactions from now on
+func (d *sessionDrain) start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.draining {
+		return
+	}
+	d.draining = true
+	d.idle = make(chan struct{})
+	if d.active == 0 {
+		close(d.idle)
+	}
+}
+
+// wait blocks until no transaction is left or ctx ends, and returns the transactions left
+func (d *sessionDrain) wait(ctx context.Context) int {
+	select {
+	case <-d.idle:
+		return 0
+	case <-ctx.Done():
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		return d.active
+	}
+}
+
+// beginTransaction counts the session's transaction once; false means the server is draining
+func (s *SMTPSession) beginTransaction() bool {
+	if s.inTransaction {
+		return true
+	}
+	if !s.drain.begin() {
+		return false
+	}
+	s.inTransaction = true
+	return true
+}
+
+// endTransaction lets a draining server stop once the session's message is handled
+func (s *SMTPSession) endTransaction() {
+	if s.inTransaction {
+		s.inTransaction = false
+		s.drain.end()
+	}
+}
+
+// serve accepts connections on listener until the server is stopped. Shutdown closes the
+// listeners itself, which ends Serve without an error
+func (s *SMTPServer) serve(server *smtp.Server, listener net.Listener) error {
+	s.mutex.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mutex.Unlock()
+
+	err := server.Serve(listener)
+	if s.backend.drain.closing() {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and new messages, waits until ctx ends for messages in
+// progress to be delivered, then closes every connection. Idle clients and clients that start
+// a message meanwhile are told to try again later with 421
+func (s *SMTPServer) Shutdown(ctx context.Context) error {
+	log.Println("Stopping SMTP server, waiting for messages in progress...")
+	s.backend.drain.start()
+	s.mutex.Lock()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	s.mutex.Unlock()
+
+	if left := s.backend.drain.wait(ctx); left > 0 {
+		log.Printf("Warning: closing %d SMTP sessions with messages still in progress", left)
+	}
+	return s.Stop()
+}
+
+// ignoreClosed drops the error of closing a listener or server that was already closed
+func ignoreClosed(err error) error {
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, smtp.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
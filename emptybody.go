@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Empty Body Configuration
+const (
+	EmptyBodySubject       = "subject"           // Send a compact message with the subject and sender (default)
+	EmptyBodyDrop          = "drop"              // Accept the email without delivering it
+	EmptyBodyPlaceholder   = "placeholder"       // Deliver the full message with EMPTY_BODY_TEXT as the body
+	DefaultEmptyBodyText   = "(no message body)" // Placeholder used without EMPTY_BODY_TEXT
+	emptyBodyNoSubjectText = "(no subject)"      // Shown by compact messages for emails without a subject
+)
+
+// emptyBodyPolicy returns the configured policy for emails whose body is empty
+func (ep *EmailProcessor) emptyBodyPolicy() string {
+	if ep.Config == nil || ep.Config.EmptyBodyPolicy == "" {
+		return EmptyBodySubject
+	}
+	return ep.Config.EmptyBodyPolicy
+}
+
+// hasEmptyBody reports whether an email has no body text; HTML bodies count as empty when
+// they are nothing but markup
+func hasEmptyBody(email *ProcessedEmail) bool {
+	body := email.Body
+	if email.BodyHTML {
+		body = htmlToSlackMrkdwn(body)
+	}
+	return strings.TrimSpace(body) == ""
+}
+
+// applyEmptyBodyPolicy handles a subject-only email, as some sensors and door bells send.
+// It reports false when the email is to be dropped; emails with attachments are never dropped
+func (ep *EmailProcessor) applyEmptyBodyPolicy(email *ProcessedEmail) bool {
+	if !hasEmptyBody(email) {
+		return true
+	}
+
+	switch ep.emptyBodyPolicy() {
+	case EmptyBodyDrop:
+		if len(email.Attachments) == 0 && len(email.InlineImages) == 0 && !email.Page {
+			return false
+		}
+		email.Body, email.BodyHTML, email.SubjectOnly = "", false, true
+	case EmptyBodyPlaceholder:
+		text := DefaultEmptyBodyText
+		if ep.Config != nil && ep.Config.EmptyBodyText != "" {
+			text = ep.Config.EmptyBodyText
+		}
+		email.Body, email.BodyHTML = text, false
+	default:
+		email.Body, email.BodyHTML, email.SubjectOnly = "", false, true
+	}
+	return true
+}
+
+// formatSubjectOnlyForPlatform formats an email without a body as the severity, subject and
+// sender, instead of the full layout with an empty message section. A sender banner is kept
+func (ep *EmailProcessor) formatSubjectOnlyForPlatform(email *ProcessedEmail, platform string) string {
+	subject := email.Subject
+	if strings.TrimSpace(subject) == "" {
+		subject = emptyBodyNoSubjectText
+	}
+
+	var message string
+	body := strings.TrimSpace(email.Body)
+	switch platform {
+	case "telegram":
+		message = fmt.Sprintf("%s <b>%s</b>\n<b>From:</b> %s", email.Severity.Emoji(), ep.escapeHTML(subject), ep.escapeHTML(senderDisplay(email)))
+		body = ep.escapeHTML(body)
+	case "slack":
+		message = fmt.Sprintf("%s *%s*\n*From:* %s", email.Severity.SlackEmoji(), ep.escapeSlackText(subject), ep.escapeSlackText(senderDisplay(email)))
+		body = ep.escapeSlackText(body)
+	case "dingtalk":
+		message = fmt.Sprintf("#### %s %s\n\n**From:** %s", email.Severity.Emoji(), subject, senderDisplay(email))
+	case "wecom":
+		if ep.WeComClient != nil && ep.WeComClient.MessageType == "text" {
+			message = fmt.Sprintf("%s\nFrom: %s", subject, senderDisplay(email))
+		} else {
+			message = fmt.Sprintf("### %s %s\n> **From:** %s", email.Severity.Emoji(), subject, senderDisplay(email))
+		}
+	case "mastodon":
+		message = fmt.Sprintf("%s %s\nFrom: %s", email.Severity.Emoji(), subject, senderDisplay(email))
+	case "whatsapp":
+		message = fmt.Sprintf("%s *%s*\n*From:* %s", email.Severity.Emoji(), subject, senderDisplay(email))
+	default:
+		message = fmt.Sprintf("%s\nFrom: %s", subject, senderDisplay(email))
+	}
+
+	if body != "" {
+		message += "\n\n" + body
+	}
+	return message
+}
@@ -0,0 +1,118 @@
+//go:build !minimal && !noencrypt
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// EncryptionKey holds the public keys mail for a destination is encrypted to: age recipients
+// or the entities of an OpenPGP key ring
+type EncryptionKey struct {
+	Source string // Recipient or file the key came from, for logs
+
+	ageRecipients []age.Recipient
+	pgpEntities   openpgp.EntityList
+}
+
+// parseEncryptionKeys parses ENCRYPTION_KEYS entries of the form platform:id=key;... where key is
+// an age recipient (age1...), several separated by commas, or the absolute path of an age
+// recipients file or an ASCII-armored OpenPGP public key
+func parseEncryptionKeys(value string) (map[string]*EncryptionKey, error) {
+	keys := make(map[string]*EncryptionKey)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		destination, source, found := strings.Cut(entry, "=")
+		platform, id, hasID := strings.Cut(strings.TrimSpace(destination), ":")
+		source = strings.TrimSpace(source)
+		if !found || !hasID || platform == "" || id == "" || source == "" {
+			return nil, fmt.Errorf("invalid ENCRYPTION_KEYS entry '%s': use platform:id=age1... or platform:id=/path/to/key", entry)
+		}
+		key, err := loadEncryptionKey(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENCRYPTION_KEYS entry for %s: %w", destination, err)
+		}
+		keys[normalizeDestinationKey(platform, id)] = key
+	}
+	return keys, nil
+}
+
+// loadEncryptionKey reads age recipients or an OpenPGP key, and encrypts a test message so keys
+// without an encryption subkey fail at startup rather than on the first alert
+func loadEncryptionKey(source string) (*EncryptionKey, error) {
+	key := &EncryptionKey{Source: source}
+	data := []byte(strings.ReplaceAll(source, ",", "\n"))
+	if strings.HasPrefix(source, "/") {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	if bytes.Contains(data, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		var unsupported pgperrors.UnsupportedError
+		if errors.As(err, &unsupported) {
+			return nil, fmt.Errorf("failed to read OpenPGP key: %w (use an RSA or Curve25519 key, or an age recipient)", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OpenPGP key: %w", err)
+		}
+		key.pgpEntities = entities
+	} else {
+		recipients, err := age.ParseRecipients(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read age recipients: %w", err)
+		}
+		key.ageRecipients = recipients
+	}
+
+	if _, err := key.Encrypt([]byte("test")); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypt returns plaintext encrypted to the key, ASCII-armored so it can be posted as text
+func (k *EncryptionKey) Encrypt(plaintext []byte) (string, error) {
+	var armored bytes.Buffer
+	var armorWriter, encrypter io.WriteCloser
+	var err error
+	if len(k.pgpEntities) > 0 {
+		if armorWriter, err = pgparmor.Encode(&armored, "PGP MESSAGE", nil); err != nil {
+			return "", err
+		}
+		encrypter, err = openpgp.Encrypt(armorWriter, k.pgpEntities, nil, nil, nil)
+	} else {
+		armorWriter = armor.NewWriter(&armored)
+		encrypter, err = age.Encrypt(armorWriter, k.ageRecipients...)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	if _, err := encrypter.Write(plaintext); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := encrypter.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return strings.TrimSpace(armored.String()), nil
+}
@@ -0,0 +1,27 @@
+//go:build minimal || noencrypt
+
+package main
+
+import "strings"
+
+func init() {
+	excludeFeature("encryption", "noencrypt")
+}
+
+// EncryptionKey is a placeholder for builds without encryption
+type EncryptionKey struct {
+	Source string
+}
+
+// parseEncryptionKeys fails when ENCRYPTION_KEYS is set, the keys cannot be used in this build
+func parseEncryptionKeys(value string) (map[string]*EncryptionKey, error) {
+	if strings.TrimSpace(value) != "" {
+		return nil, requireFeature("encryption")
+	}
+	return nil, nil
+}
+
+// Encrypt reports that encryption was compiled out
+func (k *EncryptionKey) Encrypt(plaintext []byte) (string, error) {
+	return "", requireFeature("encryption")
+}
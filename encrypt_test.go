@@ -0,0 +1,190 @@
+//go:build !minimal && !noencrypt
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// encryptTestMessage has a subject, body and attachment that must never reach the platform in clear
+const encryptTestMessage = "From: monitor@example.com\r\n" +
+	"To: 123456789+eml@telegram\r\n" +
+	"Subject: Disk full on db-secret-1\r\n" +
+	"Content-Type: multipart/mixed; boundary=x\r\n\r\n" +
+	"--x\r\nContent-Type: text/plain\r\n\r\nPassword rotation failed for svc-secret\r\n" +
+	"--x\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=\"secret-report.txt\"\r\n\r\nreport-secret-contents\r\n" +
+	"--x--\r\n"
+
+// encryptTestSecrets are the parts of encryptTestMessage only the ciphertext may hold
+var encryptTestSecrets = []string{"db-secret-1", "svc-secret", "secret-report.txt", "report-secret-contents"}
+
+// newAgeTestKey returns an EncryptionKey for a fresh age identity, and the identity
+func newAgeTestKey(t *testing.T) (*EncryptionKey, *age.X25519Identity) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := loadEncryptionKey(identity.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, identity
+}
+
+// decryptAge returns the plaintext of an armored age message
+func decryptAge(t *testing.T, ciphertext string, identity age.Identity) string {
+	t.Helper()
+	reader, err := age.Decrypt(armor.NewReader(strings.NewReader(ciphertext)), identity)
+	if err != nil {
+		t.Fatalf("age.Decrypt() error = %v", err)
+	}
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(plaintext)
+}
+
+func TestEncryptEmail(t *testing.T) {
+	key, identity := newAgeTestKey(t)
+	ep := &EmailProcessor{}
+	email, err := ep.parseEmail([]byte(encryptTestMessage), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer email.Cleanup()
+
+	if err := ep.encryptEmail(email, key); err != nil {
+		t.Fatalf("encryptEmail() error = %v", err)
+	}
+	if email.Subject != EncryptedSubject || !email.Encrypted {
+		t.Errorf("Subject = %q, Encrypted = %v, want %q, true", email.Subject, email.Encrypted, EncryptedSubject)
+	}
+	if len(email.Attachments) != 0 || len(email.InlineImages) != 0 {
+		t.Errorf("%d attachments and %d images left on the encrypted email", len(email.Attachments), len(email.InlineImages))
+	}
+	for _, secret := range encryptTestSecrets {
+		if strings.Contains(email.Body, secret) {
+			t.Errorf("encrypted body contains %q in clear", secret)
+		}
+	}
+
+	// The recipient still learns everything but the attachment contents
+	plaintext := decryptAge(t, email.Body, identity)
+	for _, want := range []string{"db-secret-1", "svc-secret", "secret-report.txt"} {
+		if !strings.Contains(plaintext, want) {
+			t.Errorf("decrypted text does not contain %q:\n%s", want, plaintext)
+		}
+	}
+}
+
+func TestEncryptedDelivery(t *testing.T) {
+	// Everything sent to the platform is recorded, text messages and uploads alike
+	var mutex sync.Mutex
+	var requests [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, append([]byte(r.URL.String()+"\n"), body...))
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1}}`)
+	}))
+	defer server.Close()
+
+	key, _ := newAgeTestKey(t)
+	telegram := NewTelegramClient("test-token")
+	telegram.APIURL = server.URL
+	ep := &EmailProcessor{
+		Config: &Config{
+			ParseLimits:    DefaultParseLimits,
+			EncryptionKeys: map[string]*EncryptionKey{destinationKey("telegram", "123456789"): key},
+		},
+		TelegramClient: telegram,
+	}
+
+	// The eml option would upload the original message; encrypted destinations ignore it
+	if err := ep.ProcessEmail([]byte(encryptTestMessage), "monitor@example.com", []string{"123456789+eml@telegram"}, "127.0.0.1:25"); err != nil {
+		t.Fatalf("ProcessEmail() error = %v", err)
+	}
+	if len(requests) == 0 {
+		t.Fatal("nothing was sent to the platform")
+	}
+	for _, request := range requests {
+		for _, secret := range encryptTestSecrets {
+			if bytes.Contains(request, []byte(secret)) {
+				t.Errorf("request to the platform contains %q in clear:\n%s", secret, request)
+			}
+		}
+		if bytes.Contains(request, []byte("original-message.eml")) {
+			t.Errorf("original message uploaded to an encrypted destination:\n%s", request)
+		}
+	}
+}
+
+func TestLoadEncryptionKeyOpenPGP(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config *packet.Config
+	}{
+		{"rsa", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}},
+		{"curve25519", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entity, err := openpgp.NewEntity("Recipient", "", "recipient@example.com", tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var public bytes.Buffer
+			writer, err := pgparmor.Encode(&public, openpgp.PublicKeyType, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := entity.Serialize(writer); err != nil {
+				t.Fatal(err)
+			}
+			writer.Close()
+			path := filepath.Join(t.TempDir(), "recipient.asc")
+			if err := os.WriteFile(path, public.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := loadEncryptionKey(path)
+			if err != nil {
+				t.Fatalf("loadEncryptionKey() error = %v", err)
+			}
+			ciphertext, err := key.Encrypt([]byte("Disk full on db-secret-1"))
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+
+			block, err := pgparmor.Decode(strings.NewReader(ciphertext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			message, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{entity}, nil, nil)
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			plaintext, err := io.ReadAll(message.UnverifiedBody)
+			if err != nil || string(plaintext) != "Disk full on db-secret-1" {
+				t.Fatalf("decrypted %q, %v, want the test message", plaintext, err)
+			}
+		})
+	}
+}
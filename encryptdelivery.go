@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EncryptedSubject replaces the subject of encrypted mail wherever a platform shows one
+const EncryptedSubject = "Encrypted email"
+
+// encryptionKey returns the key mail for a destination is encrypted to, or nil
+func (ep *EmailProcessor) encryptionKey(platform, userID string) *EncryptionKey {
+	if ep.Config == nil {
+		return nil
+	}
+	return ep.Config.EncryptionKeys[destinationKey(platform, userID)]
+}
+
+// encryptEmail replaces the email with its plain-text rendering encrypted to key, so the platform
+// only ever sees ciphertext. Attachments are not sent; the encrypted text names them instead
+func (ep *EmailProcessor) encryptEmail(email *ProcessedEmail, key *EncryptionKey) error {
+	plain := *email
+	if plain.BodyHTML {
+		plain.Body, plain.BodyHTML = htmlToSlackMrkdwn(plain.Body), false
+	}
+	text := ep.formatPlainText(&plain)
+
+	var left []string
+	for _, attachments := range [][]Attachment{email.Attachments, email.InlineImages} {
+		for _, attachment := range attachments {
+			left = append(left, fmt.Sprintf("%s (%s)", attachment.Filename, formatByteSize(attachment.Size)))
+		}
+	}
+	if len(left) > 0 {
+		text += "\n\n[Attachments not sent to an encrypted destination: " + strings.Join(left, ", ") + "]"
+	}
+
+	ciphertext, err := key.Encrypt([]byte(text))
+	if err != nil {
+		return err
+	}
+	email.Attachments, email.InlineImages = nil, nil
+	email.Subject, email.Body, email.BodyHTML, email.SubjectOnly = EncryptedSubject, ciphertext, false, false
+	email.Encrypted = true
+	return nil
+}
@@ -0,0 +1,377 @@
+//go:build fakeapi
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake API Configuration
+const (
+	DefaultFakeAPIListen = ":8081"
+	FakeAPIPollDelay     = time.Second // How long a getUpdates call waits before answering with no updates
+	FakeAPIMaxBodyBytes  = 50 << 20
+	FakeAPIUnknownID     = "404" // Chat 404, channel C404 and user U404 do not exist
+)
+
+// fakeAPIRequest is one API call recorded by the fake server
+type fakeAPIRequest struct {
+	Platform string                 `json:"platform"` // "telegram" or "slack"
+	Method   string                 `json:"method"`   // API method, e.g. sendMessage or chat.postMessage
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Files    []string               `json:"files,omitempty"` // Names of uploaded files
+	Status   int                    `json:"status"`          // HTTP status of the answer
+	Time     time.Time              `json:"time"`
+}
+
+// fakeAPI stands in for the Telegram Bot API and the Slack Web API, answering every call
+// with a success and recording it so integration tests can assert on what was sent
+type fakeAPI struct {
+	mutex       sync.Mutex
+	requests    []fakeAPIRequest
+	rateLimited int // Delivery calls still to answer with 429
+	nextID      int
+	updates     []map[string]interface{} // Telegram updates for the next getUpdates call
+	updateID    int
+}
+
+// Handler routes Telegram calls (/bot<token>/<method>), Slack calls (/api/<method>) and the
+// control endpoints under /_fake/
+func (f *fakeAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_fake/requests", f.handleRequests)
+	mux.HandleFunc("/_fake/rate-limit", f.handleRateLimit)
+	mux.HandleFunc("/_fake/updates", f.handleUpdates)
+	mux.HandleFunc("/_fake/upload/", f.handleUpload)
+	mux.HandleFunc("/api/", f.handleSlack)
+	mux.HandleFunc("/", f.handleTelegram)
+	return mux
+}
+
+// handleRequests returns the recorded calls, optionally for one platform, or forgets them on DELETE
+func (f *fakeAPI) handleRequests(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		platform := r.URL.Query().Get("platform")
+		recorded := []fakeAPIRequest{}
+		for _, request := range f.requests {
+			if platform == "" || request.Platform == platform {
+				recorded = append(recorded, request)
+			}
+		}
+		writeFakeAPIJSON(w, http.StatusOK, recorded)
+	case http.MethodDelete:
+		f.requests = nil
+		f.rateLimited = 0
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRateLimit makes the next ?next=<n> delivery calls fail with 429 to exercise retries
+func (f *fakeAPI) handleRateLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	next, err := strconv.Atoi(r.URL.Query().Get("next"))
+	if err != nil || next < 0 {
+		http.Error(w, "next must be zero or a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	f.rateLimited = next
+	f.mutex.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUpdates queues a Telegram update, such as a reply to a bridged message, for the next getUpdates call
+func (f *fakeAPI) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var update map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, FakeAPIMaxBodyBytes)).Decode(&update); err != nil {
+		http.Error(w, "body must be a JSON update object", http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	f.updateID++
+	update["update_id"] = f.updateID
+	f.updates = append(f.updates, update)
+	f.mutex.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// takeUpdates returns the queued Telegram updates and forgets them
+func (f *fakeAPI) takeUpdates() []map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	updates := f.updates
+	f.updates = nil
+	return updates
+}
+
+// handleUpload accepts the file content of a Slack external upload
+func (f *fakeAPI) handleUpload(w http.ResponseWriter, r *http.Request) {
+	size, _ := io.Copy(io.Discard, io.LimitReader(r.Body, FakeAPIMaxBodyBytes))
+	fileID := strings.TrimPrefix(r.URL.Path, "/_fake/upload/")
+	f.record(fakeAPIRequest{
+		Platform: "slack",
+		Method:   "upload",
+		Fields:   map[string]interface{}{"file_id": fileID, "length": size},
+		Status:   http.StatusOK,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTelegram answers a Bot API call
+func (f *fakeAPI) handleTelegram(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	method := parts[1]
+	request := fakeAPIRequest{Platform: "telegram", Method: method}
+	request.Fields, request.Files = readFakeAPIBody(r)
+
+	switch method {
+	case "getMe":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{
+			"ok": true, "result": map[string]interface{}{"id": 1, "is_bot": true, "username": "fakeapi_bot"},
+		})
+		return
+	case "getUpdates":
+		// Long polling: hold the call briefly rather than letting the poller spin, without recording it
+		if updates := f.takeUpdates(); len(updates) > 0 {
+			writeFakeAPIJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "result": updates})
+			return
+		}
+		select {
+		case <-time.After(FakeAPIPollDelay):
+		case <-r.Context().Done():
+		}
+		writeFakeAPIJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "result": []interface{}{}})
+		return
+	case "getChat":
+		if fmt.Sprint(request.Fields["chat_id"]) == FakeAPIUnknownID {
+			f.answer(w, request, http.StatusBadRequest, map[string]interface{}{
+				"ok": false, "error_code": http.StatusBadRequest, "description": "Bad Request: chat not found",
+			})
+			return
+		}
+		f.answer(w, request, http.StatusOK, map[string]interface{}{
+			"ok": true, "result": map[string]interface{}{"id": request.Fields["chat_id"], "type": "private"},
+		})
+		return
+	case "editMessageReplyMarkup", "answerCallbackQuery":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "result": true})
+		return
+	}
+
+	if f.takeRateLimit() {
+		f.answer(w, request, http.StatusTooManyRequests, map[string]interface{}{
+			"ok": false, "error_code": http.StatusTooManyRequests, "description": "Too Many Requests: retry after 1",
+			"parameters": map[string]interface{}{"retry_after": 1},
+		})
+		return
+	}
+	f.answer(w, request, http.StatusOK, map[string]interface{}{
+		"ok": true, "result": map[string]interface{}{"message_id": f.newID(), "chat": map[string]interface{}{"id": request.Fields["chat_id"]}},
+	})
+}
+
+// handleSlack answers a Web API call
+func (f *fakeAPI) handleSlack(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	request := fakeAPIRequest{Platform: "slack", Method: method}
+	request.Fields, request.Files = readFakeAPIBody(r)
+	for key, values := range r.URL.Query() {
+		if request.Fields == nil {
+			request.Fields = make(map[string]interface{})
+		}
+		request.Fields[key] = values[0]
+	}
+
+	switch method {
+	case "auth.test":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "user": "fakeapi", "user_id": "UFAKEAPI", "team": "fakeapi"})
+		return
+	case "users.list":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "members": []interface{}{}})
+		return
+	case "usergroups.list":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "usergroups": []interface{}{}})
+		return
+	case "conversations.open":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{
+			"ok": true, "channel": map[string]interface{}{"id": fmt.Sprintf("D%v", request.Fields["users"])},
+		})
+		return
+	case "conversations.info":
+		if request.Fields["channel"] == "C"+FakeAPIUnknownID {
+			f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": false, "error": "channel_not_found"})
+			return
+		}
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "channel": map[string]interface{}{"id": request.Fields["channel"]}})
+		return
+	case "users.info":
+		if request.Fields["user"] == "U"+FakeAPIUnknownID {
+			f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": false, "error": "user_not_found"})
+			return
+		}
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": request.Fields["user"]}})
+		return
+	case "files.getUploadURLExternal":
+		fileID := fmt.Sprintf("F%d", f.newID())
+		f.answer(w, request, http.StatusOK, map[string]interface{}{
+			"ok": true, "file_id": fileID, "upload_url": fmt.Sprintf("http://%s/_fake/upload/%s", r.Host, fileID),
+		})
+		return
+	case "canvases.create":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": true, "canvas_id": fmt.Sprintf("F%d", f.newID())})
+		return
+	case "files.info":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{
+			"ok": true, "file": map[string]interface{}{"id": r.URL.Query().Get("file"), "permalink": fmt.Sprintf("http://%s/_fake/files/%s", r.Host, r.URL.Query().Get("file"))},
+		})
+		return
+	case "apps.connections.open":
+		f.answer(w, request, http.StatusOK, map[string]interface{}{"ok": false, "error": "not_supported_by_fakeapi"})
+		return
+	}
+
+	if f.takeRateLimit() {
+		w.Header().Set("Retry-After", "1")
+		f.answer(w, request, http.StatusTooManyRequests, map[string]interface{}{"ok": false, "error": "ratelimited"})
+		return
+	}
+	f.answer(w, request, http.StatusOK, map[string]interface{}{
+		"ok": true, "channel": request.Fields["channel"], "ts": fmt.Sprintf("%d.%06d", time.Now().Unix(), f.newID()),
+	})
+}
+
+// answer records a call with the status it is answered with and writes the answer
+func (f *fakeAPI) answer(w http.ResponseWriter, request fakeAPIRequest, status int, body interface{}) {
+	request.Status = status
+	f.record(request)
+	writeFakeAPIJSON(w, status, body)
+}
+
+// record appends a call to the log
+func (f *fakeAPI) record(request fakeAPIRequest) {
+	request.Time = time.Now()
+	f.mutex.Lock()
+	f.requests = append(f.requests, request)
+	f.mutex.Unlock()
+	log.Printf("fakeapi: %s %s answered %d", request.Platform, request.Method, request.Status)
+}
+
+// takeRateLimit reports whether the current delivery call should be rate limited
+func (f *fakeAPI) takeRateLimit() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.rateLimited == 0 {
+		return false
+	}
+	f.rateLimited--
+	return true
+}
+
+// newID returns the next message or file number
+func (f *fakeAPI) newID() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.nextID++
+	return f.nextID
+}
+
+// readFakeAPIBody decodes a JSON, form or multipart request body into its fields and the
+// names of any uploaded files
+func readFakeAPIBody(r *http.Request) (map[string]interface{}, []string) {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := io.LimitReader(r.Body, FakeAPIMaxBodyBytes)
+
+	switch {
+	case mediaType == "application/json":
+		var fields map[string]interface{}
+		if err := json.NewDecoder(body).Decode(&fields); err != nil {
+			log.Printf("fakeapi: invalid JSON body for %s: %v", r.URL.Path, err)
+		}
+		return fields, nil
+	case mediaType == "multipart/form-data":
+		fields := make(map[string]interface{})
+		var files []string
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FileName() != "" {
+				files = append(files, part.FileName())
+				io.Copy(io.Discard, part)
+				continue
+			}
+			value, _ := io.ReadAll(part)
+			fields[part.FormName()] = string(value)
+		}
+		return fields, files
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, nil
+		}
+		fields := make(map[string]interface{})
+		for key, values := range r.PostForm {
+			fields[key] = values[0]
+		}
+		return fields, nil
+	}
+	return nil, nil
+}
+
+// writeFakeAPIJSON writes a JSON answer, leaving <, > and & readable for assertions on formatting
+func writeFakeAPIJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(body)
+}
+
+// runFakeAPI serves fake Telegram and Slack APIs until interrupted, for integration tests that
+// point TELEGRAM_API_URL and SLACK_API_URL at it
+func runFakeAPI(args []string) error {
+	flags := flag.NewFlagSet("fakeapi", flag.ContinueOnError)
+	listen := flags.String("listen", DefaultFakeAPIListen, "address to serve the fake APIs on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	log.Printf("Serving fake Telegram API at http://%s and fake Slack API at http://%s/api", *listen, *listen)
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           (&fakeAPI{}).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
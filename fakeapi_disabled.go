@@ -0,0 +1,10 @@
+//go:build !fakeapi
+
+package main
+
+import "errors"
+
+// runFakeAPI reports that the fake APIs for integration tests are only built on request
+func runFakeAPI(args []string) error {
+	return errors.New("not included in this build, rebuild with -tags fakeapi")
+}
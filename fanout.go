@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+)
+
+// Multi-Recipient Policies
+const (
+	MultiRecipientFirst         = "first"          // Deliver to the first recipient only
+	MultiRecipientFirstPlatform = "first-platform" // Deliver to every recipient on the first recipient's platform
+	MultiRecipientAll           = "all"            // Deliver to every recipient
+	MultiRecipientAlias         = "alias"          // Deliver to every recipient, refusing mixed platforms outside fan-out aliases
+
+	FanoutDomain = "fanout" // Fan-out aliases are addressed as <name>@fanout
+)
+
+// RecipientError is the failed delivery to one recipient of a message
+type RecipientError struct {
+	Recipient string
+	Err       error
+}
+
+// PartialDeliveryError reports a message that reached some of its recipients but not all.
+// Retrying it would repeat the message to the recipients that got it, so it is accepted
+type PartialDeliveryError struct {
+	Delivered []string
+	Failed    []RecipientError
+}
+
+func (e *PartialDeliveryError) Error() string {
+	failed := make([]string, len(e.Failed))
+	for i, failure := range e.Failed {
+		failed[i] = fmt.Sprintf("%s (%v)", failure.Recipient, failure.Err)
+	}
+	return fmt.Sprintf("delivered to %d of %d recipients, failed: %s", len(e.Delivered), len(e.Delivered)+len(e.Failed), strings.Join(failed, ", "))
+}
+
+func (e *PartialDeliveryError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, failure := range e.Failed {
+		errs[i] = failure.Err
+	}
+	return errs
+}
+
+// parseMultiRecipientPolicy validates MULTI_RECIPIENT_POLICY
+func parseMultiRecipientPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return MultiRecipientAll, nil
+	case MultiRecipientFirst, MultiRecipientFirstPlatform, MultiRecipientAll, MultiRecipientAlias:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid MULTI_RECIPIENT_POLICY '%s': use first, first-platform, all or alias", value)
+	}
+}
+
+// parseFanoutAliases parses FANOUT_ALIASES entries of the form name=address,address;...
+func parseFanoutAliases(value string) (map[string][]string, error) {
+	aliases := make(map[string][]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, members, found := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !found || name == "" || strings.ContainsAny(name, "@ ") {
+			return nil, fmt.Errorf("invalid FANOUT_ALIASES entry '%s': use name=address,address", entry)
+		}
+		for _, member := range strings.Split(members, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			if !strings.Contains(member, "@") {
+				return nil, fmt.Errorf("invalid FANOUT_ALIASES entry '%s': '%s' is not an address", entry, member)
+			}
+			if strings.HasSuffix(strings.ToLower(member), "@"+FanoutDomain) {
+				return nil, fmt.Errorf("invalid FANOUT_ALIASES entry '%s': aliases cannot contain aliases", entry)
+			}
+			aliases[name] = append(aliases[name], member)
+		}
+		if len(aliases[name]) == 0 {
+			return nil, fmt.Errorf("invalid FANOUT_ALIASES entry '%s': no addresses", entry)
+		}
+	}
+	return aliases, nil
+}
+
+// fanoutAlias returns the members of the fan-out alias an address names, or false for other addresses
+func (ep *EmailProcessor) fanoutAlias(address string) ([]string, bool, error) {
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	if addr, err := mail.ParseAddress(address); err == nil {
+		address = addr.Address
+	}
+	name, found := strings.CutSuffix(strings.ToLower(address), "@"+FanoutDomain)
+	if !found {
+		return nil, false, nil
+	}
+	if ep.Config != nil {
+		if members, exists := ep.Config.FanoutAliases[name]; exists {
+			return members, true, nil
+		}
+	}
+	return nil, true, fmt.Errorf("unknown fan-out alias: %s", address)
+}
+
+// checkFanoutAliases validates every alias member at startup
+func (ep *EmailProcessor) checkFanoutAliases() error {
+	if ep.Config == nil {
+		return nil
+	}
+	for name, members := range ep.Config.FanoutAliases {
+		for _, member := range members {
+			if _, _, _, err := ep.extractPlatformAndID(member); err != nil {
+				return fmt.Errorf("invalid FANOUT_ALIASES member %s of %s: %w", member, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// multiRecipientPolicy returns the configured policy for mail with several recipients
+func (ep *EmailProcessor) multiRecipientPolicy() string {
+	if ep.Config == nil || ep.Config.MultiRecipientPolicy == "" {
+		return MultiRecipientAll
+	}
+	return ep.Config.MultiRecipientPolicy
+}
+
+// deliveryRecipient is a recipient address with the destination it resolves to
+type deliveryRecipient struct {
+	Address  string
+	Platform string
+	ID       string
+	Options  DestinationOptions
+	Err      error // Why the address does not resolve; delivery to it fails with this error
+}
+
+// resolveRecipient resolves an address once, so the external resolver is not asked twice
+func (ep *EmailProcessor) resolveRecipient(address string) deliveryRecipient {
+	platform, id, options, err := ep.extractPlatformAndID(address)
+	return deliveryRecipient{Address: address, Platform: platform, ID: id, Options: options, Err: err}
+}
+
+// key identifies the destination, or the address as written when it does not resolve
+func (r deliveryRecipient) key() string {
+	if r.Err != nil {
+		return strings.ToLower(strings.Trim(strings.TrimSpace(r.Address), "<>"))
+	}
+	return destinationKey(r.Platform, r.ID)
+}
+
+// deliveryRecipients returns the destinations a message is delivered to: fan-out aliases are
+// expanded to their members, and the other recipients are kept as MULTI_RECIPIENT_POLICY says
+func (ep *EmailProcessor) deliveryRecipients(to []string) ([]deliveryRecipient, error) {
+	var direct, expanded []deliveryRecipient
+	for _, address := range to {
+		members, isAlias, err := ep.fanoutAlias(address)
+		if err != nil {
+			return nil, err
+		}
+		if isAlias {
+			for _, member := range members {
+				expanded = append(expanded, ep.resolveRecipient(member))
+			}
+		} else {
+			direct = append(direct, ep.resolveRecipient(address))
+		}
+	}
+
+	policy := ep.multiRecipientPolicy()
+	if len(direct) > 1 && policy != MultiRecipientAll {
+		// Recipients that do not name a destination fail at delivery as before
+		switch policy {
+		case MultiRecipientFirst:
+			dropped := make([]string, len(direct)-1)
+			for i, recipient := range direct[1:] {
+				dropped[i] = recipient.Address
+			}
+			log.Printf("Warning: delivering to the first recipient only (MULTI_RECIPIENT_POLICY=first), dropping %s", strings.Join(dropped, ", "))
+			direct = direct[:1]
+		case MultiRecipientFirstPlatform:
+			var kept []deliveryRecipient
+			var dropped []string
+			for _, recipient := range direct {
+				if recipient.Platform == direct[0].Platform {
+					kept = append(kept, recipient)
+				} else {
+					dropped = append(dropped, recipient.Address)
+				}
+			}
+			if len(dropped) > 0 {
+				log.Printf("Warning: delivering to %s recipients only (MULTI_RECIPIENT_POLICY=first-platform), dropping %s", direct[0].Platform, strings.Join(dropped, ", "))
+			}
+			direct = kept
+		case MultiRecipientAlias:
+			for _, recipient := range direct[1:] {
+				if recipient.Platform != direct[0].Platform {
+					return nil, errors.New("recipients are on more than one platform: address a fan-out alias (<name>@fanout) to deliver to several platforms")
+				}
+			}
+		}
+	}
+
+	// The same destination gets one message however it was addressed: directly, through an alias,
+	// a macro or a signed token, or with different options. The first address of it wins
+	seen := make(map[string]bool)
+	var recipients []deliveryRecipient
+	for _, recipient := range append(direct, expanded...) {
+		if key := recipient.key(); !seen[key] {
+			seen[key] = true
+			recipients = append(recipients, recipient)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipient addresses provided")
+	}
+	return recipients, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFanoutTestProcessor returns a processor with aliases, a macro, signed addresses and a named bot
+func newFanoutTestProcessor(t *testing.T, policy string) *EmailProcessor {
+	t.Helper()
+	table := filepath.Join(t.TempDir(), "teams.txt")
+	if err := os.WriteFile(table, []byte("db 123456789@telegram\nops C0123456789@slack\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	macros, err := parseAddressMacros("team-%name%@alerts=" + table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases, err := parseFanoutAliases("oncall=123456789@telegram,C0123456789@slack;db=123456789+silent@telegram;unknown=x@nowhere")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &EmailProcessor{
+		Config: &Config{
+			MultiRecipientPolicy: policy,
+			FanoutAliases:        aliases,
+			AddressMacros:        macros,
+			AddressTokens:        &AddressTokens{Secret: []byte("test secret"), Domain: DefaultAddressTokenDomain},
+		},
+		TelegramBots: map[string]*TelegramClient{"prod": nil},
+	}
+}
+
+func TestDeliveryRecipients(t *testing.T) {
+	ep := newFanoutTestProcessor(t, MultiRecipientAll)
+	token := ep.Config.AddressTokens.Issue("telegram", "123456789", time.Time{}) + "@" + DefaultAddressTokenDomain
+
+	tests := []struct {
+		name string
+		to   []string
+		want []string // Addresses delivered to, in order
+	}{
+		{"distinct destinations", []string{"123456789@telegram", "C0123456789@slack"}, []string{"123456789@telegram", "C0123456789@slack"}},
+		{"same address twice", []string{"123456789@telegram", "123456789@telegram"}, []string{"123456789@telegram"}},
+		{"case and brackets", []string{"C0123456789@slack", "<C0123456789@SLACK>"}, []string{"C0123456789@slack"}},
+		{"modifier variant", []string{"123456789@telegram", "123456789+raw@telegram"}, []string{"123456789@telegram"}},
+		{"modifier variant first", []string{"123456789+raw@telegram", "123456789@telegram"}, []string{"123456789+raw@telegram"}},
+		{"macro", []string{"team-db@alerts", "123456789@telegram"}, []string{"team-db@alerts"}},
+		{"signed address", []string{"123456789@telegram", token}, []string{"123456789@telegram"}},
+		{"named bot", []string{"123456789@telegram", "123456789@prod.telegram"}, []string{"123456789@telegram"}},
+		{"alias member named directly", []string{"oncall@fanout", "C0123456789@slack"}, []string{"C0123456789@slack", "123456789@telegram"}},
+		{"aliases sharing a member", []string{"oncall@fanout", "db@fanout"}, []string{"123456789@telegram", "C0123456789@slack"}},
+		{"alias and macro", []string{"oncall@fanout", "team-ops@alerts"}, []string{"team-ops@alerts", "123456789@telegram"}},
+		{"unresolved kept once", []string{"x@nowhere", "X@Nowhere"}, []string{"x@nowhere"}},
+		{"unresolved alias member", []string{"unknown@fanout", "x@nowhere"}, []string{"x@nowhere"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipients, err := ep.deliveryRecipients(tt.to)
+			if err != nil {
+				t.Fatalf("deliveryRecipients(%v) error = %v", tt.to, err)
+			}
+			var got []string
+			for _, recipient := range recipients {
+				got = append(got, recipient.Address)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("deliveryRecipients(%v) = %v, want %v", tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliveryRecipientsPolicy(t *testing.T) {
+	to := []string{"123456789@telegram", "C0123456789@slack", "987654321@telegram", "oncall@fanout"}
+	tests := []struct {
+		policy  string
+		want    []string
+		wantErr string
+	}{
+		{MultiRecipientAll, []string{"123456789@telegram", "C0123456789@slack", "987654321@telegram"}, ""},
+		{MultiRecipientFirst, []string{"123456789@telegram", "C0123456789@slack"}, ""},
+		{MultiRecipientFirstPlatform, []string{"123456789@telegram", "987654321@telegram", "C0123456789@slack"}, ""},
+		{MultiRecipientAlias, nil, "recipients are on more than one platform"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			recipients, err := newFanoutTestProcessor(t, tt.policy).deliveryRecipients(to)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("deliveryRecipients() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("deliveryRecipients() error = %v", err)
+			}
+			var got []string
+			for _, recipient := range recipients {
+				got = append(got, recipient.Address)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("deliveryRecipients() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessEachRecipient(t *testing.T) {
+	var mutex sync.Mutex
+	sent := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		sent++
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true,"result":{"message_id":1}}`)
+	}))
+	defer server.Close()
+
+	// Telegram delivers and Slack, without a client, fails
+	ep := newFanoutTestProcessor(t, MultiRecipientFirst)
+	ep.Config.ParseLimits = DefaultParseLimits
+	ep.TelegramClient = NewTelegramClient("test-token")
+	ep.TelegramClient.APIURL = server.URL
+
+	message := []byte("From: monitor@example.com\r\nSubject: Disk full\r\n\r\nbody\r\n")
+	to := []string{"123456789@telegram", "C0123456789@slack", "oncall@fanout", "<123456789@TELEGRAM>", "x@fanout"}
+	results := ep.ProcessEachRecipient(message, to, SessionInfo{EnvelopeFrom: "monitor@example.com"})
+
+	var partialErr *PartialDeliveryError
+	if err := results["123456789@telegram"]; err != nil {
+		t.Errorf("telegram recipient error = %v", err)
+	}
+	if err := results["<123456789@TELEGRAM>"]; err != nil {
+		t.Errorf("second telegram recipient error = %v", err)
+	}
+	if err := results["C0123456789@slack"]; err == nil || errors.As(err, &partialErr) {
+		t.Errorf("slack recipient error = %v, want a failure", err)
+	}
+	if err := results["oncall@fanout"]; !errors.As(err, &partialErr) {
+		t.Errorf("alias recipient error = %v, want a partial delivery", err)
+	}
+	if err := results["x@fanout"]; !errors.Is(err, ErrInvalidDestination) {
+		t.Errorf("unknown alias error = %v, want an invalid destination", err)
+	}
+
+	// Each recipient is delivered on its own, but Telegram gets the message once
+	if sent != 1 {
+		t.Errorf("%d messages sent to Telegram, want 1", sent)
+	}
+}
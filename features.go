@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// excludedFeatures maps the features left out of this binary to the build tag that removed them.
+// Each *_disabled.go stub registers itself here
+var excludedFeatures = map[string]string{}
+
+// excludeFeature records that a feature was compiled out
+func excludeFeature(name, tag string) {
+	excludedFeatures[name] = tag
+}
+
+// requireFeature fails when configuration asks for a feature this binary was built without
+func requireFeature(name string) error {
+	if tag, ok := excludedFeatures[name]; ok {
+		return fmt.Errorf("%s support is not included in this build (excluded by the %s or minimal build tag)", name, tag)
+	}
+	return nil
+}
+
+// ExcludedFeatures returns the names of the features compiled out of this binary
+func ExcludedFeatures() []string {
+	names := make([]string, 0, len(excludedFeatures))
+	for name := range excludedFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkFeatures fails when the configuration enables a platform or subsystem missing from this build
+func checkFeatures(config *Config) error {
+	configured := []struct {
+		name    string
+		enabled bool
+	}{
+		{"slack", config.SlackBotToken != ""},
+		{"dingtalk", len(config.DingTalkRobots) > 0},
+		{"wecom", config.WeComCorpID != ""},
+		{"mastodon", config.MastodonToken != ""},
+		{"whatsapp", config.WhatsAppToken != ""},
+		{"zoom", config.ZoomAccountID != ""},
+		{"victorops", config.VictorOpsAPIKey != ""},
+		{"redis", config.RedisOptions != nil},
+		{"inbound webhook", config.InboundListenAddr != ""},
+		{"platform plugin", config.PluginDir != ""},
+		{"custom HTTP platform", len(config.HTTPPlatforms) > 0},
+		{"resolver webhook", config.ResolverWebhookURL != ""},
+		{"bbolt", config.StateFile != "" && config.StateBackend == StateBackendBolt},
+		{"sqlite", config.StateFile != "" && config.StateBackend == StateBackendSQLite},
+	}
+
+	for _, feature := range configured {
+		if !feature.enabled {
+			continue
+		}
+		if err := requireFeature(feature.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,19 @@ module email2dm
 
 go 1.24.3
 
-require github.com/emersion/go-smtp v0.23.0
+require (
+	filippo.io/age v1.0.0
+	github.com/ProtonMail/go-crypto v1.3.0
+	github.com/emersion/go-sasl v0.0.0-20241020182733-b788ff22d5a6
+	github.com/emersion/go-smtp v0.23.0
+	github.com/klauspost/compress v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.33
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.39.0
+	golang.org/x/net v0.41.0
+)
 
-require github.com/emersion/go-sasl v0.0.0-20241020182733-b788ff22d5a6 // indirect
+require (
+	github.com/cloudflare/circl v1.6.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Greylisting Configuration
+const (
+	GreylistRetryWindow = 24 * time.Hour      // How long a first attempt waits for its retry
+	GreylistPassTTL     = 35 * 24 * time.Hour // How long a retried triple is accepted without delay
+	GreylistMaxLen      = 100000              // Triples tracked before expired ones are pruned
+)
+
+// greylistEntry is a client, sender and recipient triple seen before
+type greylistEntry struct {
+	first   time.Time // First attempt
+	passed  bool      // Retried after the delay
+	expires time.Time
+}
+
+// Greylist refuses the first attempt of an unknown client, sender and recipient triple with a
+// temporary error. MTAs retry after a while; most spam bots never do
+type Greylist struct {
+	Delay      time.Duration // How long a retry has to wait
+	MaxEntries int           // Triples kept before expired ones are pruned
+
+	mutex   sync.Mutex
+	entries map[string]greylistEntry
+}
+
+// NewGreylist creates an empty greylist that accepts retries after delay
+func NewGreylist(delay time.Duration) *Greylist {
+	return &Greylist{
+		Delay:      delay,
+		MaxEntries: GreylistMaxLen,
+		entries:    make(map[string]greylistEntry),
+	}
+}
+
+// greylistKey identifies a triple. Large senders retry from other hosts of the same network,
+// so clients are grouped by /24 for IPv4 and /64 for IPv6
+func greylistKey(ip, from, to string) string {
+	client := ip
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if v4 := parsed.To4(); v4 != nil {
+			client = v4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			client = parsed.Mask(net.CIDRMask(64, 128)).String()
+		}
+	}
+	return client + "|" + strings.ToLower(from) + "|" + strings.ToLower(to)
+}
+
+// Check records an attempt to deliver from from to to by the client at ip, and returns how much
+// longer it has to wait; 0 accepts it
+func (g *Greylist) Check(ip, from, to string) time.Duration {
+	key := greylistKey(ip, from, to)
+	now := time.Now()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if entry, exists := g.entries[key]; exists && now.Before(entry.expires) {
+		if !entry.passed {
+			if wait := entry.first.Add(g.Delay).Sub(now); wait > 0 {
+				return wait
+			}
+			entry.passed = true
+		}
+		entry.expires = now.Add(GreylistPassTTL)
+		g.entries[key] = entry
+		return 0
+	}
+
+	if len(g.entries) >= g.MaxEntries {
+		for k, entry := range g.entries {
+			if !now.Before(entry.expires) {
+				delete(g.entries, k)
+			}
+		}
+		// Accept rather than refuse every new sender while flooded
+		if len(g.entries) >= g.MaxEntries {
+			return 0
+		}
+	}
+	g.entries[key] = greylistEntry{first: now, expires: now.Add(GreylistRetryWindow)}
+	return g.Delay
+}
+
+// persistedGreylistEntry is a triple as stored in the state file
+type persistedGreylistEntry struct {
+	First   time.Time `json:"first"`
+	Passed  bool      `json:"passed,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// saveState implements persistentCache, keeping only live entries
+func (g *Greylist) saveState() (json.RawMessage, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now()
+	entries := make(map[string]persistedGreylistEntry, len(g.entries))
+	for key, entry := range g.entries {
+		if now.Before(entry.expires) {
+			entries[key] = persistedGreylistEntry{First: entry.first, Passed: entry.passed, Expires: entry.expires}
+		}
+	}
+	return json.Marshal(entries)
+}
+
+// loadState implements persistentCache, so senders that already retried are not delayed again
+// after a restart
+func (g *Greylist) loadState(data json.RawMessage) error {
+	var entries map[string]persistedGreylistEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now()
+	for key, entry := range entries {
+		if len(g.entries) >= g.MaxEntries {
+			break
+		}
+		if now.Before(entry.Expires) {
+			g.entries[key] = greylistEntry{first: entry.First, passed: entry.Passed, expires: entry.Expires}
+		}
+	}
+	return nil
+}
+
+// errGreylisted is the reply to a first attempt
+func errGreylisted(wait time.Duration) *smtp.SMTPError {
+	wait = wait.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      fmt.Sprintf("Greylisted, try again in %s", formatSnooze(wait)),
+	}
+}
+
+// SetGreylist greylists recipients of unauthenticated clients on the TCP listeners
+func (s *SMTPServer) SetGreylist(greylist *Greylist) {
+	s.backend.Greylist = greylist
+	log.Printf("Greylisting: retries accepted after %s", formatSnooze(greylist.Delay))
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Alert History Configuration
+const (
+	DefaultHistorySize   = 1000
+	LowMemoryHistorySize = 200
+	HistorySummaryLen    = 160 // Characters of the body kept with each alert
+	SearchMaxResults     = 10
+	SearchMinTermLen     = 2
+)
+
+// Delivery outcomes recorded in the history
+const (
+	HistorySent   = "sent"
+	HistoryFailed = "failed"
+)
+
+// HistoryEntry is one delivery of an email to a destination
+type HistoryEntry struct {
+	Time        time.Time `json:"time"`
+	From        string    `json:"from"`
+	Subject     string    `json:"subject"`
+	Summary     string    `json:"summary,omitempty"` // Start of the body
+	Severity    Severity  `json:"severity,omitempty"`
+	Platform    string    `json:"platform"`
+	Destination string    `json:"destination"`
+	Bot         string    `json:"bot,omitempty"`  // Named Telegram bot, "" for the default one
+	Chat        string    `json:"chat,omitempty"` // Chat, channel or user ID the message went to, for scoping searches
+	MessageID   string    `json:"message_id,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+	LatencyMS   int64     `json:"latency_ms"`
+}
+
+// AlertHistory keeps the most recent deliveries in a ring buffer, so chat users can search
+// for past alerts without access to the server, and optionally appends every delivery to a
+// JSON Lines file for reporting
+type AlertHistory struct {
+	mutex   sync.Mutex
+	entries []HistoryEntry
+	next    int // Index the next entry is written to
+	full    bool
+	file    *os.File // HISTORY_FILE; nil keeps deliveries in memory only
+	path    string
+}
+
+// NewAlertHistory creates a history keeping the last size deliveries
+func NewAlertHistory(size int) *AlertHistory {
+	return &AlertHistory{entries: make([]HistoryEntry, size)}
+}
+
+// OpenFile appends every delivery recorded from now on to a JSON Lines file
+func (h *AlertHistory) OpenFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open HISTORY_FILE: %w", err)
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.file, h.path = file, path
+	return nil
+}
+
+// Path returns the file deliveries are appended to, or "" when they are kept in memory only
+func (h *AlertHistory) Path() string {
+	if h == nil {
+		return ""
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.path
+}
+
+// Close closes the history file
+func (h *AlertHistory) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// Record adds a delivery, replacing the oldest one when the history is full
+func (h *AlertHistory) Record(entry HistoryEntry) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// One line per write, so the file stays readable while it is appended to
+	if h.file != nil {
+		line, _ := json.Marshal(entry)
+		if _, err := h.file.Write(append(line, '\n')); err != nil {
+			log.Printf("Warning: failed to append to HISTORY_FILE: %v", err)
+		}
+	}
+
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Recent returns the recorded deliveries for which match returns true, newest first, up to limit (0 for all)
+func (h *AlertHistory) Recent(limit int, match func(*HistoryEntry) bool) []HistoryEntry {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+	var found []HistoryEntry
+	for i := 1; i <= count; i++ {
+		entry := &h.entries[(h.next-i+len(h.entries))%len(h.entries)]
+		if match(entry) {
+			found = append(found, *entry)
+			if len(found) == limit {
+				break
+			}
+		}
+	}
+	return found
+}
+
+// Search returns the alerts delivered to a chat whose subject, sender or summary contain term
+func (h *AlertHistory) Search(platform, bot string, chats []string, term string) []HistoryEntry {
+	term = strings.ToLower(term)
+	return h.Recent(SearchMaxResults, func(entry *HistoryEntry) bool {
+		if entry.Outcome != HistorySent || entry.Platform != platform || entry.Bot != bot {
+			return false
+		}
+		inChat := false
+		for _, chat := range chats {
+			inChat = inChat || (chat != "" && entry.Chat == chat)
+		}
+		return inChat &&
+			(strings.Contains(strings.ToLower(entry.Subject), term) ||
+				strings.Contains(strings.ToLower(entry.From), term) ||
+				strings.Contains(strings.ToLower(entry.Summary), term))
+	})
+}
+
+// historySummary returns the start of a body on one line
+func historySummary(body string) string {
+	summary := strings.Join(strings.Fields(body), " ")
+	if utf8.RuneCountInString(summary) <= HistorySummaryLen {
+		return summary
+	}
+	return string([]rune(summary)[:HistorySummaryLen]) + "…"
+}
+
+// parseSearchCommand returns the term of a "/search <term>" command, also accepting Telegram's
+// /search@botname form, or false for other messages
+func parseSearchCommand(text string) (string, bool) {
+	command, term, _ := strings.Cut(strings.TrimSpace(text), " ")
+	command, _, _ = strings.Cut(command, "@")
+	if !strings.EqualFold(command, "/search") {
+		return "", false
+	}
+	return strings.TrimSpace(term), true
+}
+
+// searchUsage is the answer to a search without a usable term
+var searchUsage = fmt.Sprintf("Usage: /search <term>, e.g. /search disk. Finds the last %d alerts sent to this chat whose subject, sender or text contain the term", SearchMaxResults)
+
+// formatSearchResultsHTML lists search results for Telegram, linking to each alert when the chat has links
+func formatSearchResultsHTML(term string, results []HistoryEntry) string {
+	if len(results) == 0 {
+		return fmt.Sprintf("🔎 No recent alerts in this chat match <b>%s</b>", html.EscapeString(term))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔎 %d recent alert(s) matching <b>%s</b>:\n", len(results), html.EscapeString(term))
+	for _, entry := range results {
+		fmt.Fprintf(&sb, "\n%s %s <b>%s</b>", entry.Severity.Emoji(), entry.Time.UTC().Format("Jan 02 15:04"), html.EscapeString(entry.Subject))
+		if link := telegramMessageLink(entry.Chat, entry.MessageID); link != "" {
+			fmt.Fprintf(&sb, " <a href=\"%s\">open</a>", link)
+		}
+		if entry.Summary != "" {
+			fmt.Fprintf(&sb, "\n<i>%s</i>", html.EscapeString(entry.Summary))
+		}
+	}
+	sb.WriteString("\n\nTimes are UTC.")
+	return sb.String()
+}
+
+// telegramMessageLink returns a t.me link to a message; only supergroups and channels have them
+func telegramMessageLink(chatID, messageID string) string {
+	internalID, found := strings.CutPrefix(chatID, "-100")
+	if !found || messageID == "" {
+		return ""
+	}
+	if _, err := strconv.ParseInt(internalID, 10, 64); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%s/%s", internalID, messageID)
+}
+
+// recordHistory adds a delivery to the history, if one is kept
+func (ep *EmailProcessor) recordHistory(email *ProcessedEmail, platform, userID string, options DestinationOptions, receipt *DeliveryReceipt, err error) {
+	if ep.History == nil {
+		return
+	}
+
+	entry := HistoryEntry{
+		Time:        time.Now(),
+		From:        email.From,
+		Subject:     email.Subject,
+		Severity:    email.Severity,
+		Platform:    platform,
+		Destination: userID,
+		Bot:         options.Get("bot"),
+		Chat:        userID,
+		MessageID:   receipt.MessageID,
+		Outcome:     HistorySent,
+		LatencyMS:   receipt.Latency.Milliseconds(),
+	}
+	if !email.BodyHTML {
+		entry.Summary = historySummary(email.Body)
+	}
+	if err != nil {
+		entry.Outcome = HistoryFailed
+		entry.Error = err.Error()
+	}
+	switch platform {
+	case "telegram":
+		entry.Chat = ep.telegramChatID(userID)
+	case "slack":
+		entry.Chat = ep.slackHistoryChat(userID)
+	}
+	ep.History.Record(entry)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// History Export Formats
+const (
+	HistoryExportCSV  = "csv"
+	HistoryExportJSON = "json"
+)
+
+// historyExportColumns are the CSV columns, one delivery per row
+var historyExportColumns = []string{"time", "from", "subject", "severity", "platform", "destination", "bot", "outcome", "error", "latency_ms"}
+
+// historyRange selects deliveries from since (inclusive) until (exclusive); zero times are open
+type historyRange struct {
+	since, until time.Time
+}
+
+// contains reports whether a delivery time falls in the range
+func (r historyRange) contains(t time.Time) bool {
+	return (r.since.IsZero() || !t.Before(r.since)) && (r.until.IsZero() || t.Before(r.until))
+}
+
+// parseHistoryTime accepts an RFC 3339 time or a YYYY-MM-DD date, taken as midnight UTC
+func parseHistoryTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid %s '%s': use YYYY-MM-DD or an RFC 3339 time such as 2026-10-01T00:00:00Z", name, value)
+}
+
+// parseHistoryRange parses the since and until bounds of an export
+func parseHistoryRange(since, until string) (historyRange, error) {
+	var r historyRange
+	var err error
+	if r.since, err = parseHistoryTime("since", since); err != nil {
+		return r, err
+	}
+	if r.until, err = parseHistoryTime("until", until); err != nil {
+		return r, err
+	}
+	if !r.since.IsZero() && !r.until.IsZero() && !r.since.Before(r.until) {
+		return r, errors.New("since must be before until")
+	}
+	return r, nil
+}
+
+// parseHistoryFormat validates an export format, CSV by default
+func parseHistoryFormat(value string) (string, error) {
+	switch value {
+	case "", HistoryExportCSV:
+		return HistoryExportCSV, nil
+	case HistoryExportJSON:
+		return HistoryExportJSON, nil
+	default:
+		return "", fmt.Errorf("invalid format '%s': use csv or json", value)
+	}
+}
+
+// readHistoryFile returns the deliveries in a HISTORY_FILE that fall in the range, oldest first.
+// A line cut short by a crash is skipped
+func readHistoryFile(path string, r historyRange) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if r.contains(entry.Time) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return entries, nil
+}
+
+// Export returns the deliveries in the range, oldest first: from the history file when there is
+// one, otherwise from the deliveries still kept in memory
+func (h *AlertHistory) Export(r historyRange) ([]HistoryEntry, error) {
+	if path := h.Path(); path != "" {
+		return readHistoryFile(path, r)
+	}
+	entries := h.Recent(0, func(entry *HistoryEntry) bool { return r.contains(entry.Time) })
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// writeHistoryExport writes deliveries as CSV with a header row, or as a JSON array
+func writeHistoryExport(w io.Writer, format string, entries []HistoryEntry) error {
+	if format == HistoryExportJSON {
+		if entries == nil {
+			entries = []HistoryEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(historyExportColumns)
+	for _, entry := range entries {
+		writer.Write([]string{
+			entry.Time.UTC().Format(time.RFC3339),
+			entry.From,
+			entry.Subject,
+			string(entry.Severity),
+			entry.Platform,
+			entry.Destination,
+			entry.Bot,
+			entry.Outcome,
+			entry.Error,
+			strconv.FormatInt(entry.LatencyMS, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runHistoryExport writes the deliveries recorded in HISTORY_FILE for a time range to stdout
+func runHistoryExport(args []string) error {
+	flags := flag.NewFlagSet("history-export", flag.ContinueOnError)
+	since := flags.String("since", "", "first day or time to export, e.g. 2026-10-01 (default: the start of the file)")
+	until := flags.String("until", "", "day or time to stop before, e.g. 2026-11-01 (default: now)")
+	format := flags.String("format", HistoryExportCSV, "csv or json")
+	path := flags.String("file", os.Getenv("HISTORY_FILE"), "history file to read (default: HISTORY_FILE)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("HISTORY_FILE is not set: pass -file or export through the admin API")
+	}
+
+	r, err := parseHistoryRange(*since, *until)
+	if err != nil {
+		return err
+	}
+	exportFormat, err := parseHistoryFormat(*format)
+	if err != nil {
+		return err
+	}
+	entries, err := readHistoryFile(*path, r)
+	if err != nil {
+		return err
+	}
+	return writeHistoryExport(os.Stdout, exportFormat, entries)
+}
@@ -0,0 +1,285 @@
+//go:build !minimal && !nohttpplatforms
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Custom HTTP Platform Configuration
+const (
+	DefaultHTTPPlatformMethod  = "POST"
+	DefaultHTTPPlatformBody    = `{"text": {{json .Message}}}`
+	DefaultHTTPPlatformSuccess = "2xx"
+	HTTPPlatformMaxResponse    = 4096 // Bytes of a failed response kept for error messages
+)
+
+// httpPlatformNamePattern restricts platform names to domains that map to environment variable names
+var httpPlatformNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// HTTPPlatform is an operator-defined platform delivered with one HTTP request per message
+type HTTPPlatform struct {
+	Name        string
+	URL         *template.Template
+	Method      string
+	Headers     http.Header
+	Body        *template.Template
+	Success     []statusRange // Response statuses that mean delivered
+	SuccessBody string        // Text a successful response must contain; "" accepts any body
+	MaxChars    int           // Longer messages are split; 0 sends them whole
+	HTTPClient  *http.Client
+}
+
+// HTTPPlatformData is the data available to URL and body templates
+type HTTPPlatformData struct {
+	TitleData
+	Message string // Rendered plain-text message, or one part of it
+	Body    string // Decoded email body
+	Part    int    // Number of this part, starting at 1
+	Parts   int    // Number of parts the message was split into
+}
+
+// statusRange is an inclusive range of HTTP status codes
+type statusRange struct {
+	min, max int
+}
+
+// httpPlatformFuncs are the functions available to templates in addition to text/template's builtins
+var httpPlatformFuncs = template.FuncMap{
+	// json renders a value as a JSON literal, quotes included
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// parseHTTPPlatforms reads HTTP_PLATFORMS and the HTTP_PLATFORM_<NAME>_* variables of each platform
+func parseHTTPPlatforms() (map[string]*HTTPPlatform, error) {
+	platforms := make(map[string]*HTTPPlatform)
+
+	for _, name := range strings.Split(os.Getenv("HTTP_PLATFORMS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !httpPlatformNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid HTTP_PLATFORMS name '%s': use lowercase letters, digits, '-' and '_'", name)
+		}
+		if builtinPlatform(name) {
+			return nil, fmt.Errorf("invalid HTTP_PLATFORMS name '%s': it is a built-in platform", name)
+		}
+
+		platform, err := parseHTTPPlatform(name)
+		if err != nil {
+			return nil, err
+		}
+		platforms[name] = platform
+	}
+
+	return platforms, nil
+}
+
+// parseHTTPPlatform reads the definition of one custom platform
+func parseHTTPPlatform(name string) (*HTTPPlatform, error) {
+	prefix := httpPlatformPrefix(name)
+	platform := &HTTPPlatform{
+		Name:       name,
+		Method:     DefaultHTTPPlatformMethod,
+		Headers:    make(http.Header),
+		HTTPClient: &http.Client{Timeout: HTTPRequestTimeout},
+	}
+
+	urlText := os.Getenv(prefix + "URL")
+	if urlText == "" {
+		return nil, fmt.Errorf("%sURL is required for HTTP platform %s", prefix, name)
+	}
+	var err error
+	if platform.URL, err = parseHTTPPlatformTemplate(prefix+"URL", urlText); err != nil {
+		return nil, err
+	}
+
+	if value := os.Getenv(prefix + "METHOD"); value != "" {
+		platform.Method = strings.ToUpper(value)
+	}
+
+	// Headers are "Name: value" pairs separated by semicolons
+	for _, header := range strings.Split(os.Getenv(prefix+"HEADERS"), ";") {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(header, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid %sHEADERS entry '%s': use Name: value", prefix, header)
+		}
+		platform.Headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	if platform.Headers.Get("Content-Type") == "" {
+		platform.Headers.Set("Content-Type", "application/json")
+	}
+
+	bodyText := os.Getenv(prefix + "BODY")
+	if bodyText == "" {
+		bodyText = DefaultHTTPPlatformBody
+	}
+	if platform.Body, err = parseHTTPPlatformTemplate(prefix+"BODY", bodyText); err != nil {
+		return nil, err
+	}
+
+	success := os.Getenv(prefix + "SUCCESS_STATUS")
+	if success == "" {
+		success = DefaultHTTPPlatformSuccess
+	}
+	if platform.Success, err = parseStatusRanges(success); err != nil {
+		return nil, fmt.Errorf("invalid %sSUCCESS_STATUS '%s': %w", prefix, success, err)
+	}
+	platform.SuccessBody = os.Getenv(prefix + "SUCCESS_BODY")
+
+	if value := os.Getenv(prefix + "MAX_CHARS"); value != "" {
+		maxChars, err := strconv.Atoi(value)
+		if err != nil || maxChars < MinMessageBudgetChars {
+			return nil, fmt.Errorf("invalid %sMAX_CHARS '%s': use at least %d characters", prefix, value, MinMessageBudgetChars)
+		}
+		platform.MaxChars = maxChars
+	}
+
+	if value := os.Getenv(prefix + "TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid %sTIMEOUT '%s': use a duration such as 30s", prefix, value)
+		}
+		platform.HTTPClient.Timeout = timeout
+	}
+
+	log.Printf("Custom HTTP platform %s enabled (%s %s)", name, platform.Method, strings.SplitN(urlText, "?", 2)[0])
+	return platform, nil
+}
+
+// httpPlatformPrefix returns the environment variable prefix of a custom platform, e.g. HTTP_PLATFORM_ROCKET_CHAT_
+func httpPlatformPrefix(name string) string {
+	return "HTTP_PLATFORM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// parseHTTPPlatformTemplate parses a template and checks it against empty data, so typos fail at startup
+func parseHTTPPlatformTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(httpPlatformFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if err := tmpl.Execute(io.Discard, HTTPPlatformData{}); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// parseStatusRanges parses a comma-separated list of status codes and classes such as "200,202,3xx"
+func parseStatusRanges(value string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if len(item) == 3 && strings.HasSuffix(item, "xx") && item[0] >= '1' && item[0] <= '5' {
+			class := int(item[0]-'0') * 100
+			ranges = append(ranges, statusRange{class, class + 99})
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("'%s' is not a status code or class such as 2xx", item)
+		}
+		ranges = append(ranges, statusRange{code, code})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status codes given")
+	}
+	return ranges, nil
+}
+
+// succeeded applies the platform's success predicate to a response
+func (p *HTTPPlatform) succeeded(status int, body []byte) bool {
+	for _, r := range p.Success {
+		if status >= r.min && status <= r.max {
+			return p.SuccessBody == "" || bytes.Contains(body, []byte(p.SuccessBody))
+		}
+	}
+	return false
+}
+
+// Send delivers the message, split into parts when it exceeds the platform's limit
+func (p *HTTPPlatform) Send(ctx context.Context, data HTTPPlatformData) error {
+	parts := []string{data.Message}
+	if p.MaxChars > 0 {
+		parts = chunkForDestination(ctx, data.Message, p.MaxChars)
+	}
+
+	for i, part := range parts {
+		data.Message, data.Part, data.Parts = part, i+1, len(parts)
+		if err := p.sendPart(ctx, data); err != nil {
+			if len(parts) > 1 {
+				return fmt.Errorf("failed to send part %d/%d to %s: %w", i+1, len(parts), p.Name, err)
+			}
+			return err
+		}
+		deliveryReceiptFrom(ctx).recordMessage("")
+	}
+
+	log.Printf("Message sent successfully to %s %s in %d part(s)", p.Name, data.ID, len(parts))
+	return nil
+}
+
+// sendPart renders and performs the request for one part of a message
+func (p *HTTPPlatform) sendPart(ctx context.Context, data HTTPPlatformData) error {
+	var url, body strings.Builder
+	if err := p.URL.Execute(&url, data); err != nil {
+		return fmt.Errorf("failed to render %s URL: %w", p.Name, err)
+	}
+	if err := p.Body.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render %s body: %w", p.Name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.Method, strings.TrimSpace(url.String()), strings.NewReader(body.String()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = p.Headers.Clone()
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, HTTPPlatformMaxResponse))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if !p.succeeded(resp.StatusCode, respBody) {
+		return fmt.Errorf("%s API error: %d - %s", p.Name, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// httpPlatformData collects the template data of an email delivered to a custom platform
+func (ep *EmailProcessor) httpPlatformData(email *ProcessedEmail, message, platform, userID string) HTTPPlatformData {
+	return HTTPPlatformData{
+		TitleData: ep.templateData(email, platform, userID),
+		Message:   message,
+		Body:      email.Body,
+		Part:      1,
+		Parts:     1,
+	}
+}
@@ -0,0 +1,37 @@
+//go:build minimal || nohttpplatforms
+
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+func init() {
+	excludeFeature("custom HTTP platform", "nohttpplatforms")
+}
+
+// HTTPPlatform is a placeholder for builds without custom HTTP platforms
+type HTTPPlatform struct{}
+
+// HTTPPlatformData is the data handed to a custom HTTP platform
+type HTTPPlatformData struct{}
+
+// parseHTTPPlatforms rejects HTTP_PLATFORMS in builds without custom HTTP platforms
+func parseHTTPPlatforms() (map[string]*HTTPPlatform, error) {
+	if strings.TrimSpace(os.Getenv("HTTP_PLATFORMS")) != "" {
+		return nil, requireFeature("custom HTTP platform")
+	}
+	return nil, nil
+}
+
+// Send reports that custom HTTP platforms were compiled out
+func (p *HTTPPlatform) Send(ctx context.Context, data HTTPPlatformData) error {
+	return requireFeature("custom HTTP platform")
+}
+
+// httpPlatformData is unused without custom HTTP platforms
+func (ep *EmailProcessor) httpPlatformData(email *ProcessedEmail, message, platform, userID string) HTTPPlatformData {
+	return HTTPPlatformData{}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP Policy Configuration
+const (
+	DefaultHTTPRetryBackoff = 1 * time.Second
+	MaxHTTPRetryBackoff     = 60 * time.Second
+)
+
+// httpPolicyPlatforms lists the clients whose HTTP behaviour can be tuned with <PLATFORM>_HTTP_* variables
+var httpPolicyPlatforms = []string{"telegram", "slack", "dingtalk", "wecom", "mastodon", "whatsapp", "zoom", "victorops"}
+
+// HTTPPolicy holds the outbound HTTP settings of one platform client.
+// A zero Timeout keeps the client's built-in default
+type HTTPPolicy struct {
+	Timeout time.Duration // Whole-request timeout, including reading the response
+	Retries int           // Extra attempts after a network error or 5xx response
+	Backoff time.Duration // Wait before the first retry, doubled for each further retry
+}
+
+// parseHTTPPolicies reads <PLATFORM>_HTTP_TIMEOUT, <PLATFORM>_HTTP_RETRIES and <PLATFORM>_HTTP_BACKOFF
+func parseHTTPPolicies() (map[string]HTTPPolicy, error) {
+	policies := make(map[string]HTTPPolicy)
+
+	for _, platform := range httpPolicyPlatforms {
+		prefix := strings.ToUpper(platform) + "_HTTP_"
+		policy := HTTPPolicy{Backoff: DefaultHTTPRetryBackoff}
+
+		if value := os.Getenv(prefix + "TIMEOUT"); value != "" {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid %sTIMEOUT '%s': use a duration such as 30s", prefix, value)
+			}
+			policy.Timeout = timeout
+		}
+
+		if value := os.Getenv(prefix + "RETRIES"); value != "" {
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				return nil, fmt.Errorf("invalid %sRETRIES '%s': must be zero or a positive integer", prefix, value)
+			}
+			policy.Retries = retries
+		}
+
+		if value := os.Getenv(prefix + "BACKOFF"); value != "" {
+			backoff, err := time.ParseDuration(value)
+			if err != nil || backoff < 0 {
+				return nil, fmt.Errorf("invalid %sBACKOFF '%s': use a duration such as 2s", prefix, value)
+			}
+			policy.Backoff = backoff
+		}
+
+		policies[platform] = policy
+	}
+
+	return policies, nil
+}
+
+// Apply configures an HTTP client according to the policy
+func (p HTTPPolicy) Apply(client *http.Client) {
+	if p.Timeout > 0 {
+		client.Timeout = p.Timeout
+	}
+	if p.Retries > 0 {
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		// The client timeout would span all attempts, so it moves into the transport per attempt
+		client.Transport = &retryTransport{
+			Transport: transport,
+			Timeout:   client.Timeout,
+			Retries:   p.Retries,
+			Backoff:   p.Backoff,
+		}
+		client.Timeout = 0
+	}
+}
+
+// retryTransport retries requests that failed in the network or with a server error.
+// Requests built from in-memory bodies can be replayed through GetBody
+type retryTransport struct {
+	Transport http.RoundTripper
+	Timeout   time.Duration // Per-attempt timeout, including reading the response body
+	Retries   int
+	Backoff   time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := rt.Backoff
+
+	for attempt := 0; ; attempt++ {
+		resp, err := rt.attempt(req)
+
+		retryable := err != nil || resp.StatusCode >= 500
+		if !retryable || attempt >= rt.Retries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("HTTP request to %s failed (attempt %d/%d), retrying in %s: %v", req.URL.Host, attempt+1, rt.Retries+1, backoff, err)
+		} else {
+			log.Printf("HTTP request to %s returned %d (attempt %d/%d), retrying in %s", req.URL.Host, resp.StatusCode, attempt+1, rt.Retries+1, backoff)
+			resp.Body.Close()
+		}
+		deliveryReceiptFrom(req.Context()).recordRetry()
+
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		backoff *= 2
+		if backoff > MaxHTTPRetryBackoff {
+			backoff = MaxHTTPRetryBackoff
+		}
+	}
+}
+
+// attempt performs a single request bounded by the per-attempt timeout
+func (rt *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if rt.Timeout <= 0 {
+		return rt.Transport.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), rt.Timeout)
+	resp, err := rt.Transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Keep the deadline running until the caller has read the body
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnCloseBody releases the attempt's context once the response body is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// builtinPlatform reports whether a domain is handled by a built-in client
+func builtinPlatform(name string) bool {
+	if name == "redis" {
+		return true
+	}
+	for _, platform := range httpPolicyPlatforms {
+		if name == platform {
+			return true
+		}
+	}
+	return false
+}
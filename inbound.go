@@ -0,0 +1,489 @@
+//go:build !minimal && !noinbound
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Inbound Webhook Configuration
+const (
+	InboundReadTimeout       = 30 * time.Second
+	InboundWriteTimeout      = 60 * time.Second // Leaves room for slow platform APIs
+	InboundHTTPClientTimeout = 10 * time.Second
+	MailgunMaxTimestampSkew  = 15 * time.Minute
+	SESPath                  = "/inbound/ses"
+	MailgunPath              = "/inbound/mailgun/mime"
+)
+
+// snsCertHostPattern only allows signing certificates served by SNS itself
+var snsCertHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSMessage is the envelope of every Amazon SNS HTTP(S) delivery
+type SNSMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+// SESNotification is the SES receipt notification carried in SNSMessage.Message
+type SESNotification struct {
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		Source      string   `json:"source"`
+		Destination []string `json:"destination"`
+	} `json:"mail"`
+	Receipt struct {
+		Recipients []string `json:"recipients"`
+		Action     struct {
+			Type     string `json:"type"`
+			Encoding string `json:"encoding"`
+		} `json:"action"`
+	} `json:"receipt"`
+	Content string `json:"content"`
+}
+
+// InboundServer accepts mail received by cloud providers over HTTP webhooks
+type InboundServer struct {
+	server            *http.Server
+	emailProcessor    *EmailProcessor
+	listenAddr        string
+	mailgunSigningKey string
+	snsTopicARNs      map[string]bool
+	httpClient        *http.Client
+
+	certMutex sync.Mutex
+	certCache map[string]*x509.Certificate
+
+	tokenMutex    sync.Mutex
+	mailgunTokens map[string]time.Time // Tokens seen, until their timestamp leaves the accepted window
+}
+
+// NewInboundServer creates a new webhook server; endpoints are only registered for configured providers
+func NewInboundServer(emailProcessor *EmailProcessor, listenAddr, mailgunSigningKey string, snsTopicARNs []string) *InboundServer {
+	is := &InboundServer{
+		emailProcessor:    emailProcessor,
+		listenAddr:        listenAddr,
+		mailgunSigningKey: mailgunSigningKey,
+		snsTopicARNs:      make(map[string]bool),
+		httpClient: &http.Client{
+			Timeout: InboundHTTPClientTimeout,
+		},
+		certCache:     make(map[string]*x509.Certificate),
+		mailgunTokens: make(map[string]time.Time),
+	}
+
+	mux := http.NewServeMux()
+	if len(snsTopicARNs) > 0 {
+		for _, arn := range snsTopicARNs {
+			is.snsTopicARNs[arn] = true
+		}
+		mux.HandleFunc(SESPath, is.handleSES)
+		log.Printf("SES inbound webhook enabled on %s for %d SNS topic(s)", SESPath, len(snsTopicARNs))
+	}
+	if mailgunSigningKey != "" {
+		mux.HandleFunc(MailgunPath, is.handleMailgun)
+		log.Printf("Mailgun inbound webhook enabled on %s", MailgunPath)
+	}
+
+	is.server = &http.Server{
+		Addr:         listenAddr,
+		Handler:      mux,
+		ReadTimeout:  InboundReadTimeout,
+		WriteTimeout: InboundWriteTimeout,
+	}
+	return is
+}
+
+// Start starts the webhook server
+func (is *InboundServer) Start() error {
+	log.Printf("Starting inbound webhook server on %s", is.listenAddr)
+	err := is.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop stops the webhook server, letting in-flight deliveries finish
+func (is *InboundServer) Stop() error {
+	log.Println("Stopping inbound webhook server...")
+	ctx, cancel := context.WithTimeout(context.Background(), InboundWriteTimeout)
+	defer cancel()
+	return is.server.Shutdown(ctx)
+}
+
+// maxRequestBytes bounds webhook bodies; base64 and form encoding add up to a third to the message size
+func (is *InboundServer) maxRequestBytes() int64 {
+	return int64(is.emailProcessor.parseLimits().MaxParseBytes) * 4 / 3
+}
+
+// handleSES processes Amazon SNS deliveries of SES receipt notifications
+func (is *InboundServer) handleSES(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, is.maxRequestBytes()))
+	if err != nil {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var message SNSMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		http.Error(w, "invalid SNS message", http.StatusBadRequest)
+		return
+	}
+
+	if !is.snsTopicARNs[message.TopicArn] {
+		log.Printf("Rejected SNS message from unexpected topic %s (remote: %s)", message.TopicArn, r.RemoteAddr)
+		http.Error(w, "unknown topic", http.StatusForbidden)
+		return
+	}
+
+	if err := is.verifySNSMessage(&message); err != nil {
+		log.Printf("Rejected SNS message %s: %v", message.MessageID, err)
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	switch message.Type {
+	case "SubscriptionConfirmation":
+		if err := is.confirmSNSSubscription(&message); err != nil {
+			log.Printf("Failed to confirm SNS subscription for %s: %v", message.TopicArn, err)
+			http.Error(w, "subscription confirmation failed", http.StatusBadGateway)
+			return
+		}
+		log.Printf("Confirmed SNS subscription for %s", message.TopicArn)
+
+	case "Notification":
+		data, from, to, err := is.decodeSESNotification(message.Message)
+		if err != nil {
+			// Retrying will not fix the notification, so acknowledge it
+			log.Printf("Dropping SES notification %s: %v", message.MessageID, err)
+			break
+		}
+
+		if err := is.emailProcessor.ProcessEmail(data, from, to, r.RemoteAddr); err != nil {
+			log.Printf("Error processing SES message %s: %v", message.MessageID, err)
+			if !isPermanentProcessingError(err) && !isPartialDelivery(err) {
+				// SNS redelivers according to the topic's delivery policy
+				http.Error(w, "delivery failed", http.StatusInternalServerError)
+				return
+			}
+		}
+
+	case "UnsubscribeConfirmation":
+		log.Printf("SNS subscription for %s was removed", message.TopicArn)
+
+	default:
+		http.Error(w, "unsupported SNS message type", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// decodeSESNotification extracts the raw message and envelope from an SES receipt notification
+func (is *InboundServer) decodeSESNotification(payload string) ([]byte, string, []string, error) {
+	var notification SESNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		return nil, "", nil, fmt.Errorf("invalid SES notification: %w", err)
+	}
+
+	if notification.NotificationType != "Received" {
+		return nil, "", nil, fmt.Errorf("unsupported notification type %s", notification.NotificationType)
+	}
+	if notification.Content == "" {
+		return nil, "", nil, fmt.Errorf("notification has no content; use an SNS receipt rule action")
+	}
+
+	data := []byte(notification.Content)
+	if strings.EqualFold(notification.Receipt.Action.Encoding, "BASE64") {
+		decoded, err := base64.StdEncoding.DecodeString(notification.Content)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to decode content: %w", err)
+		}
+		data = decoded
+	}
+
+	// Receipt recipients are the addresses the rule matched; destination is the full header list
+	recipients := notification.Receipt.Recipients
+	if len(recipients) == 0 {
+		recipients = notification.Mail.Destination
+	}
+
+	return data, notification.Mail.Source, recipients, nil
+}
+
+// verifySNSMessage checks the message signature against the SNS signing certificate
+func (is *InboundServer) verifySNSMessage(message *SNSMessage) error {
+	var hash crypto.Hash
+	switch message.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version %s", message.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	cert, err := is.snsSigningCert(message.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("signing certificate does not hold an RSA key")
+	}
+
+	// The signed string lists a fixed set of fields per message type, in this order
+	keys := []string{"Message", "MessageId", "SubscribeURL", "Timestamp", "Token", "TopicArn", "Type"}
+	if message.Type == "Notification" {
+		keys = []string{"Message", "MessageId", "Subject", "Timestamp", "TopicArn", "Type"}
+	}
+	values := map[string]string{
+		"Message":      message.Message,
+		"MessageId":    message.MessageID,
+		"Subject":      message.Subject,
+		"SubscribeURL": message.SubscribeURL,
+		"Timestamp":    message.Timestamp,
+		"Token":        message.Token,
+		"TopicArn":     message.TopicArn,
+		"Type":         message.Type,
+	}
+
+	var signed strings.Builder
+	for _, key := range keys {
+		// Subject is only signed when the notification has one
+		if key == "Subject" && values[key] == "" {
+			continue
+		}
+		signed.WriteString(key + "\n" + values[key] + "\n")
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(signed.String()))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(signed.String()))
+		digest = sum[:]
+	}
+
+	if err := rsa.VerifyPKCS1v15(publicKey, hash, digest, signature); err != nil {
+		return fmt.Errorf("signature mismatch: %w", err)
+	}
+	return nil
+}
+
+// snsSigningCert downloads and caches the signing certificate, refusing hosts other than SNS
+func (is *InboundServer) snsSigningCert(certURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !snsCertHostPattern.MatchString(u.Hostname()) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, fmt.Errorf("untrusted signing certificate URL %s", certURL)
+	}
+
+	is.certMutex.Lock()
+	defer is.certMutex.Unlock()
+
+	if cert, exists := is.certCache[certURL]; exists {
+		return cert, nil
+	}
+
+	resp, err := is.httpClient.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %d", resp.StatusCode)
+	}
+
+	pemData, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("signing certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+
+	is.certCache[certURL] = cert
+	return cert, nil
+}
+
+// confirmSNSSubscription visits the SubscribeURL so SNS starts delivering notifications
+func (is *InboundServer) confirmSNSSubscription(message *SNSMessage) error {
+	u, err := url.Parse(message.SubscribeURL)
+	if err != nil || u.Scheme != "https" || !snsCertHostPattern.MatchString(u.Hostname()) {
+		return fmt.Errorf("untrusted SubscribeURL %s", message.SubscribeURL)
+	}
+
+	resp, err := is.httpClient.Get(message.SubscribeURL)
+	if err != nil {
+		return fmt.Errorf("failed to confirm subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("SNS API error: %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// handleMailgun processes Mailgun inbound routes that forward the raw MIME message
+// (a forward() action to a URL ending in "mime")
+func (is *InboundServer) handleMailgun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, is.maxRequestBytes())
+	if err := r.ParseMultipartForm(int64(is.emailProcessor.parseLimits().MaxParseBytes)); err != nil {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := is.verifyMailgunSignature(r.FormValue("timestamp"), r.FormValue("token"), r.FormValue("signature")); err != nil {
+		log.Printf("Rejected Mailgun webhook from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	data := r.FormValue("body-mime")
+	if data == "" {
+		// Mailgun treats 406 as a permanent rejection and stops retrying
+		log.Printf("Mailgun webhook without body-mime; route must forward to a URL ending in \"mime\"")
+		http.Error(w, "missing body-mime", http.StatusNotAcceptable)
+		return
+	}
+
+	var to []string
+	for _, recipient := range strings.Split(r.FormValue("recipient"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			to = append(to, recipient)
+		}
+	}
+
+	if err := is.emailProcessor.ProcessEmail([]byte(data), r.FormValue("sender"), to, r.RemoteAddr); err != nil && !isPartialDelivery(err) {
+		log.Printf("Error processing Mailgun message: %v", err)
+		if isPermanentProcessingError(err) {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+		// Mailgun may retry with the same signature, so the token must be accepted once more
+		is.releaseMailgunToken(r.FormValue("token"))
+		http.Error(w, "delivery failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// releaseMailgunToken forgets a token whose message was not delivered, so its retry is accepted
+func (is *InboundServer) releaseMailgunToken(token string) {
+	is.tokenMutex.Lock()
+	defer is.tokenMutex.Unlock()
+	delete(is.mailgunTokens, token)
+}
+
+// verifyMailgunSignature checks the HMAC Mailgun computes over timestamp and token with the signing key
+func (is *InboundServer) verifyMailgunSignature(timestamp, token, signature string) error {
+	if timestamp == "" || token == "" || signature == "" {
+		return fmt.Errorf("missing signature fields")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > MailgunMaxTimestampSkew || skew < -MailgunMaxTimestampSkew {
+		return fmt.Errorf("timestamp outside the accepted window")
+	}
+
+	mac := hmac.New(sha256.New, []byte(is.mailgunSigningKey))
+	mac.Write([]byte(timestamp + token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	// A captured request stays valid for the whole window, so each token is accepted only once
+	is.tokenMutex.Lock()
+	defer is.tokenMutex.Unlock()
+	now := time.Now()
+	for seen, expires := range is.mailgunTokens {
+		if now.After(expires) {
+			delete(is.mailgunTokens, seen)
+		}
+	}
+	if _, seen := is.mailgunTokens[token]; seen {
+		return fmt.Errorf("token already used")
+	}
+	is.mailgunTokens[token] = time.Unix(seconds, 0).Add(MailgunMaxTimestampSkew)
+	return nil
+}
+
+// isPermanentProcessingError reports whether redelivering the message could never succeed
+func isPermanentProcessingError(err error) bool {
+	return errors.Is(err, ErrInvalidDestination) || errors.Is(err, ErrParseLimitExceeded)
+}
+
+// isPartialDelivery reports whether some recipients got the message, so it must not be redelivered
+func isPartialDelivery(err error) bool {
+	var partialErr *PartialDeliveryError
+	return errors.As(err, &partialErr)
+}
+
+// GetServerAddress returns the webhook server address
+func (is *InboundServer) GetServerAddress() string {
+	return is.listenAddr
+}
@@ -0,0 +1,25 @@
+//go:build minimal || noinbound
+
+package main
+
+func init() {
+	excludeFeature("inbound webhook", "noinbound")
+}
+
+// InboundServer is a placeholder for builds without the inbound webhook server
+type InboundServer struct{}
+
+// NewInboundServer creates a placeholder server that never starts
+func NewInboundServer(emailProcessor *EmailProcessor, listenAddr, mailgunSigningKey string, snsTopicARNs []string) *InboundServer {
+	return &InboundServer{}
+}
+
+// Start reports that the inbound webhook server was compiled out
+func (is *InboundServer) Start() error {
+	return requireFeature("inbound webhook")
+}
+
+// Stop does nothing without the inbound webhook server
+func (is *InboundServer) Stop() error {
+	return nil
+}
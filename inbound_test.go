@@ -0,0 +1,209 @@
+//go:build !minimal && !noinbound
+
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSNSCertURL is where the test signing certificate is cached, so it is never fetched
+const testSNSCertURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+
+// newSNSTestServer returns a server trusting a fresh signing certificate, and its private key
+func newSNSTestServer(t *testing.T) (*InboundServer, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := NewInboundServer(nil, "127.0.0.1:0", "", []string{"arn:aws:sns:us-east-1:123456789012:inbound"})
+	is.certCache[testSNSCertURL] = cert
+	return is, key
+}
+
+// signSNSMessage signs the message as SNS does, over the fields of its type
+func signSNSMessage(t *testing.T, key *rsa.PrivateKey, message *SNSMessage) {
+	t.Helper()
+	fields := [][2]string{
+		{"Message", message.Message}, {"MessageId", message.MessageID}, {"SubscribeURL", message.SubscribeURL},
+		{"Timestamp", message.Timestamp}, {"Token", message.Token}, {"TopicArn", message.TopicArn}, {"Type", message.Type},
+	}
+	if message.Type == "Notification" {
+		fields = [][2]string{
+			{"Message", message.Message}, {"MessageId", message.MessageID}, {"Subject", message.Subject},
+			{"Timestamp", message.Timestamp}, {"TopicArn", message.TopicArn}, {"Type", message.Type},
+		}
+	}
+	var signed strings.Builder
+	for _, field := range fields {
+		if field[0] == "Subject" && field[1] == "" {
+			continue
+		}
+		signed.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+
+	hash := crypto.SHA256
+	var digest []byte
+	if message.SignatureVersion == "1" {
+		sum := sha1.Sum([]byte(signed.String()))
+		hash, digest = crypto.SHA1, sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(signed.String()))
+		digest = sum[:]
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestVerifySNSMessage(t *testing.T) {
+	is, key := newSNSTestServer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notification := func() *SNSMessage {
+		return &SNSMessage{
+			Type:             "Notification",
+			MessageID:        "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+			TopicArn:         "arn:aws:sns:us-east-1:123456789012:inbound",
+			Subject:          "Amazon SES Email Receipt Notification",
+			Message:          `{"notificationType":"Received"}`,
+			Timestamp:        "2026-10-17T12:00:00.000Z",
+			SignatureVersion: "2",
+			SigningCertURL:   testSNSCertURL,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		message func() *SNSMessage
+		signer  *rsa.PrivateKey
+		tamper  func(*SNSMessage)
+		wantErr string
+	}{
+		{"version 2", notification, key, nil, ""},
+		{"version 1", func() *SNSMessage { m := notification(); m.SignatureVersion = "1"; return m }, key, nil, ""},
+		{"without subject", func() *SNSMessage { m := notification(); m.Subject = ""; return m }, key, nil, ""},
+		{"subscription confirmation", func() *SNSMessage {
+			m := notification()
+			m.Type, m.Subject, m.Token = "SubscriptionConfirmation", "", "2336412f37fb687f5d51e6e2425f004ae"
+			m.SubscribeURL = "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=2336412f37fb687f5d51e6e2425f004ae"
+			return m
+		}, key, nil, ""},
+		{"message changed", notification, key, func(m *SNSMessage) { m.Message = `{"notificationType":"Bounce"}` }, "signature mismatch"},
+		{"subject changed", notification, key, func(m *SNSMessage) { m.Subject = "Other" }, "signature mismatch"},
+		{"topic changed", notification, key, func(m *SNSMessage) { m.TopicArn += "2" }, "signature mismatch"},
+		{"version downgraded", notification, key, func(m *SNSMessage) { m.SignatureVersion = "1" }, "signature mismatch"},
+		{"other key", notification, otherKey, nil, "signature mismatch"},
+		{"unknown version", notification, key, func(m *SNSMessage) { m.SignatureVersion = "3" }, "unsupported signature version 3"},
+		{"signature not base64", notification, key, func(m *SNSMessage) { m.Signature = "%%%" }, "invalid signature encoding"},
+		{"certificate elsewhere", notification, key, func(m *SNSMessage) { m.SigningCertURL = "https://example.com/cert.pem" }, "untrusted signing certificate URL"},
+		{"certificate over http", notification, key, func(m *SNSMessage) {
+			m.SigningCertURL = strings.Replace(testSNSCertURL, "https:", "http:", 1)
+		}, "untrusted signing certificate URL"},
+		{"lookalike certificate host", notification, key, func(m *SNSMessage) {
+			m.SigningCertURL = "https://sns.us-east-1.amazonaws.com.example.com/cert.pem"
+		}, "untrusted signing certificate URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message()
+			signSNSMessage(t, tt.signer, message)
+			if tt.tamper != nil {
+				tt.tamper(message)
+			}
+			err := is.verifySNSMessage(message)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifySNSMessage() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("verifySNSMessage() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyMailgunSignature(t *testing.T) {
+	const signingKey = "key-test"
+	is := NewInboundServer(nil, "127.0.0.1:0", signingKey, nil)
+	sign := func(key, timestamp, token string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(timestamp + token))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-MailgunMaxTimestampSkew-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(MailgunMaxTimestampSkew+time.Minute).Unix(), 10)
+	token := "c1f9a1d0e2b34f5a8e6d7c8b9a0f1e2d3c4b5a69788f7e6d5c"
+
+	tests := []struct {
+		name      string
+		timestamp string
+		token     string
+		signature string
+		wantErr   string
+	}{
+		{"valid", now, token, sign(signingKey, now, token), ""},
+		{"uppercase signature", now, token + "1", strings.ToUpper(sign(signingKey, now, token+"1")), ""},
+		{"token reused", now, token, sign(signingKey, now, token), "token already used"},
+		{"other key", now, token, sign("key-other", now, token), "signature mismatch"},
+		{"token changed", now, token + "0", sign(signingKey, now, token), "signature mismatch"},
+		{"timestamp moved into token", now[:5], now[5:] + token, sign(signingKey, now, token), "timestamp outside the accepted window"},
+		{"too old", old, token, sign(signingKey, old, token), "timestamp outside the accepted window"},
+		{"from the future", future, token, sign(signingKey, future, token), "timestamp outside the accepted window"},
+		{"timestamp not a number", "yesterday", token, sign(signingKey, "yesterday", token), "invalid timestamp"},
+		{"signature missing", now, token, "", "missing signature fields"},
+		{"token missing", now, "", sign(signingKey, now, ""), "missing signature fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := is.verifyMailgunSignature(tt.timestamp, tt.token, tt.signature)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyMailgunSignature() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("verifyMailgunSignature() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
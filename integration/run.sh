@@ -0,0 +1,111 @@
+#!/usr/bin/env bash
+
+# email2dm Integration Tests
+# Sends emails through the bridge running against the fake APIs of docker-compose.yml
+# and checks the API calls they produce. Needs docker compose and curl. The fakeapi image is
+# built with -tags fakeapi, the bridge image without it
+
+set -e
+
+cd "$(dirname "$0")"
+
+SMTP_URL="smtp://127.0.0.1:2525"
+FAKEAPI_URL="http://127.0.0.1:8081"
+FAILED=0
+
+cleanup() {
+    if [ -z "$KEEP_RUNNING" ]; then
+        docker compose down >/dev/null 2>&1
+    fi
+}
+trap cleanup EXIT
+
+docker compose up --build --detach
+
+# Wait for the SMTP server to accept connections
+for i in $(seq 1 30); do
+    if curl --silent --max-time 2 "$SMTP_URL" >/dev/null 2>&1; then
+        break
+    fi
+    sleep 1
+done
+
+# send_mail <recipient> <subject> <body>
+send_mail() {
+    printf 'From: CI <ci@example.com>\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n' "$1" "$2" "$3" |
+        curl --silent --show-error "$SMTP_URL" --mail-from ci@example.com --mail-rcpt "$1" --upload-file -
+}
+
+send_mail_quiet() {
+    send_mail "$1" "Recipient check" "marker-rcpt-body" 2>/dev/null
+}
+export SMTP_URL
+export -f send_mail send_mail_quiet
+
+# requests <platform> prints the calls recorded since the last reset
+requests() {
+    curl --silent "$FAKEAPI_URL/_fake/requests?platform=$1"
+}
+
+reset() {
+    curl --silent --request DELETE "$FAKEAPI_URL/_fake/requests"
+}
+
+# check <name> <condition...> reports whether the condition holds
+check() {
+    local name="$1"
+    shift
+    if "$@"; then
+        echo "PASS  $name"
+    else
+        echo "FAIL  $name"
+        FAILED=$((FAILED + 1))
+    fi
+}
+
+count() {
+    grep -o "\"method\":\"$2\"" <<<"$1" | wc -l
+}
+
+# Chunking: a body over Telegram's 4096 character limit arrives in several messages
+reset
+send_mail "123456789@telegram" "Chunking check" "$(yes 'marker-chunk-line with enough text to fill the message' | head -n 200)"
+sleep 2
+calls=$(requests telegram)
+check "telegram chunking" test "$(count "$calls" sendMessage)" -ge 3
+
+# Retries: a 429 is retried after retry_after and the message still arrives
+reset
+curl --silent --request POST "$FAKEAPI_URL/_fake/rate-limit?next=1"
+send_mail "123456789@telegram" "Retry check" "marker-retry-body"
+sleep 3
+calls=$(requests telegram)
+check "telegram retry after 429" grep -q '"status":429' <<<"$calls"
+check "telegram delivery after retry" grep -q '"status":200' <<<"$calls"
+
+reset
+curl --silent --request POST "$FAKEAPI_URL/_fake/rate-limit?next=1"
+send_mail "C0123456789@slack" "Slack retry check" "marker-slack-retry"
+sleep 3
+calls=$(requests slack)
+check "slack retry after 429" test "$(count "$calls" chat.postMessage)" -eq 2
+
+# Formatting: HTML special characters are escaped for Telegram and Slack
+reset
+send_mail "123456789@telegram" "a < b & c" "marker-format-body"
+send_mail "C0123456789@slack" "a < b & c" "marker-format-body"
+sleep 2
+check "telegram HTML escaping" grep -q 'a &lt; b &amp; c' <<<"$(requests telegram)"
+check "slack mrkdwn escaping" grep -q 'a &lt; b &amp; c' <<<"$(requests slack)"
+
+# Recipient verification: unknown chats and channels are refused at RCPT TO
+check "telegram unknown chat rejected" bash -c "! send_mail_quiet 404@telegram"
+check "slack unknown channel rejected" bash -c "! send_mail_quiet C404@slack"
+check "telegram known chat accepted" send_mail_quiet "123456789@telegram"
+
+if [ "$FAILED" -gt 0 ]; then
+    echo "$FAILED checks failed"
+    docker compose logs email2dm
+    exit 1
+fi
+echo "All checks passed"
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ParseLimits bounds the resources spent parsing a single message
+type ParseLimits struct {
+	MaxParseBytes  int   // Largest raw message accepted by the parser
+	MaxBodyBytes   int64 // Decoded text kept from the body
+	MaxMIMEDepth   int   // Nested multipart levels
+	MaxMIMEParts   int   // MIME parts across the whole tree
+	MaxHeaderBytes int   // Size of a single header section
+	MaxHeaderCount int   // Fields in a single header section
+}
+
+// DefaultParseLimits are used unless overridden through the environment
+var DefaultParseLimits = ParseLimits{
+	MaxParseBytes:  25 * 1024 * 1024,
+	MaxBodyBytes:   1024 * 1024,
+	MaxMIMEDepth:   10,
+	MaxMIMEParts:   100,
+	MaxHeaderBytes: 64 * 1024,
+	MaxHeaderCount: 200,
+}
+
+// ErrParseLimitExceeded is matched by every ParseLimitError
+var ErrParseLimitExceeded = errors.New("email exceeds parser limits")
+
+// ParseLimitError reports which parser limit a message exceeded and how to reject it
+type ParseLimitError struct {
+	Limit        string // Short limit name used in logs, e.g. "mime_depth"
+	Code         int    // SMTP reply code
+	EnhancedCode [3]int // RFC 3463 enhanced status code
+	Message      string
+}
+
+// Error implements the error interface
+func (e *ParseLimitError) Error() string {
+	return fmt.Sprintf("%s (limit=%s)", e.Message, e.Limit)
+}
+
+// Is makes errors.Is(err, ErrParseLimitExceeded) match any limit violation
+func (e *ParseLimitError) Is(target error) bool {
+	return target == ErrParseLimitExceeded
+}
+
+// newSizeLimitError builds a rejection for limits on message or header size (552 5.3.4)
+func newSizeLimitError(limit, format string, args ...interface{}) *ParseLimitError {
+	return &ParseLimitError{
+		Limit:        limit,
+		Code:         552,
+		EnhancedCode: [3]int{5, 3, 4},
+		Message:      fmt.Sprintf(format, args...),
+	}
+}
+
+// parseRejectReason tells size limit violations from other parse failures in the rejection metrics
+func parseRejectReason(err error) RejectReason {
+	var limitErr *ParseLimitError
+	if errors.As(err, &limitErr) && limitErr.Code == 552 {
+		return RejectSize
+	}
+	return RejectParse
+}
+
+// newMediaLimitError builds a rejection for limits on MIME structure (554 5.6.0)
+func newMediaLimitError(limit, format string, args ...interface{}) *ParseLimitError {
+	return &ParseLimitError{
+		Limit:        limit,
+		Code:         554,
+		EnhancedCode: [3]int{5, 6, 0},
+		Message:      fmt.Sprintf(format, args...),
+	}
+}
+
+// checkHeaderLimits scans the top-level header section before it is parsed,
+// so oversized or field-stuffed headers are rejected without being materialized
+func checkHeaderLimits(data []byte, limits ParseLimits) error {
+	headerBytes := 0
+	fields := 0
+
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+
+		// A blank line ends the header section
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return nil
+		}
+
+		headerBytes += len(line)
+		if headerBytes > limits.MaxHeaderBytes {
+			return newSizeLimitError("header_bytes", "header section larger than %d bytes", limits.MaxHeaderBytes)
+		}
+
+		// Continuation lines belong to the previous field
+		if line[0] != ' ' && line[0] != '\t' {
+			fields++
+			if fields > limits.MaxHeaderCount {
+				return newSizeLimitError("header_count", "more than %d header fields", limits.MaxHeaderCount)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+)
+
+// DefaultLMTPSocketMode lets the socket's owner and group, such as postfix, connect
+const DefaultLMTPSocketMode fs.FileMode = 0o660
+
+// parseLMTPSocketMode parses LMTP_SOCKET_MODE as an octal permission, e.g. 0660
+func parseLMTPSocketMode(value string) (fs.FileMode, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DefaultLMTPSocketMode, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid LMTP_SOCKET_MODE '%s': use octal permissions such as 0660", value)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// EnableLMTP adds an LMTP listener on a Unix socket so a local MTA can hand mail over without
+// a TCP round trip. Sessions share the backend with SMTP, but the network ACL does not apply:
+// the socket's permissions decide who may connect
+func (s *SMTPServer) EnableLMTP(socketPath string, mode fs.FileMode) {
+	server := smtp.NewServer(s.backend)
+	server.LMTP = true
+	server.Addr = socketPath
+	server.Domain = SMTPDomain
+	server.ReadTimeout = ReadTimeout
+	server.WriteTimeout = WriteTimeout
+	server.MaxMessageBytes = s.server.MaxMessageBytes
+	server.MaxRecipients = MaxRecipients
+	s.lmtpServer = server
+	s.lmtpMode = mode
+}
+
+// StartLMTP listens on the LMTP socket, replacing a socket left behind by an earlier run
+func (s *SMTPServer) StartLMTP() error {
+	path := s.lmtpServer.Addr
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, s.lmtpMode); err != nil {
+		listener.Close()
+		return err
+	}
+	log.Printf("Starting LMTP server on %s (mode %04o)", path, s.lmtpMode)
+	return s.serve(s.lmtpServer, listener)
+}
+
+// LMTPSocket returns the path of the LMTP socket, or "" when LMTP is disabled
+func (s *SMTPServer) LMTPSocket() string {
+	if s.lmtpServer == nil {
+		return ""
+	}
+	return s.lmtpServer.Addr
+}
+
+// LMTPData delivers the message for each recipient separately and reports the outcome of each,
+// so the MTA only retries or bounces the recipients that failed
+func (s *SMTPSession) LMTPData(r io.Reader, status smtp.StatusCollector) error {
+	log.Printf("Receiving LMTP data from %s to %v (remote: %s)", s.From, s.To, s.RemoteAddr)
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		log.Printf("Error reading email data: %v", err)
+		if errors.Is(err, smtp.ErrDataTooLarge) {
+			s.EmailProcessor.Metrics.Reject(RejectSize)
+		}
+		return fmt.Errorf("failed to read email data: %w", err)
+	}
+
+	log.Printf("Received %d bytes of email data", len(data))
+
+	results := s.EmailProcessor.ProcessEachRecipient(data, s.To, s.sessionInfo())
+	for _, rcpt := range s.To {
+		if err := results[rcpt]; err != nil {
+			log.Printf("Error processing email for %s: %v", rcpt, err)
+			status.SetStatus(rcpt, smtpDataError(err))
+			continue
+		}
+		log.Printf("Email for %s successfully processed and forwarded", rcpt)
+		status.SetStatus(rcpt, nil)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lookup Cache Configuration
+const (
+	DefaultCacheSize = 10000 // Entries per lookup cache
+)
+
+// Lookup cache names, used in CACHE_SIZES and as the cache label of the cache metrics
+const (
+	CacheSlackUsers    = "slack_users"    // Slack username -> user ID
+	CacheSlackChannels = "slack_channels" // Slack channel name -> channel ID
+	CacheSlackGroups   = "slack_groups"   // Slack user group handle -> subteam ID
+	CacheSlackDMs      = "slack_dms"      // Slack user ID -> DM channel ID
+	CacheRcptVerify    = "rcpt_verify"    // RCPT TO answers from Telegram getChat and Slack lookups
+)
+
+// lookupCacheNames lists every lookup cache, in the order they are reported
+var lookupCacheNames = []string{CacheSlackUsers, CacheSlackChannels, CacheSlackGroups, CacheSlackDMs, CacheRcptVerify}
+
+// lookupCacheEntry is a cached value with its expiry
+type lookupCacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time // Zero for entries kept until evicted
+}
+
+// LookupCache is a size-bounded LRU cache for name and ID lookups that counts its hits, misses
+// and evictions. Expired entries are misses but stay until evicted, so a lookup whose API is
+// unavailable can fall back on them with Stale
+type LookupCache struct {
+	Name string
+	Size int           // Most entries kept; the least recently used is evicted first
+	TTL  time.Duration // How long entries are trusted; zero keeps them until evicted
+
+	mutex     sync.Mutex
+	entries   map[string]*list.Element
+	order     *list.List // Most recently used first
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// LookupCacheStats are the counters of a cache since startup
+type LookupCacheStats struct {
+	Name      string
+	Size      int
+	Entries   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// NewLookupCache creates an empty cache of at most size entries trusted for ttl
+func NewLookupCache(name string, size int, ttl time.Duration) *LookupCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &LookupCache{
+		Name:    name,
+		Size:    size,
+		TTL:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the value cached for key, counting a hit or a miss
+func (c *LookupCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, exists := c.entries[key]
+	if !exists {
+		c.misses++
+		return nil, false
+	}
+	entry := element.Value.(*lookupCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Stale returns the value cached for key even if it expired, without counting a lookup
+func (c *LookupCache) Stale(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	return element.Value.(*lookupCacheEntry).value, true
+}
+
+// Set caches a value for the cache's TTL
+func (c *LookupCache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.TTL)
+}
+
+// SetWithTTL caches a value for ttl, evicting the least recently used entry when the cache is full
+func (c *LookupCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	entry := &lookupCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, exists := c.entries[key]; exists {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lookupCacheEntry).key)
+		c.evictions++
+	}
+}
+
+// Delete forgets the value cached for key
+func (c *LookupCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, exists := c.entries[key]; exists {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Stats returns the cache's counters
+func (c *LookupCache) Stats() LookupCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return LookupCacheStats{
+		Name:      c.Name,
+		Size:      c.Size,
+		Entries:   c.order.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// parseCacheSizes parses CACHE_SIZES overrides of the form name=entries,... and returns the size
+// of every lookup cache, defaultSize for those not named
+func parseCacheSizes(value string, defaultSize int) (map[string]int, error) {
+	sizes := make(map[string]int, len(lookupCacheNames))
+	for _, name := range lookupCacheNames {
+		sizes[name] = defaultSize
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, size, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if _, known := sizes[name]; !known {
+			return nil, fmt.Errorf("invalid CACHE_SIZES entry '%s': unknown cache, use one of %s", entry, strings.Join(lookupCacheNames, ", "))
+		}
+		entries, err := strconv.Atoi(strings.TrimSpace(size))
+		if !found || err != nil || entries <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_SIZES entry '%s': use name=entries with a positive number", entry)
+		}
+		sizes[name] = entries
+	}
+	return sizes, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+// Low-Memory Configuration
+const (
+	LowMemoryRuntimeLimit         = 48 * 1024 * 1024 // Soft Go heap limit unless GOMEMLIMIT is set
+	LowMemoryGCPercent            = 50               // Collect more often unless GOGC is set
+	LowMemoryCompressedMaxBytes   = 64 * 1024
+	LowMemorySlackThreadCacheSize = 500
+	LowMemoryCacheSize            = 1000 // Entries per lookup cache unless CACHE_SIZE is set
+)
+
+// LowMemoryParseLimits replace DefaultParseLimits in low-memory mode; MAX_* variables still override them
+var LowMemoryParseLimits = ParseLimits{
+	MaxParseBytes:  4 * 1024 * 1024,
+	MaxBodyBytes:   128 * 1024,
+	MaxMIMEDepth:   5,
+	MaxMIMEParts:   30,
+	MaxHeaderBytes: 16 * 1024,
+	MaxHeaderCount: 100,
+}
+
+// applyLowMemoryRuntime makes the Go runtime return memory to the system sooner.
+// Explicit GOMEMLIMIT and GOGC settings are left alone
+func applyLowMemoryRuntime() {
+	if os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(LowMemoryRuntimeLimit)
+	}
+	if os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(LowMemoryGCPercent)
+	}
+	log.Printf("Low-memory mode enabled: smaller parser limits, attachments spooled to disk, heap limit %d MiB",
+		LowMemoryRuntimeLimit/(1024*1024))
+}
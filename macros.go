@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Address Macro Configuration
+const (
+	AddressMacroDefaultRow = "*" // Table row used for names without a row of their own
+)
+
+// addressMacroPattern matches the single %variable% of a macro's local part
+var addressMacroPattern = regexp.MustCompile(`%([a-z0-9_]+)%`)
+
+// addressMacroValuePattern limits what a macro variable matches, so it cannot carry modifiers or other addresses
+var addressMacroValuePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// AddressMacro derives destinations from addresses such as team-payments@alerts: the part matching
+// the variable is looked up in a table of destinations, so a new team needs one table row
+type AddressMacro struct {
+	Pattern  string // e.g. team-%name%@alerts
+	File     string // Table of name and destination rows
+	prefix   string
+	suffix   string
+	domain   string
+	variable string // e.g. %name%, replaced by the name in destinations
+
+	mutex    sync.Mutex
+	table    map[string]string
+	modified time.Time // Modification time of the file the table was read from
+}
+
+// parseAddressMacros parses ADDRESS_MACROS entries of the form pattern=file;... and reads their tables
+func parseAddressMacros(value string) ([]*AddressMacro, error) {
+	var macros []*AddressMacro
+	domains := make(map[string]bool)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, file, found := strings.Cut(entry, "=")
+		pattern, file = strings.ToLower(strings.TrimSpace(pattern)), strings.TrimSpace(file)
+		if !found || file == "" {
+			return nil, fmt.Errorf("invalid ADDRESS_MACROS entry '%s': use pattern=file, e.g. team-%%name%%@alerts=/etc/email2dm/teams.txt", entry)
+		}
+
+		localPart, domain, found := strings.Cut(pattern, "@")
+		variables := addressMacroPattern.FindAllStringIndex(localPart, -1)
+		if !found || domain == "" || strings.ContainsAny(domain, "%@+") || len(variables) != 1 || strings.Contains(localPart, "+") {
+			return nil, fmt.Errorf("invalid ADDRESS_MACROS pattern '%s': use one %%variable%% in the local part, e.g. team-%%name%%@alerts", pattern)
+		}
+		if builtinPlatform(domain) || strings.HasSuffix(domain, ".telegram") || domain == FanoutDomain {
+			return nil, fmt.Errorf("invalid ADDRESS_MACROS pattern '%s': %s is a platform domain", pattern, domain)
+		}
+
+		macro := &AddressMacro{
+			Pattern:  pattern,
+			File:     file,
+			prefix:   localPart[:variables[0][0]],
+			suffix:   localPart[variables[0][1]:],
+			domain:   domain,
+			variable: localPart[variables[0][0]:variables[0][1]],
+		}
+		macros = append(macros, macro)
+		domains[domain] = true
+	}
+
+	for _, macro := range macros {
+		if err := macro.load(domains); err != nil {
+			return nil, err
+		}
+	}
+	return macros, nil
+}
+
+// readAddressMacroTable reads rows of a name and a destination address separated by spaces;
+// blank lines and lines starting with # are skipped
+func readAddressMacroTable(path string, macroDomains map[string]bool) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		row := strings.TrimSpace(scanner.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+		fields := strings.Fields(row)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: use a name and a destination address, e.g. payments C0123456789@slack", line)
+		}
+		name, destination := strings.ToLower(fields[0]), fields[1]
+		if name != AddressMacroDefaultRow && !addressMacroValuePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid name '%s'", line, fields[0])
+		}
+		at := strings.LastIndex(destination, "@")
+		if at <= 0 {
+			return nil, fmt.Errorf("line %d: '%s' is not an address", line, destination)
+		}
+		if domain := strings.ToLower(destination[at+1:]); domain == FanoutDomain || macroDomains[domain] {
+			return nil, fmt.Errorf("line %d: destinations cannot be fan-out aliases or macro addresses", line)
+		}
+		table[name] = destination
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// load reads the table if its file changed since it was last read
+func (m *AddressMacro) load(macroDomains map[string]bool) error {
+	info, err := os.Stat(m.File)
+	if err != nil {
+		return fmt.Errorf("invalid ADDRESS_MACROS table for %s: %w", m.Pattern, err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.table != nil && info.ModTime().Equal(m.modified) {
+		return nil
+	}
+	table, err := readAddressMacroTable(m.File, macroDomains)
+	if err != nil {
+		return fmt.Errorf("invalid ADDRESS_MACROS table %s: %w", m.File, err)
+	}
+	if m.table != nil {
+		log.Printf("Reloaded address macro table %s (%d rows)", m.File, len(table))
+	}
+	m.table, m.modified = table, info.ModTime()
+	return nil
+}
+
+// match returns the name an address local part and domain give the macro's variable, or false
+func (m *AddressMacro) match(localPart, domain string) (string, bool) {
+	if domain != m.domain || len(localPart) <= len(m.prefix)+len(m.suffix) ||
+		!strings.HasPrefix(localPart, m.prefix) || !strings.HasSuffix(localPart, m.suffix) {
+		return "", false
+	}
+	return localPart[len(m.prefix) : len(localPart)-len(m.suffix)], true
+}
+
+// destination returns the address a name maps to, with the variable replaced by the name
+func (m *AddressMacro) destination(name string) (string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	destination, exists := m.table[name]
+	if !exists {
+		destination, exists = m.table[AddressMacroDefaultRow]
+	}
+	return strings.ReplaceAll(destination, m.variable, name), exists
+}
+
+// macroDomains returns the domains of the configured macros
+func (ep *EmailProcessor) macroDomains() map[string]bool {
+	domains := make(map[string]bool)
+	for _, macro := range ep.Config.AddressMacros {
+		domains[macro.domain] = true
+	}
+	return domains
+}
+
+// expandAddressMacro returns the destination address a macro address maps to, keeping its
+// modifiers, or "" for addresses no macro matches. A table that changed is read again first;
+// when it no longer parses, the rows read before are kept
+func (ep *EmailProcessor) expandAddressMacro(address string) (string, error) {
+	if ep.Config == nil || len(ep.Config.AddressMacros) == 0 {
+		return "", nil
+	}
+	at := strings.LastIndex(address, "@")
+	if at <= 0 {
+		return "", nil
+	}
+	localPart, modifiers, _ := strings.Cut(address[:at], "+")
+	localPart, domain := strings.ToLower(localPart), strings.ToLower(address[at+1:])
+
+	for _, macro := range ep.Config.AddressMacros {
+		name, found := macro.match(localPart, domain)
+		if !found {
+			continue
+		}
+		if !addressMacroValuePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid name '%s' in %s", name, address)
+		}
+		if err := macro.load(ep.macroDomains()); err != nil {
+			log.Printf("Warning: %v, keeping the rows read before", err)
+		}
+		destination, exists := macro.destination(name)
+		if !exists {
+			return "", fmt.Errorf("no destination for '%s' in the table of %s", name, macro.Pattern)
+		}
+		if modifiers != "" {
+			at := strings.LastIndex(destination, "@")
+			destination = destination[:at] + "+" + modifiers + destination[at:]
+		}
+		return destination, nil
+	}
+	return "", nil
+}
+
+// checkAddressMacros validates every table row at startup; the default row is checked with its own name
+func (ep *EmailProcessor) checkAddressMacros() error {
+	if ep.Config == nil {
+		return nil
+	}
+	for _, macro := range ep.Config.AddressMacros {
+		macro.mutex.Lock()
+		names := make([]string, 0, len(macro.table))
+		for name := range macro.table {
+			names = append(names, name)
+		}
+		macro.mutex.Unlock()
+
+		for _, name := range names {
+			address := macro.prefix + name + macro.suffix + "@" + macro.domain
+			if name == AddressMacroDefaultRow {
+				address = macro.prefix + "example" + macro.suffix + "@" + macro.domain
+			}
+			if _, _, _, err := ep.extractPlatformAndID(address); err != nil {
+				return fmt.Errorf("invalid ADDRESS_MACROS row '%s' of %s: %w", name, macro.File, err)
+			}
+		}
+	}
+	return nil
+}
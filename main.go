@@ -1,42 +1,512 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"text/template"
+	"time"
 )
 
 // Config holds application configuration
 type Config struct {
 	TelegramBotToken string
+	TelegramBots     map[string]string // Tokens of named bots from TELEGRAM_BOT_TOKEN_<NAME>
+	TelegramUploads  bool
+	TelegramMaxBytes int      // Largest attachment sent to Telegram
+	TelegramTypes    []string // Attachment content types sent to Telegram; empty allows all
+	TelegramInline   int      // Embedded images sent as photos per email; 0 drops them
+	TelegramImageMax int      // Largest embedded image sent to Telegram
+	TelegramRetries  int
+	TelegramLimit    bool // Queue messages to stay within Telegram's rate limits
+	TelegramAcks     bool // Acknowledgement buttons on critical alerts, handled by polling getUpdates
+	TelegramReplies  bool // Email replies to bridged messages back through the relay, polling getUpdates
+	TelegramPins     bool // Pin critical alerts until a recovery for them arrives
+	HistorySize      int  // Recent deliveries kept in memory; 0 keeps none
+	ChatSearch       bool // Answer /search in Telegram chats and Slack, polling getUpdates
+	TelegramSnooze   time.Duration
+	TelegramReplyTTL time.Duration
+	HistoryFile      string   // JSON Lines file every delivery is appended to, for exports; "" disables
+	TelegramAckHook  string   // Webhook receiving button presses
+	TelegramAPIURL   string   // Bot API server; a fake API when running integration tests
+	TelegramProxy    *url.URL // HTTP or SOCKS5 proxy for Bot API calls; nil connects directly
 	SlackBotToken    string
+	SlackFormat      string
+	SlackThreading   string
+	SlackThreadTTL   time.Duration
+	SlackCoalesce    time.Duration // Window for folding identical alerts into one message; 0 disables
+	SlackBatch       time.Duration // Window for combining short messages into one post; 0 disables
+	SlackUploads     bool
+	SlackColorBars   bool
+	SlackReports     string // off, snippet or canvas for long bodies
+	SlackReportChars int
+	SlackUnfurlLinks *bool // nil keeps Slack's default
+	SlackUnfurlMedia *bool
+	SlackColors      map[Severity]string // Color bar overrides from SLACK_SEVERITY_COLORS
+	SlackRetries     int
+	SlackChannelTTL  time.Duration
+	SlackUserTTL     time.Duration
+	SlackAppToken    string
+	SlackAPIURL      string // Web API base; a fake API when running integration tests
+	DingTalkRobots   map[string]DingTalkRobot
+	WeComCorpID      string
+	WeComAgentID     int
+	WeComSecret      string
+	WeComMessageType string
+	MastodonURL      string
+	MastodonToken    string
+	MastodonMaxChars int
+	WhatsAppToken    string
+	WhatsAppPhoneID  string
+	WhatsAppTemplate string
+	WhatsAppLanguage string
+	ZoomAccountID    string
+	ZoomClientID     string
+	ZoomClientSecret string
+	ZoomUserID       string
+	VictorOpsAPIKey  string
+	RedisOptions     *RedisOptions
+	RedisFormat      string
 	SMTPListenHost   string
 	SMTPListenPort   int
+	SMTPSListenPort  int // Implicit-TLS listener; 0 disables it
 	AllowedNetworks  []string
+	SMTPAuth         *SMTPAuthenticator // nil offers no SMTP AUTH
 	TLSEnable        bool
 	TLSCertPath      string
 	TLSKeyPath       string
+	SMTPRequireTLS   bool  // Refuse MAIL FROM before STARTTLS
+	SMTPMaxBytes     int64 // Largest message accepted, advertised with SIZE
+	ParseLimits      ParseLimits
+	LMTPSocket       string      // Unix socket for LMTP delivery from a local MTA; "" disables it
+	LMTPSocketMode   os.FileMode // Permissions of the LMTP socket
+	SMTPRateLimit    RateLimit   // Messages accepted from all clients; zero Count disables it
+	SMTPIPRateLimit  RateLimit   // Messages accepted from one client IP; zero Count disables it
+	MaxConnections   int         // Concurrent SMTP connections from all clients; 0 allows any number
+	MaxConnsPerIP    int         // Concurrent SMTP connections from one client IP; 0 allows any number
+	SPFPolicy        string      // off, log, annotate or reject the SPF result of MAIL FROM
+	DMARCPolicy      string      // off, none, quarantine or reject messages failing DMARC
+
+	GreylistDelay   time.Duration // Wait before a retry of a new triple is accepted; 0 disables greylisting
+	ShutdownTimeout time.Duration // Wait for messages in progress on shutdown; 0 closes connections at once
+
+	ParseFailurePolicy  string // reject or forward messages the parser cannot read
+	FallbackDestination string // platform:id that receives mail for unconfigured platforms
+	EmptyBodyPolicy     string // subject, drop or placeholder for emails without a body
+	EmptyBodyText       string // Body of empty emails under the placeholder policy
+
+	MaxMessageAge time.Duration // Older mail follows StalePolicy; 0 disables the check
+	StalePolicy   string        // mark or drop mail older than MaxMessageAge
+
+	MultiRecipientPolicy string              // all, first, first-platform or alias
+	FanoutAliases        map[string][]string // Members of <name>@fanout by name
+	AddressMacros        []*AddressMacro     // Addresses such as team-%name%@alerts mapped through a table
+
+	InlineCompressedAttachments  bool
+	CompressedAttachmentMaxBytes int
+	CompressedAttachmentLines    int
+
+	LowMemory       bool
+	CacheSizes      map[string]int   // Entries per lookup cache by name
+	AttachmentSpool *AttachmentSpool // nil keeps attachments in memory
+	StateFile       string           // File keeping thread and coalescing state across restarts; "" disables
+	StateBackend    string           // bbolt, sqlite, redis or json
+
+	DestinationOptions map[string]DestinationOptions
+
+	ResolverWebhookURL   string
+	ResolverWebhookToken string
+
+	AddressTokens *AddressTokens // Signed destination addresses; nil disables
+
+	PluginDir     string
+	HTTPPlatforms map[string]*HTTPPlatform // Operator-defined platforms by domain
+
+	HTTPPolicies map[string]HTTPPolicy
+
+	SeverityKeywords map[Severity][]string
+	TitleTemplates   map[string]*template.Template
+	BannerTemplate   *template.Template // Line above the body describing the sender; nil disables
+	SenderNames      map[string]string  // Lowercased address or @domain -> name shown as the sender
+	PageKeyword      string             // Subject prefix marking a page, e.g. [PAGE]; "" disables
+	PageHeader       string             // Switch header marking a page, e.g. X-Page; "" disables
+
+	InboundListenAddr string
+	MailgunSigningKey string
+	SESTopicARNs      []string
+
+	MetricsListenAddr string        // Address serving /metrics; "" disables
+	MetricsSummary    time.Duration // Interval of the rejection summary log; 0 disables
+	SyslogEscaping    string        // escape, strip or quote control characters in syslog fields
+	SyslogFieldChars  int           // Characters kept of each syslog field value
+
+	AdminListenAddr string // Address serving the admin API; "" disables
+	AdminToken      string // Bearer token the admin API requires
+
+	RcptVerify    bool          // Check that destinations exist at RCPT TO
+	RcptVerifyTTL time.Duration // How long an existing destination is trusted
+
+	SizeQuotas      map[string]int64 // Bytes per destination and UTC day from SIZE_QUOTAS
+	SizeQuotaPolicy string           // summary or reject mail past a quota
+
+	EncryptionKeys map[string]*EncryptionKey // platform:id -> public key its mail is encrypted to
+
+	RelayAddr     string
+	RelaySecurity string
+	RelayUsername string
+	RelayPassword string
+	RelayFrom     string
 }
 
 // loadConfig loads configuration from environment variables
 func loadConfig() (*Config, error) {
 	telegramBotToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	telegramBots, err := parseTelegramBots()
+	if err != nil {
+		return nil, err
+	}
 	slackBotToken := os.Getenv("SLACK_BOT_TOKEN")
+	slackMessageFormat := os.Getenv("SLACK_MESSAGE_FORMAT")
+	slackThreading := os.Getenv("SLACK_THREADING")
+	dingTalkRobotsStr := os.Getenv("DINGTALK_ROBOTS")
+	weComCorpID := os.Getenv("WECOM_CORP_ID")
+	weComAgentIDStr := os.Getenv("WECOM_AGENT_ID")
+	weComSecret := os.Getenv("WECOM_SECRET")
+	weComMessageType := os.Getenv("WECOM_MESSAGE_TYPE")
+	mastodonURL := os.Getenv("MASTODON_INSTANCE_URL")
+	mastodonToken := os.Getenv("MASTODON_ACCESS_TOKEN")
+	whatsAppToken := os.Getenv("WHATSAPP_ACCESS_TOKEN")
+	whatsAppPhoneID := os.Getenv("WHATSAPP_PHONE_NUMBER_ID")
+	whatsAppTemplate := os.Getenv("WHATSAPP_TEMPLATE_NAME")
+	whatsAppLanguage := os.Getenv("WHATSAPP_TEMPLATE_LANGUAGE")
+	zoomAccountID := os.Getenv("ZOOM_ACCOUNT_ID")
+	zoomClientID := os.Getenv("ZOOM_CLIENT_ID")
+	zoomClientSecret := os.Getenv("ZOOM_CLIENT_SECRET")
+	zoomUserID := os.Getenv("ZOOM_USER_ID")
+	victorOpsAPIKey := os.Getenv("VICTOROPS_API_KEY")
+	redisURL := os.Getenv("REDIS_URL")
+	redisFormat := os.Getenv("REDIS_MESSAGE_FORMAT")
 	smtpHost := os.Getenv("SMTP_LISTEN_HOST")
 	smtpPortStr := os.Getenv("SMTP_LISTEN_PORT")
 	allowedNetworksStr := os.Getenv("ALLOWED_NETWORKS")
-	tlsEnableStr := os.Getenv("TLS_ENABLE")
 	tlsCertPath := os.Getenv("TLS_CERT_PATH")
 	tlsKeyPath := os.Getenv("TLS_KEY_PATH")
 
+	// Parse DingTalk robots
+	dingTalkRobots, err := parseDingTalkRobots(dingTalkRobotsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse WeCom application settings
+	weComAgentID := 0
+	if weComCorpID != "" || weComSecret != "" || weComAgentIDStr != "" {
+		if weComCorpID == "" || weComSecret == "" || weComAgentIDStr == "" {
+			return nil, fmt.Errorf("WECOM_CORP_ID, WECOM_AGENT_ID and WECOM_SECRET must be set together")
+		}
+		agentID, err := strconv.Atoi(weComAgentIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WECOM_AGENT_ID '%s': %w", weComAgentIDStr, err)
+		}
+		weComAgentID = agentID
+	}
+
+	switch strings.ToLower(slackMessageFormat) {
+	case "", "blocks":
+		slackMessageFormat = "blocks"
+	case "text":
+		slackMessageFormat = "text"
+	default:
+		return nil, fmt.Errorf("invalid SLACK_MESSAGE_FORMAT value '%s': use blocks/text", slackMessageFormat)
+	}
+
+	switch strings.ToLower(slackThreading) {
+	case "", "subject":
+		slackThreading = "subject"
+	case "references", "off":
+		slackThreading = strings.ToLower(slackThreading)
+	default:
+		return nil, fmt.Errorf("invalid SLACK_THREADING value '%s': use subject/references/off", slackThreading)
+	}
+	slackUploads, err := parseBoolEnv("SLACK_UPLOAD_ATTACHMENTS", true)
+	if err != nil {
+		return nil, err
+	}
+	telegramUploads, err := parseBoolEnv("TELEGRAM_UPLOAD_ATTACHMENTS", true)
+	if err != nil {
+		return nil, err
+	}
+	telegramMaxBytes, err := parsePositiveIntEnv("TELEGRAM_ATTACHMENT_MAX_BYTES", TelegramMaxUploadBytes)
+	if err != nil {
+		return nil, err
+	}
+	if telegramMaxBytes > TelegramMaxUploadBytes {
+		return nil, fmt.Errorf("invalid TELEGRAM_ATTACHMENT_MAX_BYTES %d: Telegram accepts at most %d bytes", telegramMaxBytes, TelegramMaxUploadBytes)
+	}
+	telegramInline := TelegramInlineImages
+	if value := os.Getenv("TELEGRAM_INLINE_IMAGES"); value != "" {
+		telegramInline, err = strconv.Atoi(value)
+		if err != nil || telegramInline < 0 {
+			return nil, fmt.Errorf("invalid TELEGRAM_INLINE_IMAGES '%s': must be zero or a positive integer", value)
+		}
+	}
+	telegramImageMax, err := parsePositiveIntEnv("TELEGRAM_INLINE_IMAGE_MAX_BYTES", TelegramMaxPhotoBytes)
+	if err != nil {
+		return nil, err
+	}
+	if telegramImageMax > TelegramMaxPhotoBytes {
+		return nil, fmt.Errorf("invalid TELEGRAM_INLINE_IMAGE_MAX_BYTES %d: Telegram accepts photos of at most %d bytes", telegramImageMax, TelegramMaxPhotoBytes)
+	}
+	var telegramTypes []string
+	for _, contentType := range strings.Split(os.Getenv("TELEGRAM_ATTACHMENT_TYPES"), ",") {
+		if contentType = strings.ToLower(strings.TrimSpace(contentType)); contentType != "" {
+			telegramTypes = append(telegramTypes, contentType)
+		}
+	}
+	slackColorBars, err := parseBoolEnv("SLACK_COLOR_BARS", false)
+	if err != nil {
+		return nil, err
+	}
+	slackReports, err := parseSlackReportMode(os.Getenv("SLACK_REPORTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SLACK_REPORTS: %w", err)
+	}
+	slackReportChars, err := parsePositiveIntEnv("SLACK_REPORT_MIN_CHARS", DefaultSlackReportChars)
+	if err != nil {
+		return nil, err
+	}
+	slackColors, err := parseSeverityColors(os.Getenv("SLACK_SEVERITY_COLORS"))
+	if err != nil {
+		return nil, err
+	}
+	slackUnfurlLinks, err := parseOptionalBoolEnv("SLACK_UNFURL_LINKS")
+	if err != nil {
+		return nil, err
+	}
+	slackUnfurlMedia, err := parseOptionalBoolEnv("SLACK_UNFURL_MEDIA")
+	if err != nil {
+		return nil, err
+	}
+	telegramLimit, err := parseBoolEnv("TELEGRAM_RATE_LIMIT", true)
+	if err != nil {
+		return nil, err
+	}
+	telegramAcks, err := parseBoolEnv("TELEGRAM_ACK_BUTTONS", false)
+	if err != nil {
+		return nil, err
+	}
+	telegramPins, err := parseBoolEnv("TELEGRAM_PIN_CRITICAL", false)
+	if err != nil {
+		return nil, err
+	}
+	telegramSnooze := DefaultTelegramSnooze
+	if value := os.Getenv("TELEGRAM_ACK_SNOOZE"); value != "" {
+		telegramSnooze, err = time.ParseDuration(value)
+		if err != nil || telegramSnooze < time.Minute {
+			return nil, fmt.Errorf("invalid TELEGRAM_ACK_SNOOZE '%s': use a duration of at least 1m such as 1h", value)
+		}
+	}
+	telegramAckHook := os.Getenv("TELEGRAM_ACK_WEBHOOK_URL")
+	if telegramAckHook != "" && !telegramAcks {
+		return nil, fmt.Errorf("TELEGRAM_ACK_WEBHOOK_URL requires TELEGRAM_ACK_BUTTONS=true")
+	}
+	telegramAPIURL, err := parseAPIURLEnv("TELEGRAM_API_URL", TelegramAPIURL)
+	if err != nil {
+		return nil, err
+	}
+	var telegramProxy *url.URL
+	if value := strings.TrimSpace(os.Getenv("TELEGRAM_PROXY_URL")); value != "" {
+		telegramProxy, err = url.Parse(value)
+		if err != nil || telegramProxy.Host == "" ||
+			(telegramProxy.Scheme != "http" && telegramProxy.Scheme != "https" && telegramProxy.Scheme != "socks5" && telegramProxy.Scheme != "socks5h") {
+			return nil, fmt.Errorf("invalid TELEGRAM_PROXY_URL: use socks5://[user:password@]host:port or http://[user:password@]host:port")
+		}
+	}
+	telegramRetries := DefaultTelegramRetries
+	if value := os.Getenv("TELEGRAM_RATE_LIMIT_RETRIES"); value != "" {
+		telegramRetries, err = strconv.Atoi(value)
+		if err != nil || telegramRetries < 0 {
+			return nil, fmt.Errorf("invalid TELEGRAM_RATE_LIMIT_RETRIES '%s': must be zero or a positive integer", value)
+		}
+	}
+	slackAPIURL, err := parseAPIURLEnv("SLACK_API_URL", SlackAPIURL)
+	if err != nil {
+		return nil, err
+	}
+	slackRetries := DefaultSlackRateRetries
+	if value := os.Getenv("SLACK_RATE_LIMIT_RETRIES"); value != "" {
+		slackRetries, err = strconv.Atoi(value)
+		if err != nil || slackRetries < 0 {
+			return nil, fmt.Errorf("invalid SLACK_RATE_LIMIT_RETRIES '%s': must be zero or a positive integer", value)
+		}
+	}
+	slackChannelTTL := DefaultSlackChannelTTL
+	if value := os.Getenv("SLACK_CHANNEL_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid SLACK_CHANNEL_CACHE_TTL '%s': use a duration such as 10m", value)
+		}
+		slackChannelTTL = ttl
+	}
+	slackUserTTL := DefaultSlackUserTTL
+	if value := os.Getenv("SLACK_USER_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid SLACK_USER_CACHE_TTL '%s': use a duration such as 24h", value)
+		}
+		slackUserTTL = ttl
+	}
+	slackThreadTTL := DefaultSlackThreadTTL
+	if value := os.Getenv("SLACK_THREAD_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid SLACK_THREAD_TTL '%s': use a duration such as 24h", value)
+		}
+		slackThreadTTL = ttl
+	}
+	var slackCoalesce time.Duration
+	if value := os.Getenv("SLACK_COALESCE_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("invalid SLACK_COALESCE_WINDOW '%s': use a duration such as 10m", value)
+		}
+		slackCoalesce = window
+	}
+	var slackBatch time.Duration
+	if value := os.Getenv("SLACK_BATCH_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 || window > MaxSlackBatchWindow {
+			return nil, fmt.Errorf("invalid SLACK_BATCH_WINDOW '%s': use a duration of at most %s such as 2s", value, MaxSlackBatchWindow)
+		}
+		slackBatch = window
+	}
+
+	// Parse the /search command, answered from the history of recent deliveries
+	chatSearch, err := parseBoolEnv("CHAT_SEARCH", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the Socket Mode reply bridge and the relay that delivers the replies
+	slackAppToken := os.Getenv("SLACK_APP_TOKEN")
+	relayAddr := os.Getenv("SMTP_RELAY_ADDR")
+	relayFrom := os.Getenv("SMTP_RELAY_FROM")
+	relaySecurity := strings.ToLower(os.Getenv("SMTP_RELAY_SECURITY"))
+	switch relaySecurity {
+	case "":
+		relaySecurity = RelaySecurityStartTLS
+	case RelaySecurityStartTLS, RelaySecurityTLS, RelaySecurityNone:
+	default:
+		return nil, fmt.Errorf("invalid SMTP_RELAY_SECURITY value '%s': use starttls/tls/none", relaySecurity)
+	}
+	if relayAddr != "" {
+		if _, _, err := net.SplitHostPort(relayAddr); err != nil {
+			return nil, fmt.Errorf("invalid SMTP_RELAY_ADDR '%s': use host:port", relayAddr)
+		}
+		if _, err := mail.ParseAddress(relayFrom); err != nil {
+			return nil, fmt.Errorf("SMTP_RELAY_FROM must be a valid address when SMTP_RELAY_ADDR is set")
+		}
+	}
+	telegramReplies, err := parseBoolEnv("TELEGRAM_REPLIES", false)
+	if err != nil {
+		return nil, err
+	}
+	if telegramReplies && relayAddr == "" {
+		return nil, fmt.Errorf("TELEGRAM_REPLIES requires SMTP_RELAY_ADDR")
+	}
+	telegramReplyTTL := DefaultTelegramReplyTTL
+	if value := os.Getenv("TELEGRAM_REPLY_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid TELEGRAM_REPLY_TTL '%s': use a duration such as 24h", value)
+		}
+		telegramReplyTTL = ttl
+	}
+	if slackAppToken != "" {
+		if !strings.HasPrefix(slackAppToken, "xapp-") {
+			return nil, fmt.Errorf("SLACK_APP_TOKEN must be an app-level token (xapp-...)")
+		}
+		if slackBotToken == "" || (relayAddr == "" && !chatSearch) {
+			return nil, fmt.Errorf("SLACK_APP_TOKEN requires SLACK_BOT_TOKEN, and SMTP_RELAY_ADDR or CHAT_SEARCH")
+		}
+	}
+
+	switch strings.ToLower(weComMessageType) {
+	case "", "markdown":
+		weComMessageType = "markdown"
+	case "text":
+		weComMessageType = "text"
+	default:
+		return nil, fmt.Errorf("invalid WECOM_MESSAGE_TYPE value '%s': use markdown/text", weComMessageType)
+	}
+
+	// Parse Mastodon settings
+	if (mastodonURL == "") != (mastodonToken == "") {
+		return nil, fmt.Errorf("MASTODON_INSTANCE_URL and MASTODON_ACCESS_TOKEN must be set together")
+	}
+	if mastodonURL != "" && !strings.HasPrefix(mastodonURL, "https://") && !strings.HasPrefix(mastodonURL, "http://") {
+		return nil, fmt.Errorf("invalid MASTODON_INSTANCE_URL '%s': must start with https://", mastodonURL)
+	}
+	mastodonMaxChars, err := parsePositiveIntEnv("MASTODON_MAX_CHARS", MastodonDefaultMaxLength)
+	if err != nil {
+		return nil, err
+	}
+	if mastodonMaxChars < MastodonMinMaxLength {
+		// Each status starts with a mention of up to 286 characters
+		return nil, fmt.Errorf("invalid MASTODON_MAX_CHARS '%d': use at least %d characters", mastodonMaxChars, MastodonMinMaxLength)
+	}
+
+	// Parse WhatsApp settings
+	if (whatsAppToken == "") != (whatsAppPhoneID == "") {
+		return nil, fmt.Errorf("WHATSAPP_ACCESS_TOKEN and WHATSAPP_PHONE_NUMBER_ID must be set together")
+	}
+	if whatsAppLanguage == "" {
+		whatsAppLanguage = "en_US"
+	}
+
+	// Parse Zoom settings
+	if zoomAccountID != "" || zoomClientID != "" || zoomClientSecret != "" {
+		if zoomAccountID == "" || zoomClientID == "" || zoomClientSecret == "" {
+			return nil, fmt.Errorf("ZOOM_ACCOUNT_ID, ZOOM_CLIENT_ID and ZOOM_CLIENT_SECRET must be set together")
+		}
+	}
+	if zoomUserID == "" {
+		zoomUserID = "me"
+	}
+
+	// Parse Redis settings
+	var redisOptions *RedisOptions
+	if redisURL != "" {
+		options, err := parseRedisURL(redisURL)
+		if err != nil {
+			return nil, err
+		}
+		redisOptions = &options
+	}
+	switch strings.ToLower(redisFormat) {
+	case "", "text":
+		redisFormat = "text"
+	case "json":
+		redisFormat = "json"
+	default:
+		return nil, fmt.Errorf("invalid REDIS_MESSAGE_FORMAT value '%s': use text/json", redisFormat)
+	}
+
 	// At least one platform token is required
-	if telegramBotToken == "" && slackBotToken == "" {
-		return nil, fmt.Errorf("at least one platform token is required (TELEGRAM_BOT_TOKEN or SLACK_BOT_TOKEN)")
+	if telegramBotToken == "" && len(telegramBots) == 0 && slackBotToken == "" && len(dingTalkRobots) == 0 && weComCorpID == "" &&
+		mastodonToken == "" && whatsAppToken == "" && zoomAccountID == "" && victorOpsAPIKey == "" &&
+		redisURL == "" && os.Getenv("PLATFORM_PLUGIN_DIR") == "" && strings.TrimSpace(os.Getenv("HTTP_PLATFORMS")) == "" {
+		return nil, fmt.Errorf("at least one platform token is required (TELEGRAM_BOT_TOKEN, TELEGRAM_BOT_TOKEN_<NAME>, SLACK_BOT_TOKEN, DINGTALK_ROBOTS, WECOM_CORP_ID, MASTODON_ACCESS_TOKEN, WHATSAPP_ACCESS_TOKEN, ZOOM_ACCOUNT_ID, VICTOROPS_API_KEY, REDIS_URL, PLATFORM_PLUGIN_DIR or HTTP_PLATFORMS)")
 	}
 
 	// Default to 0.0.0.0 if not specified
@@ -57,6 +527,22 @@ func loadConfig() (*Config, error) {
 		smtpPort = port
 	}
 
+	// Parse the optional implicit-TLS port
+	smtpsPort := 0
+	if smtpsPortStr := os.Getenv("SMTPS_LISTEN_PORT"); smtpsPortStr != "" {
+		port, err := strconv.Atoi(smtpsPortStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTPS_LISTEN_PORT '%s': %w", smtpsPortStr, err)
+		}
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("SMTPS_LISTEN_PORT must be between 1 and 65535, got %d", port)
+		}
+		if port == smtpPort {
+			return nil, fmt.Errorf("SMTPS_LISTEN_PORT must differ from SMTP_LISTEN_PORT (%d)", smtpPort)
+		}
+		smtpsPort = port
+	}
+
 	// Parse allowed networks
 	var allowedNetworks []string
 	if allowedNetworksStr != "" {
@@ -66,17 +552,26 @@ func loadConfig() (*Config, error) {
 		}
 	}
 
-	// Parse TLS settings
-	tlsEnable := false
-	if tlsEnableStr != "" {
-		switch strings.ToLower(tlsEnableStr) {
-		case "true", "1", "yes", "on":
-			tlsEnable = true
-		case "false", "0", "no", "off":
-			tlsEnable = false
-		default:
-			return nil, fmt.Errorf("invalid TLS_ENABLE value '%s': use true/false", tlsEnableStr)
+	// Parse SMTP AUTH credentials
+	smtpAuth, err := parseSMTPAuth(os.Getenv("SMTP_AUTH_USERS"), os.Getenv("SMTP_AUTH_CRAM_SECRETS"))
+	if err != nil {
+		return nil, err
+	}
+	smtpAuthRequired, err := parseBoolEnv("SMTP_AUTH_REQUIRED", false)
+	if err != nil {
+		return nil, err
+	}
+	if smtpAuthRequired {
+		if smtpAuth == nil {
+			return nil, fmt.Errorf("SMTP_AUTH_REQUIRED requires SMTP_AUTH_USERS or SMTP_AUTH_CRAM_SECRETS")
 		}
+		smtpAuth.Required = true
+	}
+
+	// Parse TLS settings
+	tlsEnable, err := parseBoolEnv("TLS_ENABLE", false)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate TLS configuration
@@ -96,26 +591,686 @@ func loadConfig() (*Config, error) {
 			return nil, fmt.Errorf("TLS key file not found: %s", tlsKeyPath)
 		}
 	}
+	if smtpsPort != 0 && !tlsEnable {
+		return nil, fmt.Errorf("SMTPS_LISTEN_PORT requires TLS_ENABLE=true with a certificate")
+	}
+	smtpRequireTLS, err := parseBoolEnv("SMTP_REQUIRE_TLS", false)
+	if err != nil {
+		return nil, err
+	}
+	if smtpRequireTLS && !tlsEnable {
+		return nil, fmt.Errorf("SMTP_REQUIRE_TLS requires TLS_ENABLE=true with a certificate")
+	}
+	smtpMaxBytes := int64(DefaultMaxMessageBytes)
+	if value := os.Getenv("SMTP_MAX_MESSAGE_BYTES"); value != "" {
+		smtpMaxBytes, err = parseByteSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_MAX_MESSAGE_BYTES: %w", err)
+		}
+	}
+
+	// Parse the message rate limits of the SMTP listeners
+	smtpRateLimit, err := parseRateLimit(os.Getenv("SMTP_RATE_LIMIT"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_RATE_LIMIT: %w", err)
+	}
+	smtpIPRateLimit, err := parseRateLimit(os.Getenv("SMTP_RATE_LIMIT_PER_IP"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_RATE_LIMIT_PER_IP: %w", err)
+	}
+	spfPolicy, err := parseSPFPolicy(os.Getenv("SPF_POLICY"))
+	if err != nil {
+		return nil, err
+	}
+	dmarcPolicy, err := parseDMARCPolicy(os.Getenv("DMARC_POLICY"))
+	if err != nil {
+		return nil, err
+	}
+	var greylistDelay time.Duration
+	if value := os.Getenv("GREYLIST_DELAY"); value != "" {
+		greylistDelay, err = time.ParseDuration(value)
+		if err != nil || greylistDelay < time.Second || greylistDelay >= GreylistRetryWindow {
+			return nil, fmt.Errorf("invalid GREYLIST_DELAY '%s': use a duration under 24h such as 5m", value)
+		}
+	}
+	shutdownTimeout := DefaultShutdownTimeout
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		shutdownTimeout, err = time.ParseDuration(value)
+		if err != nil || shutdownTimeout < 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT '%s': use a duration such as 30s, or 0 to not wait", value)
+		}
+	}
+
+	// Parse the optional LMTP socket for a local MTA
+	lmtpSocket := strings.TrimSpace(os.Getenv("LMTP_SOCKET"))
+	if lmtpSocket != "" && !filepath.IsAbs(lmtpSocket) {
+		return nil, fmt.Errorf("LMTP_SOCKET must be an absolute path, got '%s'", lmtpSocket)
+	}
+	lmtpSocketMode, err := parseLMTPSocketMode(os.Getenv("LMTP_SOCKET_MODE"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Low-memory mode lowers the defaults below; explicit settings still win
+	lowMemory, err := parseBoolEnv("LOW_MEMORY_MODE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the history of recent deliveries
+	historySize := DefaultHistorySize
+	if lowMemory {
+		historySize = LowMemoryHistorySize
+	}
+	if value := os.Getenv("HISTORY_SIZE"); value != "" {
+		historySize, err = strconv.Atoi(value)
+		if err != nil || historySize < 0 {
+			return nil, fmt.Errorf("invalid HISTORY_SIZE '%s': must be zero or a positive integer", value)
+		}
+	}
+	if chatSearch && historySize == 0 {
+		return nil, fmt.Errorf("CHAT_SEARCH requires a HISTORY_SIZE above 0")
+	}
+	historyFile := strings.TrimSpace(os.Getenv("HISTORY_FILE"))
+	if historyFile != "" {
+		if info, err := os.Stat(filepath.Dir(historyFile)); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid HISTORY_FILE '%s': directory does not exist", historyFile)
+		}
+	}
+
+	// Parse lookup cache sizes
+	cacheSize := DefaultCacheSize
+	if lowMemory {
+		cacheSize = LowMemoryCacheSize
+	}
+	if value := os.Getenv("CACHE_SIZE"); value != "" {
+		cacheSize, err = strconv.Atoi(value)
+		if err != nil || cacheSize <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_SIZE '%s': must be a positive integer", value)
+		}
+	}
+	cacheSizes, err := parseCacheSizes(os.Getenv("CACHE_SIZES"), cacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the limits on concurrent SMTP connections
+	maxConnections, maxConnsPerIP := DefaultMaxConnections, DefaultMaxConnectionsPerIP
+	if lowMemory {
+		maxConnections, maxConnsPerIP = LowMemoryMaxConnections, LowMemoryMaxConnectionsPerIP
+	}
+	connectionSettings := []struct {
+		name  string
+		value *int
+	}{
+		{"SMTP_MAX_CONNECTIONS", &maxConnections},
+		{"SMTP_MAX_CONNECTIONS_PER_IP", &maxConnsPerIP},
+	}
+	for _, setting := range connectionSettings {
+		if value := os.Getenv(setting.name); value != "" {
+			*setting.value, err = strconv.Atoi(value)
+			if err != nil || *setting.value < 0 {
+				return nil, fmt.Errorf("invalid %s '%s': must be zero or a positive integer", setting.name, value)
+			}
+		}
+	}
+
+	// Parse MIME parser limits
+	parseLimits := DefaultParseLimits
+	if lowMemory {
+		parseLimits = LowMemoryParseLimits
+	}
+	limitSettings := []struct {
+		name  string
+		value *int
+	}{
+		{"MAX_MIME_DEPTH", &parseLimits.MaxMIMEDepth},
+		{"MAX_MIME_PARTS", &parseLimits.MaxMIMEParts},
+		{"MAX_HEADER_BYTES", &parseLimits.MaxHeaderBytes},
+		{"MAX_HEADER_COUNT", &parseLimits.MaxHeaderCount},
+	}
+	for _, setting := range limitSettings {
+		value, err := parsePositiveIntEnv(setting.name, *setting.value)
+		if err != nil {
+			return nil, err
+		}
+		*setting.value = value
+	}
+
+	// Parse the policy for messages that cannot be parsed
+	parseFailurePolicy := strings.ToLower(os.Getenv("PARSE_FAILURE_POLICY"))
+	switch parseFailurePolicy {
+	case "":
+		parseFailurePolicy = ParseFailureReject
+	case ParseFailureReject, ParseFailureForward:
+	default:
+		return nil, fmt.Errorf("invalid PARSE_FAILURE_POLICY value '%s': use reject/forward", parseFailurePolicy)
+	}
+
+	// Parse the policy for emails without a body
+	emptyBodyPolicy := strings.ToLower(strings.TrimSpace(os.Getenv("EMPTY_BODY_POLICY")))
+	switch emptyBodyPolicy {
+	case "":
+		emptyBodyPolicy = EmptyBodySubject
+	case EmptyBodySubject, EmptyBodyDrop, EmptyBodyPlaceholder:
+	default:
+		return nil, fmt.Errorf("invalid EMPTY_BODY_POLICY value '%s': use subject/drop/placeholder", emptyBodyPolicy)
+	}
+	emptyBodyText := strings.TrimSpace(os.Getenv("EMPTY_BODY_TEXT"))
+	if emptyBodyText == "" {
+		emptyBodyText = DefaultEmptyBodyText
+	}
+
+	// Parse the guard against mail delivered long after it was sent
+	var maxMessageAge time.Duration
+	if value := os.Getenv("MAX_MESSAGE_AGE"); value != "" {
+		maxMessageAge, err = time.ParseDuration(value)
+		if err != nil || maxMessageAge < time.Minute {
+			return nil, fmt.Errorf("invalid MAX_MESSAGE_AGE '%s': use a duration of at least 1m such as 2h", value)
+		}
+	}
+	stalePolicy, err := parseStalePolicy(os.Getenv("STALE_POLICY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid STALE_POLICY: %w", err)
+	}
+
+	// Parse compressed attachment handling
+	inlineCompressed, err := parseBoolEnv("COMPRESSED_ATTACHMENT_INLINE", false)
+	if err != nil {
+		return nil, err
+	}
+	compressedMaxBytes := DefaultCompressedAttachmentMaxBytes
+	if lowMemory {
+		compressedMaxBytes = LowMemoryCompressedMaxBytes
+	}
+	compressedMaxBytes, err = parsePositiveIntEnv("COMPRESSED_ATTACHMENT_MAX_BYTES", compressedMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	compressedLines, err := parsePositiveIntEnv("COMPRESSED_ATTACHMENT_LINES", DefaultCompressedAttachmentLines)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse attachment spooling, always on in low-memory mode
+	spoolAttachments, err := parseBoolEnv("ATTACHMENT_SPOOL", lowMemory)
+	if err != nil {
+		return nil, err
+	}
+	spoolBytes := DefaultAttachmentSpoolBytes
+	if lowMemory {
+		spoolBytes = 0
+	}
+	spoolBytes, err = parsePositiveIntEnv("ATTACHMENT_SPOOL_BYTES", spoolBytes)
+	if err != nil {
+		return nil, err
+	}
+	var attachmentSpool *AttachmentSpool
+	if spoolAttachments {
+		spoolDir := os.Getenv("ATTACHMENT_SPOOL_DIR")
+		if spoolDir != "" {
+			if info, err := os.Stat(spoolDir); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("ATTACHMENT_SPOOL_DIR '%s' is not a directory", spoolDir)
+			}
+		}
+		attachmentSpool = &AttachmentSpool{Dir: spoolDir, MinBytes: spoolBytes}
+	}
 
-	return &Config{
+	// The state file is created in its directory, which must exist
+	stateFile := strings.TrimSpace(os.Getenv("STATE_FILE"))
+	if stateFile != "" {
+		if info, err := os.Stat(filepath.Dir(stateFile)); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid STATE_FILE '%s': directory does not exist", stateFile)
+		}
+	}
+	stateBackend, err := parseStateBackend(os.Getenv("STATE_BACKEND"))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case stateBackend == StateBackendRedis && redisOptions == nil:
+		return nil, fmt.Errorf("STATE_BACKEND=redis requires REDIS_URL")
+	case stateBackend != StateBackendRedis && os.Getenv("STATE_BACKEND") != "" && stateFile == "":
+		return nil, fmt.Errorf("STATE_BACKEND=%s requires STATE_FILE", stateBackend)
+	case os.Getenv("STATE_BACKEND") == "" && isJSONStateFile(stateFile):
+		// Keep reading state files written before STATE_BACKEND existed
+		log.Printf("STATE_FILE %s is a JSON state file, using STATE_BACKEND=json", stateFile)
+		stateBackend = StateBackendJSON
+	}
+
+	// Parse per-destination options
+	destinationOptions, err := parseDestinationOptions(os.Getenv("DESTINATION_OPTIONS"))
+	if err != nil {
+		return nil, err
+	}
+	for key, options := range destinationOptions {
+		if bot := options.Get("bot"); bot != "" && telegramBots[bot] == "" {
+			return nil, fmt.Errorf("invalid DESTINATION_OPTIONS for %s: telegram bot '%s' needs TELEGRAM_BOT_TOKEN_%s", key, bot, strings.ToUpper(strings.ReplaceAll(bot, "-", "_")))
+		}
+	}
+
+	// Parse how mail with several recipients is delivered
+	multiRecipientPolicy, err := parseMultiRecipientPolicy(os.Getenv("MULTI_RECIPIENT_POLICY"))
+	if err != nil {
+		return nil, err
+	}
+	fanoutAliases, err := parseFanoutAliases(os.Getenv("FANOUT_ALIASES"))
+	if err != nil {
+		return nil, err
+	}
+	addressMacros, err := parseAddressMacros(os.Getenv("ADDRESS_MACROS"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse inbound webhook settings
+	inboundListenAddr := os.Getenv("INBOUND_WEBHOOK_LISTEN")
+	mailgunSigningKey := os.Getenv("MAILGUN_SIGNING_KEY")
+	var sesTopicARNs []string
+	for _, arn := range strings.Split(os.Getenv("SES_SNS_TOPIC_ARNS"), ",") {
+		if arn = strings.TrimSpace(arn); arn != "" {
+			sesTopicARNs = append(sesTopicARNs, arn)
+		}
+	}
+	if inboundListenAddr != "" && mailgunSigningKey == "" && len(sesTopicARNs) == 0 {
+		return nil, fmt.Errorf("INBOUND_WEBHOOK_LISTEN requires MAILGUN_SIGNING_KEY or SES_SNS_TOPIC_ARNS")
+	}
+
+	// Parse metrics settings
+	metricsListenAddr := os.Getenv("METRICS_LISTEN")
+	metricsSummary := DefaultMetricsSummaryInterval
+	if value := os.Getenv("METRICS_SUMMARY_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid METRICS_SUMMARY_INTERVAL '%s': use a duration such as 1h, or 0 to disable", value)
+		}
+		metricsSummary = interval
+	}
+
+	// Parse syslog field handling
+	syslogEscaping, err := parseSyslogEscaping(os.Getenv("SYSLOG_FIELD_ESCAPING"))
+	if err != nil {
+		return nil, err
+	}
+	syslogFieldChars, err := parsePositiveIntEnv("SYSLOG_MAX_FIELD_CHARS", DefaultSyslogFieldChars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse admin API settings; the API sends messages, so it never runs without a token
+	adminListenAddr := os.Getenv("ADMIN_LISTEN")
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminListenAddr != "" && len(adminToken) < MinAdminTokenLength {
+		return nil, fmt.Errorf("ADMIN_LISTEN requires ADMIN_TOKEN of at least %d characters", MinAdminTokenLength)
+	}
+
+	// Parse destination checks at RCPT TO time
+	rcptVerify, err := parseBoolEnv("RCPT_VERIFY", false)
+	if err != nil {
+		return nil, err
+	}
+	rcptVerifyTTL := DefaultRcptVerifyTTL
+	if value := os.Getenv("RCPT_VERIFY_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid RCPT_VERIFY_CACHE_TTL '%s': use a duration such as 10m", value)
+		}
+		rcptVerifyTTL = ttl
+	}
+
+	// Parse daily size quotas per destination
+	sizeQuotas, err := parseSizeQuotas(os.Getenv("SIZE_QUOTAS"))
+	if err != nil {
+		return nil, err
+	}
+	sizeQuotaPolicy := strings.ToLower(strings.TrimSpace(os.Getenv("SIZE_QUOTA_POLICY")))
+	switch sizeQuotaPolicy {
+	case "":
+		sizeQuotaPolicy = SizeQuotaPolicySummary
+	case SizeQuotaPolicySummary, SizeQuotaPolicyReject:
+	default:
+		return nil, fmt.Errorf("invalid SIZE_QUOTA_POLICY '%s': use summary/reject", sizeQuotaPolicy)
+	}
+
+	// Parse the public keys of destinations that receive only encrypted mail
+	encryptionKeys, err := parseEncryptionKeys(os.Getenv("ENCRYPTION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse per-platform outbound HTTP timeouts and retries
+	httpPolicies, err := parseHTTPPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse extra severity keywords
+	severityKeywords, err := parseSeverityKeywords(os.Getenv("SEVERITY_KEYWORDS"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse title templates for platforms with native titles
+	titleTemplates, err := parseTitleTemplates()
+	if err != nil {
+		return nil, err
+	}
+	bannerTemplate, err := parseBannerTemplate()
+	if err != nil {
+		return nil, err
+	}
+	senderNames, err := parseSenderNames(os.Getenv("SENDER_NAMES"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Signed addresses let senders reach only the destinations they were issued
+	addressTokens, err := parseAddressTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	// Platform plugins are looked up in this directory at delivery time
+	pluginDir := os.Getenv("PLATFORM_PLUGIN_DIR")
+	if pluginDir != "" {
+		if info, err := os.Stat(pluginDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("PLATFORM_PLUGIN_DIR '%s' is not a directory", pluginDir)
+		}
+	}
+
+	// Custom platforms are defined entirely by HTTP_PLATFORM_<NAME>_* variables
+	httpPlatforms, err := parseHTTPPlatforms()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{
 		TelegramBotToken: telegramBotToken,
+		TelegramBots:     telegramBots,
+		TelegramUploads:  telegramUploads,
+		TelegramMaxBytes: telegramMaxBytes,
+		TelegramTypes:    telegramTypes,
+		TelegramInline:   telegramInline,
+		TelegramImageMax: telegramImageMax,
+		TelegramRetries:  telegramRetries,
+		TelegramLimit:    telegramLimit,
+		TelegramAcks:     telegramAcks,
+		TelegramReplies:  telegramReplies,
+		TelegramPins:     telegramPins,
+		TelegramReplyTTL: telegramReplyTTL,
+		TelegramSnooze:   telegramSnooze,
+		TelegramAckHook:  telegramAckHook,
+		HistorySize:      historySize,
+		HistoryFile:      historyFile,
+		ChatSearch:       chatSearch,
+		TelegramAPIURL:   telegramAPIURL,
+		TelegramProxy:    telegramProxy,
 		SlackBotToken:    slackBotToken,
+		SlackFormat:      slackMessageFormat,
+		SlackThreading:   slackThreading,
+		SlackThreadTTL:   slackThreadTTL,
+		SlackCoalesce:    slackCoalesce,
+		SlackBatch:       slackBatch,
+		SlackUploads:     slackUploads,
+		SlackColorBars:   slackColorBars,
+		SlackReports:     slackReports,
+		SlackReportChars: slackReportChars,
+		SlackColors:      slackColors,
+		SlackUnfurlLinks: slackUnfurlLinks,
+		SlackUnfurlMedia: slackUnfurlMedia,
+		SlackRetries:     slackRetries,
+		SlackChannelTTL:  slackChannelTTL,
+		SlackUserTTL:     slackUserTTL,
+		SlackAppToken:    slackAppToken,
+		SlackAPIURL:      slackAPIURL,
+		DingTalkRobots:   dingTalkRobots,
+		WeComCorpID:      weComCorpID,
+		WeComAgentID:     weComAgentID,
+		WeComSecret:      weComSecret,
+		WeComMessageType: weComMessageType,
+		MastodonURL:      mastodonURL,
+		MastodonToken:    mastodonToken,
+		MastodonMaxChars: mastodonMaxChars,
+		WhatsAppToken:    whatsAppToken,
+		WhatsAppPhoneID:  whatsAppPhoneID,
+		WhatsAppTemplate: whatsAppTemplate,
+		WhatsAppLanguage: whatsAppLanguage,
+		ZoomAccountID:    zoomAccountID,
+		ZoomClientID:     zoomClientID,
+		ZoomClientSecret: zoomClientSecret,
+		ZoomUserID:       zoomUserID,
+		VictorOpsAPIKey:  victorOpsAPIKey,
+		RedisOptions:     redisOptions,
+		RedisFormat:      redisFormat,
 		SMTPListenHost:   smtpHost,
 		SMTPListenPort:   smtpPort,
+		SMTPSListenPort:  smtpsPort,
 		AllowedNetworks:  allowedNetworks,
+		SMTPAuth:         smtpAuth,
 		TLSEnable:        tlsEnable,
 		TLSCertPath:      tlsCertPath,
 		TLSKeyPath:       tlsKeyPath,
-	}, nil
+		SMTPRequireTLS:   smtpRequireTLS,
+		SMTPMaxBytes:     smtpMaxBytes,
+		ParseLimits:      parseLimits,
+		LMTPSocket:       lmtpSocket,
+		LMTPSocketMode:   lmtpSocketMode,
+		SMTPRateLimit:    smtpRateLimit,
+		SMTPIPRateLimit:  smtpIPRateLimit,
+		MaxConnections:   maxConnections,
+		MaxConnsPerIP:    maxConnsPerIP,
+		SPFPolicy:        spfPolicy,
+		DMARCPolicy:      dmarcPolicy,
+		GreylistDelay:    greylistDelay,
+		ShutdownTimeout:  shutdownTimeout,
+
+		ParseFailurePolicy:  parseFailurePolicy,
+		FallbackDestination: strings.TrimSpace(os.Getenv("FALLBACK_DESTINATION")),
+		EmptyBodyPolicy:     emptyBodyPolicy,
+		EmptyBodyText:       emptyBodyText,
+
+		MaxMessageAge: maxMessageAge,
+		StalePolicy:   stalePolicy,
+
+		MultiRecipientPolicy: multiRecipientPolicy,
+		FanoutAliases:        fanoutAliases,
+		AddressMacros:        addressMacros,
+
+		InlineCompressedAttachments:  inlineCompressed,
+		CompressedAttachmentMaxBytes: compressedMaxBytes,
+		CompressedAttachmentLines:    compressedLines,
+
+		LowMemory:       lowMemory,
+		CacheSizes:      cacheSizes,
+		AttachmentSpool: attachmentSpool,
+		StateFile:       stateFile,
+		StateBackend:    stateBackend,
+
+		DestinationOptions: destinationOptions,
+
+		ResolverWebhookURL:   os.Getenv("RESOLVER_WEBHOOK_URL"),
+		ResolverWebhookToken: os.Getenv("RESOLVER_WEBHOOK_TOKEN"),
+
+		AddressTokens: addressTokens,
+
+		PluginDir:     pluginDir,
+		HTTPPlatforms: httpPlatforms,
+
+		HTTPPolicies: httpPolicies,
+
+		SeverityKeywords: severityKeywords,
+		TitleTemplates:   titleTemplates,
+		BannerTemplate:   bannerTemplate,
+		SenderNames:      senderNames,
+		PageKeyword:      strings.TrimSpace(os.Getenv("PAGE_KEYWORD")),
+		PageHeader:       strings.TrimSpace(os.Getenv("PAGE_HEADER")),
+
+		InboundListenAddr: inboundListenAddr,
+		MailgunSigningKey: mailgunSigningKey,
+		SESTopicARNs:      sesTopicARNs,
+
+		MetricsListenAddr: metricsListenAddr,
+		MetricsSummary:    metricsSummary,
+		SyslogEscaping:    syslogEscaping,
+		SyslogFieldChars:  syslogFieldChars,
+
+		AdminListenAddr: adminListenAddr,
+		AdminToken:      adminToken,
+
+		RcptVerify:    rcptVerify,
+		RcptVerifyTTL: rcptVerifyTTL,
+
+		SizeQuotas:      sizeQuotas,
+		SizeQuotaPolicy: sizeQuotaPolicy,
+
+		EncryptionKeys: encryptionKeys,
+
+		RelayAddr:     relayAddr,
+		RelaySecurity: relaySecurity,
+		RelayUsername: os.Getenv("SMTP_RELAY_USERNAME"),
+		RelayPassword: os.Getenv("SMTP_RELAY_PASSWORD"),
+		RelayFrom:     relayFrom,
+	}
+
+	// Refuse settings for features compiled out of this binary
+	if err := checkFeatures(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// parseBoolEnv reads a boolean environment variable, returning defaultValue when unset
+func parseBoolEnv(name string, defaultValue bool) (bool, error) {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		return defaultValue, nil
+	}
+
+	switch strings.ToLower(valueStr) {
+	case "true", "1", "yes", "on":
+		return true, nil
+	case "false", "0", "no", "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid %s value '%s': use true/false", name, valueStr)
+	}
+}
+
+// parseAPIURLEnv reads the base URL of a platform API, returning defaultValue when unset
+func parseAPIURLEnv(name, defaultValue string) (string, error) {
+	valueStr := strings.TrimSpace(os.Getenv(name))
+	if valueStr == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := url.Parse(valueStr)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid %s '%s': use an http or https URL such as http://fakeapi:8081", name, valueStr)
+	}
+	return strings.TrimSuffix(valueStr, "/"), nil
+}
+
+// parseOptionalBoolEnv reads a boolean environment variable, returning nil when it is unset
+func parseOptionalBoolEnv(name string) (*bool, error) {
+	if os.Getenv(name) == "" {
+		return nil, nil
+	}
+	value, err := parseBoolEnv(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// parsePositiveIntEnv reads a positive integer environment variable, returning defaultValue when unset
+func parsePositiveIntEnv(name string, defaultValue int) (int, error) {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", name, valueStr, err)
+	}
+	if value < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %d", name, value)
+	}
+
+	return value, nil
+}
+
+// parseTelegramBots reads the TELEGRAM_BOT_TOKEN_<NAME> variables of named bots. A bot is addressed
+// as <id>@<name>.telegram, with the name lowercased and underscores turned into dashes
+func parseTelegramBots() (map[string]string, error) {
+	const prefix = "TELEGRAM_BOT_TOKEN_"
+	bots := make(map[string]string)
+
+	for _, entry := range os.Environ() {
+		key, token, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, prefix) || token == "" {
+			continue
+		}
+		name := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(key, prefix), "_", "-"))
+		if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" || strings.HasPrefix(name, "-") {
+			return nil, fmt.Errorf("invalid Telegram bot variable %s: use letters, digits and underscores after %s", key, prefix)
+		}
+		bots[name] = token
+	}
+
+	return bots, nil
+}
+
+// parseDingTalkRobots parses DINGTALK_ROBOTS entries of the form name=access_token[:secret]
+func parseDingTalkRobots(robotsStr string) (map[string]DingTalkRobot, error) {
+	robots := make(map[string]DingTalkRobot)
+	if robotsStr == "" {
+		return robots, nil
+	}
+
+	for _, entry := range strings.Split(robotsStr, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, credentials, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || credentials == "" {
+			return nil, fmt.Errorf("invalid DINGTALK_ROBOTS entry '%s': use name=access_token[:secret]", entry)
+		}
+
+		accessToken, secret, _ := strings.Cut(credentials, ":")
+		robots[name] = DingTalkRobot{
+			AccessToken: strings.TrimSpace(accessToken),
+			Secret:      strings.TrimSpace(secret),
+		}
+	}
+
+	return robots, nil
 }
 
 // Application represents the main application
 type Application struct {
-	Config         *Config
-	TelegramClient *TelegramClient
-	SlackClient    *SlackClient
-	EmailProcessor *EmailProcessor
-	SMTPServer     *SMTPServer
+	Config          *Config
+	TelegramClient  *TelegramClient
+	SlackClient     *SlackClient
+	DingTalkClient  *DingTalkClient
+	WeComClient     *WeComClient
+	MastodonClient  *MastodonClient
+	WhatsAppClient  *WhatsAppClient
+	ZoomClient      *ZoomClient
+	VictorOpsClient *VictorOpsClient
+	RedisClient     *RedisClient
+	EmailProcessor  *EmailProcessor
+	SMTPServer      *SMTPServer
+	InboundServer   *InboundServer
+	MetricsServer   *MetricsServer // nil without METRICS_LISTEN
+	AdminServer     *AdminServer   // nil without ADMIN_LISTEN
+	SlackReplies    *SlackReplyBridge
+	TelegramPollers []*TelegramPoller // Receive button presses, one per bot
+	State           *StateStore       // nil without STATE_FILE
 }
 
 // loadTLSConfig loads TLS configuration if enabled
@@ -144,7 +1299,7 @@ func loadTLSConfig(config *Config) (*tls.Config, error) {
 }
 
 // validatePlatformTokens validates all configured platform tokens
-func validatePlatformTokens(telegramClient *TelegramClient, slackClient *SlackClient) []error {
+func validatePlatformTokens(telegramClient *TelegramClient, slackClient *SlackClient, weComClient *WeComClient, mastodonClient *MastodonClient, whatsAppClient *WhatsAppClient, zoomClient *ZoomClient, redisClient *RedisClient) []error {
 	var errors []error
 
 	if telegramClient != nil {
@@ -165,6 +1320,51 @@ func validatePlatformTokens(telegramClient *TelegramClient, slackClient *SlackCl
 		}
 	}
 
+	if weComClient != nil {
+		log.Println("Testing WeCom application credentials...")
+		if err := weComClient.TestConnection(); err != nil {
+			errors = append(errors, fmt.Errorf("WeCom validation failed: %w", err))
+		} else {
+			log.Println("WeCom application credentials validated successfully!")
+		}
+	}
+
+	if mastodonClient != nil {
+		log.Println("Testing Mastodon access token...")
+		if err := mastodonClient.TestConnection(); err != nil {
+			errors = append(errors, fmt.Errorf("Mastodon validation failed: %w", err))
+		} else {
+			log.Println("Mastodon access token validated successfully!")
+		}
+	}
+
+	if whatsAppClient != nil {
+		log.Println("Testing WhatsApp access token...")
+		if err := whatsAppClient.TestConnection(); err != nil {
+			errors = append(errors, fmt.Errorf("WhatsApp validation failed: %w", err))
+		} else {
+			log.Println("WhatsApp access token validated successfully!")
+		}
+	}
+
+	if zoomClient != nil {
+		log.Println("Testing Zoom OAuth credentials...")
+		if err := zoomClient.TestConnection(); err != nil {
+			errors = append(errors, fmt.Errorf("Zoom validation failed: %w", err))
+		} else {
+			log.Println("Zoom OAuth credentials validated successfully!")
+		}
+	}
+
+	if redisClient != nil {
+		log.Println("Testing Redis connection...")
+		if err := redisClient.TestConnection(); err != nil {
+			errors = append(errors, fmt.Errorf("Redis validation failed: %w", err))
+		} else {
+			log.Println("Redis connection validated successfully!")
+		}
+	}
+
 	return errors
 }
 
@@ -179,37 +1379,280 @@ func NewApplication(config *Config) (*Application, error) {
 	// Initialize platform clients
 	var telegramClient *TelegramClient
 	var slackClient *SlackClient
+	var dingTalkClient *DingTalkClient
+	var weComClient *WeComClient
+	var mastodonClient *MastodonClient
+	var whatsAppClient *WhatsAppClient
+	var zoomClient *ZoomClient
+	var victorOpsClient *VictorOpsClient
+	var redisClient *RedisClient
 
 	if config.TelegramBotToken != "" {
-		telegramClient = NewTelegramClient(config.TelegramBotToken)
+		telegramClient = newTelegramBot(config, config.TelegramBotToken)
+	}
+
+	// Named bots share the Telegram settings; each has its own rate limits
+	telegramBots := make(map[string]*TelegramClient)
+	for name, token := range config.TelegramBots {
+		telegramBots[name] = newTelegramBot(config, token)
+		log.Printf("Telegram bot %s enabled", name)
 	}
 
 	if config.SlackBotToken != "" {
-		slackClient = NewSlackClient(config.SlackBotToken)
+		slackClient = NewSlackClient(config.SlackBotToken, config.SlackFormat)
+		slackClient.APIURL = config.SlackAPIURL
+		slackClient.UploadAttachments = config.SlackUploads
+		slackClient.ColorBars = config.SlackColorBars
+		slackClient.Reports = config.SlackReports
+		slackClient.ReportChars = config.SlackReportChars
+		slackClient.SeverityColors = config.SlackColors
+		slackClient.UnfurlLinks = config.SlackUnfurlLinks
+		slackClient.UnfurlMedia = config.SlackUnfurlMedia
+		slackClient.RateLimitRetries = config.SlackRetries
+		slackClient.SetCaches(config.CacheSizes, config.SlackChannelTTL, config.SlackUserTTL)
+		if config.SlackThreading != "off" {
+			slackClient.Threads = NewSlackThreadCache(config.SlackThreadTTL, config.SlackThreading == "subject")
+			if config.LowMemory {
+				slackClient.Threads.MaxEntries = LowMemorySlackThreadCacheSize
+			}
+		}
+		if config.SlackCoalesce > 0 {
+			slackClient.Coalesce = NewSlackCoalesceCache(config.SlackCoalesce)
+		}
+		if config.SlackBatch > 0 {
+			slackClient.Batcher = NewSlackBatcher(slackClient, config.SlackBatch)
+		}
+		config.HTTPPolicies["slack"].Apply(slackClient.HTTPClient)
+	}
+
+	if len(config.DingTalkRobots) > 0 {
+		dingTalkClient = NewDingTalkClient(config.DingTalkRobots)
+		config.HTTPPolicies["dingtalk"].Apply(dingTalkClient.HTTPClient)
+	}
+
+	if config.WeComCorpID != "" {
+		weComClient = NewWeComClient(config.WeComCorpID, config.WeComAgentID, config.WeComSecret, config.WeComMessageType)
+		config.HTTPPolicies["wecom"].Apply(weComClient.HTTPClient)
+	}
+
+	if config.MastodonToken != "" {
+		mastodonClient = NewMastodonClient(config.MastodonURL, config.MastodonToken, config.MastodonMaxChars)
+		config.HTTPPolicies["mastodon"].Apply(mastodonClient.HTTPClient)
+	}
+
+	if config.WhatsAppToken != "" {
+		whatsAppClient = NewWhatsAppClient(config.WhatsAppToken, config.WhatsAppPhoneID, config.WhatsAppTemplate, config.WhatsAppLanguage)
+		config.HTTPPolicies["whatsapp"].Apply(whatsAppClient.HTTPClient)
+	}
+
+	if config.ZoomAccountID != "" {
+		zoomClient = NewZoomClient(config.ZoomAccountID, config.ZoomClientID, config.ZoomClientSecret, config.ZoomUserID)
+		config.HTTPPolicies["zoom"].Apply(zoomClient.HTTPClient)
+	}
+
+	if config.VictorOpsAPIKey != "" {
+		victorOpsClient = NewVictorOpsClient(config.VictorOpsAPIKey)
+		config.HTTPPolicies["victorops"].Apply(victorOpsClient.HTTPClient)
+	}
+
+	if config.RedisOptions != nil {
+		redisClient = NewRedisClient(*config.RedisOptions, config.RedisFormat)
+	}
+
+	// Initialize the relay for emails generated by the bridge
+	var relay *SMTPRelay
+	if config.RelayAddr != "" {
+		relay = NewSMTPRelay(config.RelayAddr, config.RelaySecurity, config.RelayUsername, config.RelayPassword, config.RelayFrom)
+	}
+
+	// Keep recent deliveries for /search and exports
+	var history *AlertHistory
+	if config.HistorySize > 0 || config.HistoryFile != "" {
+		history = NewAlertHistory(config.HistorySize)
+	}
+	if config.HistoryFile != "" {
+		if err := history.OpenFile(config.HistoryFile); err != nil {
+			return nil, err
+		}
+	}
+	var searchHistory *AlertHistory
+	if config.ChatSearch {
+		searchHistory = history
+	}
+
+	// Initialize the Slack reply bridge; it must exist before messages are posted so threads are recorded
+	var slackReplies *SlackReplyBridge
+	if config.SlackAppToken != "" {
+		slackReplies = NewSlackReplyBridge(config.SlackAppToken, slackClient, relay, config.SlackThreadTTL, searchHistory)
 	}
 
 	// Initialize email processor with platform clients
-	emailProcessor := NewEmailProcessor(telegramClient, slackClient)
+	emailProcessor := NewEmailProcessor(config, telegramClient, slackClient, dingTalkClient, weComClient, mastodonClient, whatsAppClient, zoomClient, victorOpsClient, redisClient)
+	emailProcessor.TelegramBots = telegramBots
+	emailProcessor.History = history
+
+	// Button presses and commands reach the bot that sent the alert, so every bot polls for them
+	var telegramPollers []*TelegramPoller
+	if config.TelegramAcks {
+		emailProcessor.TelegramAcks = NewTelegramAcks(config.TelegramSnooze, config.TelegramAckHook)
+	}
+	if config.TelegramReplies {
+		emailProcessor.TelegramReplies = NewTelegramReplies(relay, config.TelegramReplyTTL)
+	}
+	if config.TelegramPins {
+		emailProcessor.TelegramPins = NewTelegramPins()
+	}
+	if config.TelegramAcks || config.ChatSearch || config.TelegramReplies {
+		if telegramClient != nil {
+			telegramPollers = append(telegramPollers, NewTelegramPoller("", telegramClient, emailProcessor.TelegramAcks, searchHistory, emailProcessor.TelegramReplies))
+		}
+		for name, bot := range telegramBots {
+			telegramPollers = append(telegramPollers, NewTelegramPoller(name, bot, emailProcessor.TelegramAcks, searchHistory, emailProcessor.TelegramReplies))
+		}
+	}
+	emailProcessor.SizeQuotas = NewSizeQuotas(config.SizeQuotas, config.SizeQuotaPolicy)
+	if config.RcptVerify {
+		emailProcessor.RcptVerifier = NewRecipientVerifier(config.RcptVerifyTTL, config.CacheSizes[CacheRcptVerify])
+	}
+
+	// Report the lookup caches with the metrics
+	if slackClient != nil {
+		emailProcessor.Metrics.AddCaches(slackClient.Caches()...)
+	}
+	if emailProcessor.RcptVerifier != nil {
+		emailProcessor.Metrics.AddCaches(emailProcessor.RcptVerifier.Cache)
+	}
+	if _, _, _, err := emailProcessor.fallbackDestination(); err != nil {
+		return nil, err
+	}
+	if err := emailProcessor.checkAddressMacros(); err != nil {
+		return nil, err
+	}
+	if err := emailProcessor.checkFanoutAliases(); err != nil {
+		return nil, err
+	}
+
+	var greylist *Greylist
+	if config.GreylistDelay > 0 {
+		greylist = NewGreylist(config.GreylistDelay)
+	}
+
+	// Restore threads, coalesced alerts and greylisted senders from before the last restart
+	var state *StateStore
+	if config.StateFile != "" || config.StateBackend == StateBackendRedis {
+		backend, err := openStateBackend(config.StateBackend, config.StateFile, config.RedisOptions)
+		if err != nil {
+			return nil, err
+		}
+		state = NewStateStore(backend)
+		if slackClient != nil && slackClient.Threads != nil {
+			state.Register("slack_threads", slackClient.Threads)
+		}
+		if slackClient != nil && slackClient.Coalesce != nil {
+			state.Register("slack_coalesce", slackClient.Coalesce)
+		}
+		if greylist != nil {
+			state.Register("greylist", greylist)
+		}
+		if err := state.Load(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize SMTP server with TLS support
-	smtpServer := NewSMTPServer(emailProcessor, config.SMTPListenHost, config.SMTPListenPort, config.AllowedNetworks, tlsConfig)
+	smtpServer := NewSMTPServer(emailProcessor, config.SMTPListenHost, config.SMTPListenPort, config.AllowedNetworks, tlsConfig, config.SMTPAuth)
+	if config.SMTPSListenPort != 0 {
+		smtpServer.EnableSMTPS(config.SMTPListenHost, config.SMTPSListenPort)
+	}
+	if config.SMTPRequireTLS {
+		smtpServer.RequireTLS()
+	}
+	if config.LMTPSocket != "" {
+		smtpServer.EnableLMTP(config.LMTPSocket, config.LMTPSocketMode)
+	}
+	if config.SMTPMaxBytes != DefaultMaxMessageBytes {
+		smtpServer.SetMaxMessageBytes(config.SMTPMaxBytes)
+	}
+	if config.MaxConnections > 0 || config.MaxConnsPerIP > 0 {
+		smtpServer.SetConnectionLimits(config.MaxConnections, config.MaxConnsPerIP)
+	}
+	if config.SMTPRateLimit.Count > 0 || config.SMTPIPRateLimit.Count > 0 {
+		smtpServer.SetRateLimits(config.SMTPRateLimit, config.SMTPIPRateLimit)
+	}
+	if greylist != nil {
+		smtpServer.SetGreylist(greylist)
+	}
+
+	// Initialize the inbound webhook server for cloud-received mail if configured
+	var inboundServer *InboundServer
+	if config.InboundListenAddr != "" {
+		inboundServer = NewInboundServer(emailProcessor, config.InboundListenAddr, config.MailgunSigningKey, config.SESTopicARNs)
+	}
+
+	// Expose rejection counters for scraping if configured
+	var metricsServer *MetricsServer
+	if config.MetricsListenAddr != "" {
+		metricsServer = NewMetricsServer(emailProcessor.Metrics, config.MetricsListenAddr)
+	}
+
+	// Serve operator endpoints if configured
+	var adminServer *AdminServer
+	if config.AdminListenAddr != "" {
+		adminServer = NewAdminServer(emailProcessor, config.AdminListenAddr, config.AdminToken)
+	}
 
 	return &Application{
-		Config:         config,
-		TelegramClient: telegramClient,
-		SlackClient:    slackClient,
-		EmailProcessor: emailProcessor,
-		SMTPServer:     smtpServer,
+		Config:          config,
+		TelegramClient:  telegramClient,
+		SlackClient:     slackClient,
+		DingTalkClient:  dingTalkClient,
+		WeComClient:     weComClient,
+		MastodonClient:  mastodonClient,
+		WhatsAppClient:  whatsAppClient,
+		ZoomClient:      zoomClient,
+		VictorOpsClient: victorOpsClient,
+		RedisClient:     redisClient,
+		EmailProcessor:  emailProcessor,
+		SMTPServer:      smtpServer,
+		InboundServer:   inboundServer,
+		MetricsServer:   metricsServer,
+		AdminServer:     adminServer,
+		SlackReplies:    slackReplies,
+		TelegramPollers: telegramPollers,
+		State:           state,
 	}, nil
 }
 
+// newTelegramBot creates a Telegram client with the configured upload, retry and rate limit settings
+func newTelegramBot(config *Config, token string) *TelegramClient {
+	client := NewTelegramClient(token)
+	client.APIURL = config.TelegramAPIURL
+	if config.TelegramProxy != nil {
+		client.UseProxy(config.TelegramProxy)
+	}
+	client.UploadAttachments = config.TelegramUploads
+	client.AttachmentMaxBytes = int64(config.TelegramMaxBytes)
+	client.AttachmentTypes = config.TelegramTypes
+	client.InlineImages = config.TelegramInline
+	client.InlineMaxBytes = int64(config.TelegramImageMax)
+	client.RateLimitRetries = config.TelegramRetries
+	if !config.TelegramLimit {
+		client.Limiter = nil
+	}
+	config.HTTPPolicies["telegram"].Apply(client.HTTPClient)
+	return client
+}
+
 // Start starts the application
 func (app *Application) Start() error {
 	log.Println("Starting email2dm - SMTP to Chat Platform Bridge...")
+	if excluded := ExcludedFeatures(); len(excluded) > 0 {
+		log.Printf("Built without: %s", strings.Join(excluded, ", "))
+	}
 
 	// Test platform tokens
 	log.Println("Validating platform tokens...")
-	tokenErrors := validatePlatformTokens(app.TelegramClient, app.SlackClient)
+	tokenErrors := validatePlatformTokens(app.TelegramClient, app.SlackClient, app.WeComClient, app.MastodonClient, app.WhatsAppClient, app.ZoomClient, app.RedisClient)
 	if len(tokenErrors) > 0 {
 		for _, err := range tokenErrors {
 			log.Printf("Warning: %v", err)
@@ -223,6 +1666,13 @@ func (app *Application) Start() error {
 			log.Printf("Warning: Could not get Telegram bot info: %v", err)
 		}
 	}
+	for name, bot := range app.EmailProcessor.TelegramBots {
+		if err := bot.TestConnection(); err != nil {
+			log.Printf("Warning: Telegram bot %s validation failed: %v", name, err)
+		} else if err := bot.GetBotInfo(); err != nil {
+			log.Printf("Warning: Could not get Telegram bot %s info: %v", name, err)
+		}
+	}
 	if app.SlackClient != nil {
 		if err := app.SlackClient.GetBotInfo(); err != nil {
 			log.Printf("Warning: Could not get Slack bot info: %v", err)
@@ -233,10 +1683,65 @@ func (app *Application) Start() error {
 	log.Printf("Starting SMTP server on %s", app.SMTPServer.GetServerAddress())
 
 	// Start server in a goroutine so we can handle shutdown signals
-	serverErr := make(chan error, 1)
+	serverErr := make(chan error, 3)
 	go func() {
 		serverErr <- app.SMTPServer.Start()
 	}()
+	if app.SMTPServer.SMTPSAddress() != "" {
+		go func() {
+			if err := app.SMTPServer.StartSMTPS(); err != nil {
+				serverErr <- fmt.Errorf("SMTPS listener: %w", err)
+			}
+		}()
+	}
+	if app.SMTPServer.LMTPSocket() != "" {
+		go func() {
+			if err := app.SMTPServer.StartLMTP(); err != nil {
+				serverErr <- fmt.Errorf("LMTP listener: %w", err)
+			}
+		}()
+	}
+
+	// Start inbound webhook server alongside SMTP
+	inboundErr := make(chan error, 1)
+	if app.InboundServer != nil {
+		go func() {
+			inboundErr <- app.InboundServer.Start()
+		}()
+	}
+
+	// Listen for Slack thread replies; the bridge reconnects on its own
+	if app.SlackReplies != nil {
+		go app.SlackReplies.Start()
+	}
+
+	// Poll for Telegram button presses; pollers back off and retry on their own
+	for _, poller := range app.TelegramPollers {
+		go poller.Start()
+	}
+
+	if app.State != nil {
+		app.State.Start()
+	}
+
+	// Metrics are served alongside SMTP; a failing metrics server does not stop delivery
+	if app.MetricsServer != nil {
+		go func() {
+			if err := app.MetricsServer.Start(); err != nil {
+				log.Printf("Warning: metrics server error: %v", err)
+			}
+		}()
+	}
+	if app.AdminServer != nil {
+		go func() {
+			if err := app.AdminServer.Start(); err != nil {
+				log.Printf("Warning: admin API error: %v", err)
+			}
+		}()
+	}
+	if app.Config.MetricsSummary > 0 {
+		app.EmailProcessor.Metrics.StartSummary(app.Config.MetricsSummary)
+	}
 
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -249,6 +1754,8 @@ func (app *Application) Start() error {
 	select {
 	case err := <-serverErr:
 		return fmt.Errorf("SMTP server error: %w", err)
+	case err := <-inboundErr:
+		return fmt.Errorf("inbound webhook server error: %w", err)
 	case sig := <-sigChan:
 		log.Printf("Received signal: %v", sig)
 		return app.Stop()
@@ -259,10 +1766,54 @@ func (app *Application) Start() error {
 func (app *Application) Stop() error {
 	log.Println("Shutting down SMTP to Telegram Bridge...")
 
-	// Stop SMTP server
-	if err := app.SMTPServer.Stop(); err != nil {
-		log.Printf("Error stopping SMTP server: %v", err)
-		return err
+	// Stop listening for Slack replies
+	if app.SlackReplies != nil {
+		app.SlackReplies.Stop()
+	}
+	for _, poller := range app.TelegramPollers {
+		poller.Stop()
+	}
+
+	// Stop inbound webhook server
+	if app.InboundServer != nil {
+		if err := app.InboundServer.Stop(); err != nil {
+			log.Printf("Error stopping inbound webhook server: %v", err)
+		}
+	}
+
+	// Stop accepting mail and let messages in progress finish
+	ctx, cancel := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout)
+	stopErr := app.SMTPServer.Shutdown(ctx)
+	cancel()
+	if stopErr != nil {
+		log.Printf("Error stopping SMTP server: %v", stopErr)
+	}
+
+	if app.AdminServer != nil {
+		if err := app.AdminServer.Stop(); err != nil {
+			log.Printf("Error stopping admin API: %v", err)
+		}
+	}
+	if app.MetricsServer != nil {
+		if err := app.MetricsServer.Stop(); err != nil {
+			log.Printf("Error stopping metrics server: %v", err)
+		}
+	}
+	app.EmailProcessor.Metrics.Stop()
+	if app.EmailProcessor.History != nil {
+		if err := app.EmailProcessor.History.Close(); err != nil {
+			log.Printf("Error closing history file: %v", err)
+		}
+	}
+
+	// Save state last so it includes messages delivered during shutdown
+	if app.State != nil {
+		if err := app.State.Stop(); err != nil {
+			log.Printf("Error saving state: %v", err)
+		}
+	}
+	if stopErr != nil {
+		return stopErr
 	}
 
 	log.Println("SMTP to Telegram Bridge stopped successfully")
@@ -279,15 +1830,142 @@ This application creates an SMTP server that forwards emails to chat platforms.
 Required Environment Variables:
   At least one platform token is required:
   TELEGRAM_BOT_TOKEN - Your Telegram bot token from @BotFather
+  TELEGRAM_BOT_TOKEN_<NAME> - Token of a named bot, addressed as <id>@<name>.telegram
   SLACK_BOT_TOKEN    - Your Slack bot token (xoxb-...)
+  DINGTALK_ROBOTS    - DingTalk custom robots as name=access_token[:secret],...
+  WECOM_CORP_ID      - WeCom corp ID (with WECOM_AGENT_ID and WECOM_SECRET)
+  MASTODON_ACCESS_TOKEN - Mastodon access token (with MASTODON_INSTANCE_URL)
+  WHATSAPP_ACCESS_TOKEN - WhatsApp Cloud API token (with WHATSAPP_PHONE_NUMBER_ID)
+  ZOOM_ACCOUNT_ID    - Zoom server-to-server OAuth account (with ZOOM_CLIENT_ID and ZOOM_CLIENT_SECRET)
+  VICTOROPS_API_KEY  - VictorOps (Splunk On-Call) REST integration API key
+  REDIS_URL          - Redis server for pub/sub output (redis://[:password@]host[:port][/db], rediss:// for TLS)
 
 Optional Environment Variables:
   SMTP_LISTEN_HOST   - IP address to bind SMTP server (default: 0.0.0.0)
   SMTP_LISTEN_PORT   - Port to bind SMTP server (default: 2525)
+  SMTPS_LISTEN_PORT  - Also accept implicit-TLS (SMTPS) connections on this port, e.g. 465 (requires TLS_ENABLE=true)
+  LMTP_SOCKET        - Also accept LMTP from a local MTA on this Unix socket, e.g. /run/email2dm/lmtp.sock
+  LMTP_SOCKET_MODE   - Octal permissions of the LMTP socket (default: 0660)
   ALLOWED_NETWORKS   - Comma-separated CIDR networks (e.g., '192.168.1.0/24,10.0.0.0/8')
+  SMTP_AUTH_USERS    - SMTP AUTH users as user:bcrypt-hash,... or the absolute path of an htpasswd file (see hash-password)
+  SMTP_AUTH_CRAM_SECRETS - CRAM-MD5 shared secrets as user:secret,... or the absolute path of a file of them
+  SMTP_AUTH_REQUIRED - Refuse MAIL FROM before a successful AUTH (true/false, default: false)
+  TELEGRAM_UPLOAD_ATTACHMENTS - Send email attachments to Telegram (true/false, default: true)
+  TELEGRAM_ATTACHMENT_MAX_BYTES - Largest attachment sent to Telegram (default: 52428800)
+  TELEGRAM_ATTACHMENT_TYPES - Comma-separated content types sent to Telegram, e.g. 'image/*,application/pdf' (default: all)
+  TELEGRAM_INLINE_IMAGES - Images embedded in the body sent as photos captioned with the subject, 0 to drop them (default: 5)
+  TELEGRAM_INLINE_IMAGE_MAX_BYTES - Largest embedded image sent (default: 10485760)
+  TELEGRAM_RATE_LIMIT_RETRIES - Retries after Telegram answers 429, waiting for retry_after (default: 3)
+  TELEGRAM_ACK_BUTTONS - Add Ack and Snooze buttons to critical alerts, polling getUpdates for presses (true/false, default: false)
+  TELEGRAM_ACK_SNOOZE - How long Snooze delivers repeats of an alert silently (default: 1h)
+  TELEGRAM_PIN_CRITICAL - Pin critical alerts until a recovery for them arrives (true/false, default: false)
+  TELEGRAM_REPLIES    - Email replies to bridged messages back to the sender via SMTP_RELAY_ADDR, polling getUpdates (true/false, default: false)
+  TELEGRAM_REPLY_TTL  - How long a bridged message accepts replies (default: 24h)
+  TELEGRAM_ACK_WEBHOOK_URL - URL receiving every button press as JSON POST
+  HISTORY_SIZE        - Recent deliveries kept in memory for /search, 0 to keep none (default: 1000, 200 in low-memory mode)
+  CHAT_SEARCH         - Answer /search <term> in Telegram chats and Slack with recent matching alerts (true/false, default: false)
+  HISTORY_FILE        - JSON Lines file every delivery is appended to, for history-export and /admin/history (default: none)
+  TELEGRAM_RATE_LIMIT - Queue messages to stay within Telegram's per-chat and global limits (true/false, default: true)
+  TELEGRAM_API_URL   - Bot API server, e.g. a fake API for integration tests (default: https://api.telegram.org)
+  TELEGRAM_PROXY_URL - Proxy for Telegram API calls: socks5://[user:password@]host:port or http://host:port
+  SLACK_MESSAGE_FORMAT - Slack layout (blocks/text, default: blocks)
+  SLACK_THREADING    - Post follow-ups as thread replies (subject/references/off, default: subject)
+  SLACK_THREAD_TTL   - How long a thread accepts follow-ups (default: 24h)
+  SLACK_COALESCE_WINDOW - Update the original message for identical alerts within this window, e.g. 10m (default: off)
+  SLACK_BATCH_WINDOW - Combine short messages to the same channel within this window into one post, e.g. 2s (default: off)
+  SLACK_UPLOAD_ATTACHMENTS - Upload email attachments to Slack (true/false, default: true)
+  SLACK_COLOR_BARS   - Color Slack messages by severity: red, yellow, green (true/false, default: false)
+  SLACK_REPORTS      - Post long bodies as a snippet or canvas behind a short message (off/snippet/canvas, default: off)
+  SLACK_REPORT_MIN_CHARS - Body length from which SLACK_REPORTS applies (default: 10000)
+  SLACK_UNFURL_LINKS - Show previews of links in Slack messages (true/false, default: Slack's choice)
+  SLACK_UNFURL_MEDIA - Show previews of images and videos in Slack messages (true/false, default: Slack's choice)
+  SLACK_SEVERITY_COLORS - Color bar per severity as level=color;... with good/warning/danger or hex (e.g. 'info=#439FE0')
+  SLACK_CHANNEL_CACHE_TTL - How long #channel name lookups are cached (default: 10m)
+  SLACK_USER_CACHE_TTL    - How long username lookups are cached (default: 24h)
+  SLACK_APP_TOKEN     - App-level token (xapp-...) to email Slack thread replies back and answer /search via Socket Mode
+  SMTP_RELAY_ADDR     - Upstream SMTP server (host:port) for emails sent by the bridge
+  SMTP_RELAY_SECURITY - starttls, tls or none (default: starttls)
+  SMTP_RELAY_USERNAME - Username for AUTH PLAIN at the relay
+  SMTP_RELAY_PASSWORD - Password for AUTH PLAIN at the relay
+  SMTP_RELAY_FROM     - Sender address of emails sent by the bridge
+  SLACK_RATE_LIMIT_RETRIES - Retries after Slack answers 429, waiting for Retry-After (default: 3)
+  SLACK_API_URL      - Web API base, e.g. a fake API for integration tests (default: https://slack.com/api)
+  WECOM_MESSAGE_TYPE - WeCom message type (markdown/text, default: markdown)
+  MASTODON_MAX_CHARS - Status character limit of the instance (default: 500, minimum: 496)
+  WHATSAPP_TEMPLATE_NAME - Approved template with {{1}}=subject, {{2}}=body (default: session text)
+  WHATSAPP_TEMPLATE_LANGUAGE - Template language code (default: en_US)
+  ZOOM_USER_ID       - Zoom user that posts the messages (default: me)
+  REDIS_MESSAGE_FORMAT - Published payload (text/json, default: text)
   TLS_ENABLE         - Enable STARTTLS support (true/false, default: false)
   TLS_CERT_PATH      - Path to TLS certificate file (required if TLS_ENABLE=true)
   TLS_KEY_PATH       - Path to TLS private key file (required if TLS_ENABLE=true)
+  SMTP_REQUIRE_TLS   - Refuse MAIL FROM and AUTH before STARTTLS (true/false, default: false)
+  SMTP_MAX_MESSAGE_BYTES - Largest message accepted, advertised with SIZE, in bytes or with KB/MB/GB (default: 1MB)
+  SMTP_RATE_LIMIT    - Messages accepted from all clients, e.g. 600/m; more are refused with 450 (default: off)
+  SMTP_RATE_LIMIT_PER_IP - Messages accepted from one client IP, e.g. 60/m or 500/h (default: off)
+  SMTP_MAX_CONNECTIONS - Concurrent SMTP connections from all clients, 0 for no limit (default: 100)
+  SMTP_MAX_CONNECTIONS_PER_IP - Concurrent SMTP connections from one client IP, 0 for no limit (default: 20)
+  SPF_POLICY         - Check SPF of MAIL FROM: off, log, annotate (show the result below messages) or reject (refuse fail) (default: off)
+  DMARC_POLICY       - Check DMARC of the From domain: off, none (show the result), quarantine (tag failures) or reject (default: off)
+  GREYLIST_DELAY     - Refuse new client/sender/recipient triples with 451 and accept retries after this long, e.g. 5m (default: off)
+  SHUTDOWN_TIMEOUT   - On SIGTERM, wait this long for messages in progress before closing connections (default: 30s)
+  MAX_MIME_DEPTH     - Maximum nested multipart levels (default: 10)
+  MAX_MIME_PARTS     - Maximum MIME parts per message (default: 100)
+  MAX_HEADER_BYTES   - Maximum size of a header section in bytes (default: 65536)
+  MAX_HEADER_COUNT   - Maximum header fields per header section (default: 200)
+  PARSE_FAILURE_POLICY - Unparsable messages: reject, or forward the undecoded body (reject/forward, default: reject)
+  FALLBACK_DESTINATION - Deliver mail for unconfigured platforms here instead of failing, as platform:id (e.g. 'telegram:123456789')
+  EMPTY_BODY_POLICY   - Emails without a body: a compact subject-only message, drop them, or a placeholder body (subject/drop/placeholder, default: subject)
+  EMPTY_BODY_TEXT     - Placeholder body for EMPTY_BODY_POLICY=placeholder (default: '(no message body)')
+  MAX_MESSAGE_AGE     - Mail sent longer ago than this, e.g. after an outage, follows STALE_POLICY (default: off)
+  STALE_POLICY        - Mail older than MAX_MESSAGE_AGE: mark (note when it was sent) or drop (default: mark)
+  MULTI_RECIPIENT_POLICY - Mail with several recipients: all, first, first-platform or alias (default: all)
+  FANOUT_ALIASES      - Addresses delivering to several destinations, as name=address,address;... (e.g. 'oncall=123456789@telegram,C0123456789@slack')
+  ADDRESS_MACROS      - Addresses deriving their destination from a table file, as pattern=file;... (e.g. 'team-%name%@alerts=/etc/email2dm/teams.txt')
+  COMPRESSED_ATTACHMENT_INLINE    - Inline .gz/.zst/.zip log attachments (true/false, default: false)
+  COMPRESSED_ATTACHMENT_MAX_BYTES - Largest compressed attachment to inline (default: 262144)
+  COMPRESSED_ATTACHMENT_LINES     - Lines to inline per attachment (default: 50)
+  LOW_MEMORY_MODE     - Smaller parser limits and caches, spooled attachments and a 48 MiB heap target for small routers (default: false)
+  CACHE_SIZE          - Entries kept per lookup cache, least recently used evicted first (default: 10000, 1000 in low-memory mode)
+  CACHE_SIZES         - Per-cache sizes as name=entries,... (slack_users, slack_channels, slack_groups, slack_dms, rcpt_verify)
+  ATTACHMENT_SPOOL    - Write large attachments to temporary files instead of memory (default: false, true in low-memory mode)
+  ATTACHMENT_SPOOL_BYTES - Attachments larger than this are spooled (default: 262144, every attachment in low-memory mode)
+  ATTACHMENT_SPOOL_DIR   - Directory for spooled attachments (default: system temp directory)
+  STATE_FILE             - File keeping Slack thread and coalescing state across restarts (default: in memory only)
+  STATE_BACKEND          - How state is kept: bbolt, sqlite, redis (uses REDIS_URL) or json (default: bbolt)
+  RESOLVER_WEBHOOK_URL   - URL that maps unrecognized recipients to platform+ID (JSON POST)
+  RESOLVER_WEBHOOK_TOKEN - Bearer token sent to the resolver webhook
+  ADDRESS_TOKEN_SECRET   - Key for signed addresses such as 123456789.tg.<signature>@bridge (see address-token)
+  ADDRESS_TOKEN_DOMAIN   - Domain of signed addresses (default: bridge)
+  ADDRESS_TOKENS_REQUIRED - Accept only signed addresses (true/false, default: false)
+  INBOUND_WEBHOOK_LISTEN - Address for SES/Mailgun inbound webhooks (e.g. '127.0.0.1:8025')
+  SES_SNS_TOPIC_ARNS  - Comma-separated SNS topics allowed to post SES notifications to /inbound/ses
+  MAILGUN_SIGNING_KEY - Mailgun HTTP webhook signing key, enables /inbound/mailgun
+  METRICS_LISTEN      - Address serving rejection and cache counters at /metrics in Prometheus format (e.g. '127.0.0.1:9125')
+  METRICS_SUMMARY_INTERVAL - Log rejections by reason at this interval, 0 to disable (default: 1h)
+  SYSLOG_FIELD_ESCAPING - Newlines and control characters in syslog fields: escape as \n, strip, or quote values logfmt-style (escape/strip/quote, default: escape)
+  SYSLOG_MAX_FIELD_CHARS - Characters kept of each syslog field value (default: 512)
+  ADMIN_LISTEN        - Address serving the admin API, e.g. POST /admin/ping (e.g. '127.0.0.1:9126')
+  ADMIN_TOKEN         - Bearer token the admin API requires, at least 16 characters
+  RCPT_VERIFY         - Reject unknown Telegram chats and Slack channels/users at RCPT TO with 550 (true/false, default: false)
+  RCPT_VERIFY_CACHE_TTL - How long a destination found to exist is trusted (default: 10m)
+  SIZE_QUOTAS         - Daily bytes per destination as platform:id=size;... with *=size for the rest, e.g. 'slack:C0123456789=50MB;*=500MB'
+  SIZE_QUOTA_POLICY   - Mail past a quota: summary (shortened, without attachments) or reject with 552 (default: summary)
+  ENCRYPTION_KEYS     - Destinations that receive only encrypted mail, as platform:id=key;... with an age recipient or the path of an age recipients file or OpenPGP public key
+  <PLATFORM>_HTTP_TIMEOUT - Per-platform request timeout, e.g. SLACK_HTTP_TIMEOUT=60s (default: 10s)
+  <PLATFORM>_HTTP_RETRIES - Retries after network errors and 5xx responses (default: 0)
+  <PLATFORM>_HTTP_BACKOFF - Wait before the first retry, doubled per retry (default: 1s)
+  TITLE_TEMPLATE      - Go template for native titles (Slack header, DingTalk, VictorOps), e.g. '{{.Severity}}: {{.Subject}}'
+  <PLATFORM>_TITLE_TEMPLATE - Title template for one platform (SLACK, DINGTALK, VICTOROPS)
+  SENDER_BANNER_TEMPLATE - Go template for a line above the body, e.g. '{{if not .AuthUser}}⚠️ unauthenticated sender {{.ClientIP}}{{end}}'
+  SENDER_NAMES        - Names shown instead of sender addresses, as address=name;@domain=name;... or a file of 'address name' lines (e.g. 'backup01@corp.example=NAS Backups')
+  SEVERITY_KEYWORDS   - Extra severity keywords as level=word,prefix*;... (e.g. 'error=hiba,vika*')
+  PAGE_KEYWORD        - Subject prefix marking a page that bypasses snoozes, silent delivery, coalescing and quotas (e.g. '[PAGE]')
+  PAGE_HEADER         - Header that marks a page when set to yes (e.g. 'X-Page')
+  PLATFORM_PLUGIN_DIR - Directory of executables handling other platforms (<id>@<name> runs <dir>/<name>)
+  HTTP_PLATFORMS      - Comma-separated names of custom platforms defined by HTTP_PLATFORM_<NAME>_URL, _METHOD, _HEADERS, _BODY,
+                        _SUCCESS_STATUS, _SUCCESS_BODY, _MAX_CHARS and _TIMEOUT (see README)
+  DESTINATION_OPTIONS - Per-destination options as platform:id=opt+opt;... (e.g. 'slack:#ops=eml')
 
 Email Address Format:
   Send emails to: <USER_ID>@<platform>
@@ -295,6 +1973,7 @@ Email Address Format:
   Telegram Examples:
     123456789@telegram        # User ID 123456789
     g1234567@telegram         # Group chat (converts to -1234567)
+    123456789@prod.telegram   # Same user, through the bot from TELEGRAM_BOT_TOKEN_PROD
   
   Slack Examples:
     U1234567890@slack         # User ID U1234567890
@@ -302,6 +1981,38 @@ Email Address Format:
     #general@slack            # Channel name #general
     username@slack            # Username (without @)
 
+  DingTalk Examples:
+    alerts@dingtalk           # Robot named 'alerts' in DINGTALK_ROBOTS
+
+  WeCom Examples:
+    zhangsan@wecom            # WeCom user ID zhangsan
+
+  Mastodon Examples:
+    "@alice@example.social"@mastodon  # Direct status to @alice@example.social
+    alice%example.social@mastodon     # Same, without quoting
+
+  WhatsApp Examples:
+    +15551234567@whatsapp     # Phone number in international format
+
+  Zoom Examples:
+    0123abcd4567ef@zoom       # Team Chat channel (JID without @conference.xmpp.zoom.us)
+
+  VictorOps Examples:
+    database@victorops        # Incident for routing key 'database'
+
+  Redis Examples:
+    dashboard.alerts@redis    # PUBLISH to channel 'dashboard.alerts'
+
+Destination Options:
+  Append +option to the address, or set them in DESTINATION_OPTIONS:
+    123456789+eml@telegram    # Also attach the original message as an .eml file
+    123456789+raw@telegram    # Forward the decoded body verbatim in a code block
+    123456789+max=1000+messages=1@telegram  # One message of at most 1000 characters
+    C1234567890+mention=here@slack  # Mention @here (or a user group) in the message
+    C1234567890+name=Nagios+icon=:rotating_light:@slack  # Post under a custom name and icon
+    C1234567890+unfurl=off@slack  # No link or media previews in the message
+    123456789+ack@telegram    # Ack and Snooze buttons on every alert (ack=off: never)
+  
 Example Usage:
   # Basic setup (plain SMTP)
   export TELEGRAM_BOT_TOKEN='123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11'
@@ -333,6 +2044,32 @@ TLS Support:
   Clients can optionally upgrade to TLS encryption after connecting
   Self-signed certificates are supported for development/internal use
 
+Commands:
+  email2dm                  Run the SMTP bridge
+  email2dm migrate-config   Print the current environment as a YAML config file
+    -o <file>               Write to a new file (mode 0600) instead of stdout
+    -all                    Include unset settings as commented-out entries
+    -redact                 Replace tokens and secrets with placeholders
+  email2dm address-book export  Print FANOUT_ALIASES, ADDRESS_MACROS with their tables and DESTINATION_OPTIONS as JSON
+    -o <file>               Write to a new file (mode 0600) instead of stdout
+  email2dm address-book import <file>  Write the exported macro tables and print the variables to set
+    -dir <dir>              Directory for the macro tables (default .)
+  email2dm address-token platform:id  Print a signed address for a destination (needs ADDRESS_TOKEN_SECRET)
+    -days <n>               Let the address expire after n days
+  email2dm hash-password    Read a password from stdin and print its bcrypt hash for SMTP_AUTH_USERS
+  email2dm selftest         Send test emails through the bridge to a mock platform and report pass/fail
+    -v                      Show the bridge's log output
+  email2dm ping <id>@<platform>  Send a test message with the configured clients and report latency and message ID
+    -v                      Show the bridge's log output
+  email2dm telegram-chats   List the chat IDs and titles of chats the Telegram bot has seen recently
+    -bot <name>             Use the named bot from TELEGRAM_BOT_TOKEN_<NAME>
+    -wait <duration>        Keep listening for new messages this long (default 1m, 0 lists pending ones only)
+  email2dm history-export   Write the deliveries in HISTORY_FILE as CSV or JSON, for reporting
+    -since <time>           First day (YYYY-MM-DD) or RFC 3339 time to export
+    -until <time>           Day or time to stop before
+    -format <csv|json>      Output format (default csv)
+    -file <path>            History file to read (default HISTORY_FILE)
+
 Use Cases:
   • Server monitoring alerts
   • Application deployment notifications  
@@ -341,7 +2078,8 @@ Use Cases:
 
 Logging:
   All email processing events are logged to syslog with format:
-  src=<source_ip> from=<sender_email> platform=<platform> user_id=<chat_id> msg=<status>`
+  src=<source_ip> from=<sender_email> platform=<platform> user_id=<chat_id> msg=<status>
+  Delivery outcomes add chunks=<n> platform_msg_id=<id> latency_ms=<ms> retries=<n> before msg`
 
 	fmt.Println(usage)
 }
@@ -353,6 +2091,63 @@ func main() {
 		return // Exit immediately after printing help
 	}
 
+	// Subcommands run instead of the bridge
+	if len(os.Args) > 1 && os.Args[1] == "migrate-config" {
+		if err := runMigrateConfig(os.Args[2:]); err != nil {
+			log.Fatalf("migrate-config: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "address-book" {
+		if err := runAddressBook(os.Args[2:]); err != nil {
+			log.Fatalf("address-book: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "address-token" {
+		if err := runAddressToken(os.Args[2:]); err != nil {
+			log.Fatalf("address-token: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		if err := runHashPassword(os.Args[2:]); err != nil {
+			log.Fatalf("hash-password: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		if err := runSelfTest(os.Args[2:]); err != nil {
+			log.Fatalf("selftest: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "ping" {
+		if err := runPing(os.Args[2:]); err != nil {
+			log.Fatalf("ping: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "telegram-chats" {
+		if err := runTelegramChats(os.Args[2:]); err != nil {
+			log.Fatalf("telegram-chats: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history-export" {
+		if err := runHistoryExport(os.Args[2:]); err != nil {
+			log.Fatalf("history-export: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fakeapi" {
+		if err := runFakeAPI(os.Args[2:]); err != nil {
+			log.Fatalf("fakeapi: %v", err)
+		}
+		return
+	}
+
 	// Load configuration
 	config, err := loadConfig()
 	if err != nil {
@@ -362,6 +2157,10 @@ func main() {
 		os.Exit(1)
 	}
 
+	if config.LowMemory {
+		applyLowMemoryRuntime()
+	}
+
 	// Create and start application
 	app, err := NewApplication(config)
 	if err != nil {
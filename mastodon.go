@@ -0,0 +1,172 @@
+//go:build !minimal && !nomastodon
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Mastodon Configuration
+const (
+	MastodonDefaultMaxLength   = 500                     // Default status length on most instances
+	MastodonMessageSendDelay   = 1000 * time.Millisecond // Delay between message chunks
+	MastodonHTTPRequestTimeout = 10 * time.Second
+	MastodonMaxUsernameLength  = 30  // Longest username Mastodon accepts
+	MastodonMaxDomainLength    = 253 // Longest DNS name an instance can have
+	MastodonContinuationMarker = "[Part 99]\n"
+
+	// MastodonMinMaxLength is the smallest status limit that leaves MinMessageBudgetChars for the
+	// text next to the longest mention and a part marker
+	MastodonMinMaxLength = MinMessageBudgetChars + len("@@\n") + MastodonMaxUsernameLength + MastodonMaxDomainLength + len(MastodonContinuationMarker)
+)
+
+// mastodonMentionBreaker keeps an @ in the text from being read as a mention of another account
+var mastodonMentionBreaker = strings.NewReplacer("@", "@\u200B")
+
+// MastodonStatus represents a status payload for the Mastodon API
+type MastodonStatus struct {
+	Status      string `json:"status"`
+	Visibility  string `json:"visibility"`
+	InReplyToID string `json:"in_reply_to_id,omitempty"`
+}
+
+// MastodonClient handles all Mastodon API interactions
+type MastodonClient struct {
+	InstanceURL string
+	AccessToken string
+	MaxLength   int // Status character limit of the instance
+	HTTPClient  *http.Client
+}
+
+// NewMastodonClient creates a new Mastodon client
+func NewMastodonClient(instanceURL, accessToken string, maxLength int) *MastodonClient {
+	return &MastodonClient{
+		InstanceURL: strings.TrimRight(instanceURL, "/"),
+		AccessToken: accessToken,
+		MaxLength:   maxLength,
+		HTTPClient: &http.Client{
+			Timeout: MastodonHTTPRequestTimeout,
+		},
+	}
+}
+
+// SendLongDirectMessage sends a direct-visibility status to an account, threading chunks as replies
+func (mc *MastodonClient) SendLongDirectMessage(ctx context.Context, text, account string) error {
+	// Direct statuses are only delivered to the accounts they mention, so only the leading
+	// mention may stay one; an @user@instance in the subject or body would add a recipient
+	mention := "@" + account + "\n"
+	text = mastodonMentionBreaker.Replace(text)
+
+	if chunks := chunkForDestination(ctx, text, mc.MaxLength-len(mention)); len(chunks) == 1 {
+		_, err := mc.PostStatus(ctx, mention+chunks[0], "")
+		return err
+	}
+
+	// Leave room for the part markers of continuation statuses
+	chunks := chunkForDestination(ctx, text, mc.MaxLength-len(mention)-len(MastodonContinuationMarker))
+	log.Printf("Message too long (%d chars), splitting into %d chunks for Mastodon account %s", len(text), len(chunks), account)
+
+	inReplyToID := ""
+	for i, chunk := range chunks {
+		// Add part number for continuation messages
+		if i > 0 {
+			chunk = fmt.Sprintf("[Part %d]\n%s", i+1, chunk)
+		}
+
+		statusID, err := mc.PostStatus(ctx, mention+chunk, inReplyToID)
+		if err != nil {
+			return fmt.Errorf("failed to send chunk %d/%d to Mastodon account %s: %w", i+1, len(chunks), account, err)
+		}
+		inReplyToID = statusID
+
+		// Add delay between messages to avoid rate limiting
+		if i < len(chunks)-1 {
+			log.Printf("Sent chunk %d/%d to Mastodon account %s, waiting before next...", i+1, len(chunks), account)
+			time.Sleep(MastodonMessageSendDelay)
+		}
+	}
+
+	log.Printf("Successfully sent all %d message chunks to Mastodon account %s", len(chunks), account)
+	return nil
+}
+
+// PostStatus creates a direct-visibility status and returns its ID
+func (mc *MastodonClient) PostStatus(ctx context.Context, text, inReplyToID string) (string, error) {
+	status := MastodonStatus{
+		Status:      text,
+		Visibility:  "direct",
+		InReplyToID: inReplyToID,
+	}
+
+	jsonData, err := json.Marshal(status)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal status: %w", err)
+	}
+
+	log.Printf("Posting direct status to Mastodon (length: %d)", len(text))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", mc.InstanceURL+"/api/v1/statuses", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", mc.AccessToken))
+
+	resp, err := mc.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mastodon API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	deliveryReceiptFrom(ctx).recordMessage(response.ID)
+
+	log.Printf("Direct status %s posted successfully to Mastodon", response.ID)
+	return response.ID, nil
+}
+
+// TestConnection validates the access token by verifying the account credentials
+func (mc *MastodonClient) TestConnection() error {
+	req, err := http.NewRequest("GET", mc.InstanceURL+"/api/v1/accounts/verify_credentials", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", mc.AccessToken))
+
+	resp, err := mc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify credentials: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("mastodon API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build minimal || nomastodon
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func init() {
+	excludeFeature("mastodon", "nomastodon")
+}
+
+// Mastodon Configuration
+const (
+	MastodonDefaultMaxLength  = 500
+	MastodonMaxUsernameLength = 30
+	MastodonMaxDomainLength   = 253
+	MastodonMinMaxLength      = MinMessageBudgetChars + len("@@\n") + MastodonMaxUsernameLength + MastodonMaxDomainLength + len("[Part 99]\n")
+)
+
+// MastodonClient is a placeholder for builds without Mastodon support
+type MastodonClient struct {
+	HTTPClient *http.Client
+}
+
+// NewMastodonClient creates a placeholder client whose calls all fail
+func NewMastodonClient(instanceURL, accessToken string, maxLength int) *MastodonClient {
+	return &MastodonClient{HTTPClient: &http.Client{}}
+}
+
+// SendLongDirectMessage reports that Mastodon support was compiled out
+func (mc *MastodonClient) SendLongDirectMessage(ctx context.Context, text, account string) error {
+	return requireFeature("mastodon")
+}
+
+// TestConnection reports that Mastodon support was compiled out
+func (mc *MastodonClient) TestConnection() error {
+	return requireFeature("mastodon")
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics Configuration
+const (
+	MetricsPath                   = "/metrics"
+	DefaultMetricsSummaryInterval = 1 * time.Hour
+	MetricsReadTimeout            = 10 * time.Second
+	MetricsWriteTimeout           = 10 * time.Second
+)
+
+// RejectReason labels why a connection or message was turned away
+type RejectReason string
+
+// Rejection reasons, used as the reason label of email2dm_rejections_total
+const (
+	RejectACL         RejectReason = "acl"         // Client outside ALLOWED_NETWORKS
+	RejectConnections RejectReason = "connections" // Client over a concurrent connection limit
+	RejectAuth        RejectReason = "auth"        // Failed or missing SMTP authentication
+	RejectRateLimit   RejectReason = "rate_limit"  // Sender over its rate limit
+	RejectDestination RejectReason = "destination" // Recipient does not map to a usable destination
+	RejectParse       RejectReason = "parse"       // Message could not be parsed or broke parser limits
+	RejectSize        RejectReason = "size"        // Message larger than the SMTP size limit
+	RejectDelivery    RejectReason = "delivery"    // Platform refused or failed the delivery
+	RejectQuota       RejectReason = "quota"       // Destination used up its daily SIZE_QUOTAS
+	RejectTLS         RejectReason = "tls"         // MAIL FROM without STARTTLS under SMTP_REQUIRE_TLS
+	RejectSPF         RejectReason = "spf"         // MAIL FROM failed SPF under SPF_POLICY=reject
+	RejectDMARC       RejectReason = "dmarc"       // Message failed a DMARC reject policy under DMARC_POLICY=reject
+	RejectGreylist    RejectReason = "greylist"    // First attempt of a new triple under GREYLIST_DELAY
+)
+
+// rejectReasons lists every reason, so all series exist from the start
+var rejectReasons = []RejectReason{RejectACL, RejectConnections, RejectAuth, RejectRateLimit, RejectDestination, RejectParse, RejectSize, RejectDelivery, RejectQuota, RejectTLS, RejectSPF, RejectDMARC, RejectGreylist}
+
+// Metrics counts rejected connections and messages by reason, and reports the lookup caches
+type Metrics struct {
+	mutex      sync.Mutex
+	rejections map[RejectReason]uint64
+	reported   map[RejectReason]uint64 // Counts at the last summary log
+	caches     []*LookupCache
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewMetrics creates a metrics registry with every counter at zero
+func NewMetrics() *Metrics {
+	return &Metrics{
+		rejections: make(map[RejectReason]uint64),
+		reported:   make(map[RejectReason]uint64),
+	}
+}
+
+// Reject counts a rejection; a nil registry ignores it
+func (m *Metrics) Reject(reason RejectReason) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rejections[reason]++
+}
+
+// AddCaches reports lookup caches with the metrics
+func (m *Metrics) AddCaches(caches ...*LookupCache) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.caches = append(m.caches, caches...)
+}
+
+// CacheStats returns the counters of the reported lookup caches
+func (m *Metrics) CacheStats() []LookupCacheStats {
+	m.mutex.Lock()
+	caches := m.caches
+	m.mutex.Unlock()
+
+	stats := make([]LookupCacheStats, 0, len(caches))
+	for _, cache := range caches {
+		stats = append(stats, cache.Stats())
+	}
+	return stats
+}
+
+// Rejections returns the rejection counts since startup
+func (m *Metrics) Rejections() map[RejectReason]uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts := make(map[RejectReason]uint64, len(rejectReasons))
+	for _, reason := range rejectReasons {
+		counts[reason] = m.rejections[reason]
+	}
+	return counts
+}
+
+// ServeHTTP writes the counters in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	counts := m.Rejections()
+
+	var b strings.Builder
+	b.WriteString("# HELP email2dm_rejections_total Connections and messages turned away, by reason.\n")
+	b.WriteString("# TYPE email2dm_rejections_total counter\n")
+	for _, reason := range rejectReasons {
+		fmt.Fprintf(&b, "email2dm_rejections_total{reason=%q} %d\n", reason, counts[reason])
+	}
+	writeCacheMetrics(&b, m.CacheStats())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// writeCacheMetrics writes the counters of the lookup caches; without caches nothing is written
+func writeCacheMetrics(b *strings.Builder, stats []LookupCacheStats) {
+	if len(stats) == 0 {
+		return
+	}
+	series := []struct {
+		name, kind, help string
+		value            func(LookupCacheStats) uint64
+	}{
+		{"email2dm_cache_hits_total", "counter", "Lookups answered from a cache, by cache.", func(s LookupCacheStats) uint64 { return s.Hits }},
+		{"email2dm_cache_misses_total", "counter", "Lookups not found in a cache or expired, by cache.", func(s LookupCacheStats) uint64 { return s.Misses }},
+		{"email2dm_cache_evictions_total", "counter", "Entries dropped because a cache was full, by cache.", func(s LookupCacheStats) uint64 { return s.Evictions }},
+		{"email2dm_cache_entries", "gauge", "Entries in a cache, by cache.", func(s LookupCacheStats) uint64 { return uint64(s.Entries) }},
+		{"email2dm_cache_size", "gauge", "Most entries a cache keeps (CACHE_SIZE), by cache.", func(s LookupCacheStats) uint64 { return uint64(s.Size) }},
+	}
+	for _, metric := range series {
+		fmt.Fprintf(b, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(b, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, cache := range stats {
+			fmt.Fprintf(b, "%s{cache=%q} %d\n", metric.name, cache.Name, metric.value(cache))
+		}
+	}
+}
+
+// summary describes the rejections since the last summary, or returns "" when there were none
+func (m *Metrics) summary() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var parts []string
+	for _, reason := range rejectReasons {
+		if delta := m.rejections[reason] - m.reported[reason]; delta > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", reason, delta))
+		}
+		m.reported[reason] = m.rejections[reason]
+	}
+	return strings.Join(parts, " ")
+}
+
+// StartSummary logs the rejections of each interval until Stop is called; quiet intervals are not logged
+func (m *Metrics) StartSummary(interval time.Duration) {
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if summary := m.summary(); summary != "" {
+					log.Printf("Rejections in the last %s: %s", interval, summary)
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the summary log, logging what was rejected since the last summary
+func (m *Metrics) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+	if summary := m.summary(); summary != "" {
+		log.Printf("Rejections since the last summary: %s", summary)
+	}
+}
+
+// MetricsServer exposes the metrics over HTTP for scraping
+type MetricsServer struct {
+	server     *http.Server
+	listenAddr string
+}
+
+// NewMetricsServer creates a server answering on MetricsPath
+func NewMetricsServer(metrics *Metrics, listenAddr string) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, metrics)
+	return &MetricsServer{
+		listenAddr: listenAddr,
+		server: &http.Server{
+			Addr:         listenAddr,
+			Handler:      mux,
+			ReadTimeout:  MetricsReadTimeout,
+			WriteTimeout: MetricsWriteTimeout,
+		},
+	}
+}
+
+// Start starts the metrics server
+func (ms *MetricsServer) Start() error {
+	log.Printf("Starting metrics server on %s%s", ms.listenAddr, MetricsPath)
+	err := ms.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop stops the metrics server
+func (ms *MetricsServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), MetricsWriteTimeout)
+	defer cancel()
+	return ms.server.Shutdown(ctx)
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configSetting describes one environment variable and where it lives in the YAML config
+type configSetting struct {
+	Env         string
+	Section     string
+	Key         string
+	Kind        string // string, int, bool, duration or list (comma-separated)
+	Description string
+	Secret      bool
+}
+
+// configSettings lists every environment variable the bridge reads, grouped by YAML section
+var configSettings = []configSetting{
+	{"SMTP_LISTEN_HOST", "smtp", "listen_host", "string", "IP address to bind the SMTP server", false},
+	{"SMTP_LISTEN_PORT", "smtp", "listen_port", "int", "Port to bind the SMTP server", false},
+	{"SMTPS_LISTEN_PORT", "smtp", "smtps_listen_port", "int", "Port for implicit-TLS (SMTPS) connections", false},
+	{"LMTP_SOCKET", "smtp", "lmtp_socket", "string", "Unix socket for LMTP from a local MTA", false},
+	{"LMTP_SOCKET_MODE", "smtp", "lmtp_socket_mode", "string", "Octal permissions of the LMTP socket, e.g. 0660", false},
+	{"ALLOWED_NETWORKS", "smtp", "allowed_networks", "list", "CIDR networks allowed to connect", false},
+	{"SMTP_AUTH_USERS", "smtp", "auth_users", "string", "SMTP AUTH users as user:bcrypt-hash,... or an htpasswd file", true},
+	{"SMTP_AUTH_CRAM_SECRETS", "smtp", "auth_cram_secrets", "string", "CRAM-MD5 shared secrets as user:secret,... or a file of them", true},
+	{"SMTP_AUTH_REQUIRED", "smtp", "auth_required", "bool", "Refuse MAIL FROM before AUTH", false},
+	{"TLS_ENABLE", "smtp", "tls_enable", "bool", "Enable STARTTLS support", false},
+	{"TLS_CERT_PATH", "smtp", "tls_cert_path", "string", "Path to the TLS certificate", false},
+	{"TLS_KEY_PATH", "smtp", "tls_key_path", "string", "Path to the TLS private key", false},
+	{"SMTP_REQUIRE_TLS", "smtp", "require_tls", "bool", "Refuse MAIL FROM and AUTH before STARTTLS", false},
+	{"SMTP_MAX_MESSAGE_BYTES", "smtp", "max_message_bytes", "string", "Largest message accepted, e.g. 25MB", false},
+	{"SMTP_RATE_LIMIT", "smtp", "rate_limit", "string", "Messages accepted from all clients, e.g. 600/m", false},
+	{"SMTP_RATE_LIMIT_PER_IP", "smtp", "rate_limit_per_ip", "string", "Messages accepted from one client IP, e.g. 60/m", false},
+	{"SMTP_MAX_CONNECTIONS", "smtp", "max_connections", "int", "Concurrent connections from all clients", false},
+	{"SMTP_MAX_CONNECTIONS_PER_IP", "smtp", "max_connections_per_ip", "int", "Concurrent connections from one client IP", false},
+	{"SPF_POLICY", "smtp", "spf_policy", "string", "Check SPF of MAIL FROM: off, log, annotate or reject", false},
+	{"DMARC_POLICY", "smtp", "dmarc_policy", "string", "Check DMARC of the From domain: off, none, quarantine or reject", false},
+	{"GREYLIST_DELAY", "smtp", "greylist_delay", "duration", "Wait before retries of new senders are accepted, e.g. 5m", false},
+	{"SHUTDOWN_TIMEOUT", "smtp", "shutdown_timeout", "duration", "Wait for messages in progress on shutdown", false},
+
+	{"TELEGRAM_BOT_TOKEN", "telegram", "bot_token", "string", "Telegram bot token from @BotFather", true},
+	{"TELEGRAM_UPLOAD_ATTACHMENTS", "telegram", "upload_attachments", "bool", "Send email attachments after the message", false},
+	{"TELEGRAM_ATTACHMENT_MAX_BYTES", "telegram", "attachment_max_bytes", "int", "Largest attachment sent", false},
+	{"TELEGRAM_ATTACHMENT_TYPES", "telegram", "attachment_types", "list", "Attachment content types sent, e.g. image/*", false},
+	{"TELEGRAM_INLINE_IMAGES", "telegram", "inline_images", "int", "Embedded images sent as photos per email", false},
+	{"TELEGRAM_INLINE_IMAGE_MAX_BYTES", "telegram", "inline_image_max_bytes", "int", "Largest embedded image sent", false},
+	{"TELEGRAM_RATE_LIMIT_RETRIES", "telegram", "rate_limit_retries", "int", "Retries after a 429 response", false},
+	{"TELEGRAM_RATE_LIMIT", "telegram", "rate_limit", "bool", "Queue messages to stay within Telegram's limits", false},
+	{"TELEGRAM_ACK_BUTTONS", "telegram", "ack_buttons", "bool", "Ack and Snooze buttons on critical alerts", false},
+	{"TELEGRAM_ACK_SNOOZE", "telegram", "ack_snooze", "duration", "How long Snooze silences repeats", false},
+	{"TELEGRAM_PIN_CRITICAL", "telegram", "pin_critical", "bool", "Pin critical alerts until they recover", false},
+	{"TELEGRAM_REPLIES", "telegram", "replies", "bool", "Email replies to bridged messages back", false},
+	{"TELEGRAM_REPLY_TTL", "telegram", "reply_ttl", "duration", "How long a bridged message accepts replies", false},
+	{"TELEGRAM_ACK_WEBHOOK_URL", "telegram", "ack_webhook_url", "string", "URL receiving button presses", false},
+	{"HISTORY_SIZE", "history", "size", "int", "Recent deliveries kept in memory", false},
+	{"CHAT_SEARCH", "history", "chat_search", "bool", "Answer /search in Telegram and Slack", false},
+	{"HISTORY_FILE", "history", "file", "string", "JSON Lines file every delivery is appended to", false},
+	{"TELEGRAM_API_URL", "telegram", "api_url", "string", "Bot API server, e.g. a fake API for tests", false},
+	{"TELEGRAM_PROXY_URL", "telegram", "proxy_url", "string", "socks5:// or http:// proxy for API calls", true},
+
+	{"SLACK_BOT_TOKEN", "slack", "bot_token", "string", "Slack bot token (xoxb-...)", true},
+	{"SLACK_MESSAGE_FORMAT", "slack", "message_format", "string", "Layout: blocks or text", false},
+	{"SLACK_THREADING", "slack", "threading", "string", "Thread follow-ups: subject, references or off", false},
+	{"SLACK_THREAD_TTL", "slack", "thread_ttl", "duration", "How long a thread accepts follow-ups", false},
+	{"SLACK_COALESCE_WINDOW", "slack", "coalesce_window", "duration", "Fold identical alerts into the original message", false},
+	{"SLACK_BATCH_WINDOW", "slack", "batch_window", "duration", "Combine short messages to a channel into one post", false},
+	{"SLACK_UPLOAD_ATTACHMENTS", "slack", "upload_attachments", "bool", "Upload email attachments", false},
+	{"SLACK_COLOR_BARS", "slack", "color_bars", "bool", "Color messages by severity", false},
+	{"SLACK_REPORTS", "slack", "reports", "string", "Post long bodies as a snippet or canvas (off/snippet/canvas)", false},
+	{"SLACK_REPORT_MIN_CHARS", "slack", "report_min_chars", "int", "Body length from which SLACK_REPORTS applies", false},
+	{"SLACK_UNFURL_LINKS", "slack", "unfurl_links", "bool", "Show link previews", false},
+	{"SLACK_UNFURL_MEDIA", "slack", "unfurl_media", "bool", "Show image and video previews", false},
+	{"SLACK_SEVERITY_COLORS", "slack", "severity_colors", "string", "Color bar per severity as level=color;...", false},
+	{"SLACK_RATE_LIMIT_RETRIES", "slack", "rate_limit_retries", "int", "Retries after a 429 response", false},
+	{"SLACK_CHANNEL_CACHE_TTL", "slack", "channel_cache_ttl", "duration", "How long #channel lookups are cached", false},
+	{"SLACK_USER_CACHE_TTL", "slack", "user_cache_ttl", "duration", "How long username lookups are cached", false},
+	{"SLACK_API_URL", "slack", "api_url", "string", "Web API base, e.g. a fake API for tests", false},
+	{"SLACK_APP_TOKEN", "slack", "app_token", "string", "App-level token for Socket Mode replies (xapp-...)", true},
+
+	{"DINGTALK_ROBOTS", "dingtalk", "robots", "list", "Custom robots as name=access_token[:secret]", true},
+
+	{"WECOM_CORP_ID", "wecom", "corp_id", "string", "WeCom corp ID", false},
+	{"WECOM_AGENT_ID", "wecom", "agent_id", "int", "WeCom application agent ID", false},
+	{"WECOM_SECRET", "wecom", "secret", "string", "WeCom application secret", true},
+	{"WECOM_MESSAGE_TYPE", "wecom", "message_type", "string", "Message type: markdown or text", false},
+
+	{"MASTODON_INSTANCE_URL", "mastodon", "instance_url", "string", "Base URL of the Mastodon instance", false},
+	{"MASTODON_ACCESS_TOKEN", "mastodon", "access_token", "string", "Mastodon access token", true},
+	{"MASTODON_MAX_CHARS", "mastodon", "max_chars", "int", "Status character limit of the instance", false},
+
+	{"WHATSAPP_ACCESS_TOKEN", "whatsapp", "access_token", "string", "WhatsApp Cloud API access token", true},
+	{"WHATSAPP_PHONE_NUMBER_ID", "whatsapp", "phone_number_id", "string", "Sending phone number ID", false},
+	{"WHATSAPP_TEMPLATE_NAME", "whatsapp", "template_name", "string", "Approved template used instead of session text", false},
+	{"WHATSAPP_TEMPLATE_LANGUAGE", "whatsapp", "template_language", "string", "Template language code", false},
+
+	{"ZOOM_ACCOUNT_ID", "zoom", "account_id", "string", "Server-to-server OAuth account ID", false},
+	{"ZOOM_CLIENT_ID", "zoom", "client_id", "string", "Server-to-server OAuth client ID", false},
+	{"ZOOM_CLIENT_SECRET", "zoom", "client_secret", "string", "Server-to-server OAuth client secret", true},
+	{"ZOOM_USER_ID", "zoom", "user_id", "string", "User the messages are posted as", false},
+
+	{"VICTOROPS_API_KEY", "victorops", "api_key", "string", "REST endpoint integration API key", true},
+
+	{"REDIS_URL", "redis", "url", "string", "Redis server for pub/sub output", true},
+	{"REDIS_MESSAGE_FORMAT", "redis", "message_format", "string", "Published payload: text or json", false},
+
+	{"SMTP_RELAY_ADDR", "relay", "addr", "string", "Upstream SMTP server for emails sent by the bridge", false},
+	{"SMTP_RELAY_SECURITY", "relay", "security", "string", "starttls, tls or none", false},
+	{"SMTP_RELAY_USERNAME", "relay", "username", "string", "Username for AUTH PLAIN", false},
+	{"SMTP_RELAY_PASSWORD", "relay", "password", "string", "Password for AUTH PLAIN", true},
+	{"SMTP_RELAY_FROM", "relay", "from", "string", "Sender address of emails sent by the bridge", false},
+
+	{"MAX_MIME_DEPTH", "parser", "max_mime_depth", "int", "Maximum nested multipart levels", false},
+	{"MAX_MIME_PARTS", "parser", "max_mime_parts", "int", "Maximum MIME parts per message", false},
+	{"MAX_HEADER_BYTES", "parser", "max_header_bytes", "int", "Maximum size of a header section", false},
+	{"MAX_HEADER_COUNT", "parser", "max_header_count", "int", "Maximum header fields per header section", false},
+	{"PARSE_FAILURE_POLICY", "parser", "parse_failure_policy", "string", "Unparsable messages: reject or forward", false},
+	{"EMPTY_BODY_POLICY", "parser", "empty_body_policy", "string", "Emails without a body: subject, drop or placeholder", false},
+	{"EMPTY_BODY_TEXT", "parser", "empty_body_text", "string", "Placeholder body for the placeholder policy", false},
+	{"MAX_MESSAGE_AGE", "parser", "max_message_age", "duration", "Mail sent longer ago than this follows the stale policy", false},
+	{"STALE_POLICY", "parser", "stale_policy", "string", "Mail older than the maximum age: mark or drop", false},
+	{"COMPRESSED_ATTACHMENT_INLINE", "parser", "compressed_attachment_inline", "bool", "Inline .gz/.zst/.zip log attachments", false},
+	{"COMPRESSED_ATTACHMENT_MAX_BYTES", "parser", "compressed_attachment_max_bytes", "int", "Largest compressed attachment to inline", false},
+	{"COMPRESSED_ATTACHMENT_LINES", "parser", "compressed_attachment_lines", "int", "Lines inlined per attachment", false},
+
+	{"LOW_MEMORY_MODE", "resources", "low_memory_mode", "bool", "Smaller limits and caches for small devices", false},
+	{"CACHE_SIZE", "resources", "cache_size", "int", "Entries kept per lookup cache", false},
+	{"CACHE_SIZES", "resources", "cache_sizes", "string", "Per-cache sizes as name=entries,...", false},
+	{"ATTACHMENT_SPOOL", "resources", "attachment_spool", "bool", "Write large attachments to temporary files", false},
+	{"ATTACHMENT_SPOOL_BYTES", "resources", "attachment_spool_bytes", "int", "Attachments larger than this are spooled", false},
+	{"ATTACHMENT_SPOOL_DIR", "resources", "attachment_spool_dir", "string", "Directory for spooled attachments", false},
+	{"STATE_FILE", "resources", "state_file", "string", "File keeping thread and coalescing state across restarts", false},
+	{"STATE_BACKEND", "resources", "state_backend", "string", "How state is kept: bbolt, sqlite, redis or json", false},
+
+	{"DESTINATION_OPTIONS", "routing", "destination_options", "string", "Per-destination options as platform:id=opt+opt;...", false},
+	{"RCPT_VERIFY", "routing", "rcpt_verify", "bool", "Reject unknown destinations at RCPT TO", false},
+	{"RCPT_VERIFY_CACHE_TTL", "routing", "rcpt_verify_cache_ttl", "duration", "How long an existing destination is trusted", false},
+	{"SIZE_QUOTAS", "routing", "size_quotas", "string", "Daily bytes per destination as platform:id=size;...", false},
+	{"SIZE_QUOTA_POLICY", "routing", "size_quota_policy", "string", "summary or reject mail past a quota", false},
+	{"ENCRYPTION_KEYS", "routing", "encryption_keys", "string", "Public keys of encrypted destinations as platform:id=key;...", false},
+	{"FALLBACK_DESTINATION", "routing", "fallback_destination", "string", "platform:id receiving mail for unconfigured platforms", false},
+	{"MULTI_RECIPIENT_POLICY", "routing", "multi_recipient_policy", "string", "Mail with several recipients: all, first, first-platform or alias", false},
+	{"FANOUT_ALIASES", "routing", "fanout_aliases", "string", "Fan-out aliases as name=address,address;...", false},
+	{"ADDRESS_MACROS", "routing", "address_macros", "string", "Addresses deriving their destination from a table file", false},
+	{"RESOLVER_WEBHOOK_URL", "routing", "resolver_webhook_url", "string", "Webhook mapping unrecognized recipients", false},
+	{"RESOLVER_WEBHOOK_TOKEN", "routing", "resolver_webhook_token", "string", "Bearer token sent to the resolver", true},
+	{"ADDRESS_TOKEN_SECRET", "routing", "address_token_secret", "string", "Key for signed destination addresses", true},
+	{"ADDRESS_TOKEN_DOMAIN", "routing", "address_token_domain", "string", "Domain of signed addresses", false},
+	{"ADDRESS_TOKENS_REQUIRED", "routing", "address_tokens_required", "bool", "Accept only signed addresses", false},
+	{"PLATFORM_PLUGIN_DIR", "routing", "platform_plugin_dir", "string", "Directory of platform plugin executables", false},
+	{"HTTP_PLATFORMS", "routing", "http_platforms", "list", "Names of custom HTTP platforms", false},
+
+	{"INBOUND_WEBHOOK_LISTEN", "inbound", "listen", "string", "Address of the SES/Mailgun webhook server", false},
+	{"SES_SNS_TOPIC_ARNS", "inbound", "ses_sns_topic_arns", "list", "SNS topics allowed to post SES notifications", false},
+	{"MAILGUN_SIGNING_KEY", "inbound", "mailgun_signing_key", "string", "Mailgun HTTP webhook signing key", true},
+	{"METRICS_LISTEN", "metrics", "listen", "string", "Address serving /metrics", false},
+	{"METRICS_SUMMARY_INTERVAL", "metrics", "summary_interval", "duration", "Interval of the rejection summary log", false},
+	{"SYSLOG_FIELD_ESCAPING", "logging", "syslog_field_escaping", "string", "Control characters in syslog fields: escape, strip or quote", false},
+	{"SYSLOG_MAX_FIELD_CHARS", "logging", "syslog_max_field_chars", "int", "Characters kept of each syslog field value", false},
+
+	{"ADMIN_LISTEN", "admin", "listen", "string", "Address serving the admin API", false},
+	{"ADMIN_TOKEN", "admin", "token", "string", "Bearer token the admin API requires", true},
+
+	{"SEVERITY_KEYWORDS", "formatting", "severity_keywords", "string", "Extra severity keywords as level=word,prefix*;...", false},
+	{"PAGE_KEYWORD", "formatting", "page_keyword", "string", "Subject prefix marking a page, e.g. [PAGE]", false},
+	{"PAGE_HEADER", "formatting", "page_header", "string", "Header marking a page when set to yes, e.g. X-Page", false},
+	{"TITLE_TEMPLATE", "formatting", "title_template", "string", "Template for native titles", false},
+	{"SENDER_BANNER_TEMPLATE", "formatting", "sender_banner_template", "string", "Template for a sender line above the body", false},
+	{"SENDER_NAMES", "formatting", "sender_names", "string", "Names shown instead of sender addresses, or a file of them", false},
+}
+
+func init() {
+	// Named Telegram bots present in the environment
+	for _, entry := range os.Environ() {
+		if key, _, _ := strings.Cut(entry, "="); strings.HasPrefix(key, "TELEGRAM_BOT_TOKEN_") {
+			name := strings.ToLower(strings.TrimPrefix(key, "TELEGRAM_BOT_TOKEN_"))
+			configSettings = append(configSettings, configSetting{key, "telegram.bots", name, "string", "Token of the " + name + " bot", true})
+		}
+	}
+	// Settings repeated for every platform
+	for _, platform := range titlePlatforms {
+		configSettings = append(configSettings, configSetting{
+			strings.ToUpper(platform) + "_TITLE_TEMPLATE", "formatting", platform + "_title_template", "string",
+			"Title template for " + platform, false,
+		})
+	}
+	// Custom platforms named in the environment
+	for _, name := range strings.Split(os.Getenv("HTTP_PLATFORMS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "HTTP_PLATFORM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		section := "http_platforms." + name
+		configSettings = append(configSettings,
+			configSetting{prefix + "URL", section, "url", "string", "Request URL template", true},
+			configSetting{prefix + "METHOD", section, "method", "string", "HTTP method", false},
+			configSetting{prefix + "HEADERS", section, "headers", "string", "Request headers as Name: value;...", true},
+			configSetting{prefix + "BODY", section, "body", "string", "Request body template", false},
+			configSetting{prefix + "SUCCESS_STATUS", section, "success_status", "list", "Status codes that mean delivered", false},
+			configSetting{prefix + "SUCCESS_BODY", section, "success_body", "string", "Text a successful response contains", false},
+			configSetting{prefix + "MAX_CHARS", section, "max_chars", "int", "Split longer messages", false},
+			configSetting{prefix + "TIMEOUT", section, "timeout", "duration", "Request timeout", false},
+		)
+	}
+	for _, platform := range httpPolicyPlatforms {
+		prefix := strings.ToUpper(platform) + "_HTTP_"
+		configSettings = append(configSettings,
+			configSetting{prefix + "TIMEOUT", "http." + platform, "timeout", "duration", "Request timeout", false},
+			configSetting{prefix + "RETRIES", "http." + platform, "retries", "int", "Retries after network errors and 5xx responses", false},
+			configSetting{prefix + "BACKOFF", "http." + platform, "backoff", "duration", "Wait before the first retry", false},
+		)
+	}
+}
+
+// runMigrateConfig implements `email2dm migrate-config`, writing the current environment as a YAML config
+func runMigrateConfig(args []string) error {
+	flags := flag.NewFlagSet("migrate-config", flag.ContinueOnError)
+	output := flags.String("o", "", "write the config to this file instead of stdout")
+	all := flags.Bool("all", false, "include unset settings as commented-out entries")
+	redact := flags.Bool("redact", false, "replace tokens and secrets with placeholders")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Report configuration problems, but still emit what was set so it can be fixed in the file
+	if _, err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: current environment is not a valid configuration: %v\n", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count, err := writeYAMLConfig(w, *all, *redact)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d settings to %s\n", count, *output)
+	}
+	if !*redact {
+		fmt.Fprintln(os.Stderr, "Note: the config contains tokens and secrets; keep it private")
+	}
+	return nil
+}
+
+// writeYAMLConfig emits the settings grouped by section, each preceded by its description
+// and environment variable. It returns the number of settings that were set
+func writeYAMLConfig(w io.Writer, all, redact bool) (int, error) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# email2dm configuration\n# Generated by `email2dm migrate-config` on %s from environment variables.\n", time.Now().Format("2006-01-02"))
+
+	count := 0
+	section := ""
+	for _, setting := range configSettings {
+		value, set := os.LookupEnv(setting.Env)
+		if value == "" {
+			set = false
+		}
+		if !set && !all {
+			continue
+		}
+
+		// Sections may be nested one level (http.slack)
+		parent, child, nested := strings.Cut(setting.Section, ".")
+		indent := "  "
+		if setting.Section != section {
+			previousParent, _, _ := strings.Cut(section, ".")
+			if parent != previousParent {
+				fmt.Fprintf(&out, "\n%s:\n", parent)
+			}
+			if nested {
+				fmt.Fprintf(&out, "  %s:\n", child)
+			}
+			section = setting.Section
+		}
+		if nested {
+			indent = "    "
+		}
+
+		fmt.Fprintf(&out, "%s# %s (%s)\n", indent, setting.Description, setting.Env)
+		if !set {
+			fmt.Fprintf(&out, "%s# %s:\n", indent, setting.Key)
+			continue
+		}
+
+		if redact && setting.Secret {
+			value = "REDACTED"
+		}
+		fmt.Fprintf(&out, "%s%s:%s\n", indent, setting.Key, yamlValue(setting.Kind, value, indent))
+		count++
+	}
+
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return 0, fmt.Errorf("failed to write config: %w", err)
+	}
+	return count, nil
+}
+
+// yamlValue renders an environment value as YAML, keeping typed scalars unquoted when they parse
+func yamlValue(kind, value, indent string) string {
+	switch kind {
+	case "int":
+		if _, err := strconv.Atoi(value); err == nil {
+			return " " + value
+		}
+	case "bool":
+		if enabled, err := strconv.ParseBool(strings.ToLower(value)); err == nil {
+			return " " + strconv.FormatBool(enabled)
+		}
+		switch strings.ToLower(value) {
+		case "yes", "on":
+			return " true"
+		case "no", "off":
+			return " false"
+		}
+	case "list":
+		var items strings.Builder
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				fmt.Fprintf(&items, "\n%s  - %s", indent, strconv.Quote(item))
+			}
+		}
+		if items.Len() > 0 {
+			return items.String()
+		}
+	}
+
+	// YAML double-quoted scalars accept Go's escape sequences
+	return " " + strconv.Quote(value)
+}
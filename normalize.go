@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// normalizeDestinationID converts the ID forms an address may use to the canonical ID of the
+// platform, so every variant of a destination shares its options, quotas and history:
+//
+//	g1001234@telegram, -1001234@telegram  -> -1001234
+//	%40my_alerts@telegram                 -> @my_alerts
+//	%23General@slack, #General@slack      -> #general
+//	@Jane.Doe@slack                       -> jane.doe
+//	@alice@example.social, alice%example.social (mastodon) -> alice@example.social
+//	0123abcd@conference.xmpp.zoom.us (zoom) -> 0123abcd
+//	+1-555-123-4567 (whatsapp)            -> +15551234567
+//
+// IDs of other platforms are only trimmed. The result still needs validating
+func normalizeDestinationID(platform, id string) string {
+	id = strings.TrimSpace(id)
+	switch platform {
+	case "telegram":
+		return normalizeTelegramID(unescapeDestinationID(id))
+	case "slack":
+		return normalizeSlackID(unescapeDestinationID(id))
+	case "mastodon":
+		// % stands for the @ of the instance, so Mastodon accounts are not URL-decoded
+		return strings.Replace(strings.TrimPrefix(id, "@"), "%", "@", 1)
+	case "zoom":
+		channelID, _, _ := strings.Cut(id, "@")
+		return channelID
+	case "whatsapp":
+		digits := strings.NewReplacer("-", "", ".", "", "(", "", ")", "").Replace(strings.TrimPrefix(id, "+"))
+		return "+" + digits
+	default:
+		return id
+	}
+}
+
+// unescapeDestinationID decodes URL-encoded characters such as %23 for #, which some clients
+// and web forms cannot put in an address; IDs that do not decode are kept as given
+func unescapeDestinationID(id string) string {
+	if !strings.Contains(id, "%") {
+		return id
+	}
+	decoded, err := url.PathUnescape(id)
+	if err != nil {
+		return id
+	}
+	return decoded
+}
+
+// normalizeTelegramID converts group prefix notation to the chat ID, keeping any forum topic:
+// g123456.42 -> -123456.42
+func normalizeTelegramID(id string) string {
+	if strings.HasPrefix(id, "g") && len(id) > 1 {
+		return "-" + id[1:]
+	}
+	return id
+}
+
+// normalizeSlackID lowercases channel names and usernames as Slack stores them, and drops the
+// @ of a username. IDs such as U1234567890 are kept as given
+func normalizeSlackID(id string) string {
+	switch {
+	case strings.HasPrefix(id, "#"):
+		return strings.ToLower(id)
+	case strings.HasPrefix(id, "@") && len(id) > 1:
+		return strings.ToLower(id[1:])
+	default:
+		return id
+	}
+}
+
+// normalizeDestinationKey normalizes the ID of a configured platform:id key
+func normalizeDestinationKey(platform, id string) string {
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	return destinationKey(platform, normalizeDestinationID(platform, id))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// OutboundEmail represents an email generated by email2dm (chat replies, bounces, notifications)
+type OutboundEmail struct {
+	From       string
+	ReplyTo    string
+	ReturnPath string // Envelope sender; empty uses the relay's address
+	To         string
+	Subject    string
+	Body       string
+	MessageID  string
+	InReplyTo  string
+	References []string
+}
+
+// NewReplyEmail creates an email replying to original, threaded through In-Reply-To and References
+// so it lands in the same conversation in the sender's mailbox
+func NewReplyEmail(original *ProcessedEmail, from, body string) *OutboundEmail {
+	subject := original.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	reply := &OutboundEmail{
+		From:       from,
+		To:         original.From,
+		Subject:    subject,
+		Body:       body,
+		MessageID:  generateMessageID(),
+		References: append([]string(nil), original.References...),
+	}
+
+	// RFC 5322 §3.6.4: References is the parent's References followed by the parent's Message-ID
+	if original.MessageID != "" {
+		reply.InReplyTo = original.MessageID
+		reply.References = append(reply.References, original.MessageID)
+	}
+
+	return reply
+}
+
+// Bytes renders the email as an RFC 5322 message with a UTF-8 plain text body
+func (oe *OutboundEmail) Bytes() []byte {
+	var buf bytes.Buffer
+
+	writeHeader := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+
+	writeHeader("From", oe.From)
+	writeHeader("Reply-To", oe.ReplyTo)
+	writeHeader("To", oe.To)
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", oe.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", oe.MessageID)
+	writeHeader("In-Reply-To", oe.InReplyTo)
+	writeHeader("References", strings.Join(oe.References, " "))
+	writeHeader("Auto-Submitted", "auto-replied")
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", "text/plain; charset=utf-8")
+	writeHeader("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(oe.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if !strings.HasSuffix(body, "\n") {
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes()
+}
+
+// UseReplyAddress sends the email from a per-destination reply address, tagged with the chat it
+// came from so mail filters can route answers back, e.g. alerts-reply+C1234567890@example.com.
+// The display name of the current sender is kept
+func (oe *OutboundEmail) UseReplyAddress(base, tag string) error {
+	address, err := taggedReplyAddress(base, tag)
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	if from, err := mail.ParseAddress(oe.From); err == nil {
+		name = from.Name
+	}
+	oe.From = (&mail.Address{Name: name, Address: address}).String()
+	oe.ReplyTo = address
+	oe.ReturnPath = address
+	return nil
+}
+
+// taggedReplyAddress adds a "+tag" subaddress to base, keeping only characters that are safe in a local part
+func taggedReplyAddress(base, tag string) (string, error) {
+	at := strings.LastIndex(base, "@")
+	if at <= 0 || at == len(base)-1 {
+		return "", fmt.Errorf("invalid reply address '%s'", base)
+	}
+
+	tag = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return -1
+	}, tag)
+	tag = strings.Trim(tag, ".")
+	if tag == "" {
+		return base, nil
+	}
+	return base[:at] + "+" + tag + base[at:], nil
+}
+
+// generateMessageID creates a unique Message-ID in the bridge's own domain
+func generateMessageID() string {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Sprintf("<%d@%s>", time.Now().UnixNano(), SMTPDomain)
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), SMTPDomain)
+}
+
+// parseMessageIDList extracts the <id> tokens from a Message-ID, In-Reply-To or References header
+func parseMessageIDList(header string) []string {
+	var ids []string
+	for {
+		start := strings.Index(header, "<")
+		if start < 0 {
+			return ids
+		}
+		end := strings.Index(header[start:], ">")
+		if end < 0 {
+			return ids
+		}
+		ids = append(ids, header[start:start+end+1])
+		header = header[start+end+1:]
+	}
+}
+
+// threadingHeaders extracts Message-ID, In-Reply-To and References from parsed headers
+func threadingHeaders(header mail.Header) (messageID, inReplyTo string, references []string) {
+	if ids := parseMessageIDList(header.Get("Message-ID")); len(ids) > 0 {
+		messageID = ids[0]
+	}
+	if ids := parseMessageIDList(header.Get("In-Reply-To")); len(ids) > 0 {
+		inReplyTo = ids[0]
+	}
+	references = parseMessageIDList(header.Get("References"))
+	return messageID, inReplyTo, references
+}
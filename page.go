@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+)
+
+// isPage reports whether an email is a page: its subject starts with PAGE_KEYWORD or the
+// PAGE_HEADER switch is on. Pages bypass everything that holds back or quietens an alert
+func (ep *EmailProcessor) isPage(subject string, header mail.Header) bool {
+	if ep.Config == nil {
+		return false
+	}
+	subject = strings.TrimSpace(subject)
+	if keyword := ep.Config.PageKeyword; keyword != "" && len(subject) >= len(keyword) &&
+		strings.EqualFold(subject[:len(keyword)], keyword) {
+		return true
+	}
+	return ep.Config.PageHeader != "" && header != nil && headerEnabled(header.Get(ep.Config.PageHeader))
+}
+
+// isPageMessage reads only the headers of a raw message, so a page can be let past the
+// daily size quota before the message is parsed
+func (ep *EmailProcessor) isPageMessage(data []byte) bool {
+	if ep.Config == nil || (ep.Config.PageKeyword == "" && ep.Config.PageHeader == "") {
+		return false
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	return ep.isPage(ep.decodeHeader(msg.Header.Get("Subject")), msg.Header)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Parse Failure Configuration
+const (
+	ParseFailureReject  = "reject"  // Refuse the message after DATA (default)
+	ParseFailureForward = "forward" // Accept it and forward the undecoded body
+	RawFallbackMaxBytes = 8 * 1024  // Undecoded body kept in a raw fallback message
+)
+
+// parseFailurePolicy returns the configured policy for messages the parser rejects
+func (ep *EmailProcessor) parseFailurePolicy() string {
+	if ep.Config == nil || ep.Config.ParseFailurePolicy == "" {
+		return ParseFailureReject
+	}
+	return ep.Config.ParseFailurePolicy
+}
+
+// rawFallbackEmail builds a best-effort message from data that could not be parsed. Headers are
+// scanned leniently for From, Subject and Date, and the body is forwarded undecoded
+func (ep *EmailProcessor) rawFallbackEmail(data []byte, envelopeFrom, envelopeTo string, parseErr error) *ProcessedEmail {
+	var header, body []byte
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+		header, body = data[:i], data[i+4:]
+	} else if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		header, body = data[:i], data[i+2:]
+	} else {
+		// Without a header/body separator there is no telling which is which
+		body = data
+	}
+
+	email := &ProcessedEmail{
+		From:    envelopeFrom,
+		To:      envelopeTo,
+		Subject: "(unparsable message)",
+		Date:    ep.formatDate(""),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(header))
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "from":
+			if value != "" {
+				email.From = ep.cleanEmailAddress(ep.decodeHeader(value))
+			}
+		case "subject":
+			if value != "" {
+				email.Subject = ep.decodeHeader(value)
+			}
+		case "date":
+			email.Date = ep.formatDate(value)
+		}
+	}
+
+	truncated := len(body) > RawFallbackMaxBytes
+	if truncated {
+		body = body[:RawFallbackMaxBytes]
+	}
+	text := strings.ToValidUTF8(string(body), "�")
+	if truncated {
+		text += "\n[truncated]"
+	}
+
+	email.Body = fmt.Sprintf("[This message could not be parsed (%v); showing the undecoded body]\n\n%s", parseErr, text)
+	email.Severity = ep.severityClassifier().Classify(email.Subject, email.Body)
+	return email
+}
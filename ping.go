@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Ping Configuration
+const (
+	PingSender  = "email2dm"
+	PingTimeout = 2 * time.Minute // Leaves room for rate limit retries
+)
+
+// PingResult is the outcome of a canary message sent to one destination
+type PingResult struct {
+	Platform  string `json:"platform"`
+	ID        string `json:"id"`
+	MessageID string `json:"message_id,omitempty"` // Platform ID of the message, when the API returns one
+	Messages  int    `json:"messages"`
+	Retries   int    `json:"retries"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// String describes the result on one line
+func (r *PingResult) String() string {
+	messageID := "none returned"
+	if r.MessageID != "" {
+		messageID = r.MessageID
+	}
+	return fmt.Sprintf("%s:%s answered in %dms, message ID %s (%d message(s), %d retries)",
+		r.Platform, r.ID, r.LatencyMS, messageID, r.Messages, r.Retries)
+}
+
+// Ping sends a short canary message to a destination address such as 123456789@telegram,
+// taking the same path as an email to that address, and reports the round trip
+func (ep *EmailProcessor) Ping(ctx context.Context, address string) (*PingResult, error) {
+	platform, userID, options, err := ep.extractPlatformAndID(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+	identity, err := parseSenderIdentity(options)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+
+	now := time.Now()
+	email := &ProcessedEmail{
+		From:     PingSender,
+		To:       address,
+		Subject:  "email2dm ping",
+		Date:     now.Format("Mon, 02 Jan 2006 15:04:05 MST"),
+		Body:     fmt.Sprintf("Test message sent at %s to check delivery to %s:%s. No action is needed.", now.Format(time.RFC3339), platform, userID),
+		Severity: SeverityInfo,
+		Session:  SessionInfo{EnvelopeFrom: PingSender, RemoteAddr: "ping"},
+	}
+
+	receipt := &DeliveryReceipt{}
+	ctx = withSenderIdentity(withDeliveryReceipt(ctx, receipt), identity)
+	started := time.Now()
+	err = ep.sendToPlatform(ctx, email, ep.formatMessageForPlatform(email, platform), platform, userID, options)
+	receipt.Latency = time.Since(started)
+	if err != nil {
+		ep.logDeliveryToSyslog("ping", PingSender, platform, userID, receipt, fmt.Sprintf("Ping failed: %v", err))
+		return nil, fmt.Errorf("failed to send to %s: %w", platform, err)
+	}
+	ep.logDeliveryToSyslog("ping", PingSender, platform, userID, receipt, "Ping sent")
+
+	return &PingResult{
+		Platform:  platform,
+		ID:        userID,
+		MessageID: receipt.MessageID,
+		Messages:  receipt.Chunks,
+		Retries:   receipt.Retries,
+		LatencyMS: receipt.Latency.Milliseconds(),
+	}, nil
+}
+
+// runPing sends a canary message to a destination with the configured platform clients and
+// prints the round trip, for checking a newly configured chat end to end
+func runPing(args []string) error {
+	flags := flag.NewFlagSet("ping", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "show the bridge's log output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: email2dm ping [-v] <id>@<platform>")
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	app, err := NewApplication(config)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PingTimeout)
+	defer cancel()
+	result, err := app.EmailProcessor.Ping(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(result)
+	return nil
+}
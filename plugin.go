@@ -0,0 +1,156 @@
+//go:build !minimal && !noplugins
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Plugin Configuration
+const (
+	PluginExecTimeout   = 30 * time.Second
+	PluginMaxStderrSize = 4096 // Bytes of plugin stderr kept for error messages
+)
+
+// pluginNamePattern restricts plugin names to safe file names so a domain can never escape the plugin directory
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// PluginMessage is the JSON document written to a plugin's stdin
+type PluginMessage struct {
+	Platform    string             `json:"platform"`
+	ID          string             `json:"id"`
+	From        string             `json:"from"`
+	To          string             `json:"to"`
+	Subject     string             `json:"subject"`
+	Date        string             `json:"date"`
+	Body        string             `json:"body"`
+	Message     string             `json:"message"` // Rendered plain-text message
+	MessageID   string             `json:"message_id,omitempty"`
+	Attachments []PluginAttachment `json:"attachments,omitempty"`
+}
+
+// PluginAttachment describes an attachment; the content is base64-encoded by encoding/json
+type PluginAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// PluginRunner delivers messages for unknown platform domains by executing <dir>/<domain>
+type PluginRunner struct {
+	Dir     string
+	Timeout time.Duration
+}
+
+// NewPluginRunner creates a new plugin runner for the given directory
+func NewPluginRunner(dir string) *PluginRunner {
+	return &PluginRunner{
+		Dir:     dir,
+		Timeout: PluginExecTimeout,
+	}
+}
+
+// Lookup returns the executable handling the platform, if one is installed.
+// The directory is checked on every call so plugins can be added without a restart
+func (pr *PluginRunner) Lookup(platform string) (string, bool) {
+	if !pluginNamePattern.MatchString(platform) {
+		return "", false
+	}
+
+	path := filepath.Join(pr.Dir, platform)
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return "", false
+	}
+
+	return path, true
+}
+
+// Send runs the plugin for the platform with the message as JSON on stdin.
+// Exit code 0 means delivered; anything else is reported with the plugin's stderr
+func (pr *PluginRunner) Send(platform string, message PluginMessage) error {
+	path, ok := pr.Lookup(platform)
+	if !ok {
+		return fmt.Errorf("no plugin installed for %s", platform)
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plugin message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pr.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(jsonData)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"EMAIL2DM_PLATFORM="+platform,
+		"EMAIL2DM_ID="+message.ID,
+	)
+
+	log.Printf("Running plugin %s for %s (payload: %d bytes)", path, message.ID, len(jsonData))
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("plugin %s timed out after %s", platform, pr.Timeout)
+		}
+
+		detail := strings.TrimSpace(stderr.String())
+		if len(detail) > PluginMaxStderrSize {
+			detail = detail[:PluginMaxStderrSize] + "..."
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("plugin %s exited with code %d: %s", platform, exitErr.ExitCode(), detail)
+		}
+		return fmt.Errorf("failed to run plugin %s: %w", platform, err)
+	}
+
+	log.Printf("Plugin %s delivered message to %s", platform, message.ID)
+	return nil
+}
+
+// pluginMessage builds the JSON document handed to a platform plugin
+func (ep *EmailProcessor) pluginMessage(email *ProcessedEmail, message, platform, userID string) PluginMessage {
+	pluginMessage := PluginMessage{
+		Platform:  platform,
+		ID:        userID,
+		From:      email.From,
+		To:        email.To,
+		Subject:   email.Subject,
+		Date:      email.Date,
+		Body:      email.Body,
+		Message:   message,
+		MessageID: email.MessageID,
+	}
+
+	for _, attachment := range email.Attachments {
+		data, err := attachment.Content()
+		if err != nil {
+			log.Printf("Warning: leaving attachment out of plugin message: %v", err)
+			continue
+		}
+		pluginMessage.Attachments = append(pluginMessage.Attachments, PluginAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        data,
+		})
+	}
+
+	return pluginMessage
+}
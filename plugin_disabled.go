@@ -0,0 +1,33 @@
+//go:build minimal || noplugins
+
+package main
+
+func init() {
+	excludeFeature("platform plugin", "noplugins")
+}
+
+// PluginMessage is the document handed to a platform plugin
+type PluginMessage struct{}
+
+// PluginRunner is a placeholder for builds without platform plugins
+type PluginRunner struct{}
+
+// NewPluginRunner creates a placeholder runner that finds no plugins
+func NewPluginRunner(dir string) *PluginRunner {
+	return &PluginRunner{}
+}
+
+// Lookup finds no plugins without plugin support
+func (pr *PluginRunner) Lookup(platform string) (string, bool) {
+	return "", false
+}
+
+// Send reports that platform plugins were compiled out
+func (pr *PluginRunner) Send(platform string, message PluginMessage) error {
+	return requireFeature("platform plugin")
+}
+
+// pluginMessage is unused without plugin support
+func (ep *EmailProcessor) pluginMessage(email *ProcessedEmail, message, platform, userID string) PluginMessage {
+	return PluginMessage{}
+}
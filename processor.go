@@ -2,25 +2,54 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"log/syslog"
 	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// ErrInvalidDestination is matched by errors for recipients that cannot be mapped to a platform
+var ErrInvalidDestination = errors.New("invalid destination")
+
 // EmailProcessor handles email parsing and processing
 type EmailProcessor struct {
-	TelegramClient *TelegramClient
-	SlackClient    *SlackClient
-	SyslogWriter   *syslog.Writer
+	Config          *Config
+	TelegramClient  *TelegramClient
+	TelegramBots    map[string]*TelegramClient // Named bots, addressed as <id>@<name>.telegram
+	TelegramAcks    *TelegramAcks              // Acknowledgement buttons on alerts; nil disables
+	TelegramReplies *TelegramReplies           // Emails replies to bridged messages back; nil disables
+	TelegramPins    *TelegramPins              // Pins critical alerts until they recover; nil disables
+	SlackClient     *SlackClient
+	DingTalkClient  *DingTalkClient
+	WeComClient     *WeComClient
+	MastodonClient  *MastodonClient
+	WhatsAppClient  *WhatsAppClient
+	ZoomClient      *ZoomClient
+	VictorOpsClient *VictorOpsClient
+	RedisClient     *RedisClient
+	Resolver        *ResolverClient
+	Plugins         *PluginRunner
+	Severity        *SeverityClassifier
+	RcptVerifier    *RecipientVerifier // Destination checks at RCPT TO; nil disables
+	History         *AlertHistory      // Recent deliveries for /search; nil keeps none
+	SizeQuotas      *SizeQuotas        // Bytes accepted per destination and day; nil counts nothing
+	SyslogWriter    *syslog.Writer
+	Metrics         *Metrics
 }
 
 // NewEmailProcessor creates a new email processor
-func NewEmailProcessor(telegramClient *TelegramClient, slackClient *SlackClient) *EmailProcessor {
+func NewEmailProcessor(config *Config, telegramClient *TelegramClient, slackClient *SlackClient, dingTalkClient *DingTalkClient, weComClient *WeComClient, mastodonClient *MastodonClient, whatsAppClient *WhatsAppClient, zoomClient *ZoomClient, victorOpsClient *VictorOpsClient, redisClient *RedisClient) *EmailProcessor {
 	// Initialize syslog writer
 	syslogWriter, err := syslog.New(syslog.LOG_INFO|syslog.LOG_MAIL, "email2dm")
 	if err != nil {
@@ -28,38 +57,335 @@ func NewEmailProcessor(telegramClient *TelegramClient, slackClient *SlackClient)
 		syslogWriter = nil
 	}
 
+	// Initialize the external destination resolver if configured
+	var resolver *ResolverClient
+	if config != nil && config.ResolverWebhookURL != "" {
+		resolver = NewResolverClient(config.ResolverWebhookURL, config.ResolverWebhookToken)
+		log.Printf("External destination resolver enabled: %s", config.ResolverWebhookURL)
+	}
+
+	// Initialize the plugin runner for platforms handled by external executables
+	var plugins *PluginRunner
+	if config != nil && config.PluginDir != "" {
+		plugins = NewPluginRunner(config.PluginDir)
+		log.Printf("Platform plugins enabled from %s", config.PluginDir)
+	}
+
+	// Initialize the severity classifier with any extra keywords
+	severity := defaultSeverityClassifier
+	if config != nil && len(config.SeverityKeywords) > 0 {
+		severity = NewSeverityClassifier(config.SeverityKeywords)
+	}
+
 	return &EmailProcessor{
-		TelegramClient: telegramClient,
-		SlackClient:    slackClient,
-		SyslogWriter:   syslogWriter,
+		Config:          config,
+		TelegramClient:  telegramClient,
+		SlackClient:     slackClient,
+		DingTalkClient:  dingTalkClient,
+		WeComClient:     weComClient,
+		MastodonClient:  mastodonClient,
+		WhatsAppClient:  whatsAppClient,
+		ZoomClient:      zoomClient,
+		VictorOpsClient: victorOpsClient,
+		RedisClient:     redisClient,
+		Resolver:        resolver,
+		Plugins:         plugins,
+		Severity:        severity,
+		SyslogWriter:    syslogWriter,
+		Metrics:         NewMetrics(),
 	}
 }
 
 // ProcessedEmail represents a processed email with extracted information
 type ProcessedEmail struct {
-	From    string
-	To      string
-	Subject string
-	Date    string
-	Body    string
+	From         string
+	To           string
+	Subject      string
+	Date         string
+	Sent         time.Time // From the first Received header, or a Date close to it; zero when unknown
+	Body         string
+	BodyHTML     bool // Body is text/html markup because the message had no plain text part
+	Attachments  []Attachment
+	InlineImages []Attachment // Images embedded in the body rather than attached
+	Severity     Severity     // Detected from multi-language keywords in subject and body, or X-Priority
+
+	// Threading headers of the original message, used when replying to it
+	MessageID  string
+	InReplyTo  string
+	References []string
+
+	SlackMention string // X-Slack-Mention header, e.g. "@oncall-team, @here"
+	Silent       bool   // X-Silent header or an automatic reply: deliver without a notification sound where supported
+	FromName     string // Name SENDER_NAMES gives the sender, shown instead of the address
+	Encrypted    bool   // Body is the ciphertext of the email for a destination in ENCRYPTION_KEYS
+	SubjectOnly  bool   // Empty body under EMPTY_BODY_POLICY=subject: send a compact message
+	Page         bool   // PAGE_KEYWORD or PAGE_HEADER: notify, and never fold, batch or drop the alert
+
+	Session SessionInfo // How the message reached the bridge
 }
 
 // ProcessEmail processes raw email data and sends it to the appropriate platform
 func (ep *EmailProcessor) ProcessEmail(data []byte, from string, to []string, remoteAddr string) error {
+	return ep.ProcessSessionEmail(data, to, SessionInfo{EnvelopeFrom: from, RemoteAddr: remoteAddr})
+}
+
+// ProcessSessionEmail processes an email along with what is known about the session that delivered it
+func (ep *EmailProcessor) ProcessSessionEmail(data []byte, to []string, session SessionInfo) error {
+	log.Printf("Processing email: %d bytes", len(data))
+
+	recipients, err := ep.deliveryRecipients(to)
+	if err != nil {
+		ep.logToSyslog(session.RemoteAddr, session.EnvelopeFrom, "", "", fmt.Sprintf("Invalid destination: %v", err))
+		ep.Metrics.Reject(RejectDestination)
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+
+	// Every recipient is attempted; the message only fails if none of them got it
+	parsed := newParsedMessage(data)
+	defer parsed.Cleanup()
+	return deliveryError(ep.deliverToRecipients(parsed, recipients, session))
+}
+
+// ProcessEachRecipient delivers a message for each envelope recipient on its own, as LMTP
+// replies per recipient: MULTI_RECIPIENT_POLICY does not apply, and the error of a recipient
+// only covers the destinations it named. The message is still parsed once, and a destination
+// named by several recipients gets it once
+func (ep *EmailProcessor) ProcessEachRecipient(data []byte, to []string, session SessionInfo) map[string]error {
 	log.Printf("Processing email: %d bytes", len(data))
 
-	// Extract platform and ID from first TO address
-	platform, userID, err := ep.extractPlatformAndID(to)
+	results := make(map[string]error, len(to))
+	addresses := make(map[string][]string) // Addresses delivered to for each envelope recipient
+	seen := make(map[string]string)        // Address delivered to for each destination
+	var recipients []deliveryRecipient
+	for _, rcpt := range to {
+		destinations, err := ep.deliveryRecipients([]string{rcpt})
+		if err != nil {
+			ep.logToSyslog(session.RemoteAddr, session.EnvelopeFrom, "", "", fmt.Sprintf("Invalid destination: %v", err))
+			ep.Metrics.Reject(RejectDestination)
+			results[rcpt] = fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+			continue
+		}
+		for _, destination := range destinations {
+			address, exists := seen[destination.key()]
+			if !exists {
+				address = destination.Address
+				seen[destination.key()] = address
+				recipients = append(recipients, destination)
+			}
+			addresses[rcpt] = append(addresses[rcpt], address)
+		}
+	}
+
+	parsed := newParsedMessage(data)
+	defer parsed.Cleanup()
+	delivered, failed := ep.deliverToRecipients(parsed, recipients, session)
+	reached := make(map[string]bool, len(delivered))
+	for _, address := range delivered {
+		reached[address] = true
+	}
+	failures := make(map[string]RecipientError, len(failed))
+	for _, failure := range failed {
+		failures[failure.Recipient] = failure
+	}
+
+	for rcpt, rcptAddresses := range addresses {
+		var rcptDelivered []string
+		var rcptFailed []RecipientError
+		for _, address := range rcptAddresses {
+			if reached[address] {
+				rcptDelivered = append(rcptDelivered, address)
+			} else {
+				rcptFailed = append(rcptFailed, failures[address])
+			}
+		}
+		results[rcpt] = deliveryError(rcptDelivered, rcptFailed)
+	}
+	return results
+}
+
+// deliverToRecipients delivers a parsed message to each recipient, and returns the addresses it
+// reached and the failures of the others
+func (ep *EmailProcessor) deliverToRecipients(parsed *parsedMessage, recipients []deliveryRecipient, session SessionInfo) ([]string, []RecipientError) {
+	var delivered []string
+	var failed []RecipientError
+	for _, recipient := range recipients {
+		if err := ep.processRecipientEmail(parsed, recipient, session); err != nil {
+			if len(recipients) > 1 {
+				log.Printf("Delivery to %s failed: %v", recipient.Address, err)
+			}
+			failed = append(failed, RecipientError{Recipient: recipient.Address, Err: err})
+		} else {
+			delivered = append(delivered, recipient.Address)
+		}
+	}
+	return delivered, failed
+}
+
+// deliveryError is the outcome of delivering to several recipients: nil when all got the message,
+// a PartialDeliveryError when some did, and the failure otherwise
+func deliveryError(delivered []string, failed []RecipientError) error {
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(delivered) > 0:
+		return &PartialDeliveryError{Delivered: delivered, Failed: failed}
+	case len(failed) == 1:
+		return failed[0].Err
+	default:
+		return fmt.Errorf("%w (and %d more recipients failed)", failed[0].Err, len(failed)-1)
+	}
+}
+
+// parseResult is the outcome of parsing a message in one body mode
+type parseResult struct {
+	email *ProcessedEmail
+	err   error
+}
+
+// parsedMessage parses a message at most once per body mode, raw or cleaned, so a message for
+// several destinations is not walked and decoded again for each of them
+type parsedMessage struct {
+	data    []byte
+	results map[bool]*parseResult // By raw
+}
+
+// newParsedMessage wraps the raw message data; nothing is parsed until a destination needs it
+func newParsedMessage(data []byte) *parsedMessage {
+	return &parsedMessage{data: data, results: make(map[bool]*parseResult)}
+}
+
+// email returns a copy of the parsed message that one destination may change freely: subject
+// tags, annotations and dropped attachments do not reach the other destinations
+func (m *parsedMessage) email(ep *EmailProcessor, raw bool) (*ProcessedEmail, error) {
+	result := m.results[raw]
+	if result == nil {
+		email, err := ep.parseEmail(m.data, raw)
+		result = &parseResult{email: email, err: err}
+		m.results[raw] = result
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	// Clipped slices make an append copy instead of writing into the shared array
+	email := *result.email
+	email.Attachments = slices.Clip(email.Attachments)
+	email.InlineImages = slices.Clip(email.InlineImages)
+	email.References = slices.Clip(email.References)
+	return &email, nil
+}
+
+// Cleanup removes the spool files of every parse once all destinations are done with them
+func (m *parsedMessage) Cleanup() {
+	for _, result := range m.results {
+		if result.email != nil {
+			result.email.Cleanup()
+		}
+	}
+}
+
+// processRecipientEmail delivers a parsed email to one recipient
+func (ep *EmailProcessor) processRecipientEmail(parsed *parsedMessage, recipient deliveryRecipient, session SessionInfo) error {
+	data := parsed.data
+	from, remoteAddr := session.EnvelopeFrom, session.RemoteAddr
+	address := recipient.Address
+
+	// The platform and ID were extracted from the address when the recipients were listed
+	platform, userID, options, err := recipient.Platform, recipient.ID, recipient.Options, recipient.Err
 	if err != nil {
 		ep.logToSyslog(remoteAddr, from, "", "", fmt.Sprintf("Invalid destination: %v", err))
-		return fmt.Errorf("invalid destination: %w", err)
+		ep.Metrics.Reject(RejectDestination)
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
 	}
 
-	// Parse the email
-	parsedEmail, err := ep.parseEmail(data)
+	// Mail for a platform without a client can go to the fallback destination instead
+	var rerouted string
+	intendedPlatform, intendedID := platform, userID
+	platform, userID, options, rerouted = ep.rerouteUnconfigured(platform, userID, options)
+	if rerouted != "" {
+		ep.logToSyslog(remoteAddr, from, intendedPlatform, intendedID, fmt.Sprintf("Platform not configured, rerouting to %s:%s", platform, userID))
+	}
+
+	budget, err := parseMessageBudget(options)
+	if err != nil {
+		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Invalid destination: %v", err))
+		ep.Metrics.Reject(RejectDestination)
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+	identity, err := parseSenderIdentity(options)
+	if err != nil {
+		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Invalid destination: %v", err))
+		ep.Metrics.Reject(RejectDestination)
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+	staleGuard, err := ep.staleGuard(options)
 	if err != nil {
-		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Parse error: %v", err))
-		return fmt.Errorf("failed to parse email: %w", err)
+		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Invalid destination: %v", err))
+		ep.Metrics.Reject(RejectDestination)
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+
+	// Count the bytes accepted for the destination; past its daily quota mail is refused or shortened
+	var quotaErr *SizeQuotaError
+	if ep.SizeQuotas != nil {
+		quotaErr = ep.SizeQuotas.Account(destinationKey(platform, userID), int64(len(data)))
+	}
+	if quotaErr != nil && ep.isPageMessage(data) {
+		log.Printf("Delivering page to %s:%s in full despite the daily size quota", platform, userID)
+		quotaErr = nil
+	}
+	if quotaErr != nil && ep.SizeQuotas.Policy == SizeQuotaPolicyReject {
+		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Refused: %v", quotaErr))
+		ep.Metrics.Reject(RejectQuota)
+		return quotaErr
+	}
+
+	// Parse the email; raw destinations keep the decoded body exactly as sent
+	parsedEmail, err := parsed.email(ep, options.Has("raw"))
+	if err != nil {
+		// Limit violations are always rejected, they protect the bridge from crafted messages
+		if errors.Is(err, ErrParseLimitExceeded) || ep.parseFailurePolicy() != ParseFailureForward {
+			ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Parse error: %v", err))
+			ep.Metrics.Reject(parseRejectReason(err))
+			return fmt.Errorf("failed to parse email: %w", err)
+		}
+
+		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Parse error, forwarding raw message: %v", err))
+		parsedEmail = ep.rawFallbackEmail(data, from, address, err)
+	}
+	if rerouted != "" {
+		parsedEmail.Subject = strings.TrimSpace(parsedEmail.Subject + " " + rerouted)
+	}
+	parsedEmail.Session = session
+	if quotaErr != nil {
+		summarizeOverQuota(parsedEmail, quotaErr.Quota)
+	}
+	if !ep.applyEmptyBodyPolicy(parsedEmail) {
+		ep.logToSyslog(remoteAddr, from, platform, userID, "Dropped: empty body")
+		log.Printf("Dropped email with an empty body - From: %s, Subject: %s", parsedEmail.From, parsedEmail.Subject)
+		return nil
+	}
+	ep.applySenderName(parsedEmail)
+	ep.applySenderBanner(parsedEmail, platform, userID)
+
+	// Mail held up in a queue for too long is dropped or marked with its age
+	if !ep.applyStaleGuard(parsedEmail, staleGuard) {
+		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Dropped: stale, sent at %s", parsedEmail.Sent.UTC().Format(time.RFC3339)))
+		log.Printf("Dropped email older than %s - From: %s, Subject: %s", staleGuard.MaxAge, parsedEmail.From, parsedEmail.Subject)
+		return nil
+	}
+
+	// SPF and DMARC results go below the body, inside the ciphertext of encrypted destinations
+	ep.applySPFAnnotation(parsedEmail)
+	ep.applyDMARCAnnotation(parsedEmail)
+
+	// Destinations with a public key only ever receive ciphertext
+	if key := ep.encryptionKey(platform, userID); key != nil {
+		if err := ep.encryptEmail(parsedEmail, key); err != nil {
+			ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Encryption failed: %v", err))
+			ep.Metrics.Reject(RejectDelivery)
+			return fmt.Errorf("failed to encrypt for %s: %w", platform, err)
+		}
 	}
 
 	// Log to syslog
@@ -70,59 +396,179 @@ func (ep *EmailProcessor) ProcessEmail(data []byte, from string, to []string, re
 		parsedEmail.From, platform, userID, parsedEmail.Subject)
 
 	// Format message for the specific platform
-	message := ep.formatMessageForPlatform(parsedEmail, platform)
+	var message string
+	if parsedEmail.SubjectOnly {
+		message = ep.formatSubjectOnlyForPlatform(parsedEmail, platform)
+	} else if options.Has("raw") || parsedEmail.Encrypted {
+		message = ep.formatRawForPlatform(parsedEmail, platform)
+	} else {
+		message = ep.formatMessageForPlatform(parsedEmail, platform)
+	}
 
-	// Send to the appropriate platform
-	if err := ep.sendToPlatform(message, platform, userID); err != nil {
-		ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Send failed: %v", err))
+	// Send to the appropriate platform, recording chunks, message IDs and retries on the way
+	receipt := &DeliveryReceipt{}
+	ctx := withSenderIdentity(withMessageBudget(withDeliveryReceipt(context.Background(), receipt), budget), identity)
+	started := time.Now()
+	err = ep.sendToPlatform(ctx, parsedEmail, message, platform, userID, options)
+	receipt.Latency = time.Since(started)
+	ep.recordHistory(parsedEmail, platform, userID, options, receipt, err)
+	if err != nil {
+		ep.logDeliveryToSyslog(remoteAddr, from, platform, userID, receipt, fmt.Sprintf("Send failed: %v", err))
+		ep.Metrics.Reject(RejectDelivery)
 		return fmt.Errorf("failed to send to %s: %w", platform, err)
 	}
 
-	ep.logToSyslog(remoteAddr, from, platform, userID, "Email sent successfully")
+	// Attach the untouched original message if requested; the text is already delivered,
+	// so a failed upload is logged rather than failing the SMTP transaction
+	if options.Has("eml") && quotaErr == nil && !parsedEmail.Encrypted {
+		if err := ep.sendOriginalToPlatform(ctx, data, parsedEmail, platform, userID, options); err != nil {
+			log.Printf("Warning: failed to attach original message: %v", err)
+			ep.logToSyslog(remoteAddr, from, platform, userID, fmt.Sprintf("Original attachment failed: %v", err))
+		}
+	}
+
+	ep.logDeliveryToSyslog(remoteAddr, from, platform, userID, receipt, "Email sent successfully")
 	log.Println("Email successfully processed and sent")
 	return nil
 }
 
-// extractPlatformAndID extracts platform and user ID from the first email address
-func (ep *EmailProcessor) extractPlatformAndID(toAddresses []string) (platform, userID string, err error) {
-	if len(toAddresses) == 0 {
-		return "", "", fmt.Errorf("no recipient addresses provided")
+// extractPlatformAndID extracts platform, user ID and destination options from a recipient address
+func (ep *EmailProcessor) extractPlatformAndID(recipient string) (platform, userID string, options DestinationOptions, err error) {
+	// Parse email address to get local and domain parts. The SMTP layer has already
+	// unquoted local parts such as "@user@instance", so fall back to the raw address
+	address := strings.Trim(strings.TrimSpace(recipient), "<>")
+	if addr, err := mail.ParseAddress(recipient); err == nil {
+		address = addr.Address
 	}
 
-	// Use only the first TO address
-	firstAddress := toAddresses[0]
-
-	// Parse email address to get local and domain parts
-	addr, err := mail.ParseAddress(firstAddress)
+	// Address macros derive the destination from a table row maintained by the operator
+	derived, err := ep.expandAddressMacro(address)
 	if err != nil {
-		return "", "", fmt.Errorf("invalid email address format: %s", firstAddress)
+		return "", "", nil, fmt.Errorf("address macro %s: %w", address, err)
+	}
+	if derived != "" {
+		address = derived
+	}
+
+	// Split at the last @ so the local part may itself contain @ (Mastodon accounts)
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return "", "", nil, fmt.Errorf("invalid email address format: %s", address)
+	}
+
+	// Address modifiers (id+option) select per-destination behaviour
+	localPart, addressOptions := splitAddressModifiers(address[:at])
+	domainPart := strings.ToLower(address[at+1:])
+
+	// Signed addresses name their destination in the local part; once required, nothing else is accepted
+	tokens := ep.addressTokens()
+	if tokens != nil && domainPart == tokens.Domain {
+		tokenPlatform, tokenID, err := tokens.Verify(localPart, time.Now())
+		if err != nil {
+			return "", "", nil, fmt.Errorf("invalid signed address %s: %w", address, err)
+		}
+		platform, userID, err = ep.validateDestination(tokenPlatform, tokenID)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return platform, userID, ep.destinationOptions(platform, userID, addressOptions), nil
+	}
+	if tokens != nil && tokens.Required && derived == "" {
+		return "", "", nil, fmt.Errorf("unsigned address %s rejected: ADDRESS_TOKENS_REQUIRED is set", address)
 	}
 
-	// Split email to get local part (before @) and domain (after @)
-	parts := strings.Split(addr.Address, "@")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid email address format: %s", addr.Address)
+	// Named Telegram bots are addressed by subdomain: 12345@prod.telegram
+	if bot, found := strings.CutSuffix(domainPart, ".telegram"); found {
+		if _, exists := ep.TelegramBots[bot]; !exists {
+			return "", "", nil, fmt.Errorf("unsupported platform: %s (no TELEGRAM_BOT_TOKEN_%s)", domainPart, strings.ToUpper(strings.ReplaceAll(bot, "-", "_")))
+		}
+		domainPart = "telegram"
+		addressOptions["bot"] = bot
+	}
+
+	// Determine platform from domain and validate the ID for it
+	platform, userID, err = ep.validateDestination(domainPart, localPart)
+
+	// Let the external resolver map addresses we do not recognize
+	if err != nil && ep.Resolver != nil {
+		resolvedPlatform, resolvedID, resolveErr := ep.Resolver.Resolve(address, localPart, domainPart)
+		if resolveErr != nil {
+			log.Printf("External resolver could not map %s: %v", address, resolveErr)
+			return "", "", nil, err
+		}
+
+		platform, userID, err = ep.validateDestination(strings.ToLower(resolvedPlatform), resolvedID)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("resolver returned an invalid destination for %s: %w", address, err)
+		}
+	}
+	if err != nil {
+		return "", "", nil, err
 	}
 
-	localPart := parts[0]
-	domainPart := strings.ToLower(parts[1])
+	return platform, userID, ep.destinationOptions(platform, userID, addressOptions), nil
+}
 
-	// Determine platform from domain
-	switch domainPart {
+// validateDestination maps a domain to its platform and validates the ID for that platform
+func (ep *EmailProcessor) validateDestination(domain, id string) (platform, userID string, err error) {
+	switch domain {
 	case "telegram":
 		platform = "telegram"
 	case "slack":
 		platform = "slack"
+	case "dingtalk":
+		platform = "dingtalk"
+	case "wecom":
+		platform = "wecom"
+	case "mastodon":
+		platform = "mastodon"
+	case "whatsapp":
+		platform = "whatsapp"
+	case "zoom":
+		platform = "zoom"
+	case "victorops":
+		platform = "victorops"
+	case "redis":
+		platform = "redis"
 	default:
-		return "", "", fmt.Errorf("unsupported platform: %s", domainPart)
+		// Unknown domains may be a custom HTTP platform or handled by an installed plugin
+		if _, ok := ep.httpPlatform(domain); ok {
+			platform = domain
+			break
+		}
+		if ep.Plugins == nil {
+			return "", "", fmt.Errorf("unsupported platform: %s", domain)
+		}
+		if _, ok := ep.Plugins.Lookup(domain); !ok {
+			return "", "", fmt.Errorf("unsupported platform: %s", domain)
+		}
+		platform = domain
 	}
 
-	// Validate the ID for the specific platform
-	if err := ep.validateIDForPlatform(localPart, platform); err != nil {
-		return "", "", fmt.Errorf("invalid %s ID '%s': %w", platform, localPart, err)
+	// Validate the canonical form of the ID for the specific platform
+	id = normalizeDestinationID(platform, id)
+	if err := ep.validateIDForPlatform(id, platform); err != nil {
+		return "", "", fmt.Errorf("invalid %s ID '%s': %w", platform, id, err)
 	}
 
-	return platform, localPart, nil
+	return platform, id, nil
+}
+
+// addressTokens returns the signed address settings, or nil when they are disabled
+func (ep *EmailProcessor) addressTokens() *AddressTokens {
+	if ep.Config == nil {
+		return nil
+	}
+	return ep.Config.AddressTokens
+}
+
+// httpPlatform returns the custom HTTP platform registered for a domain
+func (ep *EmailProcessor) httpPlatform(name string) (*HTTPPlatform, bool) {
+	if ep.Config == nil {
+		return nil, false
+	}
+	platform, ok := ep.Config.HTTPPlatforms[name]
+	return platform, ok
 }
 
 // validateIDForPlatform validates if a string looks like a valid ID for the specified platform
@@ -136,21 +582,51 @@ func (ep *EmailProcessor) validateIDForPlatform(id, platform string) error {
 		return ep.validateTelegramID(id)
 	case "slack":
 		return ep.validateSlackID(id)
+	case "dingtalk":
+		return ep.validateDingTalkID(id)
+	case "wecom":
+		return ep.validateWeComID(id)
+	case "mastodon":
+		return ep.validateMastodonID(id)
+	case "whatsapp":
+		return ep.validateWhatsAppID(id)
+	case "zoom":
+		return ep.validateZoomID(id)
+	case "victorops":
+		return ep.validateVictorOpsID(id)
+	case "redis":
+		return ep.validateRedisChannel(id)
 	default:
+		// Custom platforms take any ID, and plugins validate their own IDs when they run
+		if _, ok := ep.httpPlatform(platform); ok {
+			return nil
+		}
+		if ep.Plugins != nil {
+			if _, ok := ep.Plugins.Lookup(platform); ok {
+				return nil
+			}
+		}
 		return fmt.Errorf("unsupported platform: %s", platform)
 	}
 }
 
 // validateTelegramID validates if a string looks like a valid Telegram chat ID
 func (ep *EmailProcessor) validateTelegramID(id string) error {
-	// Handle group prefix notation: g123456 -> -123456
-	if strings.HasPrefix(id, "g") && len(id) > 1 {
-		// Remove 'g' prefix and validate the rest as a number
-		numPart := id[1:]
-		if _, err := strconv.ParseInt(numPart, 10, 64); err != nil {
-			return fmt.Errorf("invalid group ID format 'g%s': %w", numPart, err)
-		}
-		log.Printf("Validated Telegram group ID: g%s (will convert to -%s)", numPart, numPart)
+	// A forum topic follows the chat ID: g123456.42
+	id, topicID, err := splitTelegramTopic(id)
+	if err != nil {
+		return err
+	}
+	if topicID != 0 {
+		log.Printf("Validated Telegram forum topic: %d", topicID)
+	}
+
+	// Public channels and groups can be addressed by username: @channelname
+	if strings.HasPrefix(id, "@") {
+		if !telegramUsernamePattern.MatchString(id[1:]) {
+			return fmt.Errorf("invalid username '%s': use 5-32 letters, digits and underscores, starting with a letter", id)
+		}
+		log.Printf("Validated Telegram public chat username: %s", id)
 		return nil
 	}
 
@@ -207,48 +683,256 @@ func (ep *EmailProcessor) validateSlackID(id string) error {
 	return fmt.Errorf("invalid Slack ID format (expected U1234567890, C1234567890, #channel, or username)")
 }
 
-// sendToPlatform routes the message to the appropriate platform client
-func (ep *EmailProcessor) sendToPlatform(message, platform, userID string) error {
-	switch platform {
-	case "telegram":
-		if ep.TelegramClient == nil {
-			return fmt.Errorf("telegram client not configured")
+// validateDingTalkID validates if a string looks like a valid DingTalk robot name
+func (ep *EmailProcessor) validateDingTalkID(id string) error {
+	// Robot names are operator-chosen keys from DINGTALK_ROBOTS
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') &&
+			r != '-' && r != '_' && r != '.' {
+			return fmt.Errorf("invalid DingTalk robot name (expected letters, digits, '-', '_' or '.')")
+		}
+	}
+
+	log.Printf("Validated DingTalk robot name: %s", id)
+	return nil
+}
+
+// validateWeComID validates if a string looks like a valid WeCom user ID
+func (ep *EmailProcessor) validateWeComID(id string) error {
+	// WeCom user IDs are up to 64 letters, digits, '_', '-' or '.'
+	if len(id) > 64 {
+		return fmt.Errorf("WeCom user ID longer than 64 characters")
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') &&
+			r != '-' && r != '_' && r != '.' {
+			return fmt.Errorf("invalid WeCom user ID (expected letters, digits, '-', '_' or '.')")
+		}
+	}
+
+	log.Printf("Validated WeCom user ID: %s", id)
+	return nil
+}
+
+// validateMastodonID validates if a string looks like a valid Mastodon account
+func (ep *EmailProcessor) validateMastodonID(id string) error {
+	// Accounts are normalized to user@instance or a local user
+	username, domain, remote := strings.Cut(id, "@")
+	if username == "" {
+		return fmt.Errorf("empty Mastodon username")
+	}
+	if len(username) > MastodonMaxUsernameLength {
+		return fmt.Errorf("Mastodon username longer than %d characters", MastodonMaxUsernameLength)
+	}
+	if len(domain) > MastodonMaxDomainLength {
+		return fmt.Errorf("Mastodon instance longer than %d characters", MastodonMaxDomainLength)
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '_' {
+			return fmt.Errorf("invalid Mastodon username (expected letters, digits or '_')")
 		}
+	}
+	if remote && (domain == "" || strings.ContainsAny(domain, "@/ ") || !strings.Contains(domain, ".")) {
+		return fmt.Errorf("invalid Mastodon instance '%s'", domain)
+	}
+
+	log.Printf("Validated Mastodon account: @%s", id)
+	return nil
+}
 
-		// Convert group prefix notation: g123456 -> -123456
-		telegramID := userID
-		if strings.HasPrefix(userID, "g") && len(userID) > 1 {
-			telegramID = "-" + userID[1:]
-			log.Printf("Converted group ID: %s -> %s", userID, telegramID)
+// validateWhatsAppID validates if a string looks like an international phone number
+func (ep *EmailProcessor) validateWhatsAppID(id string) error {
+	// Numbers are given in E.164 form, e.g. +15551234567
+	number := strings.TrimPrefix(id, "+")
+	if len(number) < 8 || len(number) > 15 {
+		return fmt.Errorf("phone number must have 8 to 15 digits")
+	}
+	if _, err := strconv.ParseUint(number, 10, 64); err != nil {
+		return fmt.Errorf("invalid phone number (expected +15551234567)")
+	}
+
+	log.Printf("Validated WhatsApp number: +%s", number)
+	return nil
+}
+
+// telegramChatID returns the chat of a validated Telegram ID, dropping any forum topic
+func (ep *EmailProcessor) telegramChatID(userID string) string {
+	chatID, _, _ := splitTelegramTopic(userID)
+	return chatID
+}
+
+// validateZoomID validates if a string looks like a Zoom channel JID or channel ID
+func (ep *EmailProcessor) validateZoomID(id string) error {
+	// Channel JIDs are normalized to the channel ID
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return fmt.Errorf("invalid Zoom channel ID (expected a channel JID or ID)")
 		}
+	}
+	if id == "" {
+		return fmt.Errorf("empty Zoom channel ID")
+	}
 
-		return ep.TelegramClient.SendLongMessageToChat(message, telegramID)
+	log.Printf("Validated Zoom channel ID: %s", id)
+	return nil
+}
+
+// validateVictorOpsID validates if a string looks like a VictorOps routing key
+func (ep *EmailProcessor) validateVictorOpsID(id string) error {
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') &&
+			r != '-' && r != '_' && r != '.' {
+			return fmt.Errorf("invalid VictorOps routing key (expected letters, digits, '-', '_' or '.')")
+		}
+	}
+
+	log.Printf("Validated VictorOps routing key: %s", id)
+	return nil
+}
+
+// validateRedisChannel validates if a string is usable as a Redis pub/sub channel name
+func (ep *EmailProcessor) validateRedisChannel(id string) error {
+	if len(id) > RedisMaxChannelBytes {
+		return fmt.Errorf("channel name longer than %d bytes", RedisMaxChannelBytes)
+	}
+	for _, r := range id {
+		if r <= ' ' || r == 0x7f {
+			return fmt.Errorf("channel name contains whitespace or control characters")
+		}
+	}
+
+	log.Printf("Validated Redis channel: %s", id)
+	return nil
+}
+
+// sendToPlatform routes the message to the appropriate platform client
+func (ep *EmailProcessor) sendToPlatform(ctx context.Context, email *ProcessedEmail, message, platform, userID string, options DestinationOptions) error {
+	switch platform {
+	case "telegram":
+		return ep.sendToTelegram(ctx, email, message, userID, options)
 
 	case "slack":
 		if ep.SlackClient == nil {
 			return fmt.Errorf("slack client not configured")
 		}
 
-		// Resolve username to User ID if needed
-		resolvedID := userID
-		if !strings.HasPrefix(userID, "U") && !strings.HasPrefix(userID, "C") && !strings.HasPrefix(userID, "#") {
-			// This looks like a username, try to resolve it
-			log.Printf("Attempting to resolve Slack username '%s' to User ID", userID)
-			resolvedUserID, err := ep.SlackClient.ResolveUserID(userID)
-			if err != nil {
-				return fmt.Errorf("failed to resolve username '%s': %w", userID, err)
-			}
-			resolvedID = resolvedUserID
-			log.Printf("Resolved username '%s' to User ID '%s'", userID, resolvedID)
+		return ep.sendToSlack(ctx, email, message, platform, userID, options)
+
+	case "dingtalk":
+		if ep.DingTalkClient == nil {
+			return fmt.Errorf("dingtalk client not configured")
+		}
+
+		// The title is what shows up in the DingTalk conversation list and notifications
+		return ep.DingTalkClient.SendLongMarkdownToRobot(ctx, ep.renderTitle(email, platform, userID), message, userID)
+
+	case "wecom":
+		if ep.WeComClient == nil {
+			return fmt.Errorf("wecom client not configured")
 		}
 
-		return ep.SlackClient.SendLongMessageToChannel(message, resolvedID)
+		return ep.WeComClient.SendLongMessageToUser(ctx, message, userID)
+
+	case "mastodon":
+		if ep.MastodonClient == nil {
+			return fmt.Errorf("mastodon client not configured")
+		}
+
+		return ep.MastodonClient.SendLongDirectMessage(ctx, message, userID)
+
+	case "whatsapp":
+		if ep.WhatsAppClient == nil {
+			return fmt.Errorf("whatsapp client not configured")
+		}
+
+		// The Cloud API expects the number without the leading +
+		number := strings.TrimPrefix(userID, "+")
+
+		// Templates can be delivered at any time, session messages only inside the 24h window
+		if ep.WhatsAppClient.TemplateName != "" {
+			return ep.WhatsAppClient.SendTemplateToNumber(ctx, email.Subject, email.Body, number)
+		}
+
+		return ep.WhatsAppClient.SendLongTextToNumber(ctx, message, number)
+
+	case "zoom":
+		if ep.ZoomClient == nil {
+			return fmt.Errorf("zoom client not configured")
+		}
+
+		return ep.ZoomClient.SendLongMessageToChannel(ctx, message, userID)
+
+	case "victorops":
+		if ep.VictorOpsClient == nil {
+			return fmt.Errorf("victorops client not configured")
+		}
+
+		alert := VictorOpsAlert{
+			MessageType:       ep.VictorOpsClient.MessageTypeForSeverity(email.Severity, email.Subject),
+			EntityID:          ep.VictorOpsClient.EntityID(ep.severityClassifier().StripKeywords(email.Subject)),
+			EntityDisplayName: ep.renderTitle(email, platform, userID),
+			StateMessage:      message,
+			MonitoringTool:    "email2dm",
+		}
+		if identity := senderIdentityFrom(ctx); identity.Name != "" {
+			alert.MonitoringTool = identity.Name
+		}
+
+		return ep.VictorOpsClient.SendAlert(ctx, alert, userID)
+
+	case "redis":
+		if ep.RedisClient == nil {
+			return fmt.Errorf("redis client not configured")
+		}
+
+		if err := ep.RedisClient.PublishToChannel(email, message, userID); err != nil {
+			return err
+		}
+		deliveryReceiptFrom(ctx).recordMessage("")
+		return nil
 
 	default:
+		if custom, ok := ep.httpPlatform(platform); ok {
+			return custom.Send(ctx, ep.httpPlatformData(email, message, platform, userID))
+		}
+		if ep.Plugins != nil {
+			if err := ep.Plugins.Send(platform, ep.pluginMessage(email, message, platform, userID)); err != nil {
+				return err
+			}
+			deliveryReceiptFrom(ctx).recordMessage("")
+			return nil
+		}
 		return fmt.Errorf("unsupported platform: %s", platform)
 	}
 }
 
+// sendOriginalToPlatform uploads the raw message as an .eml file on platforms that support uploads
+func (ep *EmailProcessor) sendOriginalToPlatform(ctx context.Context, data []byte, email *ProcessedEmail, platform, userID string, options DestinationOptions) error {
+	const filename = "original-message.eml"
+
+	switch platform {
+	case "telegram":
+		bot, err := ep.telegramBot(options)
+		if err != nil {
+			return err
+		}
+		ctx, err = ep.telegramContext(ctx, email, userID, options)
+		if err != nil {
+			return err
+		}
+		return bot.SendDocumentToChat(ctx, filename, data, email.Subject, ep.telegramChatID(userID))
+
+	case "slack":
+		if ep.SlackClient == nil {
+			return fmt.Errorf("slack client not configured")
+		}
+		return ep.sendOriginalToSlack(ctx, filename, data, email, userID)
+
+	default:
+		return fmt.Errorf("%s does not support file uploads", platform)
+	}
+}
+
 // formatMessageForPlatform formats the processed email for the specific platform
 func (ep *EmailProcessor) formatMessageForPlatform(email *ProcessedEmail, platform string) string {
 	switch platform {
@@ -256,18 +940,69 @@ func (ep *EmailProcessor) formatMessageForPlatform(email *ProcessedEmail, platfo
 		return ep.formatForTelegram(email)
 	case "slack":
 		return ep.formatForSlack(email)
+	case "dingtalk":
+		return ep.formatForDingTalk(email)
+	case "wecom":
+		if ep.WeComClient != nil && ep.WeComClient.MessageType == "text" {
+			return ep.formatPlainText(email)
+		}
+		return ep.formatForWeCom(email)
+	case "mastodon":
+		return ep.formatForMastodon(email)
+	case "whatsapp":
+		return ep.formatForWhatsApp(email)
 	default:
 		// Fallback to plain text
-		return fmt.Sprintf("New Email\nFrom: %s\nTo: %s\nSubject: %s\nDate: %s\n\nMessage:\n%s",
-			email.From, email.To, email.Subject, email.Date, email.Body)
+		return ep.formatPlainText(email)
+	}
+}
+
+// formatRawForPlatform forwards the decoded body verbatim in the platform's code block markup,
+// for devices that send pre-formatted text
+func (ep *EmailProcessor) formatRawForPlatform(email *ProcessedEmail, platform string) string {
+	// Only line endings are normalized, chat clients render CRLF inconsistently
+	body := strings.TrimRight(strings.ReplaceAll(email.Body, "\r\n", "\n"), "\n")
+
+	switch platform {
+	case "telegram":
+		return "<pre>" + ep.escapeHTML(body) + "</pre>"
+	case "slack":
+		return "```\n" + ep.escapeSlackText(body) + "\n```"
+	case "dingtalk":
+		return "```\n" + body + "\n```"
+	case "wecom":
+		if ep.WeComClient != nil && ep.WeComClient.MessageType == "text" {
+			return body
+		}
+		return "```\n" + body + "\n```"
+	case "whatsapp":
+		return "```" + body + "```"
+	default:
+		// Plain-text platforms have no code blocks
+		return body
 	}
 }
 
+// formatPlainText formats the processed email without any markup
+func (ep *EmailProcessor) formatPlainText(email *ProcessedEmail) string {
+	return fmt.Sprintf("New Email\nFrom: %s\nTo: %s\nSubject: %s\nDate: %s\n\nMessage:\n%s",
+		senderDisplay(email), email.To, email.Subject, email.Date, email.Body)
+}
+
 // logToSyslog logs email processing events to syslog
 func (ep *EmailProcessor) logToSyslog(srcIP, fromAddr, platform, userID, message string) {
-	logMessage := fmt.Sprintf("src=%s from=%s platform=%s user_id=%s msg=%s",
-		srcIP, fromAddr, platform, userID, message)
+	ep.writeSyslog(fmt.Sprintf("src=%s from=%s platform=%s user_id=%s msg=%s",
+		ep.syslogField(srcIP), ep.syslogField(fromAddr), ep.syslogField(platform), ep.syslogField(userID), ep.syslogField(message)))
+}
 
+// logDeliveryToSyslog logs the outcome of a delivery with the receipt fields before the message
+func (ep *EmailProcessor) logDeliveryToSyslog(srcIP, fromAddr, platform, userID string, receipt *DeliveryReceipt, message string) {
+	ep.writeSyslog(fmt.Sprintf("src=%s from=%s platform=%s user_id=%s %s msg=%s",
+		ep.syslogField(srcIP), ep.syslogField(fromAddr), ep.syslogField(platform), ep.syslogField(userID), receipt, ep.syslogField(message)))
+}
+
+// writeSyslog writes a formatted line to syslog, falling back to the standard log
+func (ep *EmailProcessor) writeSyslog(logMessage string) {
 	if ep.SyslogWriter != nil {
 		err := ep.SyslogWriter.Info(logMessage)
 		if err != nil {
@@ -279,8 +1014,43 @@ func (ep *EmailProcessor) logToSyslog(srcIP, fromAddr, platform, userID, message
 	}
 }
 
+// ParseEmail parses raw email data into a ProcessedEmail using DefaultParseLimits.
+// It depends only on its input and bounds input size, header size, MIME nesting,
+// part count and decoded body size, which makes it safe to feed untrusted mail
+// and usable as a fuzzing entry point.
+func ParseEmail(data []byte) (*ProcessedEmail, error) {
+	var ep EmailProcessor
+	return ep.parseEmail(data, false)
+}
+
+// severityClassifier returns the configured severity classifier, falling back to the default keywords
+func (ep *EmailProcessor) severityClassifier() *SeverityClassifier {
+	if ep.Severity == nil {
+		return defaultSeverityClassifier
+	}
+	return ep.Severity
+}
+
+// parseLimits returns the configured parser limits, falling back to the defaults
+func (ep *EmailProcessor) parseLimits() ParseLimits {
+	if ep.Config == nil {
+		return DefaultParseLimits
+	}
+	return ep.Config.ParseLimits
+}
+
 // parseEmail parses raw email data into a ProcessedEmail struct
-func (ep *EmailProcessor) parseEmail(data []byte) (*ProcessedEmail, error) {
+// With raw set the decoded body is kept verbatim instead of being cleaned
+func (ep *EmailProcessor) parseEmail(data []byte, raw bool) (*ProcessedEmail, error) {
+	limits := ep.parseLimits()
+	if len(data) > limits.MaxParseBytes {
+		return nil, newSizeLimitError("message_bytes", "message larger than %d bytes", limits.MaxParseBytes)
+	}
+
+	if err := checkHeaderLimits(data, limits); err != nil {
+		return nil, err
+	}
+
 	// Parse the email using Go's mail package
 	msg, err := mail.ReadMessage(bytes.NewReader(data))
 	if err != nil {
@@ -292,27 +1062,82 @@ func (ep *EmailProcessor) parseEmail(data []byte) (*ProcessedEmail, error) {
 	to := ep.decodeHeader(msg.Header.Get("To"))
 	subject := ep.decodeHeader(msg.Header.Get("Subject"))
 	date := ep.formatDate(msg.Header.Get("Date"))
+	messageID, inReplyTo, references := threadingHeaders(msg.Header)
 
 	// Clean email addresses
 	from = ep.cleanEmailAddress(from)
 	to = ep.cleanEmailAddress(to)
 
 	// Extract body content
-	body, err := ep.extractEmailBody(msg)
+	body, bodyHTML, attachments, err := ep.extractEmailBody(msg, raw)
+	if errors.Is(err, ErrParseLimitExceeded) {
+		return nil, err
+	}
 	if err != nil {
 		log.Printf("Warning: failed to extract email body: %v", err)
 		body = "[Unable to extract email body]"
 	}
 
+	if !raw {
+		body = ep.inlineCompressedAttachments(body, attachments)
+	}
+	attachments, inlineImages := splitInlineImages(attachments)
+
+	// A monitoring system's own severity header is authoritative. Otherwise keywords win, and an
+	// urgent X-Priority only raises mail that carries no stronger signal
+	severity := severityFromMonitoringHeaders(msg.Header)
+	if severity == SeverityNone {
+		severity = ep.severityClassifier().Classify(subject, body)
+		if severity == SeverityNone || severity == SeverityInfo {
+			if priority := severityFromPriority(msg.Header.Get("X-Priority")); priority != SeverityNone {
+				severity = priority
+			}
+		}
+	}
+
+	// Out-of-office and other automatic replies are never urgent
+	autoReply := isAutoReply(msg.Header)
+	if autoReply && severity == SeverityNone {
+		severity = SeverityInfo
+	}
+
+	// A page is critical whatever it says
+	page := ep.isPage(subject, msg.Header)
+	if page {
+		severity = SeverityCritical
+	}
+
 	return &ProcessedEmail{
-		From:    from,
-		To:      to,
-		Subject: subject,
-		Date:    date,
-		Body:    body,
+		From:         from,
+		To:           to,
+		Subject:      subject,
+		Date:         date,
+		Body:         body,
+		BodyHTML:     bodyHTML,
+		Attachments:  attachments,
+		InlineImages: inlineImages,
+		Severity:     severity,
+		Sent:         messageSentTime(msg.Header),
+		MessageID:    messageID,
+		InReplyTo:    inReplyTo,
+		References:   references,
+
+		SlackMention: msg.Header.Get("X-Slack-Mention"),
+		Silent:       (headerEnabled(msg.Header.Get("X-Silent")) || autoReply) && !page,
+		Page:         page,
 	}, nil
 }
 
+// headerEnabled reports whether a switch header such as "X-Silent: yes" is turned on
+func headerEnabled(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "yes", "true", "on":
+		return true
+	default:
+		return false
+	}
+}
+
 // decodeHeader decodes MIME-encoded email headers
 func (ep *EmailProcessor) decodeHeader(header string) string {
 	if header == "" {
@@ -368,14 +1193,9 @@ func (ep *EmailProcessor) formatDate(dateStr string) string {
 	return parsedTime.UTC().Format("2006-01-02 15:04:05 UTC")
 }
 
-// extractEmailBody extracts the text content from an email
-func (ep *EmailProcessor) extractEmailBody(msg *mail.Message) (string, error) {
-	// Read the entire body
-	bodyBytes, err := io.ReadAll(msg.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read message body: %w", err)
-	}
-
+// extractEmailBody extracts the text content and attachments from an email, reporting
+// whether the text is HTML markup
+func (ep *EmailProcessor) extractEmailBody(msg *mail.Message, raw bool) (string, bool, []Attachment, error) {
 	// Get content type from headers
 	contentType := msg.Header.Get("Content-Type")
 	contentTransferEncoding := msg.Header.Get("Content-Transfer-Encoding")
@@ -383,65 +1203,245 @@ func (ep *EmailProcessor) extractEmailBody(msg *mail.Message) (string, error) {
 	log.Printf("Email content type: %s", contentType)
 	log.Printf("Content transfer encoding: %s", contentTransferEncoding)
 
-	// Handle different content types
-	if strings.Contains(strings.ToLower(contentType), "multipart/") {
-		return ep.extractFromMultipart(bodyBytes)
+	// Handle multipart messages with a bounded MIME walk
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		return ep.extractFromMultipart(msg.Body, params["boundary"], raw)
+	}
+
+	// A message that is only an image, as some cameras send, has no text
+	if err == nil && strings.HasPrefix(mediaType, "image/") {
+		data, err := io.ReadAll(io.LimitReader(decodeTransferEncoding(msg.Body, contentTransferEncoding), int64(ep.parseLimits().MaxParseBytes)))
+		if err != nil {
+			return "", false, nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		filename := params["name"]
+		if filename == "" {
+			filename = "image" + imageExtension(mediaType)
+		}
+		return "", false, []Attachment{{Filename: filename, ContentType: mediaType, Data: data, Size: int64(len(data)), Inline: true}}, nil
 	}
 
 	// Handle single-part messages
+	isHTML := err == nil && mediaType == "text/html"
+	bodyBytes, err := io.ReadAll(io.LimitReader(decodeTransferEncoding(msg.Body, contentTransferEncoding), ep.parseLimits().MaxBodyBytes))
+	if err != nil {
+		return "", false, nil, fmt.Errorf("failed to read message body: %w", err)
+	}
 	bodyText := string(bodyBytes)
+	if raw {
+		return bodyText, isHTML, nil, nil
+	}
 
 	// Clean up the body text
 	bodyText = ep.cleanBodyText(bodyText)
 
-	return bodyText, nil
+	return bodyText, isHTML, nil, nil
 }
 
-// extractFromMultipart extracts text content from multipart messages
-func (ep *EmailProcessor) extractFromMultipart(body []byte) (string, error) {
-	bodyStr := string(body)
-	var textContent strings.Builder
+// extractFromMultipart extracts text content and attachments from multipart messages,
+// preferring text/plain parts and falling back to text/html
+func (ep *EmailProcessor) extractFromMultipart(body io.Reader, boundary string, raw bool) (string, bool, []Attachment, error) {
+	limits := ep.parseLimits()
+	walker := &mimeWalker{limits: limits, budget: limits.MaxBodyBytes, raw: raw}
+	if ep.Config != nil {
+		walker.spool = ep.Config.AttachmentSpool
+	}
+	if err := walker.walk(body, boundary, 1); err != nil {
+		if errors.Is(err, ErrParseLimitExceeded) || walker.plain.Len()+walker.html.Len() == 0 {
+			removeSpooledAttachments(walker.attachments)
+			return "", false, nil, err
+		}
+		// Keep whatever text was recovered from a truncated or malformed message
+		log.Printf("Warning: incomplete multipart message: %v", err)
+	}
 
-	// Split by common multipart boundaries
-	// This is a simplified approach - in production you might want to use a proper MIME parser
-	parts := strings.Split(bodyStr, "\n\n")
+	result := walker.plain.String()
+	isHTML := false
+	if strings.TrimSpace(result) == "" {
+		result = walker.html.String()
+		isHTML = result != ""
+	}
+	if raw {
+		return result, isHTML, walker.attachments, nil
+	}
 
-	inTextPart := false
-	for _, part := range parts {
-		lines := strings.Split(part, "\n")
+	return strings.TrimSpace(result), isHTML, walker.attachments, nil
+}
 
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
+// mimeWalker collects text parts from a multipart tree within fixed resource limits
+type mimeWalker struct {
+	limits ParseLimits
+	spool  *AttachmentSpool // nil keeps attachments in memory
+	raw    bool             // Keep text parts verbatim instead of trimming them
+	parts  int
+	budget int64 // Remaining decoded text bytes
+	plain  strings.Builder
+	html   strings.Builder
+
+	attachments []Attachment
+}
 
-			// Check if this is a text/plain part
-			if strings.Contains(strings.ToLower(line), "content-type:") &&
-				strings.Contains(strings.ToLower(line), "text/plain") {
-				inTextPart = true
-				continue
-			}
+// walk reads every part below boundary, recursing into nested multiparts
+func (w *mimeWalker) walk(r io.Reader, boundary string, depth int) error {
+	if depth > w.limits.MaxMIMEDepth {
+		return newMediaLimitError("mime_depth", "MIME nesting deeper than %d levels", w.limits.MaxMIMEDepth)
+	}
+	if boundary == "" {
+		return fmt.Errorf("multipart message without boundary")
+	}
 
-			// Check if this is a boundary or other content type
-			if strings.Contains(strings.ToLower(line), "content-type:") &&
-				!strings.Contains(strings.ToLower(line), "text/plain") {
-				inTextPart = false
-				continue
-			}
+	reader := multipart.NewReader(r, boundary)
+	for {
+		// NextRawPart leaves Content-Transfer-Encoding handling to us
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read MIME part: %w", err)
+		}
+
+		w.parts++
+		if w.parts > w.limits.MaxMIMEParts {
+			return newMediaLimitError("mime_parts", "more than %d MIME parts", w.limits.MaxMIMEParts)
+		}
+		if len(part.Header) > w.limits.MaxHeaderCount {
+			return newSizeLimitError("header_count", "MIME part with more than %d header fields", w.limits.MaxHeaderCount)
+		}
+
+		// Parts without a Content-Type default to text/plain (RFC 2045)
+		mediaType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			mediaType = "text/plain"
+		}
 
-			// If we're in a text part and this isn't a header, add it to content
-			if inTextPart && !strings.Contains(line, ":") && line != "" {
-				textContent.WriteString(line)
-				textContent.WriteString("\n")
+		disposition, dispositionParams, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		filename := dispositionParams["filename"]
+		if filename == "" {
+			filename = params["name"]
+		}
+
+		switch {
+		case strings.HasPrefix(mediaType, "multipart/"):
+			if err := w.walk(part, params["boundary"], depth+1); err != nil {
+				return err
+			}
+		case disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")):
+			// Attachments are not part of the message text
+			if err := w.collectAttachment(part, mediaType, filename, false); err != nil {
+				return err
+			}
+		case strings.HasPrefix(mediaType, "image/"):
+			// Images embedded in the body, such as camera snapshots, often have no name, only a Content-ID
+			if err := w.collectAttachment(part, mediaType, filename, true); err != nil {
+				return err
 			}
+		case mediaType == "text/plain":
+			if err := w.collect(&w.plain, part); err != nil {
+				return err
+			}
+		case mediaType == "text/html":
+			if err := w.collect(&w.html, part); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// collect appends the decoded content of a text part, honouring the remaining budget
+func (w *mimeWalker) collect(dst *strings.Builder, part *multipart.Part) error {
+	if w.budget <= 0 {
+		return nil
+	}
+
+	decoded := decodeTransferEncoding(part, part.Header.Get("Content-Transfer-Encoding"))
+	content, err := io.ReadAll(io.LimitReader(decoded, w.budget))
+	if err != nil {
+		return fmt.Errorf("failed to decode MIME part: %w", err)
+	}
+	w.budget -= int64(len(content))
+
+	if dst.Len() > 0 {
+		dst.WriteString("\n")
+	}
+	if w.raw {
+		dst.Write(content)
+		return nil
+	}
+	dst.WriteString(strings.TrimSpace(string(content)))
+	return nil
+}
+
+// collectAttachment decodes an attachment part and keeps it alongside the message text
+func (w *mimeWalker) collectAttachment(part *multipart.Part, mediaType, filename string, inline bool) error {
+	decoded := decodeTransferEncoding(part, part.Header.Get("Content-Transfer-Encoding"))
+
+	var attachment Attachment
+	if w.spool != nil {
+		if err := w.spool.store(&attachment, decoded, int64(w.limits.MaxParseBytes)); err != nil {
+			return fmt.Errorf("failed to decode attachment: %w", err)
+		}
+	} else {
+		data, err := io.ReadAll(io.LimitReader(decoded, int64(w.limits.MaxParseBytes)))
+		if err != nil {
+			return fmt.Errorf("failed to decode attachment: %w", err)
 		}
+		attachment.Data = data
+		attachment.Size = int64(len(data))
+	}
+
+	// Filenames may be RFC 2047 encoded
+	decoder := new(mime.WordDecoder)
+	if decodedName, err := decoder.DecodeHeader(filename); err == nil {
+		filename = decodedName
+	}
+	if filename == "" && inline {
+		filename = "image" + imageExtension(mediaType)
 	}
+	if filename == "" {
+		filename = "attachment"
+	}
+
+	attachment.Filename = filename
+	attachment.ContentType = mediaType
+	attachment.Inline = inline
+	w.attachments = append(w.attachments, attachment)
+	return nil
+}
 
-	result := textContent.String()
-	if result == "" {
-		// If no text/plain found, return the whole body (cleaned)
-		result = ep.cleanBodyText(bodyStr)
+// decodeTransferEncoding wraps r with a decoder for the given Content-Transfer-Encoding
+func decodeTransferEncoding(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
 	}
+}
 
-	return strings.TrimSpace(result), nil
+// newlineStripper removes CR/LF so base64 bodies wrapped at 76 columns can be decoded
+type newlineStripper struct {
+	r io.Reader
+}
+
+// Read implements io.Reader
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+		kept := 0
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
 }
 
 // cleanBodyText cleans up body text by removing headers and formatting
@@ -489,8 +1489,9 @@ func (ep *EmailProcessor) cleanBodyText(body string) string {
 // formatForTelegram formats the processed email for Telegram display
 func (ep *EmailProcessor) formatForTelegram(email *ProcessedEmail) string {
 	// Create a nicely formatted message for Telegram
-	message := fmt.Sprintf("📧 <b>New Email</b>\n\n<b>From:</b> %s\n<b>To:</b> %s\n<b>Subject:</b> %s\n<b>Date:</b> %s\n\n<b>Message:</b>\n%s",
-		ep.escapeHTML(email.From),
+	message := fmt.Sprintf("%s <b>New Email</b>\n\n<b>From:</b> %s\n<b>To:</b> %s\n<b>Subject:</b> %s\n<b>Date:</b> %s\n\n<b>Message:</b>\n%s",
+		email.Severity.Emoji(),
+		ep.escapeHTML(senderDisplay(email)),
 		ep.escapeHTML(email.To),
 		ep.escapeHTML(email.Subject),
 		ep.escapeHTML(email.Date),
@@ -501,9 +1502,50 @@ func (ep *EmailProcessor) formatForTelegram(email *ProcessedEmail) string {
 
 // formatForSlack formats the processed email for Slack display (using Slack markdown)
 func (ep *EmailProcessor) formatForSlack(email *ProcessedEmail) string {
-	// Create a nicely formatted message for Slack using markdown
-	message := fmt.Sprintf(":email: *New Email*\n\n*From:* %s\n*To:* %s\n*Subject:* %s\n*Date:* %s\n\n*Message:*\n```\n%s\n```",
-		email.From,
+	// HTML bodies are converted so their formatting renders instead of showing up as markup
+	body := "```\n" + ep.escapeSlackText(email.Body) + "\n```"
+	if email.BodyHTML {
+		body = htmlToSlackMrkdwn(email.Body)
+	}
+
+	// Every field comes from the sender, so none may open a link or mention
+	message := fmt.Sprintf("%s *New Email*\n\n*From:* %s\n*To:* %s\n*Subject:* %s\n*Date:* %s\n\n*Message:*\n%s",
+		email.Severity.SlackEmoji(),
+		ep.escapeSlackText(senderDisplay(email)),
+		ep.escapeSlackText(email.To),
+		ep.escapeSlackText(email.Subject),
+		ep.escapeSlackText(email.Date),
+		body)
+
+	return message
+}
+
+// escapeSlackText escapes the characters Slack reserves for links and mentions in mrkdwn text
+func (ep *EmailProcessor) escapeSlackText(text string) string {
+	return escapeSlackMrkdwn(text)
+}
+
+// formatForDingTalk formats the processed email for DingTalk display (using DingTalk markdown)
+func (ep *EmailProcessor) formatForDingTalk(email *ProcessedEmail) string {
+	// DingTalk markdown only breaks lines on blank lines or trailing double spaces
+	body := strings.ReplaceAll(email.Body, "\n", "  \n")
+
+	message := fmt.Sprintf("#### %s New Email\n\n**From:** %s\n\n**To:** %s\n\n**Subject:** %s\n\n**Date:** %s\n\n**Message:**\n\n%s",
+		email.Severity.Emoji(),
+		senderDisplay(email),
+		email.To,
+		email.Subject,
+		email.Date,
+		body)
+
+	return message
+}
+
+// formatForWeCom formats the processed email for WeCom display (using WeCom markdown)
+func (ep *EmailProcessor) formatForWeCom(email *ProcessedEmail) string {
+	message := fmt.Sprintf("### %s New Email\n> **From:** %s\n> **To:** %s\n> **Subject:** <font color=\"info\">%s</font>\n> **Date:** %s\n\n**Message:**\n%s",
+		email.Severity.Emoji(),
+		senderDisplay(email),
 		email.To,
 		email.Subject,
 		email.Date,
@@ -512,6 +1554,30 @@ func (ep *EmailProcessor) formatForSlack(email *ProcessedEmail) string {
 	return message
 }
 
+// formatForMastodon formats the processed email as a compact plain-text status
+func (ep *EmailProcessor) formatForMastodon(email *ProcessedEmail) string {
+	// Statuses are short and rendered as plain text, so keep only the essentials
+	message := fmt.Sprintf("%s %s\nFrom: %s\n\n%s",
+		email.Severity.Emoji(),
+		email.Subject,
+		senderDisplay(email),
+		email.Body)
+
+	return message
+}
+
+// formatForWhatsApp formats the processed email for WhatsApp display (using WhatsApp formatting)
+func (ep *EmailProcessor) formatForWhatsApp(email *ProcessedEmail) string {
+	message := fmt.Sprintf("%s *New Email*\n\n*From:* %s\n*Subject:* %s\n*Date:* %s\n\n%s",
+		email.Severity.Emoji(),
+		senderDisplay(email),
+		email.Subject,
+		email.Date,
+		email.Body)
+
+	return message
+}
+
 // escapeHTML escapes HTML special characters for Telegram
 func (ep *EmailProcessor) escapeHTML(text string) string {
 	replacer := strings.NewReplacer(
@@ -527,8 +1593,17 @@ func (ep *EmailProcessor) escapeHTML(text string) string {
 func (ep *EmailProcessor) GetProcessorStats() map[string]interface{} {
 	// This could be expanded to track actual statistics
 	return map[string]interface{}{
-		"status":             "active",
-		"telegram_connected": ep.TelegramClient != nil,
-		"slack_connected":    ep.SlackClient != nil,
+		"status":              "active",
+		"telegram_connected":  ep.TelegramClient != nil,
+		"telegram_bots":       len(ep.TelegramBots),
+		"slack_connected":     ep.SlackClient != nil,
+		"dingtalk_connected":  ep.DingTalkClient != nil,
+		"wecom_connected":     ep.WeComClient != nil,
+		"mastodon_connected":  ep.MastodonClient != nil,
+		"whatsapp_connected":  ep.WhatsAppClient != nil,
+		"zoom_connected":      ep.ZoomClient != nil,
+		"victorops_connected": ep.VictorOpsClient != nil,
+		"redis_connected":     ep.RedisClient != nil,
+		"plugins_enabled":     ep.Plugins != nil,
 	}
 }
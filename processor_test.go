@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fuzzParseLimits are small enough for the fuzzer to reach every limit quickly
+var fuzzParseLimits = ParseLimits{
+	MaxParseBytes:  64 * 1024,
+	MaxBodyBytes:   1024,
+	MaxMIMEDepth:   3,
+	MaxMIMEParts:   8,
+	MaxHeaderBytes: 1024,
+	MaxHeaderCount: 20,
+}
+
+func TestMain(m *testing.M) {
+	// The parser logs every message it reads
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// nestedMultipart builds a message with depth levels of multipart/mixed around a text part
+func nestedMultipart(depth int) string {
+	var b strings.Builder
+	b.WriteString("From: a@example.com\r\nSubject: nested\r\n")
+	for i := 0; i < depth; i++ {
+		fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=b%d\r\n\r\n--b%d\r\n", i, i)
+	}
+	b.WriteString("Content-Type: text/plain\r\n\r\ninnermost\r\n")
+	for i := depth - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "--b%d--\r\n", i)
+	}
+	return b.String()
+}
+
+// manyParts builds a multipart message with count text parts
+func manyParts(count int) string {
+	var b strings.Builder
+	b.WriteString("From: a@example.com\r\nSubject: parts\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&b, "--x\r\nContent-Type: text/plain\r\n\r\npart %d\r\n", i)
+	}
+	b.WriteString("--x--\r\n")
+	return b.String()
+}
+
+// parseSeeds are well-formed and malformed messages the fuzzer starts from
+var parseSeeds = []string{
+	"From: a@example.com\r\nTo: 1@telegram\r\nSubject: hello\r\n\r\nbody\r\n",
+	nestedMultipart(2),
+	nestedMultipart(6),
+	manyParts(4),
+	manyParts(20),
+	"From: a@example.com\r\nContent-Type: multipart/mixed\r\n\r\n--x\r\n\r\nno boundary parameter\r\n--x--\r\n",
+	"From: a@example.com\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\nContent-Type: text/plain\r\n\r\nnever closed",
+	"From: a@example.com\r\nContent-Type: multipart/alternative; boundary=\"\"\r\n\r\n",
+	"From: a@example.com\r\nSubject: " + strings.Repeat("x", 4096) + "\r\n\r\nlong header\r\n",
+	"From: a@example.com\r\n" + strings.Repeat("X-Filler: y\r\n", 50) + "\r\nmany headers\r\n",
+	"From: a@example.com\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" + strings.Repeat("QUJD", 1000) + "\r\n",
+	"From: a@example.com\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"=?utf-8?b?w6Qu?=\"\r\nContent-Transfer-Encoding: base64\r\n\r\nJVBERi0=\r\n--x--\r\n",
+	"From: a@example.com\r\nContent-Type: image/png; name=snap.png\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n=89PNG=\r\n",
+	"no header at all",
+	"",
+}
+
+// checkParseLimits reports how a parse result breaks the limits it was parsed under, if it does
+func checkParseLimits(t *testing.T, data []byte, email *ProcessedEmail, err error) {
+	t.Helper()
+	limits := fuzzParseLimits
+	if len(data) > limits.MaxParseBytes && !errors.Is(err, ErrParseLimitExceeded) {
+		t.Fatalf("message of %d bytes parsed without a limit error: %v", len(data), err)
+	}
+	if err != nil {
+		return
+	}
+	// Text parts are joined with a newline, so the body may exceed the budget by one byte per part
+	if maxBody := limits.MaxBodyBytes + int64(limits.MaxMIMEParts); int64(len(email.Body)) > maxBody {
+		t.Fatalf("body of %d bytes exceeds the %d byte budget", len(email.Body), maxBody)
+	}
+	attachments := len(email.Attachments) + len(email.InlineImages)
+	if attachments > limits.MaxMIMEParts {
+		t.Fatalf("%d attachments from at most %d MIME parts", attachments, limits.MaxMIMEParts)
+	}
+	for _, attachment := range append(email.Attachments, email.InlineImages...) {
+		if len(attachment.Data) > limits.MaxParseBytes {
+			t.Fatalf("attachment %s of %d bytes exceeds the message limit", attachment.Filename, len(attachment.Data))
+		}
+	}
+}
+
+func FuzzParseEmail(f *testing.F) {
+	for _, seed := range parseSeeds {
+		f.Add([]byte(seed))
+	}
+	ep := &EmailProcessor{Config: &Config{ParseLimits: fuzzParseLimits}}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Raw mode keeps the decoded text as is, so its size can be checked against the budget
+		email, err := ep.parseEmail(data, true)
+		checkParseLimits(t, data, email, err)
+
+		// The cleaned body goes through more code, which must not panic either
+		ep.parseEmail(data, false)
+	})
+}
+
+func TestParseEmailLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		limit   string // Expected ParseLimitError.Limit, "" to parse successfully
+	}{
+		{"plain", parseSeeds[0], ""},
+		{"nesting within the limit", nestedMultipart(2), ""},
+		{"nesting too deep", nestedMultipart(6), "mime_depth"},
+		{"parts within the limit", manyParts(fuzzParseLimits.MaxMIMEParts), ""},
+		{"too many parts", manyParts(fuzzParseLimits.MaxMIMEParts + 1), "mime_parts"},
+		{"oversized header", parseSeeds[8], "header_bytes"},
+		{"too many header fields", parseSeeds[9], "header_count"},
+		{"oversized message", "Subject: big\r\n\r\n" + strings.Repeat("x", fuzzParseLimits.MaxParseBytes), "message_bytes"},
+	}
+
+	ep := &EmailProcessor{Config: &Config{ParseLimits: fuzzParseLimits}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ep.parseEmail([]byte(tt.message), false)
+			if tt.limit == "" {
+				if err != nil {
+					t.Fatalf("parseEmail() error = %v", err)
+				}
+				return
+			}
+			var limitErr *ParseLimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("parseEmail() error = %v, want limit %s", err, tt.limit)
+			}
+		})
+	}
+}
+
+func TestParseEmailMissingBoundary(t *testing.T) {
+	// A multipart message without a usable boundary still yields a message, not an error
+	for _, message := range parseSeeds[5:8] {
+		email, err := ParseEmail([]byte(message))
+		if err != nil {
+			t.Fatalf("ParseEmail(%q) error = %v", message[:40], err)
+		}
+		if email.From != "a@example.com" {
+			t.Errorf("From = %q, want a@example.com", email.From)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// SMTP Rate Limit Configuration
+const (
+	SMTPRateLimiterMaxLen = 10000 // Clients tracked before the least limited ones are dropped
+)
+
+// RateLimit allows Count messages per Per, in bursts of up to Count
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// String describes the limit, e.g. 60 per 1m
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d per %s", r.Count, formatSnooze(r.Per))
+}
+
+// bucket creates an empty token bucket for the limit
+func (r RateLimit) bucket() *rateBucket {
+	return &rateBucket{interval: r.Per / time.Duration(r.Count), burst: r.Count}
+}
+
+// parseRateLimit parses a rate such as 60/m, 1000/h or 10/30s; "" disables the limit
+func parseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return RateLimit{}, nil
+	}
+	countStr, perStr, found := strings.Cut(value, "/")
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if !found || err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate '%s': use messages per period such as 60/m or 1000/h", value)
+	}
+
+	perStr = strings.TrimSpace(perStr)
+	var per time.Duration
+	switch perStr {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(perStr)
+		if err != nil || per < time.Second {
+			return RateLimit{}, fmt.Errorf("invalid rate '%s': use messages per period such as 60/m or 1000/h", value)
+		}
+	}
+	return RateLimit{Count: count, Per: per}, nil
+}
+
+// SMTPRateLimiter counts messages per client IP and across all clients, so a runaway sender
+// is told to come back later instead of flooding the chats
+type SMTPRateLimiter struct {
+	Global RateLimit // Zero Count disables the global limit
+	PerIP  RateLimit // Zero Count disables the per-IP limit
+
+	mutex  sync.Mutex
+	global *rateBucket
+	ips    map[string]*rateBucket
+}
+
+// NewSMTPRateLimiter creates a limiter; a zero RateLimit disables that limit
+func NewSMTPRateLimiter(global, perIP RateLimit) *SMTPRateLimiter {
+	limiter := &SMTPRateLimiter{
+		Global: global,
+		PerIP:  perIP,
+		ips:    make(map[string]*rateBucket),
+	}
+	if global.Count > 0 {
+		limiter.global = global.bucket()
+	}
+	return limiter
+}
+
+// errSMTPRateLimited is the reply to a client that has to wait before sending more
+func errSMTPRateLimited(code int, message string, wait time.Duration) *smtp.SMTPError {
+	wait = wait.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return &smtp.SMTPError{
+		Code:         code,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      fmt.Sprintf("%s, try again in %s", message, formatSnooze(wait)),
+	}
+}
+
+// clientNetwork is the key a client is limited by: its IPv4 address, or its IPv6 /64 network,
+// since a single host is usually given a whole /64 and could use a fresh address per message
+func clientNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	mask := net.CIDRMask(64, 128)
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String()
+}
+
+// Check refuses a new connection with 421 while the client, or everyone, is out of messages.
+// It takes nothing, so clients that connect without sending are not counted
+func (l *SMTPRateLimiter) Check(ip string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	client := clientNetwork(ip)
+	if bucket := l.ips[client]; bucket != nil {
+		if wait := bucket.available(now); wait > 0 {
+			return errSMTPRateLimited(421, fmt.Sprintf("Too many messages from %s", client), wait)
+		}
+	}
+	if l.global != nil {
+		if wait := l.global.available(now); wait > 0 {
+			return errSMTPRateLimited(421, "Too many messages", wait)
+		}
+	}
+	return nil
+}
+
+// Take counts a message from ip, or refuses it with 450 when a limit is reached. An empty ip,
+// as on the LMTP socket, only counts towards the global limit
+func (l *SMTPRateLimiter) Take(ip string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+
+	var bucket *rateBucket
+	if ip != "" && l.PerIP.Count > 0 {
+		client := clientNetwork(ip)
+		bucket = l.ips[client]
+		if bucket == nil {
+			if len(l.ips) >= SMTPRateLimiterMaxLen {
+				l.evict(now)
+			}
+			bucket = l.PerIP.bucket()
+			l.ips[client] = bucket
+		}
+		if wait := bucket.available(now); wait > 0 {
+			return errSMTPRateLimited(450, fmt.Sprintf("Rate limit of %d messages per %s reached for %s", l.PerIP.Count, formatSnooze(l.PerIP.Per), client), wait)
+		}
+	}
+	if l.global != nil {
+		if wait := l.global.available(now); wait > 0 {
+			return errSMTPRateLimited(450, fmt.Sprintf("Rate limit of %d messages per %s reached", l.Global.Count, formatSnooze(l.Global.Per)), wait)
+		}
+		l.global.reserve(now)
+	}
+	if bucket != nil {
+		bucket.reserve(now)
+	}
+	return nil
+}
+
+// evict drops the idle buckets, or when none is idle, the one closest to being full again, so
+// a flood of client IPs cannot grow the map past SMTPRateLimiterMaxLen
+func (l *SMTPRateLimiter) evict(now time.Time) {
+	oldest := ""
+	for address, bucket := range l.ips {
+		if bucket.idle(now) {
+			delete(l.ips, address)
+		} else if oldest == "" || bucket.tat.Before(l.ips[oldest].tat) {
+			oldest = address
+		}
+	}
+	if len(l.ips) >= SMTPRateLimiterMaxLen {
+		delete(l.ips, oldest)
+	}
+}
+
+// SetRateLimits limits the messages accepted per client IP and overall. Clients over a limit
+// are refused with 421 when they connect and 450 at MAIL FROM
+func (s *SMTPServer) SetRateLimits(global, perIP RateLimit) {
+	s.backend.RateLimiter = NewSMTPRateLimiter(global, perIP)
+	if global.Count > 0 {
+		log.Printf("Message rate limit: %s", global)
+	}
+	if perIP.Count > 0 {
+		log.Printf("Message rate limit per client IP: %s", perIP)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSMTPRateLimiterBound(t *testing.T) {
+	// One message per hour, so no bucket is idle again during the test
+	limiter := NewSMTPRateLimiter(RateLimit{}, RateLimit{Count: 1, Per: time.Hour})
+	for i := 0; i < SMTPRateLimiterMaxLen+100; i++ {
+		if err := limiter.Take(fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255)); err != nil {
+			t.Fatalf("Take() of a new client error = %v", err)
+		}
+	}
+	if len(limiter.ips) > SMTPRateLimiterMaxLen {
+		t.Fatalf("%d client IPs tracked, want at most %d", len(limiter.ips), SMTPRateLimiterMaxLen)
+	}
+
+	// The most recent client is still limited
+	last := SMTPRateLimiterMaxLen + 99
+	if err := limiter.Take(fmt.Sprintf("10.%d.%d.%d", last>>16&255, last>>8&255, last&255)); err == nil {
+		t.Fatal("Take() of a limited client succeeded")
+	}
+}
+
+func TestSMTPRateLimiterIPv6Network(t *testing.T) {
+	limiter := NewSMTPRateLimiter(RateLimit{}, RateLimit{Count: 1, Per: time.Hour})
+	if err := limiter.Take("2001:db8:1:2::10"); err != nil {
+		t.Fatalf("Take() of a new client error = %v", err)
+	}
+
+	// Another address in the same /64 shares the bucket; the next /64 does not
+	if err := limiter.Take("2001:db8:1:2:ffff::1"); err == nil {
+		t.Fatal("Take() from the same /64 succeeded")
+	}
+	if err := limiter.Check("2001:db8:1:2::abcd"); err == nil {
+		t.Fatal("Check() from the same /64 succeeded")
+	}
+	if err := limiter.Take("2001:db8:1:3::10"); err != nil {
+		t.Fatalf("Take() from another /64 error = %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Recipient Verification Configuration
+const (
+	DefaultRcptVerifyTTL  = 10 * time.Minute // How long a destination found to exist is trusted
+	RcptVerifyNegativeTTL = 1 * time.Minute  // How long an unknown destination stays rejected, so adding the bot takes effect soon
+	RcptVerifyTimeout     = 10 * time.Second // Longest an SMTP client waits for a RCPT TO answer
+)
+
+// DestinationNotFoundError reports a chat, channel or user the platform says does not exist
+// or the bot cannot post to
+type DestinationNotFoundError struct {
+	Message string
+}
+
+// Error returns the platform's reason
+func (e *DestinationNotFoundError) Error() string {
+	return e.Message
+}
+
+// rcptVerification is a cached answer for one destination
+type rcptVerification struct {
+	err error // nil when the destination exists
+}
+
+// RecipientVerifier checks at RCPT TO time that a destination exists on its platform, so mail
+// for an unknown chat is rejected while the sender is still connected. Answers are cached
+type RecipientVerifier struct {
+	Cache *LookupCache
+}
+
+// NewRecipientVerifier creates a verifier caching up to size answers and trusting existing destinations for ttl
+func NewRecipientVerifier(ttl time.Duration, size int) *RecipientVerifier {
+	return &RecipientVerifier{Cache: NewLookupCache(CacheRcptVerify, size, ttl)}
+}
+
+// lookup returns the cached answer for a destination
+func (v *RecipientVerifier) lookup(key string) (error, bool) {
+	entry, exists := v.Cache.Get(key)
+	if !exists {
+		return nil, false
+	}
+	return entry.(rcptVerification).err, true
+}
+
+// store caches a definite answer for a destination
+func (v *RecipientVerifier) store(key string, err error) {
+	ttl := v.Cache.TTL
+	if err != nil {
+		ttl = RcptVerifyNegativeTTL
+	}
+	v.Cache.SetWithTTL(key, rcptVerification{err: err}, ttl)
+}
+
+// VerifyRecipient checks that an address maps to a destination that exists. It returns an error
+// matching ErrInvalidDestination for addresses that are invalid or name an unknown chat; when the
+// platform cannot be asked, or cannot be verified at all, the address is accepted
+func (ep *EmailProcessor) VerifyRecipient(ctx context.Context, address string) error {
+	// A fan-out alias is as good as its members
+	if members, isAlias, err := ep.fanoutAlias(address); isAlias {
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+		}
+		for _, member := range members {
+			if err := ep.VerifyRecipient(ctx, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	platform, userID, options, err := ep.extractPlatformAndID(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+	platform, userID, options, _ = ep.rerouteUnconfigured(platform, userID, options)
+	if ep.RcptVerifier == nil || !ep.platformConfigured(platform) {
+		return nil
+	}
+
+	key := platform + ":" + userID + ":" + options.Get("bot")
+	if err, cached := ep.RcptVerifier.lookup(key); cached {
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RcptVerifyTimeout)
+	defer cancel()
+
+	switch platform {
+	case "telegram":
+		err = ep.verifyTelegramDestination(ctx, userID, options)
+	case "slack":
+		err = ep.verifySlackDestination(ctx, userID)
+	default:
+		// Other platforms have no cheap way to look up a destination
+		return nil
+	}
+
+	var notFound *DestinationNotFoundError
+	switch {
+	case errors.As(err, &notFound):
+		log.Printf("Destination %s:%s does not exist: %v", platform, userID, err)
+		ep.RcptVerifier.store(key, err)
+		return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	case err != nil:
+		// Mail is not turned away because the platform was unreachable
+		log.Printf("Warning: could not verify %s:%s, accepting it: %v", platform, userID, err)
+		return nil
+	default:
+		ep.RcptVerifier.store(key, nil)
+		return nil
+	}
+}
+
+// verifyTelegramDestination looks up the chat with getChat. Chats that were never started
+// with the bot are not found, and the bot is forbidden from chats it was removed from
+func (ep *EmailProcessor) verifyTelegramDestination(ctx context.Context, userID string, options DestinationOptions) error {
+	bot, err := ep.telegramBot(options)
+	if err != nil {
+		return err
+	}
+
+	chatID := ep.telegramChatID(userID)
+	err = bot.callMethod(ctx, "getChat", map[string]string{"chat_id": chatID}, nil)
+
+	var apiErr *TelegramAPIError
+	if errors.As(err, &apiErr) &&
+		(apiErr.Code == 403 || (apiErr.Code == 400 && strings.Contains(strings.ToLower(apiErr.Description), "chat not found"))) {
+		return &DestinationNotFoundError{Message: fmt.Sprintf("telegram chat %s: %s", chatID, apiErr.Description)}
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeliveryReceipt records the outcome of delivering one email to a chat platform,
+// so a single syslog line can tell the whole delivery story
+type DeliveryReceipt struct {
+	Chunks    int           // Messages posted to the platform
+	MessageID string        // Platform ID of the first message, when the API returns one
+	Retries   int           // Extra HTTP attempts after network errors, server errors or rate limiting
+	Latency   time.Duration // Time spent delivering the message
+}
+
+// deliveryReceiptKey is the context key under which the active DeliveryReceipt is stored
+type deliveryReceiptKey struct{}
+
+// withDeliveryReceipt returns a context that records outcome details into receipt
+func withDeliveryReceipt(ctx context.Context, receipt *DeliveryReceipt) context.Context {
+	return context.WithValue(ctx, deliveryReceiptKey{}, receipt)
+}
+
+// deliveryReceiptFrom returns the receipt carried by ctx, or nil if the request is not part of a delivery
+func deliveryReceiptFrom(ctx context.Context) *DeliveryReceipt {
+	receipt, _ := ctx.Value(deliveryReceiptKey{}).(*DeliveryReceipt)
+	return receipt
+}
+
+// recordMessage counts a posted message, keeping the ID of the first one
+func (r *DeliveryReceipt) recordMessage(id string) {
+	if r == nil {
+		return
+	}
+	r.Chunks++
+	if r.MessageID == "" {
+		r.MessageID = id
+	}
+}
+
+// recordRetry counts an extra attempt at an HTTP request
+func (r *DeliveryReceipt) recordRetry() {
+	if r == nil {
+		return
+	}
+	r.Retries++
+}
+
+// String formats the receipt as syslog key=value fields
+func (r *DeliveryReceipt) String() string {
+	fields := []string{fmt.Sprintf("chunks=%d", r.Chunks)}
+	if r.MessageID != "" {
+		fields = append(fields, "platform_msg_id="+r.MessageID)
+	}
+	fields = append(fields,
+		fmt.Sprintf("latency_ms=%d", r.Latency.Milliseconds()),
+		fmt.Sprintf("retries=%d", r.Retries))
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,296 @@
+//go:build !minimal && !noredis
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis Configuration
+const (
+	DefaultRedisPort     = 6379
+	RedisDialTimeout     = 5 * time.Second
+	RedisCommandTimeout  = 5 * time.Second
+	RedisMaxChannelBytes = 256
+)
+
+// RedisOptions holds the connection settings parsed from REDIS_URL
+type RedisOptions struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	TLS      bool
+}
+
+// parseRedisURL parses redis://[user[:password]@]host[:port][/db] (rediss:// for TLS)
+func parseRedisURL(raw string) (RedisOptions, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return RedisOptions{}, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+
+	var options RedisOptions
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		options.TLS = true
+	default:
+		return RedisOptions{}, fmt.Errorf("invalid REDIS_URL scheme '%s': use redis:// or rediss://", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return RedisOptions{}, fmt.Errorf("invalid REDIS_URL: missing host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = strconv.Itoa(DefaultRedisPort)
+	}
+	options.Addr = net.JoinHostPort(u.Hostname(), port)
+
+	if u.User != nil {
+		// redis://:password@host authenticates as the default user
+		options.Username = u.User.Username()
+		options.Password, _ = u.User.Password()
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		options.DB, err = strconv.Atoi(db)
+		if err != nil || options.DB < 0 {
+			return RedisOptions{}, fmt.Errorf("invalid REDIS_URL database '%s'", db)
+		}
+	}
+
+	return options, nil
+}
+
+// RedisPayload is the document published when the JSON message format is selected
+type RedisPayload struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Subject   string `json:"subject"`
+	Date      string `json:"date"`
+	Body      string `json:"body"`
+	Message   string `json:"message"`
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// RedisClient publishes messages to Redis pub/sub channels over a minimal RESP connection
+type RedisClient struct {
+	Options       RedisOptions
+	MessageFormat string // "text" or "json"
+
+	connMutex sync.Mutex
+	conn      net.Conn
+	reader    *bufio.Reader
+}
+
+// NewRedisClient creates a new Redis client; the connection is opened on first use
+func NewRedisClient(options RedisOptions, messageFormat string) *RedisClient {
+	return &RedisClient{
+		Options:       options,
+		MessageFormat: messageFormat,
+	}
+}
+
+// connect opens and authenticates a connection. The caller must hold connMutex
+func (rc *RedisClient) connect() error {
+	dialer := &net.Dialer{Timeout: RedisDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if rc.Options.TLS {
+		host, _, _ := net.SplitHostPort(rc.Options.Addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", rc.Options.Addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", rc.Options.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis at %s: %w", rc.Options.Addr, err)
+	}
+
+	rc.conn = conn
+	rc.reader = bufio.NewReader(conn)
+
+	if rc.Options.Password != "" {
+		args := []string{"AUTH", rc.Options.Password}
+		if rc.Options.Username != "" {
+			args = []string{"AUTH", rc.Options.Username, rc.Options.Password}
+		}
+		if _, err := rc.roundTrip(args...); err != nil {
+			rc.close()
+			return fmt.Errorf("redis authentication failed: %w", err)
+		}
+	}
+
+	if rc.Options.DB != 0 {
+		if _, err := rc.roundTrip("SELECT", strconv.Itoa(rc.Options.DB)); err != nil {
+			rc.close()
+			return fmt.Errorf("failed to select redis database %d: %w", rc.Options.DB, err)
+		}
+	}
+
+	log.Printf("Connected to Redis at %s", rc.Options.Addr)
+	return nil
+}
+
+// close drops the current connection. The caller must hold connMutex
+func (rc *RedisClient) close() {
+	if rc.conn != nil {
+		rc.conn.Close()
+		rc.conn = nil
+		rc.reader = nil
+	}
+}
+
+// do runs a command, reconnecting once if the existing connection has gone stale
+func (rc *RedisClient) do(args ...string) (interface{}, error) {
+	rc.connMutex.Lock()
+	defer rc.connMutex.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if rc.conn == nil {
+			if err := rc.connect(); err != nil {
+				return nil, err
+			}
+		}
+
+		reply, err := rc.roundTrip(args...)
+		if err == nil {
+			return reply, nil
+		}
+
+		// Server-side errors are final; transport errors get one retry on a fresh connection
+		if _, ok := err.(redisError); ok {
+			return nil, err
+		}
+		log.Printf("Redis connection error, reconnecting: %v", err)
+		rc.close()
+		if attempt == 1 {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("redis command failed")
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis error: " + string(e)
+}
+
+// roundTrip writes a command as a RESP array of bulk strings and reads one reply
+func (rc *RedisClient) roundTrip(args ...string) (interface{}, error) {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	rc.conn.SetDeadline(time.Now().Add(RedisCommandTimeout))
+	if _, err := io.WriteString(rc.conn, command.String()); err != nil {
+		return nil, fmt.Errorf("failed to write command: %w", err)
+	}
+
+	return rc.readReply()
+}
+
+// readReply reads one RESP reply (simple string, error, integer or bulk string)
+func (rc *RedisClient) readReply() (interface{}, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer reply '%s'", line)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk reply '%s'", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rc.reader, data); err != nil {
+			return nil, fmt.Errorf("failed to read bulk reply: %w", err)
+		}
+		return string(data[:size]), nil
+	default:
+		return nil, fmt.Errorf("unsupported reply type '%c'", line[0])
+	}
+}
+
+// PublishToChannel publishes a rendered email to a pub/sub channel
+func (rc *RedisClient) PublishToChannel(email *ProcessedEmail, message, channel string) error {
+	payload := message
+	if rc.MessageFormat == "json" {
+		jsonData, err := json.Marshal(RedisPayload{
+			From:      email.From,
+			To:        email.To,
+			Subject:   email.Subject,
+			Date:      email.Date,
+			Body:      email.Body,
+			Message:   message,
+			MessageID: email.MessageID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		payload = string(jsonData)
+	}
+
+	log.Printf("Publishing message to Redis channel %s (length: %d)", channel, len(payload))
+
+	reply, err := rc.do("PUBLISH", channel, payload)
+	if err != nil {
+		return fmt.Errorf("failed to publish to redis channel %s: %w", channel, err)
+	}
+
+	// PUBLISH succeeds even without subscribers; log it so missing dashboards are noticed
+	if receivers, ok := reply.(int64); ok && receivers == 0 {
+		log.Printf("Warning: no subscribers received the message on Redis channel %s", channel)
+	} else {
+		log.Printf("Message published successfully to Redis channel %s (%v subscribers)", channel, reply)
+	}
+	return nil
+}
+
+// TestConnection validates the connection settings with PING
+func (rc *RedisClient) TestConnection() error {
+	reply, err := rc.do("PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected PING reply: %v", reply)
+	}
+	return nil
+}
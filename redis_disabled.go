@@ -0,0 +1,43 @@
+//go:build minimal || noredis
+
+package main
+
+func init() {
+	excludeFeature("redis", "noredis")
+}
+
+// Redis Configuration
+const (
+	RedisMaxChannelBytes = 256
+)
+
+// RedisOptions holds the connection settings parsed from REDIS_URL
+type RedisOptions struct{}
+
+// parseRedisURL rejects REDIS_URL in builds without Redis support
+func parseRedisURL(raw string) (RedisOptions, error) {
+	return RedisOptions{}, requireFeature("redis")
+}
+
+// RedisClient is a placeholder for builds without Redis support
+type RedisClient struct{}
+
+// NewRedisClient creates a placeholder client whose calls all fail
+func NewRedisClient(options RedisOptions, messageFormat string) *RedisClient {
+	return &RedisClient{}
+}
+
+// PublishToChannel reports that Redis support was compiled out
+func (rc *RedisClient) PublishToChannel(email *ProcessedEmail, message, channel string) error {
+	return requireFeature("redis")
+}
+
+// TestConnection reports that Redis support was compiled out
+func (rc *RedisClient) TestConnection() error {
+	return requireFeature("redis")
+}
+
+// newRedisStateBackend reports that Redis support was compiled out
+func newRedisStateBackend(options *RedisOptions) (stateBackend, error) {
+	return nil, requireFeature("redis")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+)
+
+// SMTP Relay Configuration
+const (
+	RelaySecurityStartTLS = "starttls" // Upgrade the connection, fail if the server does not offer STARTTLS
+	RelaySecurityTLS      = "tls"      // Implicit TLS, usually port 465
+	RelaySecurityNone     = "none"     // Plain SMTP, for relays on localhost or a trusted network
+	RelayTimeout          = 30 * time.Second
+)
+
+// SMTPRelay sends emails generated by the bridge (chat replies) through an upstream SMTP server
+type SMTPRelay struct {
+	Addr     string // host:port
+	Security string // starttls, tls or none
+	Username string // Optional, authenticates with AUTH PLAIN
+	Password string
+	From     string // Envelope and header sender
+}
+
+// NewSMTPRelay creates a new relay client
+func NewSMTPRelay(addr, security, username, password, from string) *SMTPRelay {
+	return &SMTPRelay{
+		Addr:     addr,
+		Security: security,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+// FromWithName returns the sender address with a display name, e.g. "Alice via Slack <bridge@example.com>"
+func (r *SMTPRelay) FromWithName(name string) string {
+	if name == "" {
+		return r.From
+	}
+	return (&mail.Address{Name: name, Address: r.From}).String()
+}
+
+// AllowsSender reports whether the relay may send as address: it must share the domain of
+// SMTP_RELAY_FROM, so destination options cannot make the bridge impersonate other domains
+func (r *SMTPRelay) AllowsSender(address string) bool {
+	relayFrom, err := mail.ParseAddress(r.From)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(addressDomain(relayFrom.Address), addressDomain(address))
+}
+
+// addressDomain returns the part of an email address after the last @
+func addressDomain(address string) string {
+	return address[strings.LastIndex(address, "@")+1:]
+}
+
+// Send delivers the email to its recipient through the relay
+func (r *SMTPRelay) Send(email *OutboundEmail) error {
+	recipient, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient '%s': %w", email.To, err)
+	}
+
+	client, err := r.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP relay %s: %w", r.Addr, err)
+	}
+	defer client.Close()
+
+	if r.Username != "" {
+		if err := client.Auth(sasl.NewPlainClient("", r.Username, r.Password)); err != nil {
+			return fmt.Errorf("SMTP relay authentication failed: %w", err)
+		}
+	}
+
+	sender := r.From
+	if email.ReturnPath != "" {
+		sender = email.ReturnPath
+	}
+	if err := client.SendMail(sender, []string{recipient.Address}, bytes.NewReader(email.Bytes())); err != nil {
+		return fmt.Errorf("SMTP relay rejected message: %w", err)
+	}
+	if err := client.Quit(); err != nil {
+		log.Printf("Warning: SMTP relay QUIT failed: %v", err)
+	}
+
+	log.Printf("Relayed email to %s via %s", recipient.Address, r.Addr)
+	return nil
+}
+
+// dial connects to the relay with the configured transport security
+func (r *SMTPRelay) dial() (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(r.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: RelayTimeout}
+	tlsConfig := &tls.Config{ServerName: host}
+
+	var conn net.Conn
+	if r.Security == RelaySecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.Addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", r.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the whole transaction, not just the connect
+	conn.SetDeadline(time.Now().Add(RelayTimeout))
+
+	if r.Security == RelaySecurityStartTLS {
+		return smtp.NewClientStartTLS(conn, tlsConfig)
+	}
+
+	client := smtp.NewClient(conn)
+	if err := client.Hello(SMTPDomain); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Reply Index Configuration
+const (
+	ReplyIndexMaxLen = 10000 // Entries kept before expired ones are pruned
+)
+
+// replyEntry is the email a chat message was posted from
+type replyEntry struct {
+	email     *ProcessedEmail
+	replyFrom string // Reply address of the destination, "" for SMTP_RELAY_FROM
+	expires   time.Time
+}
+
+// ReplyIndex maps messages posted to a chat back to the email that should receive replies to them.
+// Slack keys it by thread timestamp, Telegram by bot, chat and message ID
+type ReplyIndex struct {
+	TTL time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]replyEntry
+}
+
+// NewReplyIndex creates a new reply index
+func NewReplyIndex(ttl time.Duration) *ReplyIndex {
+	return &ReplyIndex{
+		TTL:     ttl,
+		entries: make(map[string]replyEntry),
+	}
+}
+
+// Remember records the latest email posted as a message and the address replies are sent from.
+// Only the headers needed for a reply are kept
+func (ri *ReplyIndex) Remember(key string, email *ProcessedEmail, replyFrom string) {
+	if key == "" || email.From == "" {
+		return
+	}
+
+	ri.mutex.Lock()
+	defer ri.mutex.Unlock()
+
+	now := time.Now()
+	if len(ri.entries) >= ReplyIndexMaxLen {
+		for stale, entry := range ri.entries {
+			if !now.Before(entry.expires) {
+				delete(ri.entries, stale)
+			}
+		}
+	}
+
+	ri.entries[key] = replyEntry{
+		email: &ProcessedEmail{
+			From:       email.From,
+			Subject:    email.Subject,
+			MessageID:  email.MessageID,
+			References: email.References,
+		},
+		replyFrom: replyFrom,
+		expires:   now.Add(ri.TTL),
+	}
+}
+
+// Lookup returns the email a reply should be sent to, or nil, and the address to send it from
+func (ri *ReplyIndex) Lookup(key string) (*ProcessedEmail, string) {
+	ri.mutex.Lock()
+	defer ri.mutex.Unlock()
+
+	entry, exists := ri.entries[key]
+	if !exists || !time.Now().Before(entry.expires) {
+		return nil, ""
+	}
+	return entry.email, entry.replyFrom
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// platformConfigured reports whether the platform has a client to deliver with
+func (ep *EmailProcessor) platformConfigured(platform string) bool {
+	switch platform {
+	case "telegram":
+		return ep.TelegramClient != nil || len(ep.TelegramBots) > 0
+	case "slack":
+		return ep.SlackClient != nil
+	case "dingtalk":
+		return ep.DingTalkClient != nil
+	case "wecom":
+		return ep.WeComClient != nil
+	case "mastodon":
+		return ep.MastodonClient != nil
+	case "whatsapp":
+		return ep.WhatsAppClient != nil
+	case "zoom":
+		return ep.ZoomClient != nil
+	case "victorops":
+		return ep.VictorOpsClient != nil
+	case "redis":
+		return ep.RedisClient != nil
+	default:
+		// Plugin platforms only resolve when their executable exists
+		return true
+	}
+}
+
+// fallbackDestination returns the validated FALLBACK_DESTINATION, or false when none is set
+func (ep *EmailProcessor) fallbackDestination() (platform, userID string, ok bool, err error) {
+	if ep.Config == nil || ep.Config.FallbackDestination == "" {
+		return "", "", false, nil
+	}
+
+	platform, id, found := strings.Cut(ep.Config.FallbackDestination, ":")
+	if !found || id == "" {
+		return "", "", false, fmt.Errorf("invalid FALLBACK_DESTINATION '%s': use platform:id", ep.Config.FallbackDestination)
+	}
+	platform, userID, err = ep.validateDestination(strings.ToLower(platform), id)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid FALLBACK_DESTINATION '%s': %w", ep.Config.FallbackDestination, err)
+	}
+	if !ep.platformConfigured(platform) {
+		return "", "", false, fmt.Errorf("invalid FALLBACK_DESTINATION '%s': %s is not configured", ep.Config.FallbackDestination, platform)
+	}
+	return platform, userID, true, nil
+}
+
+// rerouteUnconfigured sends mail for a platform without a client to the fallback destination,
+// returning the destination to deliver to and a note naming the intended one. Without a
+// fallback the destination is returned unchanged and delivery fails as before
+func (ep *EmailProcessor) rerouteUnconfigured(platform, userID string, options DestinationOptions) (string, string, DestinationOptions, string) {
+	if ep.platformConfigured(platform) {
+		return platform, userID, options, ""
+	}
+
+	fallbackPlatform, fallbackID, ok, err := ep.fallbackDestination()
+	if err != nil || !ok {
+		return platform, userID, options, ""
+	}
+
+	// Options of the intended destination may not make sense on the fallback
+	note := fmt.Sprintf("(intended for %s:%s)", platform, userID)
+	return fallbackPlatform, fallbackID, ep.destinationOptions(fallbackPlatform, fallbackID, nil), note
+}
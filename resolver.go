@@ -0,0 +1,103 @@
+//go:build !minimal && !noresolver
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Resolver Configuration
+const (
+	ResolverHTTPRequestTimeout = 5 * time.Second
+)
+
+// ResolverRequest is the payload posted to the external resolver for an unrecognized destination
+type ResolverRequest struct {
+	Address   string `json:"address"`
+	LocalPart string `json:"local_part"`
+	Domain    string `json:"domain"`
+}
+
+// ResolverResponse is the destination returned by the external resolver
+type ResolverResponse struct {
+	Platform string `json:"platform"`
+	ID       string `json:"id"`
+}
+
+// ResolverClient asks an operator-provided webhook to map unrecognized addresses to destinations
+type ResolverClient struct {
+	URL        string
+	Token      string // Optional bearer token sent with every request
+	HTTPClient *http.Client
+}
+
+// NewResolverClient creates a new resolver client
+func NewResolverClient(url, token string) *ResolverClient {
+	return &ResolverClient{
+		URL:   url,
+		Token: token,
+		HTTPClient: &http.Client{
+			Timeout: ResolverHTTPRequestTimeout,
+		},
+	}
+}
+
+// Resolve posts the address to the webhook and returns the platform and ID it maps to.
+// A 404 response means the resolver does not know the address either
+func (rc *ResolverClient) Resolve(address, localPart, domain string) (string, string, error) {
+	jsonData, err := json.Marshal(ResolverRequest{
+		Address:   address,
+		LocalPart: localPart,
+		Domain:    domain,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	log.Printf("Asking external resolver for destination of %s", address)
+
+	req, err := http.NewRequest("POST", rc.URL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if rc.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rc.Token))
+	}
+
+	resp, err := rc.HTTPClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to call resolver: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", "", fmt.Errorf("resolver has no destination for %s", address)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("resolver error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response ResolverResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if response.Platform == "" || response.ID == "" {
+		return "", "", fmt.Errorf("resolver response for %s is missing platform or id", address)
+	}
+
+	log.Printf("External resolver mapped %s to %s:%s", address, response.Platform, response.ID)
+	return response.Platform, response.ID, nil
+}
@@ -0,0 +1,20 @@
+//go:build minimal || noresolver
+
+package main
+
+func init() {
+	excludeFeature("resolver webhook", "noresolver")
+}
+
+// ResolverClient is a placeholder for builds without the resolver webhook
+type ResolverClient struct{}
+
+// NewResolverClient creates a placeholder client whose lookups all fail
+func NewResolverClient(url, token string) *ResolverClient {
+	return &ResolverClient{}
+}
+
+// Resolve reports that the resolver webhook was compiled out
+func (rc *ResolverClient) Resolve(address, localPart, domain string) (string, string, error) {
+	return "", "", requireFeature("resolver webhook")
+}
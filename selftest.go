@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Self-Test Configuration
+const (
+	SelfTestChatID = "123456789"
+	SelfTestFrom   = "selftest@localhost"
+)
+
+// selfTestCase is one email sent through the bridge, with what the mock platform should receive
+type selfTestCase struct {
+	name     string
+	message  string
+	accept   bool     // The SMTP server should accept the message
+	want     []string // Text expected in the delivered message
+	unwanted []string // Text that must not be delivered
+}
+
+// selfTestPlatform stands in for the Telegram Bot API and records every message posted to it
+type selfTestPlatform struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+// RoundTrip implements http.RoundTripper by accepting every request
+func (p *selfTestPlatform) RoundTrip(req *http.Request) (*http.Response, error) {
+	var message TelegramMessage
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+			return nil, fmt.Errorf("mock platform: invalid request: %w", err)
+		}
+		req.Body.Close()
+	}
+
+	p.mutex.Lock()
+	p.messages = append(p.messages, message.Text)
+	id := len(p.messages)
+	p.mutex.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(fmt.Sprintf(`{"ok":true,"result":{"message_id":%d}}`, id))),
+		Request:    req,
+	}, nil
+}
+
+// delivered returns the messages posted since the last call and forgets them
+func (p *selfTestPlatform) delivered() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	text := strings.Join(p.messages, "\n")
+	p.messages = nil
+	return text
+}
+
+// selfTestCases is the battery of emails covering the parser paths that break most often
+func selfTestCases() []selfTestCase {
+	header := func(extra string) string {
+		return "From: Self Test <" + SelfTestFrom + ">\r\nTo: " + SelfTestChatID + "@telegram\r\n" +
+			"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" + extra
+	}
+
+	return []selfTestCase{
+		{
+			name:    "plain text",
+			message: header("Subject: Plain check\r\n\r\nmarker-plain-body\r\n"),
+			accept:  true,
+			want:    []string{"Plain check", "marker-plain-body"},
+		},
+		{
+			name: "HTML only",
+			message: header("Subject: HTML check\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+				"<html><body><p>marker-html-<b>body</b></p></body></html>\r\n"),
+			accept: true,
+			want:   []string{"HTML check", "marker-html-"},
+		},
+		{
+			name: "multipart alternative",
+			message: header("Subject: Multipart check\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=\"b1\"\r\n\r\n" +
+				"--b1\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nmarker-multipart-plain\r\n" +
+				"--b1\r\nContent-Type: text/html; charset=utf-8\r\n\r\n<p>marker-multipart-html</p>\r\n--b1--\r\n"),
+			accept:   true,
+			want:     []string{"marker-multipart-plain"},
+			unwanted: []string{"marker-multipart-html"},
+		},
+		{
+			name: "quoted-printable",
+			message: header("Subject: QP check\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n\r\nmarker-qp-=\r\nbody caf=C3=A9\r\n"),
+			accept: true,
+			want:   []string{"marker-qp-body café"},
+		},
+		{
+			name:    "encoded subject",
+			message: header("Subject: =?UTF-8?B?w5xiZXJ3YWNodW5n?=\r\n\r\nmarker-subject-body\r\n"),
+			accept:  true,
+			want:    []string{"Überwachung"},
+		},
+		{
+			name: "unknown charset",
+			message: header("Subject: Charset check\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=x-no-such-charset\r\n\r\n" +
+				"marker-charset-body\r\n"),
+			accept: true,
+			want:   []string{"marker-charset-body"},
+		},
+		{
+			name:    "oversized",
+			message: header("Subject: Oversized check\r\n\r\n") + strings.Repeat("marker-oversized-line\r\n", DefaultMaxMessageBytes/20),
+			accept:  false,
+		},
+	}
+}
+
+// runSelfTest starts the bridge on an ephemeral port with a mock platform, sends itself the
+// test battery over SMTP and reports each result, failing if any check failed
+func runSelfTest(args []string) error {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "show the bridge's log output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	platform := &selfTestPlatform{}
+	telegramClient := NewTelegramClient("selftest")
+	telegramClient.HTTPClient.Transport = platform
+	telegramClient.Limiter = nil // The mock platform has no limits to respect
+
+	config := &Config{ParseLimits: DefaultParseLimits, ParseFailurePolicy: ParseFailureReject}
+	processor := NewEmailProcessor(config, telegramClient, nil, nil, nil, nil, nil, nil, nil, nil)
+	if processor.SyslogWriter != nil {
+		// Test mail must not show up among real deliveries
+		processor.SyslogWriter.Close()
+		processor.SyslogWriter = nil
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen on an ephemeral port: %w", err)
+	}
+	server := NewSMTPServer(processor, "127.0.0.1", 0, nil, nil, nil)
+	go server.Serve(listener)
+	defer server.Stop()
+	addr := listener.Addr().String()
+
+	failed := 0
+	cases := selfTestCases()
+	for _, tc := range cases {
+		sendErr := smtp.SendMail(addr, nil, SelfTestFrom, []string{SelfTestChatID + "@telegram"}, []byte(tc.message))
+		delivered := platform.delivered()
+
+		var problems []string
+		switch {
+		case tc.accept && sendErr != nil:
+			problems = append(problems, fmt.Sprintf("rejected: %v", sendErr))
+		case !tc.accept && sendErr == nil:
+			problems = append(problems, "accepted, expected a rejection")
+		case !tc.accept && delivered != "":
+			problems = append(problems, "rejected but still delivered")
+		}
+		for _, text := range tc.want {
+			if sendErr == nil && !strings.Contains(delivered, text) {
+				problems = append(problems, fmt.Sprintf("missing %q", text))
+			}
+		}
+		for _, text := range tc.unwanted {
+			if strings.Contains(delivered, text) {
+				problems = append(problems, fmt.Sprintf("unexpected %q", text))
+			}
+		}
+
+		if len(problems) > 0 {
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", tc.name, strings.Join(problems, "; "))
+		} else {
+			fmt.Printf("PASS  %s\n", tc.name)
+		}
+	}
+
+	fmt.Printf("%d/%d checks passed\n", len(cases)-failed, len(cases))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(cases))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseSenderNames reads SENDER_NAMES, the display names shown instead of sender addresses:
+// address=Name pairs separated by semicolons, or the absolute path of a file with one address and
+// name per line, blank lines and # comments skipped. An entry for @domain names every sender of
+// the domain without an entry of its own
+func parseSenderNames(value string) (map[string]string, error) {
+	value = strings.TrimSpace(value)
+	names := make(map[string]string)
+	if value == "" {
+		return names, nil
+	}
+
+	add := func(address, name, context string) error {
+		address, name = strings.ToLower(strings.TrimSpace(address)), strings.TrimSpace(name)
+		if name == "" || !strings.Contains(address, "@") || strings.HasSuffix(address, "@") {
+			return fmt.Errorf("invalid SENDER_NAMES %s: use an address or @domain and a name, e.g. backup01@corp.example=NAS Backups", context)
+		}
+		names[address] = name
+		return nil
+	}
+
+	if !strings.HasPrefix(value, "/") {
+		for _, entry := range strings.Split(value, ";") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			address, name, _ := strings.Cut(entry, "=")
+			if err := add(address, name, fmt.Sprintf("entry '%s'", entry)); err != nil {
+				return nil, err
+			}
+		}
+		return names, nil
+	}
+
+	file, err := os.Open(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENDER_NAMES: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		row := strings.TrimSpace(scanner.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+		address, name := row, ""
+		if i := strings.IndexAny(row, " \t"); i >= 0 {
+			address, name = row[:i], row[i+1:]
+		}
+		if err := add(address, name, fmt.Sprintf("line %d of %s", line, value)); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid SENDER_NAMES: %w", err)
+	}
+	return names, nil
+}
+
+// applySenderName looks up the display name of the email's sender, by address and then by domain
+func (ep *EmailProcessor) applySenderName(email *ProcessedEmail) {
+	if ep.Config == nil || len(ep.Config.SenderNames) == 0 || email.From == "" {
+		return
+	}
+	address := strings.ToLower(email.From)
+	if name, exists := ep.Config.SenderNames[address]; exists {
+		email.FromName = name
+		return
+	}
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		email.FromName = ep.Config.SenderNames[address[at:]]
+	}
+}
+
+// senderDisplay is the sender as messages show it: the display name when one is configured
+func senderDisplay(email *ProcessedEmail) string {
+	if email.FromName != "" {
+		return email.FromName
+	}
+	return email.From
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// SessionInfo describes how a message reached the bridge, so recipients can judge where an alert came from
+type SessionInfo struct {
+	EnvelopeFrom string      // MAIL FROM address
+	AuthUser     string      // SMTP AUTH username, empty for unauthenticated sessions
+	Helo         string      // Name the client gave in HELO/EHLO
+	TLS          bool        // The message was received over an encrypted connection
+	RemoteAddr   string      // Client address including the port
+	SPF          string      // SPF result for MAIL FROM, e.g. pass; empty when not checked
+	SPFDetail    string      // Why SPF gave that result
+	DMARC        *DMARCCheck // nil when not checked
+}
+
+// ClientIP returns the client's IP address without the port
+func (s SessionInfo) ClientIP() string {
+	host, _, err := net.SplitHostPort(s.RemoteAddr)
+	if err != nil {
+		return s.RemoteAddr
+	}
+	return host
+}
+
+// parseBannerTemplate reads SENDER_BANNER_TEMPLATE, which renders a line shown above the message body
+func parseBannerTemplate() (*template.Template, error) {
+	text := os.Getenv("SENDER_BANNER_TEMPLATE")
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("SENDER_BANNER_TEMPLATE").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENDER_BANNER_TEMPLATE: %w", err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, TitleData{}); err != nil {
+		return nil, fmt.Errorf("invalid SENDER_BANNER_TEMPLATE: %w", err)
+	}
+	return tmpl, nil
+}
+
+// applySenderBanner renders the banner template for an email and places it above the body.
+// An empty rendering, e.g. for authenticated senders, leaves the body unchanged
+func (ep *EmailProcessor) applySenderBanner(email *ProcessedEmail, platform, userID string) {
+	if ep.Config == nil || ep.Config.BannerTemplate == nil {
+		return
+	}
+
+	var rendered strings.Builder
+	if err := ep.Config.BannerTemplate.Execute(&rendered, ep.templateData(email, platform, userID)); err != nil {
+		log.Printf("Warning: failed to render sender banner: %v", err)
+		return
+	}
+	banner := strings.Join(strings.Fields(rendered.String()), " ")
+	if banner == "" {
+		return
+	}
+
+	if email.BodyHTML {
+		email.Body = "<p>" + html.EscapeString(banner) + "</p>\n" + email.Body
+	} else {
+		email.Body = banner + "\n\n" + email.Body
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+)
+
+// Severity is the urgency detected from keywords in an email
+type Severity string
+
+// Severity levels, from no signal to most urgent
+const (
+	SeverityNone     Severity = ""
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+	SeverityRecovery Severity = "recovery"
+)
+
+// severityOrder is the order in which levels are checked; a recovery notice usually repeats
+// the problem's keywords ("RESOLVED: disk error"), so it wins over every other level
+var severityOrder = []Severity{SeverityRecovery, SeverityCritical, SeverityError, SeverityWarning, SeverityInfo}
+
+// DefaultSeverityKeywords covers English, German, French, Russian and Spanish.
+// A trailing * matches any word starting with the keyword, which handles inflected forms
+var DefaultSeverityKeywords = map[Severity][]string{
+	SeverityRecovery: {
+		"recovered", "recovery", "resolved", "cleared",
+		"wiederhergestellt", "behoben",
+		"rétabli", "résolu", "restauré",
+		"восстановлен*", "устранен*",
+		"resuelto", "recuperado",
+	},
+	SeverityCritical: {
+		"critical", "crit", "fatal", "emergency", "down", "outage",
+		"kritisch*", "ausfall", "notfall",
+		"critique", "urgence", "panne",
+		"критическ*", "авари*",
+		"crítico", "crítica", "caído",
+	},
+	SeverityError: {
+		"error*", "fail*", "problem",
+		"fehler*", "fehlgeschlagen",
+		"erreur*", "échec", "échoué*", "problème",
+		"ошибк*", "сбой", "отказ", "проблем*",
+		"fallo", "fallido", "problema",
+	},
+	SeverityWarning: {
+		"warn*", "degraded",
+		"warnung", "achtung",
+		"avertissement",
+		"предупрежден*", "внимание",
+		"advertencia", "aviso",
+	},
+	SeverityInfo: {
+		"info", "information", "notice",
+		"hinweis",
+		"avis",
+		"информаци*", "уведомлени*",
+		"información",
+	},
+}
+
+// severityEmoji is shown in message headers for each level
+var severityEmoji = map[Severity]string{
+	SeverityNone:     "📧",
+	SeverityInfo:     "ℹ️",
+	SeverityWarning:  "⚠️",
+	SeverityError:    "🔴",
+	SeverityCritical: "🚨",
+	SeverityRecovery: "✅",
+}
+
+// severitySlackEmoji is the Slack shortcode equivalent of severityEmoji
+var severitySlackEmoji = map[Severity]string{
+	SeverityNone:     ":email:",
+	SeverityInfo:     ":information_source:",
+	SeverityWarning:  ":warning:",
+	SeverityError:    ":red_circle:",
+	SeverityCritical: ":rotating_light:",
+	SeverityRecovery: ":white_check_mark:",
+}
+
+// severitySlackColor is the attachment color bar for each level: red for problems,
+// yellow for warnings and green for recoveries. Other levels get no bar
+var severitySlackColor = map[Severity]string{
+	SeverityWarning:  "#ECB22E",
+	SeverityError:    "#E01E5A",
+	SeverityCritical: "#E01E5A",
+	SeverityRecovery: "#2EB67D",
+}
+
+// slackNamedColors are the legacy attachment colors Slack renders in its own palette
+var slackNamedColors = map[string]bool{"good": true, "warning": true, "danger": true}
+
+// Emoji returns the emoji shown in message headers for the severity
+func (s Severity) Emoji() string {
+	return severityEmoji[s]
+}
+
+// SlackEmoji returns the Slack emoji shortcode for the severity
+func (s Severity) SlackEmoji() string {
+	return severitySlackEmoji[s]
+}
+
+// SlackColor returns the attachment color for the severity, or "" for none
+func (s Severity) SlackColor() string {
+	return severitySlackColor[s]
+}
+
+// severityFromPriority maps an X-Priority header such as "1 (Highest)" to a severity.
+// Only the urgent values 1 and 2 carry a signal; normal and low priorities return SeverityNone
+func severityFromPriority(header string) Severity {
+	value := strings.TrimSpace(header)
+	if value == "" {
+		return SeverityNone
+	}
+	switch value[0] {
+	case '1':
+		return SeverityCritical
+	case '2':
+		return SeverityWarning
+	default:
+		return SeverityNone
+	}
+}
+
+// monitoringSeverityHeaders map the headers monitoring systems set to a severity, by lowercase value.
+// Values not listed, such as Zabbix's "Not classified", carry no signal
+var monitoringSeverityHeaders = []struct {
+	header string
+	values map[string]Severity
+}{
+	{"X-Zabbix-Severity", map[string]Severity{
+		"disaster": SeverityCritical, "high": SeverityError, "average": SeverityWarning,
+		"warning": SeverityWarning, "information": SeverityInfo,
+	}},
+	{"X-Nagios-Notification-Type", map[string]Severity{
+		"problem": SeverityError, "recovery": SeverityRecovery, "acknowledgement": SeverityInfo,
+		"flappingstart": SeverityWarning, "flappingstop": SeverityInfo, "flappingdisabled": SeverityInfo,
+		"downtimestart": SeverityInfo, "downtimeend": SeverityInfo, "downtimecancelled": SeverityInfo,
+		"custom": SeverityInfo,
+	}},
+	{"X-GitHub-Severity", map[string]Severity{
+		"critical": SeverityCritical, "high": SeverityError, "moderate": SeverityWarning, "low": SeverityInfo,
+	}},
+}
+
+// severityFromMonitoringHeaders returns the severity a monitoring system declared in its own
+// header, or SeverityNone when the message has none of them
+func severityFromMonitoringHeaders(header mail.Header) Severity {
+	for _, known := range monitoringSeverityHeaders {
+		value := strings.ToLower(strings.TrimSpace(header.Get(known.header)))
+		if severity, exists := known.values[value]; exists {
+			return severity
+		}
+	}
+	return SeverityNone
+}
+
+// isAutoReply reports whether an Auto-Submitted header (RFC 3834) marks the message as an
+// automatic reply such as an out-of-office notice
+func isAutoReply(header mail.Header) bool {
+	value, _, _ := strings.Cut(header.Get("Auto-Submitted"), ";")
+	return strings.EqualFold(strings.TrimSpace(value), "auto-replied")
+}
+
+// defaultSeverityClassifier uses only DefaultSeverityKeywords
+var defaultSeverityClassifier = NewSeverityClassifier(nil)
+
+// SeverityClassifier detects severity from keyword sets independent of the email's language
+type SeverityClassifier struct {
+	exact  map[string]Severity   // Whole-word keywords
+	prefix map[Severity][]string // Keywords ending in *
+}
+
+// NewSeverityClassifier creates a classifier from the default keywords plus the extra ones given
+func NewSeverityClassifier(extra map[Severity][]string) *SeverityClassifier {
+	sc := &SeverityClassifier{
+		exact:  make(map[string]Severity),
+		prefix: make(map[Severity][]string),
+	}
+
+	// Add in reverse check order so a word listed under two levels keeps the higher one
+	for i := len(severityOrder) - 1; i >= 0; i-- {
+		severity := severityOrder[i]
+		for _, keywords := range [][]string{DefaultSeverityKeywords[severity], extra[severity]} {
+			for _, keyword := range keywords {
+				keyword = strings.ToLower(strings.TrimSpace(keyword))
+				if stem, isPrefix := strings.CutSuffix(keyword, "*"); isPrefix {
+					if stem != "" {
+						sc.prefix[severity] = append(sc.prefix[severity], stem)
+					}
+				} else if keyword != "" {
+					sc.exact[keyword] = severity
+				}
+			}
+		}
+	}
+
+	return sc
+}
+
+// parseSeverityKeywords parses level=word,word*;level=word into extra keyword sets
+func parseSeverityKeywords(value string) (map[Severity][]string, error) {
+	keywords := make(map[Severity][]string)
+	if strings.TrimSpace(value) == "" {
+		return keywords, nil
+	}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		level, words, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid SEVERITY_KEYWORDS entry '%s': expected level=word,word", entry)
+		}
+
+		severity := Severity(strings.ToLower(strings.TrimSpace(level)))
+		if _, known := DefaultSeverityKeywords[severity]; !known {
+			return nil, fmt.Errorf("invalid SEVERITY_KEYWORDS level '%s': use critical/error/warning/info/recovery", level)
+		}
+
+		for _, word := range strings.Split(words, ",") {
+			if word = strings.TrimSpace(word); word != "" {
+				keywords[severity] = append(keywords[severity], word)
+			}
+		}
+	}
+
+	return keywords, nil
+}
+
+// parseSeverityColors parses level=color;level=color into color bar overrides. A color is
+// good, warning, danger or a #RRGGBB hex value; an empty color removes the bar for that level
+func parseSeverityColors(value string) (map[Severity]string, error) {
+	colors := make(map[Severity]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		level, color, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid SLACK_SEVERITY_COLORS entry '%s': expected level=color", entry)
+		}
+
+		severity := Severity(strings.ToLower(strings.TrimSpace(level)))
+		if _, known := DefaultSeverityKeywords[severity]; !known {
+			return nil, fmt.Errorf("invalid SLACK_SEVERITY_COLORS level '%s': use critical/error/warning/info/recovery", level)
+		}
+
+		color = strings.TrimSpace(color)
+		if slackNamedColors[strings.ToLower(color)] {
+			color = strings.ToLower(color)
+		} else if color != "" && !isHexColor(color) {
+			return nil, fmt.Errorf("invalid SLACK_SEVERITY_COLORS color '%s': use good/warning/danger or a hex value such as #E01E5A", color)
+		}
+		colors[severity] = color
+	}
+
+	return colors, nil
+}
+
+// isHexColor reports whether color is a #RGB or #RRGGBB value
+func isHexColor(color string) bool {
+	digits, found := strings.CutPrefix(color, "#")
+	if !found || (len(digits) != 3 && len(digits) != 6) {
+		return false
+	}
+	for _, r := range digits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// severityWords splits text into lowercase words of letters and digits in any script
+func severityWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordSeverity returns the severity a single lowercase word signals
+func (sc *SeverityClassifier) wordSeverity(word string) Severity {
+	if severity, exists := sc.exact[word]; exists {
+		return severity
+	}
+	for _, severity := range severityOrder {
+		for _, stem := range sc.prefix[severity] {
+			if strings.HasPrefix(word, stem) {
+				return severity
+			}
+		}
+	}
+	return SeverityNone
+}
+
+// classifyText returns the highest-ranked severity among the words of text
+func (sc *SeverityClassifier) classifyText(text string) Severity {
+	rank := len(severityOrder)
+	for _, word := range severityWords(text) {
+		severity := sc.wordSeverity(word)
+		if severity == SeverityNone {
+			continue
+		}
+		for i, candidate := range severityOrder[:rank] {
+			if candidate == severity {
+				rank = i
+				break
+			}
+		}
+	}
+
+	if rank == len(severityOrder) {
+		return SeverityNone
+	}
+	return severityOrder[rank]
+}
+
+// Classify detects the severity of an email. The subject is authoritative;
+// the body is only consulted when the subject carries no keyword
+func (sc *SeverityClassifier) Classify(subject, body string) Severity {
+	if severity := sc.classifyText(subject); severity != SeverityNone {
+		return severity
+	}
+	return sc.classifyText(body)
+}
+
+// StripKeywords removes severity keywords from text, leaving the remaining words joined by spaces
+func (sc *SeverityClassifier) StripKeywords(text string) string {
+	var kept []string
+	for _, word := range severityWords(text) {
+		if sc.wordSeverity(word) == SeverityNone {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
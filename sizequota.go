@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Size Quota Configuration
+const (
+	SizeQuotaDefaultKey      = "*"       // SIZE_QUOTAS entry for destinations without one of their own
+	SizeQuotaPolicySummary   = "summary" // Deliver a shortened email without attachments
+	SizeQuotaPolicyReject    = "reject"  // Refuse mail with 552 until the next UTC day
+	SizeQuotaSummaryChars    = 500       // Body characters kept when an email is shortened
+	SizeQuotaMaxDestinations = 10000     // Destinations counted per day; more are not counted
+)
+
+// SizeQuotaError reports mail refused because a destination used up its daily size quota
+type SizeQuotaError struct {
+	Destination string
+	Quota       int64
+}
+
+// Error describes the quota that was reached
+func (e *SizeQuotaError) Error() string {
+	return fmt.Sprintf("daily size quota of %s for %s reached", formatByteSize(e.Quota), e.Destination)
+}
+
+// SizeQuotaUsage is the bytes a destination accepted today, for the admin API
+type SizeQuotaUsage struct {
+	Destination string `json:"destination"`
+	Bytes       int64  `json:"bytes"`
+	Quota       int64  `json:"quota,omitempty"` // 0 without a quota
+}
+
+// SizeQuotas counts the bytes of mail accepted for each destination per UTC day and enforces
+// the daily quotas of SIZE_QUOTAS, so a runaway appliance cannot fill a workspace's file storage
+type SizeQuotas struct {
+	Limits map[string]int64 // platform:id -> bytes per day; "*" for destinations without an entry
+	Policy string           // summary or reject
+
+	mutex  sync.Mutex
+	day    string           // UTC date the counts are for
+	usage  map[string]int64 // platform:id -> bytes accepted today
+	warned map[string]bool  // Destinations whose quota was reached today, logged once
+}
+
+// NewSizeQuotas creates a counter enforcing limits with policy; nil limits only count
+func NewSizeQuotas(limits map[string]int64, policy string) *SizeQuotas {
+	return &SizeQuotas{
+		Limits: limits,
+		Policy: policy,
+		usage:  make(map[string]int64),
+		warned: make(map[string]bool),
+	}
+}
+
+// parseByteSize parses a size such as 512KB, 50MB or 1GB; units are multiples of 1024
+func parseByteSize(value string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if trimmed, found := strings.CutSuffix(number, unit.suffix); found {
+			number, multiplier = strings.TrimSpace(trimmed), unit.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size '%s': use a positive number of bytes, KB, MB or GB", value)
+	}
+	return size * multiplier, nil
+}
+
+// formatByteSize describes a byte count in the largest unit that keeps it readable
+func formatByteSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+}
+
+// parseSizeQuotas parses SIZE_QUOTAS entries of the form platform:id=size;... where "*=size"
+// applies to every destination without an entry of its own
+func parseSizeQuotas(value string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		destination, size, found := strings.Cut(entry, "=")
+		destination = strings.TrimSpace(destination)
+		platform, id, hasID := strings.Cut(destination, ":")
+		if !found || (destination != SizeQuotaDefaultKey && (!hasID || platform == "" || id == "")) {
+			return nil, fmt.Errorf("invalid SIZE_QUOTAS entry '%s': use platform:id=size or *=size, e.g. slack:C0123456789=50MB", entry)
+		}
+		bytes, err := parseByteSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIZE_QUOTAS entry '%s': %w", entry, err)
+		}
+		if destination != SizeQuotaDefaultKey {
+			destination = normalizeDestinationKey(platform, id)
+		}
+		limits[destination] = bytes
+	}
+	return limits, nil
+}
+
+// quota returns the daily quota of a destination, or 0 without one
+func (q *SizeQuotas) quota(key string) int64 {
+	if limit, exists := q.Limits[key]; exists {
+		return limit
+	}
+	return q.Limits[SizeQuotaDefaultKey]
+}
+
+// rollover starts new counts when the UTC day changed; the caller holds the mutex
+func (q *SizeQuotas) rollover(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); day != q.day {
+		q.day = day
+		q.usage = make(map[string]int64)
+		q.warned = make(map[string]bool)
+	}
+}
+
+// Check returns a SizeQuotaError when the destination has used up its quota, or would with
+// size more bytes. It counts nothing, so it can run at RCPT TO
+func (q *SizeQuotas) Check(key string, size int64) error {
+	quota := q.quota(key)
+	if quota == 0 {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover(time.Now())
+	if q.usage[key] >= quota || q.usage[key]+size > quota {
+		return &SizeQuotaError{Destination: key, Quota: quota}
+	}
+	return nil
+}
+
+// Account counts size bytes accepted for a destination, or returns a SizeQuotaError when they
+// would go over its daily quota. Mail past the quota is not counted
+func (q *SizeQuotas) Account(key string, size int64) *SizeQuotaError {
+	quota := q.quota(key)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover(time.Now())
+	if quota > 0 && q.usage[key]+size > quota {
+		if !q.warned[key] {
+			q.warned[key] = true
+			log.Printf("Warning: daily size quota of %s for %s reached (%s accepted today), applying the %s policy until midnight UTC",
+				formatByteSize(quota), key, formatByteSize(q.usage[key]), q.Policy)
+		}
+		return &SizeQuotaError{Destination: key, Quota: quota}
+	}
+	if _, counted := q.usage[key]; counted || len(q.usage) < SizeQuotaMaxDestinations {
+		q.usage[key] += size
+	}
+	return nil
+}
+
+// Usage returns today's counts, largest first
+func (q *SizeQuotas) Usage() []SizeQuotaUsage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover(time.Now())
+	usage := make([]SizeQuotaUsage, 0, len(q.usage))
+	for key, bytes := range q.usage {
+		usage = append(usage, SizeQuotaUsage{Destination: key, Bytes: bytes, Quota: q.quota(key)})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Bytes != usage[j].Bytes {
+			return usage[i].Bytes > usage[j].Bytes
+		}
+		return usage[i].Destination < usage[j].Destination
+	})
+	return usage
+}
+
+// summarizeOverQuota shortens an email to its first lines and drops its attachments, naming
+// what was left out, so an alert still arrives without adding to the workspace's file storage
+func summarizeOverQuota(email *ProcessedEmail, quota int64) {
+	var dropped []string
+	for _, attachments := range [][]Attachment{email.Attachments, email.InlineImages} {
+		for _, attachment := range attachments {
+			dropped = append(dropped, fmt.Sprintf("%s (%s)", attachment.Filename, formatByteSize(attachment.Size)))
+		}
+	}
+	email.Attachments, email.InlineImages = nil, nil
+
+	// Cutting markup could leave tags open, so HTML bodies are left out
+	note := fmt.Sprintf("[Daily size quota of %s for this destination reached: body shortened", formatByteSize(quota))
+	if body := []rune(email.Body); email.BodyHTML {
+		email.Body, email.BodyHTML = "", false
+		note = fmt.Sprintf("[Daily size quota of %s for this destination reached: HTML body left out", formatByteSize(quota))
+	} else if len(body) > SizeQuotaSummaryChars {
+		email.Body = string(body[:SizeQuotaSummaryChars]) + "…"
+	}
+	if len(dropped) > 0 {
+		note += ", attachments not sent: " + strings.Join(dropped, ", ")
+	}
+	email.Body = strings.TrimSpace(email.Body + "\n\n" + note + "]")
+}
+
+// sizeQuotaSMTPError answers mail for a destination over its quota with 552 5.2.2 (mailbox full)
+func sizeQuotaSMTPError(err error) *smtp.SMTPError {
+	return &smtp.SMTPError{
+		Code:         552,
+		EnhancedCode: smtp.EnhancedCode{5, 2, 2},
+		Message:      fmt.Sprintf("Destination over quota: %v", err),
+	}
+}
+
+// CheckSizeQuota refuses a recipient at RCPT TO whose destination used up its quota under the
+// reject policy, or whose quota the size declared in MAIL FROM would exceed
+func (ep *EmailProcessor) CheckSizeQuota(address string, size int64) error {
+	if ep.SizeQuotas == nil || ep.SizeQuotas.Policy != SizeQuotaPolicyReject {
+		return nil
+	}
+	platform, userID, options, err := ep.extractPlatformAndID(address)
+	if err != nil {
+		return nil // Invalid destinations are reported with their own error later
+	}
+	platform, userID, _, _ = ep.rerouteUnconfigured(platform, userID, options)
+	return ep.SizeQuotas.Check(destinationKey(platform, userID), size)
+}
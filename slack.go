@@ -1,13 +1,20 @@
+//go:build !minimal && !noslack
+
 package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,43 +24,134 @@ const (
 	SlackMaxMessageLength   = 40000                   // Slack's message limit (much higher than Telegram)
 	SlackMessageSendDelay   = 1000 * time.Millisecond // Delay between message chunks
 	SlackHTTPRequestTimeout = 10 * time.Second
+	SlackMaxBlocks          = 50   // Blocks per message
+	SlackMaxSectionText     = 3000 // Characters in a section block
+	SlackMaxHeaderText      = 150  // Characters in a header block
+	SlackMaxUploads         = 10   // Attachments uploaded per email
+	DefaultSlackRateRetries = 3    // Retries of a rate-limited API call
+	SlackMaxRetryAfter      = 5 * time.Minute
+	DefaultSlackChannelTTL  = 10 * time.Minute // How long the channel name cache is trusted
+	DefaultSlackUserTTL     = 24 * time.Hour   // How long the username cache is trusted
+	SlackChannelMinRefresh  = 1 * time.Minute  // Unknown names trigger a refresh at most this often
 )
 
 // SlackMessage represents a message payload for Slack API
 type SlackMessage struct {
-	Channel string `json:"channel"`
-	Text    string `json:"text"`
-	AsUser  bool   `json:"as_user"`
+	Channel     string            `json:"channel"`
+	Text        string            `json:"text"`
+	Blocks      []SlackBlock      `json:"blocks,omitempty"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
+	AsUser      bool              `json:"as_user"`
+	Username    string            `json:"username,omitempty"`
+	IconEmoji   string            `json:"icon_emoji,omitempty"`
+	IconURL     string            `json:"icon_url,omitempty"`
+	UnfurlLinks *bool             `json:"unfurl_links,omitempty"`
+	UnfurlMedia *bool             `json:"unfurl_media,omitempty"`
+}
+
+// SlackAttachment is a legacy message attachment, used for its colored side bar
+type SlackAttachment struct {
+	Color    string       `json:"color,omitempty"`
+	Fallback string       `json:"fallback,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Blocks   []SlackBlock `json:"blocks,omitempty"`
+	MrkdwnIn []string     `json:"mrkdwn_in,omitempty"`
+}
+
+// SlackBlock is a Block Kit layout block (header, section, context or divider)
+type SlackBlock struct {
+	Type     string            `json:"type"`
+	Text     *SlackTextObject  `json:"text,omitempty"`
+	Elements []SlackTextObject `json:"elements,omitempty"`
+}
+
+// SlackTextObject is a Block Kit text object
+type SlackTextObject struct {
+	Type  string `json:"type"` // "plain_text" or "mrkdwn"
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
 }
 
 // SlackClient handles all Slack API interactions
 type SlackClient struct {
-	BotToken   string
-	HTTPClient *http.Client
-	UserCache  map[string]string // Cache for username -> user ID mappings
+	BotToken      string
+	MessageFormat string // "blocks" for Block Kit layouts, "text" for a flat mrkdwn string
+	HTTPClient    *http.Client
+	APIURL        string            // Web API base, replaced by SLACK_API_URL for tests against fake APIs
+	Threads       *SlackThreadCache // Thread roots per conversation; nil disables threading
+	Replies       *ReplyIndex       // Threads whose replies are emailed back; nil without Socket Mode
+
+	UploadAttachments bool                // Upload email attachments next to the message
+	Reports           string              // off, snippet or canvas for bodies of ReportChars or more
+	ReportChars       int                 // Body length from which Reports applies
+	ColorBars         bool                // Wrap messages in an attachment colored by severity
+	SeverityColors    map[Severity]string // Color bar overrides per severity
+	RateLimitRetries  int                 // Retries of API calls answered with 429
+
+	users          *LookupCache // Username -> user ID
+	channelMutex   sync.Mutex   // One conversations.list refresh at a time
+	channels       *LookupCache // Channel name -> channel ID
+	channelsListed time.Time
+	groupMutex     sync.Mutex
+	groups         *LookupCache // User group handle -> subteam ID
+	groupsListed   time.Time
+
+	Coalesce *SlackCoalesceCache // Repeated alerts update the original message; nil disables coalescing
+	Batcher  *SlackBatcher       // Short messages within a window share one post; nil disables batching
+
+	UnfurlLinks *bool // Link previews in posted messages; nil keeps Slack's default
+	UnfurlMedia *bool // Media previews in posted messages; nil keeps Slack's default
+	dmMutex     sync.Mutex
+	dmChannels  *LookupCache // User ID -> DM channel ID opened with conversations.open
 }
 
+// slackMentionIDPattern matches user group (S...) and user (U.../W...) IDs given directly as mentions
+var slackMentionIDPattern = regexp.MustCompile(`^[SUW][A-Z0-9]{6,}$`)
+
 // NewSlackClient creates a new Slack client
-func NewSlackClient(botToken string) *SlackClient {
+func NewSlackClient(botToken, messageFormat string) *SlackClient {
 	return &SlackClient{
-		BotToken: botToken,
+		BotToken:      botToken,
+		MessageFormat: messageFormat,
 		HTTPClient: &http.Client{
 			Timeout: SlackHTTPRequestTimeout,
 		},
-		UserCache: make(map[string]string),
+		APIURL:           SlackAPIURL,
+		RateLimitRetries: DefaultSlackRateRetries,
+		Reports:          SlackReportsOff,
+		ReportChars:      DefaultSlackReportChars,
+		users:            NewLookupCache(CacheSlackUsers, DefaultCacheSize, DefaultSlackUserTTL),
+		channels:         NewLookupCache(CacheSlackChannels, DefaultCacheSize, DefaultSlackChannelTTL),
+		groups:           NewLookupCache(CacheSlackGroups, DefaultCacheSize, DefaultSlackChannelTTL),
+		dmChannels:       NewLookupCache(CacheSlackDMs, DefaultCacheSize, 0),
 	}
 }
 
+// SetCaches replaces the lookup caches with empty ones of the given sizes. Channel names and
+// user group handles are trusted for channelTTL, usernames for userTTL; DM channels never change
+func (sc *SlackClient) SetCaches(sizes map[string]int, channelTTL, userTTL time.Duration) {
+	sc.users = NewLookupCache(CacheSlackUsers, sizes[CacheSlackUsers], userTTL)
+	sc.channels = NewLookupCache(CacheSlackChannels, sizes[CacheSlackChannels], channelTTL)
+	sc.groups = NewLookupCache(CacheSlackGroups, sizes[CacheSlackGroups], channelTTL)
+	sc.dmChannels = NewLookupCache(CacheSlackDMs, sizes[CacheSlackDMs], 0)
+}
+
+// Caches returns the lookup caches, for the cache metrics
+func (sc *SlackClient) Caches() []*LookupCache {
+	return []*LookupCache{sc.users, sc.channels, sc.groups, sc.dmChannels}
+}
+
 // ResolveUserID resolves a username to a User ID, with caching
 func (sc *SlackClient) ResolveUserID(username string) (string, error) {
 	// Check cache first
-	if userID, exists := sc.UserCache[username]; exists {
+	if userID, exists := sc.users.Get(username); exists {
 		log.Printf("Found cached User ID for %s: %s", username, userID)
-		return userID, nil
+		return userID.(string), nil
 	}
 
 	// Look up user via API
-	url := fmt.Sprintf("%s/users.list", SlackAPIURL)
+	url := fmt.Sprintf("%s/users.list", sc.APIURL)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -100,7 +198,7 @@ func (sc *SlackClient) ResolveUserID(username string) (string, error) {
 	var foundUserID string
 	for _, member := range response.Members {
 		// Cache this user
-		sc.UserCache[member.Name] = member.ID
+		sc.users.Set(member.Name, member.ID)
 
 		// Check if this is the user we're looking for
 		if member.Name == username {
@@ -109,30 +207,259 @@ func (sc *SlackClient) ResolveUserID(username string) (string, error) {
 	}
 
 	if foundUserID == "" {
-		return "", fmt.Errorf("user '%s' not found", username)
+		return "", &DestinationNotFoundError{Message: fmt.Sprintf("user '%s' not found", username)}
 	}
+	sc.users.Set(username, foundUserID) // Most recently used, so a full cache keeps it
 
 	log.Printf("Resolved username %s to User ID %s", username, foundUserID)
 	return foundUserID, nil
 }
 
-// SendLongMessageToChannel handles long messages by splitting them into chunks for a specific channel
-func (sc *SlackClient) SendLongMessageToChannel(text, channelID string) error {
-	if len(text) <= SlackMaxMessageLength {
-		return sc.SendMessageToChannel(text, channelID)
+// UserName returns the display name of a user ID for reply attribution, falling back to the real name and handle
+func (sc *SlackClient) UserName(userID string) (string, error) {
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		User  struct {
+			Name    string `json:"name"`
+			Profile struct {
+				DisplayName string `json:"display_name"`
+				RealName    string `json:"real_name"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	if err := sc.callAPI(context.Background(), "GET", "users.info?user="+url.QueryEscape(userID), nil, &response); err != nil {
+		return "", err
+	}
+	if !response.OK {
+		return "", fmt.Errorf("slack API error: %s", response.Error)
+	}
+
+	for _, name := range []string{response.User.Profile.DisplayName, response.User.Profile.RealName, response.User.Name} {
+		if name != "" {
+			return name, nil
+		}
+	}
+	return userID, nil
+}
+
+// ResolveChannelID resolves a channel name (with or without #) to its ID using conversations.list.
+// Names are cached for SLACK_CHANNEL_CACHE_TTL; an unknown name refreshes the cache at most once a minute
+func (sc *SlackClient) ResolveChannelID(name string) (string, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "#"))
+
+	sc.channelMutex.Lock()
+	defer sc.channelMutex.Unlock()
+
+	if channelID, cached := sc.channels.Get(name); cached {
+		return channelID.(string), nil
+	}
+
+	channelID, cached := "", false
+	if stale, expired := sc.channels.Stale(name); expired || time.Since(sc.channelsListed) >= SlackChannelMinRefresh {
+		channels, err := sc.listChannels()
+		if err != nil {
+			// A stale mapping beats failing the delivery while the API is unavailable
+			if expired {
+				log.Printf("Warning: failed to refresh Slack channels, using cached ID for #%s: %v", name, err)
+				return stale.(string), nil
+			}
+			return "", err
+		}
+
+		// The name looked up is cached last, so a cache smaller than the workspace keeps it
+		for channelName, id := range channels {
+			sc.channels.Set(channelName, id)
+		}
+		sc.channelsListed = time.Now()
+		if channelID, cached = channels[name]; cached {
+			sc.channels.Set(name, channelID)
+		} else {
+			sc.channels.Delete(name)
+		}
+	}
+
+	if !cached {
+		return "", &DestinationNotFoundError{Message: fmt.Sprintf("channel '#%s' not found (the bot needs channels:read, and groups:read plus membership for private channels)", name)}
+	}
+
+	log.Printf("Resolved Slack channel #%s to %s", name, channelID)
+	return channelID, nil
+}
+
+// listChannels fetches all non-archived public and private channels visible to the bot
+func (sc *SlackClient) listChannels() (map[string]string, error) {
+	channels := make(map[string]string)
+	cursor := ""
+
+	for {
+		params := url.Values{}
+		params.Set("types", "public_channel,private_channel")
+		params.Set("exclude_archived", "true")
+		params.Set("limit", "1000")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		var response struct {
+			OK       bool   `json:"ok"`
+			Error    string `json:"error,omitempty"`
+			Channels []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"channels"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		if err := sc.callAPI(context.Background(), "GET", "conversations.list?"+params.Encode(), nil, &response); err != nil {
+			return nil, err
+		}
+		if !response.OK {
+			return nil, fmt.Errorf("slack API error: %s", response.Error)
+		}
+
+		for _, channel := range response.Channels {
+			channels[strings.ToLower(channel.Name)] = channel.ID
+		}
+
+		cursor = response.ResponseMetadata.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	log.Printf("Cached %d Slack channels", len(channels))
+	return channels, nil
+}
+
+// ResolveUserGroupID resolves a user group handle (with or without @) to its subteam ID using usergroups.list.
+// Handles are cached like channel names
+func (sc *SlackClient) ResolveUserGroupID(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+
+	sc.groupMutex.Lock()
+	defer sc.groupMutex.Unlock()
+
+	if groupID, cached := sc.groups.Get(handle); cached {
+		return groupID.(string), nil
+	}
+
+	groupID, cached := "", false
+	if stale, expired := sc.groups.Stale(handle); expired || time.Since(sc.groupsListed) >= SlackChannelMinRefresh {
+		var response struct {
+			OK         bool   `json:"ok"`
+			Error      string `json:"error,omitempty"`
+			UserGroups []struct {
+				ID     string `json:"id"`
+				Handle string `json:"handle"`
+			} `json:"usergroups"`
+		}
+		err := sc.callAPI(context.Background(), "GET", "usergroups.list", nil, &response)
+		if err == nil && !response.OK {
+			err = fmt.Errorf("slack API error: %s", response.Error)
+		}
+		if err != nil {
+			if expired {
+				log.Printf("Warning: failed to refresh Slack user groups, using cached ID for @%s: %v", handle, err)
+				return stale.(string), nil
+			}
+			return "", err
+		}
+
+		groups := make(map[string]string)
+		for _, group := range response.UserGroups {
+			groups[strings.ToLower(group.Handle)] = group.ID
+			sc.groups.Set(strings.ToLower(group.Handle), group.ID)
+		}
+		sc.groupsListed = time.Now()
+		if groupID, cached = groups[handle]; cached {
+			sc.groups.Set(handle, groupID)
+		} else {
+			sc.groups.Delete(handle)
+		}
+	}
+
+	if !cached {
+		return "", fmt.Errorf("user group '@%s' not found (the bot needs usergroups:read)", handle)
+	}
+	return groupID, nil
+}
+
+// FormatMentions turns mention names into Slack mention syntax, separated by spaces.
+// here, channel and everyone become special mentions, user groups <!subteam^ID> and users <@ID>.
+// Names that cannot be resolved are kept as escaped text so the message still goes out
+func (sc *SlackClient) FormatMentions(names []string) string {
+	var mentions []string
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		name = strings.TrimLeft(strings.TrimSpace(name), "@!")
+		if name == "" {
+			continue
+		}
+
+		mention := sc.formatMention(name)
+		if !seen[mention] {
+			seen[mention] = true
+			mentions = append(mentions, mention)
+		}
+	}
+
+	return strings.Join(mentions, " ")
+}
+
+// formatMention resolves a single mention name
+func (sc *SlackClient) formatMention(name string) string {
+	switch special := strings.ToLower(name); special {
+	case "here", "channel", "everyone":
+		return "<!" + special + ">"
+	}
+
+	if slackMentionIDPattern.MatchString(name) {
+		if name[0] == 'S' {
+			return "<!subteam^" + name + ">"
+		}
+		return "<@" + name + ">"
+	}
+
+	groupID, groupErr := sc.ResolveUserGroupID(name)
+	if groupErr == nil {
+		return "<!subteam^" + groupID + ">"
+	}
+
+	userID, userErr := sc.ResolveUserID(name)
+	if userErr == nil {
+		return "<@" + userID + ">"
+	}
+
+	log.Printf("Warning: could not resolve Slack mention @%s: %v; %v", name, groupErr, userErr)
+	return "@" + strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(name)
+}
+
+// SendLongMessageToChannel handles long messages by splitting them into chunks for a specific channel.
+// When threadTS is set every chunk is posted as a reply in that thread. It returns the ts of the first message
+func (sc *SlackClient) SendLongMessageToChannel(ctx context.Context, text, channelID, threadTS, color string) (string, error) {
+	chunks := chunkForDestination(ctx, text, SlackMaxMessageLength)
+	if len(chunks) == 1 {
+		return sc.SendMessageToChannel(ctx, chunks[0], channelID, threadTS, color)
 	}
 
-	log.Printf("Message too long (%d chars), splitting into chunks for Slack channel %s", len(text), channelID)
-	chunks := sc.splitMessage(text)
+	log.Printf("Message too long (%d chars), splitting into %d chunks for Slack channel %s", len(text), len(chunks), channelID)
 
+	var firstTS string
 	for i, chunk := range chunks {
 		// Add part number for continuation messages
 		if i > 0 {
 			chunk = fmt.Sprintf("*[Part %d]*\n%s", i+1, chunk)
 		}
 
-		if err := sc.SendMessageToChannel(chunk, channelID); err != nil {
-			return fmt.Errorf("failed to send chunk %d/%d to Slack channel %s: %w", i+1, len(chunks), channelID, err)
+		ts, err := sc.SendMessageToChannel(ctx, chunk, channelID, threadTS, color)
+		if err != nil {
+			return firstTS, fmt.Errorf("failed to send chunk %d/%d to Slack channel %s: %w", i+1, len(chunks), channelID, err)
+		}
+		if i == 0 {
+			firstTS = ts
 		}
 
 		// Add delay between messages to avoid rate limiting
@@ -143,151 +470,439 @@ func (sc *SlackClient) SendLongMessageToChannel(text, channelID string) error {
 	}
 
 	log.Printf("Successfully sent all %d message chunks to Slack channel %s", len(chunks), channelID)
-	return nil
+	return firstTS, nil
 }
 
-// SendMessageToChannel sends a message to a specific Slack channel
-func (sc *SlackClient) SendMessageToChannel(text, channelID string) error {
-	url := fmt.Sprintf("%s/chat.postMessage", SlackAPIURL)
+// SendLongBlocksToChannel sends a Block Kit message, splitting it into several messages
+// when it has more blocks than Slack accepts at once. The text is shown in notifications
+func (sc *SlackClient) SendLongBlocksToChannel(ctx context.Context, text string, blocks []SlackBlock, channelID, threadTS, color string) (string, error) {
+	if len(blocks) <= SlackMaxBlocks {
+		return sc.SendBlocksToChannel(ctx, text, blocks, channelID, threadTS, color)
+	}
 
-	message := SlackMessage{
-		Channel: channelID,
-		Text:    text,
-		AsUser:  true,
+	parts := (len(blocks) + SlackMaxBlocks - 1) / SlackMaxBlocks
+	if budget := messageBudgetFrom(ctx); budget.MaxMessages > 0 && parts > budget.MaxMessages {
+		// Keep what fits and end on a marker in place of the last block
+		parts = budget.MaxMessages
+		blocks = append(blocks[:parts*SlackMaxBlocks-1:parts*SlackMaxBlocks-1], SlackBlock{
+			Type:     "context",
+			Elements: []SlackTextObject{{Type: "mrkdwn", Text: "_[truncated]_"}},
+		})
 	}
+	log.Printf("Message has %d blocks, splitting into %d messages for Slack channel %s", len(blocks), parts, channelID)
 
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+	var firstTS string
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * SlackMaxBlocks
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+
+		ts, err := sc.SendBlocksToChannel(ctx, text, blocks[i*SlackMaxBlocks:end], channelID, threadTS, color)
+		if err != nil {
+			return firstTS, fmt.Errorf("failed to send part %d/%d to Slack channel %s: %w", i+1, parts, channelID, err)
+		}
+		if i == 0 {
+			firstTS = ts
+		}
+
+		// Add delay between messages to avoid rate limiting
+		if i < parts-1 {
+			time.Sleep(SlackMessageSendDelay)
+		}
+	}
+
+	log.Printf("Successfully sent all %d block messages to Slack channel %s", parts, channelID)
+	return firstTS, nil
+}
+
+// SendBlocksToChannel sends a Block Kit message to a specific Slack channel and returns its ts.
+// A non-empty color shows the blocks inside an attachment with that color bar
+func (sc *SlackClient) SendBlocksToChannel(ctx context.Context, text string, blocks []SlackBlock, channelID, threadTS, color string) (string, error) {
+	return sc.postMessage(ctx, withColorBar(SlackMessage{
+		Channel:  channelID,
+		Text:     text,
+		Blocks:   blocks,
+		ThreadTS: threadTS,
+		AsUser:   true,
+	}, color))
+}
+
+// SendMessageToChannel sends a message to a specific Slack channel and returns its ts.
+// A non-empty color shows the text inside an attachment with that color bar
+func (sc *SlackClient) SendMessageToChannel(ctx context.Context, text, channelID, threadTS, color string) (string, error) {
+	return sc.postMessage(ctx, withColorBar(SlackMessage{
+		Channel:  channelID,
+		Text:     text,
+		ThreadTS: threadTS,
+		AsUser:   true,
+	}, color))
+}
+
+// slackUnfurlKey is the context key under which a destination's unfurl override is stored
+type slackUnfurlKey struct{}
+
+// withSlackUnfurl returns a context that turns link and media previews on or off, or leaves
+// the client's settings in place when unfurl is nil
+func withSlackUnfurl(ctx context.Context, unfurl *bool) context.Context {
+	if unfurl == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, slackUnfurlKey{}, unfurl)
+}
+
+// slackUnfurlFrom returns the unfurl override carried by ctx, or nil
+func slackUnfurlFrom(ctx context.Context) *bool {
+	unfurl, _ := ctx.Value(slackUnfurlKey{}).(*bool)
+	return unfurl
+}
+
+// SeverityColor returns the color bar for a severity, preferring configured colors over the defaults
+func (sc *SlackClient) SeverityColor(severity Severity) string {
+	if color, exists := sc.SeverityColors[severity]; exists {
+		return color
 	}
+	return severity.SlackColor()
+}
 
-	log.Printf("Sending message to Slack channel %s (length: %d)", channelID, len(text))
+// withColorBar moves the content of a message into an attachment with the given color bar.
+// Block messages keep their text for notifications; text messages use it as the fallback
+func withColorBar(message SlackMessage, color string) SlackMessage {
+	if color == "" {
+		return message
+	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	attachment := SlackAttachment{Color: color, Fallback: message.Text}
+	if len(message.Blocks) > 0 {
+		attachment.Blocks = message.Blocks
+		message.Blocks = nil
+	} else {
+		attachment.Text = message.Text
+		attachment.MrkdwnIn = []string{"text"}
+		message.Text = ""
+	}
+	message.Attachments = []SlackAttachment{attachment}
+	return message
+}
+
+// postMessage sends a prepared message with chat.postMessage and returns the message timestamp
+func (sc *SlackClient) postMessage(ctx context.Context, message SlackMessage) (string, error) {
+	channelID, err := sc.conversationID(ctx, message.Channel)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", err
+	}
+	message.Channel = channelID
+
+	// A custom name or icon needs the chat:write.customize scope and is ignored when posting as the bot user
+	if identity := senderIdentityFrom(ctx); identity.Name != "" || identity.Icon != "" {
+		message.AsUser = false
+		message.Username = identity.Name
+		if identity.IsEmoji() {
+			message.IconEmoji = identity.Icon
+		} else {
+			message.IconURL = identity.Icon
+		}
 	}
 
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", sc.BotToken))
+	// A destination's unfurl option switches both kinds of previews
+	message.UnfurlLinks, message.UnfurlMedia = sc.UnfurlLinks, sc.UnfurlMedia
+	if unfurl := slackUnfurlFrom(ctx); unfurl != nil {
+		message.UnfurlLinks, message.UnfurlMedia = unfurl, unfurl
+	}
 
-	resp, err := sc.HTTPClient.Do(req)
+	log.Printf("Sending message to Slack channel %s (length: %d, blocks: %d, thread: %s)",
+		message.Channel, len(message.Text), len(message.Blocks), message.ThreadTS)
+
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		TS    string `json:"ts"`
+	}
+	if err := sc.callAPI(ctx, "POST", "chat.postMessage", message, &response); err != nil {
+		return "", err
+	}
+
+	if !response.OK {
+		errorMsg := response.Error
+		if errorMsg == "" {
+			errorMsg = "unknown error"
+		}
+		return "", fmt.Errorf("slack API error: %s", errorMsg)
+	}
+	deliveryReceiptFrom(ctx).recordMessage(response.TS)
+
+	log.Printf("Message sent successfully to Slack channel %s (ts: %s)", message.Channel, response.TS)
+	return response.TS, nil
+}
+
+// UpdateMessage replaces the text and blocks of a posted message with chat.update,
+// keeping them in an attachment when the message has a color bar
+func (sc *SlackClient) UpdateMessage(ctx context.Context, channelID, ts, text string, blocks []SlackBlock, color string) error {
+	channelID, err := sc.conversationID(ctx, channelID)
 	if err != nil {
-		return fmt.Errorf("failed to send HTTP request: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	log.Printf("Updating Slack message %s in channel %s (length: %d, blocks: %d)", ts, channelID, len(text), len(blocks))
+
+	message := withColorBar(SlackMessage{Text: text, Blocks: blocks}, color)
+	update := struct {
+		Channel     string            `json:"channel"`
+		TS          string            `json:"ts"`
+		Text        string            `json:"text"`
+		Blocks      []SlackBlock      `json:"blocks,omitempty"`
+		Attachments []SlackAttachment `json:"attachments,omitempty"`
+	}{channelID, ts, message.Text, message.Blocks, message.Attachments}
+
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+	if err := sc.callAPI(ctx, "POST", "chat.update", update, &response); err != nil {
+		return err
+	}
+	if !response.OK {
+		return fmt.Errorf("slack API error: %s", response.Error)
+	}
+	deliveryReceiptFrom(ctx).recordMessage(ts)
+
+	log.Printf("Message %s updated successfully in Slack channel %s", ts, channelID)
+	return nil
+}
+
+// conversationID returns the channel to post to: user IDs are mapped to their DM channel, which
+// is opened with conversations.open on first use, and anything else is returned unchanged
+func (sc *SlackClient) conversationID(ctx context.Context, target string) (string, error) {
+	if !strings.HasPrefix(target, "U") && !strings.HasPrefix(target, "W") {
+		return target, nil
+	}
+
+	sc.dmMutex.Lock()
+	defer sc.dmMutex.Unlock()
+
+	if channelID, exists := sc.dmChannels.Get(target); exists {
+		return channelID.(string), nil
+	}
+
+	var response struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error,omitempty"`
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+	}
+	if err := sc.callAPI(ctx, "POST", "conversations.open", map[string]string{"users": target}, &response); err != nil {
+		return "", fmt.Errorf("failed to open DM with %s: %w", target, err)
+	}
+	if !response.OK {
+		return "", fmt.Errorf("failed to open DM with %s: slack API error: %s", target, response.Error)
+	}
+
+	log.Printf("Opened Slack DM channel %s for user %s", response.Channel.ID, target)
+	sc.dmChannels.Set(target, response.Channel.ID)
+	return response.Channel.ID, nil
+}
+
+// UploadFileToChannel uploads a file to a channel using the external upload flow
+// (files.getUploadURLExternal, upload, files.completeUploadExternal). When threadTS is set
+// the file is shared as a reply in that thread
+func (sc *SlackClient) UploadFileToChannel(ctx context.Context, filename string, data []byte, title, channelID, threadTS string) error {
+	// Step 1: reserve an upload URL
+	params := url.Values{}
+	params.Set("filename", filename)
+	params.Set("length", strconv.Itoa(len(data)))
+
+	var uploadTarget struct {
+		OK        bool   `json:"ok"`
+		Error     string `json:"error,omitempty"`
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	if err := sc.callAPI(ctx, "GET", "files.getUploadURLExternal?"+params.Encode(), nil, &uploadTarget); err != nil {
+		return err
+	}
+	if !uploadTarget.OK {
+		return fmt.Errorf("slack API error: %s", uploadTarget.Error)
+	}
+
+	log.Printf("Uploading %s to Slack (size: %d)", filename, len(data))
+
+	// Step 2: send the file content
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadTarget.UploadURL, bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/octet-stream")
 
+	resp, err := sc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(body))
+		return fmt.Errorf("slack file upload error: %d", resp.StatusCode)
 	}
 
-	// Parse response to check for Slack-specific errors
-	var response map[string]interface{}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	// Step 3: share the file in the channel
+	channelID, err = sc.conversationID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	completion := map[string]interface{}{
+		"files":      []map[string]string{{"id": uploadTarget.FileID, "title": title}},
+		"channel_id": channelID,
+	}
+	if threadTS != "" {
+		completion["thread_ts"] = threadTS
 	}
 
-	if ok, exists := response["ok"].(bool); !exists || !ok {
-		errorMsg := "unknown error"
-		if errField, exists := response["error"].(string); exists {
-			errorMsg = errField
-		}
-		return fmt.Errorf("slack API error: %s", errorMsg)
+	var completed struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+	if err := sc.callAPI(ctx, "POST", "files.completeUploadExternal", completion, &completed); err != nil {
+		return err
+	}
+	if !completed.OK {
+		return fmt.Errorf("slack API error: %s", completed.Error)
 	}
 
-	log.Printf("Message sent successfully to Slack channel %s", channelID)
+	log.Printf("File %s shared successfully to Slack channel %s", filename, channelID)
 	return nil
 }
 
-// splitMessage splits a message into chunks that fit within Slack's limits
-func (sc *SlackClient) splitMessage(text string) []string {
-	var chunks []string
-	lines := strings.Split(text, "\n")
-	var currentChunk strings.Builder
-
-	for _, line := range lines {
-		// Check if adding this line would exceed the limit
-		if currentChunk.Len()+len(line)+1 > SlackMaxMessageLength {
-			// Save current chunk if it has content
-			if currentChunk.Len() > 0 {
-				chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
-				currentChunk.Reset()
-			}
+// CreateCanvas creates a standalone canvas from markdown, lets the members of a channel read it
+// and returns its link. The bot needs the canvases:write and files:read scopes
+func (sc *SlackClient) CreateCanvas(ctx context.Context, title, markdown, channelID string) (string, error) {
+	var created struct {
+		OK       bool   `json:"ok"`
+		Error    string `json:"error,omitempty"`
+		CanvasID string `json:"canvas_id"`
+	}
+	request := map[string]interface{}{
+		"title":            title,
+		"document_content": map[string]string{"type": "markdown", "markdown": markdown},
+	}
+	if err := sc.callAPI(ctx, "POST", "canvases.create", request, &created); err != nil {
+		return "", err
+	}
+	if !created.OK {
+		return "", fmt.Errorf("slack API error: %s", created.Error)
+	}
 
-			// Handle very long lines by wrapping them
-			if len(line) > SlackMaxMessageLength-100 {
-				wrappedLines := sc.wrapLongLine(line, SlackMaxMessageLength-100)
-				for j, wrappedLine := range wrappedLines {
-					if j == 0 && currentChunk.Len() == 0 {
-						// First wrapped line can go in current chunk
-						currentChunk.WriteString(wrappedLine)
-					} else {
-						// Additional wrapped lines become separate chunks
-						if currentChunk.Len() > 0 {
-							chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
-							currentChunk.Reset()
-						}
-						currentChunk.WriteString(wrappedLine)
-					}
-				}
-			} else {
-				currentChunk.WriteString(line)
-			}
-		} else {
-			// Add line to current chunk
-			if currentChunk.Len() > 0 {
-				currentChunk.WriteString("\n")
-			}
-			currentChunk.WriteString(line)
-		}
+	channelID, err := sc.conversationID(ctx, channelID)
+	if err != nil {
+		return "", err
+	}
+	var shared struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+	access := map[string]interface{}{"canvas_id": created.CanvasID, "access_level": "read", "channel_ids": []string{channelID}}
+	if err := sc.callAPI(ctx, "POST", "canvases.access.set", access, &shared); err != nil {
+		return "", err
+	}
+	if !shared.OK {
+		return "", fmt.Errorf("slack API error: %s", shared.Error)
 	}
 
-	// Don't forget the last chunk
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+	// Canvases are files, so their link comes from files.info
+	var info struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		File  struct {
+			Permalink string `json:"permalink"`
+		} `json:"file"`
 	}
+	if err := sc.callAPI(ctx, "GET", "files.info?file="+url.QueryEscape(created.CanvasID), nil, &info); err != nil {
+		return "", err
+	}
+	if !info.OK || info.File.Permalink == "" {
+		return "", fmt.Errorf("slack API error: no link to canvas %s: %s", created.CanvasID, info.Error)
+	}
+
+	log.Printf("Created Slack canvas %s for channel %s", created.CanvasID, channelID)
+	return info.File.Permalink, nil
+}
 
-	return chunks
+// callAPI performs an authenticated Web API call, sending payload as JSON and decoding the reply into result.
+// Rate-limited calls (429) are retried after the Retry-After delay Slack asks for
+func (sc *SlackClient) callAPI(ctx context.Context, method, endpoint string, payload interface{}, result interface{}) error {
+	return sc.callAPIWithToken(ctx, sc.BotToken, method, endpoint, payload, result)
 }
 
-// wrapLongLine wraps a single long line into multiple lines
-func (sc *SlackClient) wrapLongLine(line string, maxLength int) []string {
-	var wrapped []string
+// callAPIWithToken calls a Web API method authenticated with the given token, e.g. an app-level token
+func (sc *SlackClient) callAPIWithToken(ctx context.Context, token, method, endpoint string, payload interface{}, result interface{}) error {
+	var jsonData []byte
+	if payload != nil {
+		var err error
+		jsonData, err = json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(jsonData)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", sc.APIURL, endpoint), body)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+		resp, err := sc.HTTPClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send HTTP request: %w", err)
+		}
 
-	for len(line) > maxLength {
-		// Try to break at a space near the limit
-		breakPoint := maxLength
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
 
-		// Look for a space within the last 50 characters
-		for i := maxLength - 1; i >= maxLength-50 && i >= 0; i-- {
-			if line[i] == ' ' {
-				breakPoint = i
-				break
+		if resp.StatusCode == http.StatusTooManyRequests {
+			delay := slackRetryAfter(resp.Header.Get("Retry-After"))
+			if attempt >= sc.RateLimitRetries {
+				return fmt.Errorf("slack API rate limited on %s after %d retries", endpoint, attempt)
+			}
+			if delay > SlackMaxRetryAfter {
+				return fmt.Errorf("slack API rate limited on %s for %s, longer than the %s we wait", endpoint, delay, SlackMaxRetryAfter)
 			}
+
+			log.Printf("Slack API rate limited on %s, retrying in %s (retry %d/%d)", endpoint, delay, attempt+1, sc.RateLimitRetries)
+			deliveryReceiptFrom(ctx).recordRetry()
+			time.Sleep(delay)
+			continue
 		}
 
-		// Extract the chunk
-		chunk := line[:breakPoint]
-		wrapped = append(wrapped, chunk)
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("slack API error: %d - %s", resp.StatusCode, string(respBody))
+		}
 
-		// Update remaining line
-		line = line[breakPoint:]
-		if len(line) > 0 && line[0] == ' ' {
-			line = line[1:] // Remove leading space
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
 		}
-	}
 
-	// Add remaining text
-	if len(line) > 0 {
-		wrapped = append(wrapped, line)
+		return nil
 	}
+}
 
-	return wrapped
+// slackRetryAfter parses the Retry-After header (in seconds), defaulting to one second
+func slackRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds < 1 {
+		return time.Second
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // TestConnection validates the bot token by checking auth test
@@ -297,7 +912,7 @@ func (sc *SlackClient) TestConnection() error {
 
 // GetBotInfo retrieves information about the bot (useful for debugging)
 func (sc *SlackClient) GetBotInfo() error {
-	url := fmt.Sprintf("%s/auth.test", SlackAPIURL)
+	url := fmt.Sprintf("%s/auth.test", sc.APIURL)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -0,0 +1,128 @@
+//go:build minimal || noslack
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+func init() {
+	excludeFeature("slack", "noslack")
+}
+
+// Slack Configuration
+const (
+	SlackAPIURL             = "https://slack.com/api"
+	DefaultSlackRateRetries = 3
+	DefaultSlackChannelTTL  = 10 * time.Minute
+	DefaultSlackUserTTL     = 24 * time.Hour
+	MaxSlackBatchWindow     = 30 * time.Second
+)
+
+// SlackClient is a placeholder for builds without Slack support
+type SlackClient struct {
+	MessageFormat     string
+	HTTPClient        *http.Client
+	APIURL            string
+	Threads           *SlackThreadCache
+	UploadAttachments bool
+	Reports           string
+	ReportChars       int
+	ColorBars         bool
+	SeverityColors    map[Severity]string
+	RateLimitRetries  int
+	Coalesce          *SlackCoalesceCache
+	Batcher           *SlackBatcher
+	UnfurlLinks       *bool
+	UnfurlMedia       *bool
+}
+
+// SlackCoalesceCache is a placeholder for builds without Slack support
+type SlackCoalesceCache struct{}
+
+// NewSlackCoalesceCache creates a placeholder cache that is never consulted
+func NewSlackCoalesceCache(window time.Duration) *SlackCoalesceCache {
+	return &SlackCoalesceCache{}
+}
+
+// saveState implements persistentCache with an empty cache
+func (c *SlackCoalesceCache) saveState() (json.RawMessage, error) {
+	return json.RawMessage("{}"), nil
+}
+
+// loadState implements persistentCache by ignoring the saved alerts
+func (c *SlackCoalesceCache) loadState(data json.RawMessage) error {
+	return nil
+}
+
+// SlackBatcher is a placeholder for builds without Slack support
+type SlackBatcher struct{}
+
+// NewSlackBatcher creates a placeholder batcher that is never consulted
+func NewSlackBatcher(client *SlackClient, window time.Duration) *SlackBatcher {
+	return &SlackBatcher{}
+}
+
+// NewSlackClient creates a placeholder client whose calls all fail
+func NewSlackClient(botToken, messageFormat string) *SlackClient {
+	return &SlackClient{MessageFormat: messageFormat, HTTPClient: &http.Client{}}
+}
+
+// SetCaches does nothing; builds without Slack support have no lookup caches
+func (sc *SlackClient) SetCaches(sizes map[string]int, channelTTL, userTTL time.Duration) {}
+
+// Caches returns no lookup caches
+func (sc *SlackClient) Caches() []*LookupCache {
+	return nil
+}
+
+// TestConnection reports that Slack support was compiled out
+func (sc *SlackClient) TestConnection() error {
+	return requireFeature("slack")
+}
+
+// GetBotInfo reports that Slack support was compiled out
+func (sc *SlackClient) GetBotInfo() error {
+	return requireFeature("slack")
+}
+
+// SlackReplyBridge is a placeholder for builds without Slack support
+type SlackReplyBridge struct{}
+
+// NewSlackReplyBridge creates a placeholder bridge that never connects
+func NewSlackReplyBridge(appToken string, slackClient *SlackClient, relay *SMTPRelay, ttl time.Duration, history *AlertHistory) *SlackReplyBridge {
+	return &SlackReplyBridge{}
+}
+
+// Start reports that Slack support was compiled out
+func (b *SlackReplyBridge) Start() error {
+	return requireFeature("slack")
+}
+
+// Stop does nothing without Slack support
+func (b *SlackReplyBridge) Stop() error {
+	return nil
+}
+
+// sendToSlack reports that Slack support was compiled out
+func (ep *EmailProcessor) sendToSlack(ctx context.Context, email *ProcessedEmail, message, platform, userID string, options DestinationOptions) error {
+	return requireFeature("slack")
+}
+
+// slackHistoryChat returns no chat without Slack support
+func (ep *EmailProcessor) slackHistoryChat(userID string) string {
+	return ""
+}
+
+// verifySlackDestination reports that Slack support was compiled out
+func (ep *EmailProcessor) verifySlackDestination(ctx context.Context, userID string) error {
+	return requireFeature("slack")
+}
+
+// sendOriginalToSlack reports that Slack support was compiled out
+func (ep *EmailProcessor) sendOriginalToSlack(ctx context.Context, filename string, data []byte, email *ProcessedEmail, userID string) error {
+	return requireFeature("slack")
+}
@@ -0,0 +1,138 @@
+//go:build !minimal && !noslack
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slack Batching Configuration
+const (
+	SlackBatchMaxLength   = 1000             // Longer messages are always posted on their own
+	SlackBatchMaxMessages = 8                // Messages per combined post; a full batch is posted at once
+	SlackBatchSeparator   = "\n\n───\n\n"    // Separates messages in combined text posts
+	MaxSlackBatchWindow   = 30 * time.Second // Senders wait for the window, so it must stay short
+)
+
+// slackBatch collects short messages for one channel until its window closes
+type slackBatch struct {
+	channelID string
+	color     string
+	identity  SenderIdentity
+	unfurl    *bool
+	texts     []string
+	blocks    [][]SlackBlock // Per message, nil for text layouts
+	timer     *time.Timer
+
+	done chan struct{} // Closed once the batch is posted
+	ts   string
+	err  error
+}
+
+// SlackBatcher combines short messages sent to the same channel within a small window into a
+// single post, so an alert storm costs one API call and one message instead of dozens
+type SlackBatcher struct {
+	Window      time.Duration
+	MaxMessages int
+
+	client  *SlackClient
+	mutex   sync.Mutex
+	pending map[string]*slackBatch
+}
+
+// NewSlackBatcher creates a batcher that posts through client
+func NewSlackBatcher(client *SlackClient, window time.Duration) *SlackBatcher {
+	return &SlackBatcher{
+		Window:      window,
+		MaxMessages: SlackBatchMaxMessages,
+		client:      client,
+		pending:     make(map[string]*slackBatch),
+	}
+}
+
+// Accepts reports whether a message is short enough to share a post with others,
+// including under the destination's own message size limit
+func (b *SlackBatcher) Accepts(ctx context.Context, text string, blocks []SlackBlock) bool {
+	return len(chunkForDestination(ctx, text, SlackBatchMaxLength)) == 1 &&
+		len(text) <= SlackBatchMaxLength && len(blocks) < SlackMaxBlocks/b.MaxMessages
+}
+
+// Send queues a message for the channel and waits until its batch is posted. It returns the ts
+// of the post and whether the post combined several messages
+func (b *SlackBatcher) Send(ctx context.Context, channelID, text string, blocks []SlackBlock, color string) (string, bool, error) {
+	// Only messages that look alike share a post
+	identity := senderIdentityFrom(ctx)
+	unfurl := slackUnfurlFrom(ctx)
+	layout := "text"
+	if blocks != nil {
+		layout = "blocks"
+	}
+	if unfurl != nil {
+		layout += fmt.Sprintf(" unfurl=%t", *unfurl)
+	}
+	key := strings.Join([]string{channelID, layout, color, identity.Name, identity.Icon}, "|")
+
+	b.mutex.Lock()
+	batch := b.pending[key]
+	if batch == nil {
+		batch = &slackBatch{channelID: channelID, color: color, identity: identity, unfurl: unfurl, done: make(chan struct{})}
+		b.pending[key] = batch
+		batch.timer = time.AfterFunc(b.Window, func() { b.flush(key, batch) })
+	}
+	batch.texts = append(batch.texts, text)
+	batch.blocks = append(batch.blocks, blocks)
+	full := len(batch.texts) >= b.MaxMessages
+	if full {
+		// Later messages start a new batch
+		delete(b.pending, key)
+	}
+	b.mutex.Unlock()
+
+	if full && batch.timer.Stop() {
+		go b.flush(key, batch)
+	}
+
+	// The batch no longer changes once it is posted
+	<-batch.done
+	if batch.err == nil {
+		deliveryReceiptFrom(ctx).recordMessage(batch.ts)
+	}
+	return batch.ts, len(batch.texts) > 1, batch.err
+}
+
+// flush posts a batch, combining its messages when it holds more than one
+func (b *SlackBatcher) flush(key string, batch *slackBatch) {
+	b.mutex.Lock()
+	if b.pending[key] == batch {
+		delete(b.pending, key)
+	}
+	texts, messageBlocks := batch.texts, batch.blocks
+	b.mutex.Unlock()
+
+	// Waiters record the post in their own receipts
+	ctx := withSlackUnfurl(withSenderIdentity(context.Background(), batch.identity), batch.unfurl)
+
+	if len(texts) > 1 {
+		log.Printf("Combining %d messages into one Slack post to channel %s", len(texts), batch.channelID)
+	}
+
+	text := strings.Join(texts, SlackBatchSeparator)
+	if messageBlocks[0] == nil {
+		batch.ts, batch.err = b.client.SendMessageToChannel(ctx, text, batch.channelID, "", batch.color)
+	} else {
+		var blocks []SlackBlock
+		for i, part := range messageBlocks {
+			if i > 0 {
+				blocks = append(blocks, SlackBlock{Type: "divider"})
+			}
+			blocks = append(blocks, part...)
+		}
+		batch.ts, batch.err = b.client.SendBlocksToChannel(ctx, text, blocks, batch.channelID, "", batch.color)
+	}
+	close(batch.done)
+}
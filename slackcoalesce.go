@@ -0,0 +1,202 @@
+//go:build !minimal && !noslack
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slack Coalescing Configuration
+const (
+	SlackCoalesceMaxLen     = 1000 // Alerts tracked before the oldest are evicted
+	SlackCoalesceTimeFormat = "2006-01-02 15:04:05 MST"
+)
+
+// slackCoalesceEntry is an alert posted to Slack that repeats are folded into
+type slackCoalesceEntry struct {
+	channelID string
+	ts        string
+	text      string       // Text of the first posted message, restored on every update
+	blocks    []SlackBlock // Blocks of the first posted message, nil for text layouts
+	color     string       // Color bar of the posted message, "" for none
+	count     int
+	lastSeen  time.Time
+	expires   time.Time
+}
+
+// SlackCoalesceCache tracks recently posted alerts by channel, sender and subject, so identical
+// alerts within the window update the original message with a counter instead of flooding the channel
+type SlackCoalesceCache struct {
+	Window     time.Duration // Counted from the original message; later repeats start a new one
+	MaxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]*slackCoalesceEntry
+}
+
+// NewSlackCoalesceCache creates a new coalescing cache
+func NewSlackCoalesceCache(window time.Duration) *SlackCoalesceCache {
+	return &SlackCoalesceCache{
+		Window:     window,
+		MaxEntries: SlackCoalesceMaxLen,
+		entries:    make(map[string]*slackCoalesceEntry),
+	}
+}
+
+// coalesceKey identifies identical alerts: same channel, sender and subject
+func coalesceKey(channelID string, email *ProcessedEmail) string {
+	return channelID + "|" + strings.ToLower(email.From) + "|" + normalizeThreadSubject(email.Subject)
+}
+
+// Repeat counts the email against an identical alert still inside the window and returns
+// a snapshot of the updated entry, or false if the email should be posted as a new message
+func (c *SlackCoalesceCache) Repeat(channelID string, email *ProcessedEmail) (slackCoalesceEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	entry, exists := c.entries[coalesceKey(channelID, email)]
+	if !exists || !now.Before(entry.expires) {
+		return slackCoalesceEntry{}, false
+	}
+
+	entry.count++
+	entry.lastSeen = now
+	return *entry, true
+}
+
+// Remember records a newly posted alert so repeats within the window can update it
+func (c *SlackCoalesceCache) Remember(channelID string, email *ProcessedEmail, ts, text string, blocks []SlackBlock, color string) {
+	if ts == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.MaxEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+
+	// Still full: drop the entry closest to expiry
+	if len(c.entries) >= c.MaxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = key, entry.expires
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+
+	c.entries[coalesceKey(channelID, email)] = &slackCoalesceEntry{
+		channelID: channelID,
+		ts:        ts,
+		text:      text,
+		blocks:    blocks,
+		color:     color,
+		count:     1,
+		lastSeen:  now,
+		expires:   now.Add(c.Window),
+	}
+}
+
+// persistedCoalesceEntry is a coalesced alert as stored in the state file
+type persistedCoalesceEntry struct {
+	ChannelID string       `json:"channel_id"`
+	TS        string       `json:"ts"`
+	Text      string       `json:"text"`
+	Blocks    []SlackBlock `json:"blocks,omitempty"`
+	Color     string       `json:"color,omitempty"`
+	Count     int          `json:"count"`
+	LastSeen  time.Time    `json:"last_seen"`
+	Expires   time.Time    `json:"expires"`
+}
+
+// saveState implements persistentCache, keeping only alerts still inside their window
+func (c *SlackCoalesceCache) saveState() (json.RawMessage, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	entries := make(map[string]persistedCoalesceEntry, len(c.entries))
+	for key, entry := range c.entries {
+		if now.Before(entry.expires) {
+			entries[key] = persistedCoalesceEntry{
+				ChannelID: entry.channelID,
+				TS:        entry.ts,
+				Text:      entry.text,
+				Blocks:    entry.blocks,
+				Color:     entry.color,
+				Count:     entry.count,
+				LastSeen:  entry.lastSeen,
+				Expires:   entry.expires,
+			}
+		}
+	}
+	return json.Marshal(entries)
+}
+
+// loadState implements persistentCache, skipping alerts whose window closed while the bridge was down
+func (c *SlackCoalesceCache) loadState(data json.RawMessage) error {
+	var entries map[string]persistedCoalesceEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, entry := range entries {
+		if len(c.entries) >= c.MaxEntries {
+			break
+		}
+		if now.Before(entry.Expires) {
+			c.entries[key] = &slackCoalesceEntry{
+				channelID: entry.ChannelID,
+				ts:        entry.TS,
+				text:      entry.Text,
+				blocks:    entry.Blocks,
+				color:     entry.Color,
+				count:     entry.Count,
+				lastSeen:  entry.LastSeen,
+				expires:   entry.Expires,
+			}
+		}
+	}
+	return nil
+}
+
+// counterText describes how often the alert was seen
+func (e slackCoalesceEntry) counterText() string {
+	return fmt.Sprintf("Seen %d times, last at %s", e.count, e.lastSeen.Format(SlackCoalesceTimeFormat))
+}
+
+// updatedMessage returns the original text and blocks with the repeat counter added
+func (e slackCoalesceEntry) updatedMessage() (string, []SlackBlock) {
+	text := e.text + "\n\n_" + e.counterText() + "_"
+	if e.blocks == nil {
+		return text, nil
+	}
+
+	blocks := e.blocks
+	if len(blocks) >= SlackMaxBlocks {
+		blocks = blocks[:SlackMaxBlocks-1]
+	}
+	blocks = append(blocks[:len(blocks):len(blocks)], SlackBlock{
+		Type:     "context",
+		Elements: []SlackTextObject{{Type: "mrkdwn", Text: ":repeat: " + e.counterText()}},
+	})
+	return text, blocks
+}
@@ -0,0 +1,330 @@
+//go:build !minimal && !noslack
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// sendToSlack posts the message to a user or channel, threading follow-ups and uploading attachments when enabled
+func (ep *EmailProcessor) sendToSlack(ctx context.Context, email *ProcessedEmail, message, platform, userID string, options DestinationOptions) error {
+	resolvedID, err := ep.resolveSlackDestination(userID)
+	if err != nil {
+		return err
+	}
+	unfurl, err := parseSwitchOption(options, "unfurl")
+	if err != nil {
+		return err
+	}
+	ctx = withSlackUnfurl(ctx, unfurl)
+
+	// Huge reports go to a snippet or canvas behind a short message, keeping the channel readable
+	report, err := ep.slackReportMode(email, options)
+	if err != nil {
+		return err
+	}
+	switch report {
+	case SlackReportsCanvas:
+		link, err := ep.SlackClient.CreateCanvas(ctx, email.Subject, slackReportCanvas(email), resolvedID)
+		if err != nil {
+			log.Printf("Warning: failed to create Slack canvas for report, posting it in full: %v", err)
+			report = SlackReportsOff
+			break
+		}
+		message = slackReportMessage(email, link)
+	case SlackReportsSnippet:
+		message = slackReportMessage(email, "")
+	}
+
+	// Mentions go first so they show up in the notification preview
+	mention := ep.SlackClient.FormatMentions(ep.slackMentions(email, options))
+	if mention != "" {
+		message = mention + "\n" + message
+	}
+
+	// Fold a repeat of a recent identical alert into the original message. Encrypted alerts all
+	// look alike, so they are neither folded nor threaded. Pages always get a message of their own
+	if ep.SlackClient.Coalesce != nil && !email.Encrypted && !email.Page {
+		if repeat, ok := ep.SlackClient.Coalesce.Repeat(resolvedID, email); ok {
+			text, blocks := repeat.updatedMessage()
+			err := ep.SlackClient.UpdateMessage(ctx, repeat.channelID, repeat.ts, text, blocks, repeat.color)
+			if err == nil {
+				return nil
+			}
+			log.Printf("Warning: failed to update repeated Slack alert, posting it instead: %v", err)
+		}
+	}
+
+	// Continue an earlier conversation as a thread reply when threading is enabled
+	var threadTS string
+	if ep.SlackClient.Threads != nil && !email.Encrypted && !email.Page {
+		threadTS = ep.SlackClient.Threads.Lookup(resolvedID, email)
+	}
+
+	// The color bar shows the severity at a glance
+	var color string
+	if ep.SlackClient.ColorBars {
+		color = ep.SlackClient.SeverityColor(email.Severity)
+	}
+
+	var blocks []SlackBlock
+	if ep.SlackClient.MessageFormat == "blocks" && !options.Has("raw") && !email.Encrypted && report == SlackReportsOff {
+		blocks = ep.buildSlackBlocks(email, ep.renderTitle(email, platform, userID), mention)
+	}
+
+	// Short new messages may share a post with others sent to the channel at the same time
+	var ts string
+	var combined bool
+	batcher := ep.SlackClient.Batcher
+	switch {
+	case batcher != nil && threadTS == "" && !email.Page && batcher.Accepts(ctx, message, blocks):
+		ts, combined, err = batcher.Send(ctx, resolvedID, message, blocks, color)
+	case blocks != nil:
+		ts, err = ep.SlackClient.SendLongBlocksToChannel(ctx, message, blocks, resolvedID, threadTS, color)
+	default:
+		ts, err = ep.SlackClient.SendLongMessageToChannel(ctx, message, resolvedID, threadTS, color)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A combined post belongs to no single alert, so it is not updated, threaded or replied to
+	if combined {
+		if report == SlackReportsSnippet {
+			ep.uploadSlackReport(ctx, email, resolvedID, ts)
+		}
+		if ep.SlackClient.UploadAttachments {
+			ep.uploadSlackAttachments(ctx, email, resolvedID, ts)
+		}
+		return nil
+	}
+
+	// Only the first message of a split alert is updated by repeats
+	if ep.SlackClient.Coalesce != nil && !email.Encrypted {
+		text := chunkForDestination(ctx, message, SlackMaxMessageLength)[0]
+		if len(blocks) > SlackMaxBlocks {
+			blocks = blocks[:SlackMaxBlocks]
+		}
+		ep.SlackClient.Coalesce.Remember(resolvedID, email, ts, text, blocks, color)
+	}
+
+	if threadTS == "" {
+		threadTS = ts
+	}
+	if ep.SlackClient.Threads != nil && !email.Encrypted {
+		ep.SlackClient.Threads.Remember(resolvedID, email, threadTS)
+	}
+	if ep.SlackClient.Replies != nil {
+		replyFrom, err := parseReplyAddress(options)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		ep.SlackClient.Replies.Remember(threadTS, email, replyFrom)
+	}
+
+	if report == SlackReportsSnippet {
+		ep.uploadSlackReport(ctx, email, resolvedID, threadTS)
+	}
+	if ep.SlackClient.UploadAttachments {
+		ep.uploadSlackAttachments(ctx, email, resolvedID, threadTS)
+	}
+	return nil
+}
+
+// slackReportMode returns how a body is posted: off in full, or as a snippet or canvas when it
+// has at least SLACK_REPORT_MIN_CHARS characters. The report option overrides SLACK_REPORTS
+func (ep *EmailProcessor) slackReportMode(email *ProcessedEmail, options DestinationOptions) (string, error) {
+	mode, err := slackReportOption(options)
+	if err != nil {
+		return "", err
+	}
+	if mode == "" {
+		mode = ep.SlackClient.Reports
+	}
+	if mode == "" || len(email.Body) < ep.SlackClient.ReportChars {
+		return SlackReportsOff, nil
+	}
+	return mode, nil
+}
+
+// uploadSlackReport uploads the body of a report as a snippet in the thread of the message
+// announcing it. The message is already delivered, so a failed upload is logged
+func (ep *EmailProcessor) uploadSlackReport(ctx context.Context, email *ProcessedEmail, channelID, threadTS string) {
+	title := email.Subject
+	if title == "" {
+		title = "Report"
+	}
+	if err := ep.SlackClient.UploadFileToChannel(ctx, slackReportFilename(email), []byte(email.Body), title, channelID, threadTS); err != nil {
+		log.Printf("Warning: failed to upload report to Slack: %v", err)
+	}
+}
+
+// sendOriginalToSlack uploads the raw message next to the posted message
+func (ep *EmailProcessor) sendOriginalToSlack(ctx context.Context, filename string, data []byte, email *ProcessedEmail, userID string) error {
+	channelID, err := ep.resolveSlackDestination(userID)
+	if err != nil {
+		return err
+	}
+	// Keep the original next to the message when it was threaded
+	var threadTS string
+	if ep.SlackClient.Threads != nil {
+		threadTS = ep.SlackClient.Threads.Lookup(channelID, email)
+	}
+	return ep.SlackClient.UploadFileToChannel(ctx, filename, data, email.Subject, channelID, threadTS)
+}
+
+// resolveSlackDestination resolves a username to a User ID if needed
+func (ep *EmailProcessor) resolveSlackDestination(userID string) (string, error) {
+	if strings.HasPrefix(userID, "U") || strings.HasPrefix(userID, "C") {
+		return userID, nil
+	}
+
+	// Channel names are only accepted by chat.postMessage in limited cases, so look up the ID
+	if strings.HasPrefix(userID, "#") {
+		channelID, err := ep.SlackClient.ResolveChannelID(userID)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve channel '%s': %w", userID, err)
+		}
+		return channelID, nil
+	}
+
+	// This looks like a username, try to resolve it
+	log.Printf("Attempting to resolve Slack username '%s' to User ID", userID)
+	resolvedID, err := ep.SlackClient.ResolveUserID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve username '%s': %w", userID, err)
+	}
+	log.Printf("Resolved username '%s' to User ID '%s'", userID, resolvedID)
+	return resolvedID, nil
+}
+
+// slackHistoryChat returns the channel or user ID a destination was resolved to, or "" if it cannot be
+func (ep *EmailProcessor) slackHistoryChat(userID string) string {
+	resolvedID, err := ep.resolveSlackDestination(userID)
+	if err != nil {
+		return ""
+	}
+	return resolvedID
+}
+
+// verifySlackDestination checks that a user or channel exists with users.info or conversations.info,
+// resolving names first. Private channels the bot is not in are not found
+func (ep *EmailProcessor) verifySlackDestination(ctx context.Context, userID string) error {
+	resolvedID, err := ep.resolveSlackDestination(userID)
+	if err != nil {
+		return err
+	}
+
+	method, param, notFound := "conversations.info", "channel", "channel_not_found"
+	if strings.HasPrefix(resolvedID, "U") || strings.HasPrefix(resolvedID, "W") {
+		method, param, notFound = "users.info", "user", "user_not_found"
+	}
+
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+	if err := ep.SlackClient.callAPI(ctx, "GET", method+"?"+param+"="+url.QueryEscape(resolvedID), nil, &response); err != nil {
+		return err
+	}
+	if response.Error == notFound {
+		return &DestinationNotFoundError{Message: fmt.Sprintf("slack %s %s: %s", param, userID, response.Error)}
+	}
+	if !response.OK {
+		return fmt.Errorf("slack API error: %s", response.Error)
+	}
+	return nil
+}
+
+// uploadSlackAttachments shares the email's attachments in the thread of the posted message.
+// The message is already delivered, so failed uploads are logged rather than returned
+func (ep *EmailProcessor) uploadSlackAttachments(ctx context.Context, email *ProcessedEmail, channelID, threadTS string) {
+	attachments := email.Attachments
+	if len(attachments) > SlackMaxUploads {
+		log.Printf("Warning: email has %d attachments, uploading the first %d to Slack", len(attachments), SlackMaxUploads)
+		attachments = attachments[:SlackMaxUploads]
+	}
+
+	for _, attachment := range attachments {
+		if attachment.Size == 0 {
+			continue
+		}
+		data, err := attachment.Content()
+		if err != nil {
+			log.Printf("Warning: failed to upload attachment %s to Slack: %v", attachment.Filename, err)
+			continue
+		}
+		if err := ep.SlackClient.UploadFileToChannel(ctx, attachment.Filename, data, attachment.Filename, channelID, threadTS); err != nil {
+			log.Printf("Warning: failed to upload attachment %s to Slack: %v", attachment.Filename, err)
+		}
+	}
+}
+
+// buildSlackBlocks lays the processed email out as Block Kit blocks: a header with the title,
+// a context line with the envelope fields and the body split across section blocks
+func (ep *EmailProcessor) buildSlackBlocks(email *ProcessedEmail, title, mention string) []SlackBlock {
+	header := email.Severity.SlackEmoji() + " " + title
+	if runes := []rune(header); len(runes) > SlackMaxHeaderText {
+		header = string(runes[:SlackMaxHeaderText-3]) + "..."
+	}
+
+	blocks := []SlackBlock{
+		{
+			Type: "header",
+			Text: &SlackTextObject{Type: "plain_text", Text: header, Emoji: true},
+		},
+		{
+			Type: "context",
+			Elements: []SlackTextObject{
+				{Type: "mrkdwn", Text: "*From:* " + ep.escapeSlackText(senderDisplay(email))},
+				{Type: "mrkdwn", Text: "*To:* " + ep.escapeSlackText(email.To)},
+				{Type: "mrkdwn", Text: "*Date:* " + ep.escapeSlackText(email.Date)},
+			},
+		},
+		{Type: "divider"},
+	}
+
+	// Header blocks are plain text, so mentions get their own section
+	if mention != "" {
+		blocks = append(blocks[:1], append([]SlackBlock{{
+			Type: "section",
+			Text: &SlackTextObject{Type: "mrkdwn", Text: mention},
+		}}, blocks[1:]...)...)
+	}
+
+	body := strings.TrimSpace(email.Body)
+	if email.BodyHTML {
+		body = htmlToSlackMrkdwn(body)
+	}
+	if body == "" {
+		// EMPTY_BODY_POLICY=subject leaves nothing below the envelope fields
+		return blocks[:len(blocks)-1]
+	}
+	if !email.BodyHTML {
+		body = ep.escapeSlackText(body)
+	}
+
+	for _, chunk := range splitMessage(body, SlackMaxSectionText) {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObject{Type: "mrkdwn", Text: chunk},
+		})
+	}
+
+	return blocks
+}
+
+// slackMentions collects the mentions requested by the X-Slack-Mention header and the "mention" destination option
+func (ep *EmailProcessor) slackMentions(email *ProcessedEmail, options DestinationOptions) []string {
+	var mentions []string
+	for _, list := range []string{email.SlackMention, options.Get("mention")} {
+		mentions = append(mentions, strings.FieldsFunc(list, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+	return mentions
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// htmlConverter turns HTML markup into Slack mrkdwn. It understands the tags alert mailers
+// commonly produce and drops everything else, keeping the text
+type htmlConverter struct {
+	out   []byte
+	stack []htmlInline // Open inline elements, rewritten when they close
+	lists []int        // Item counters of open lists, -1 for unordered lists
+	pre   int          // Depth of open <pre> elements
+	skip  string       // Element whose content is dropped, e.g. "script"
+	cells int          // Cells written in the current table row
+}
+
+// htmlInline is an open inline element whose content starts at offset start of the output
+type htmlInline struct {
+	tag    string
+	marker string // Emphasis marker, "" for links
+	href   string
+	start  int
+}
+
+// htmlToSlackMrkdwn converts an HTML body to Slack mrkdwn: emphasis, links, lists, line breaks
+// and tables are kept, other markup is removed and text is escaped for Slack
+func htmlToSlackMrkdwn(src string) string {
+	c := &htmlConverter{}
+	for len(src) > 0 {
+		i := strings.IndexByte(src, '<')
+		if i < 0 {
+			c.text(src)
+			break
+		}
+		if i > 0 {
+			c.text(src[:i])
+			src = src[i:]
+		}
+
+		switch {
+		case strings.HasPrefix(src, "<!--"):
+			end := strings.Index(src, "-->")
+			if end < 0 {
+				return c.result()
+			}
+			src = src[end+3:]
+		case len(src) > 1 && (isASCIILetter(src[1]) || src[1] == '/' || src[1] == '!'):
+			end := strings.IndexByte(src, '>')
+			if end < 0 {
+				return c.result()
+			}
+			c.tag(src[1:end])
+			src = src[end+1:]
+		default:
+			// A lone "<" is text
+			c.text("<")
+			src = src[1:]
+		}
+	}
+	return c.result()
+}
+
+// isASCIILetter reports whether b can start a tag name
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// text appends a text node, collapsing whitespace outside of <pre>
+func (c *htmlConverter) text(s string) {
+	if c.skip != "" {
+		return
+	}
+	s = html.UnescapeString(s)
+	if c.pre > 0 {
+		c.write(escapeSlackMrkdwn(s))
+		return
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			c.space()
+		}
+		return
+	}
+	if s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r' {
+		c.space()
+	}
+	c.write(escapeSlackMrkdwn(strings.Join(fields, " ")))
+	if last := s[len(s)-1]; last == ' ' || last == '\t' || last == '\n' || last == '\r' {
+		c.space()
+	}
+}
+
+// tag handles the content of one tag, without the angle brackets
+func (c *htmlConverter) tag(content string) {
+	if strings.HasPrefix(content, "!") {
+		return // DOCTYPE and other declarations
+	}
+
+	closing := strings.HasPrefix(content, "/")
+	content = strings.TrimPrefix(content, "/")
+	name := content
+	if i := strings.IndexAny(content, " \t\r\n/"); i >= 0 {
+		name = content[:i]
+	}
+	name = strings.ToLower(name)
+
+	if c.skip != "" {
+		if closing && name == c.skip {
+			c.skip = ""
+		}
+		return
+	}
+
+	switch name {
+	case "script", "style", "head", "title":
+		if !closing {
+			c.skip = name
+		}
+	case "b", "strong":
+		c.inline(name, "*", "", closing)
+	case "i", "em":
+		c.inline(name, "_", "", closing)
+	case "s", "strike", "del":
+		c.inline(name, "~", "", closing)
+	case "code", "tt":
+		if c.pre == 0 {
+			c.inline(name, "`", "", closing)
+		}
+	case "a":
+		c.inline(name, "", htmlAttribute(content, "href"), closing)
+	case "br":
+		c.newline()
+	case "pre":
+		if closing {
+			if c.pre > 0 {
+				c.pre--
+				c.newline()
+				c.write("```")
+				c.newline()
+			}
+			return
+		}
+		c.newline()
+		c.write("```\n")
+		c.pre++
+	case "p", "div", "blockquote", "table", "section", "article", "header", "footer":
+		c.paragraph()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.paragraph()
+		c.inline(name, "*", "", closing)
+	case "hr":
+		c.paragraph()
+		c.write("───")
+		c.paragraph()
+	case "ul", "ol":
+		if closing {
+			if len(c.lists) > 0 {
+				c.lists = c.lists[:len(c.lists)-1]
+			}
+		} else if name == "ol" {
+			c.lists = append(c.lists, 0)
+		} else {
+			c.lists = append(c.lists, -1)
+		}
+		c.newline()
+	case "li":
+		if closing {
+			return
+		}
+		c.newline()
+		bullet := "• "
+		if len(c.lists) > 0 {
+			c.write(strings.Repeat("    ", len(c.lists)-1))
+			if n := &c.lists[len(c.lists)-1]; *n >= 0 {
+				*n++
+				bullet = strconv.Itoa(*n) + ". "
+			}
+		}
+		c.write(bullet)
+	case "tr":
+		c.newline()
+		c.cells = 0
+	case "td", "th":
+		if closing {
+			return
+		}
+		if c.cells > 0 {
+			c.trimSpace()
+			c.write(" | ")
+		}
+		c.cells++
+	}
+}
+
+// inline opens an emphasis or link element, or rewrites its content when it closes
+func (c *htmlConverter) inline(tag, marker, href string, closing bool) {
+	if !closing {
+		c.stack = append(c.stack, htmlInline{tag: tag, marker: marker, href: href, start: len(c.out)})
+		return
+	}
+
+	// Close the innermost matching element; unmatched closing tags are ignored
+	i := len(c.stack) - 1
+	for i >= 0 && c.stack[i].tag != tag {
+		i--
+	}
+	if i < 0 {
+		return
+	}
+	open := c.stack[i]
+	c.stack = c.stack[:i]
+
+	// Markers must hug the text for Slack to render them, so move surrounding spaces outside
+	content := string(c.out[open.start:])
+	inner := strings.TrimSpace(content)
+	lead := content[:strings.Index(content, inner)]
+	trail := content[len(lead)+len(inner):]
+	c.out = c.out[:open.start]
+	c.write(lead)
+
+	switch {
+	case open.marker != "" && inner != "":
+		c.write(open.marker + inner + open.marker)
+	case open.marker == "" && slackLinkable(open.href):
+		link := slackLinkEscaper.Replace(open.href)
+		if inner == "" || inner == escapeSlackMrkdwn(open.href) {
+			c.write("<" + link + ">")
+		} else {
+			c.write("<" + link + "|" + inner + ">")
+		}
+	default:
+		c.write(inner)
+	}
+	c.write(trail)
+}
+
+// slackLinkEscaper escapes the characters that would end or break a Slack link
+var slackLinkEscaper = strings.NewReplacer("&", "&amp;", "<", "%3C", ">", "%3E", "|", "%7C", " ", "%20")
+
+// slackLinkable reports whether href is worth keeping as a Slack link
+func slackLinkable(href string) bool {
+	lower := strings.ToLower(href)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
+
+// htmlAttribute returns the unescaped value of the named attribute in a tag's content
+func htmlAttribute(content, name string) string {
+	lower := strings.ToLower(content)
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], name)
+		if i < 0 {
+			return ""
+		}
+		i += offset
+		offset = i + len(name)
+
+		// The name must stand alone, e.g. not match "data-href"
+		if i == 0 || !strings.ContainsRune(" \t\r\n", rune(lower[i-1])) {
+			continue
+		}
+		rest := strings.TrimLeft(content[offset:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		if rest == "" {
+			return ""
+		}
+
+		var value string
+		if quote := rest[0]; quote == '"' || quote == '\'' {
+			end := strings.IndexByte(rest[1:], quote)
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value = rest[1 : end+1]
+		} else if end := strings.IndexAny(rest, " \t\r\n"); end >= 0 {
+			value = rest[:end]
+		} else {
+			value = rest
+		}
+		return strings.TrimSpace(html.UnescapeString(value))
+	}
+}
+
+// slackEscaper replaces the three characters Slack reserves for control sequences. Unlike
+// HTML escaping, quotes are left alone: Slack would show &quot; literally
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeSlackMrkdwn escapes the characters Slack reserves for links and mentions, so text
+// such as "<!channel>" or "a < b" is shown as written
+func escapeSlackMrkdwn(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+// write appends s to the output
+func (c *htmlConverter) write(s string) {
+	c.out = append(c.out, s...)
+}
+
+// space appends a single space unless the output already ends a word
+func (c *htmlConverter) space() {
+	if n := len(c.out); n > 0 && c.out[n-1] != ' ' && c.out[n-1] != '\n' {
+		c.out = append(c.out, ' ')
+	}
+}
+
+// trimSpace removes trailing spaces from the output
+func (c *htmlConverter) trimSpace() {
+	for len(c.out) > 0 && c.out[len(c.out)-1] == ' ' {
+		c.out = c.out[:len(c.out)-1]
+	}
+}
+
+// newline ends the current line unless it is already empty
+func (c *htmlConverter) newline() {
+	c.trimSpace()
+	if len(c.out) > 0 && c.out[len(c.out)-1] != '\n' {
+		c.out = append(c.out, '\n')
+	}
+}
+
+// paragraph leaves a blank line before the next block
+func (c *htmlConverter) paragraph() {
+	c.newline()
+	if n := len(c.out); n > 1 && c.out[n-2] != '\n' {
+		c.out = append(c.out, '\n')
+	}
+}
+
+// result returns the converted text without leading or trailing blank lines
+func (c *htmlConverter) result() string {
+	return strings.TrimSpace(string(c.out))
+}
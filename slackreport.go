@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Slack Report Configuration
+const (
+	SlackReportsOff         = "off"
+	SlackReportsSnippet     = "snippet" // Upload the body as a text file in the message's thread
+	SlackReportsCanvas      = "canvas"  // Create a canvas the channel can read and link to it
+	DefaultSlackReportChars = 10000     // Bodies at least this long become a report
+	SlackReportPreviewLines = 5         // Body lines shown in the message announcing a report
+)
+
+// parseSlackReportMode validates a SLACK_REPORTS value or report option
+func parseSlackReportMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case SlackReportsOff, SlackReportsSnippet, SlackReportsCanvas:
+		return mode, nil
+	case "":
+		return SlackReportsOff, nil
+	default:
+		return "", fmt.Errorf("invalid Slack report mode '%s': use off/snippet/canvas", value)
+	}
+}
+
+// slackReportOption reads the "report" option of a destination, returning "" when it is unset
+func slackReportOption(options DestinationOptions) (string, error) {
+	if !options.Has("report") {
+		return "", nil
+	}
+	mode, err := parseSlackReportMode(options.Get("report"))
+	if err != nil {
+		return "", fmt.Errorf("invalid report option: %w", err)
+	}
+	return mode, nil
+}
+
+// slackReportFilename names the snippet a report body is uploaded as
+func slackReportFilename(email *ProcessedEmail) string {
+	if email.BodyHTML {
+		return "report.html"
+	}
+	return "report.txt"
+}
+
+// slackReportMessage is the short message posted instead of a report: the subject, the first
+// lines of the body and where the rest is. link is the canvas, or "" for a snippet in the thread
+func slackReportMessage(email *ProcessedEmail, link string) string {
+	body := email.Body
+	if email.BodyHTML {
+		body = htmlToSlackMrkdwn(body)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	preview := lines
+	if len(preview) > SlackReportPreviewLines {
+		preview = preview[:SlackReportPreviewLines]
+	}
+
+	var message strings.Builder
+	if email.Subject != "" {
+		fmt.Fprintf(&message, "*%s*\n", escapeSlackMrkdwn(email.Subject))
+	}
+	fmt.Fprintf(&message, "```%s```\n", strings.ReplaceAll(escapeSlackMrkdwn(strings.Join(preview, "\n")), "```", "'''"))
+	size := fmt.Sprintf("%d lines, %s", len(lines), formatByteSize(int64(len(email.Body))))
+	if link != "" {
+		fmt.Fprintf(&message, "Full report (%s): <%s|open the canvas>", size, link)
+	} else {
+		fmt.Fprintf(&message, "Full report (%s) in the thread", size)
+	}
+	return message.String()
+}
+
+// slackReportCanvas is the markdown of a report canvas; a code block keeps the columns of tables aligned
+func slackReportCanvas(email *ProcessedEmail) string {
+	body := email.Body
+	if email.BodyHTML {
+		body = htmlToSlackMrkdwn(body)
+	}
+	return "```\n" + strings.ReplaceAll(body, "```", "'''") + "\n```\n"
+}
@@ -0,0 +1,315 @@
+//go:build !minimal && !noslack
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slack Socket Mode Configuration
+const (
+	SlackSocketReadTimeout  = 2 * time.Minute // Slack pings well within this; silence means a dead connection
+	SlackSocketMaxBackoff   = 1 * time.Minute
+	SlackReplySignatureLine = "-- \nReplied in Slack by %s"
+)
+
+// slackLinkPattern matches Slack's angle-bracket markup: <@U123>, <#C123|name>, <!here>, <https://x|label>
+var slackLinkPattern = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+
+// slackSocketEnvelope is a message received over a Socket Mode connection
+type slackSocketEnvelope struct {
+	Type       string          `json:"type"`
+	EnvelopeID string          `json:"envelope_id"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// slackMessageEvent is the part of an events_api message event the bridge needs
+type slackMessageEvent struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	BotID    string `json:"bot_id"`
+	User     string `json:"user"`
+	Channel  string `json:"channel"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts"`
+}
+
+// slackSlashCommand is the part of a slash command payload the bridge needs
+type slackSlashCommand struct {
+	Command   string `json:"command"`
+	Text      string `json:"text"`
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+}
+
+// SlackReplyBridge listens for thread replies over Socket Mode and emails them back to the original sender.
+// It also answers the /search slash command when a history is kept
+type SlackReplyBridge struct {
+	AppToken string // App-level token (xapp-...) with connections:write
+	Slack    *SlackClient
+	Relay    *SMTPRelay    // Sends thread replies by email; nil ignores them
+	Replies  *ReplyIndex   // nil without a relay
+	History  *AlertHistory // Answers /search; nil ignores slash commands
+
+	mutex   sync.Mutex
+	conn    *WebSocketConn
+	stopped bool
+}
+
+// NewSlackReplyBridge creates a reply bridge and, with a relay, makes the Slack client record threads for it
+func NewSlackReplyBridge(appToken string, slackClient *SlackClient, relay *SMTPRelay, ttl time.Duration, history *AlertHistory) *SlackReplyBridge {
+	var replies *ReplyIndex
+	if relay != nil {
+		replies = NewReplyIndex(ttl)
+		slackClient.Replies = replies
+	}
+
+	return &SlackReplyBridge{
+		AppToken: appToken,
+		Slack:    slackClient,
+		Relay:    relay,
+		Replies:  replies,
+		History:  history,
+	}
+}
+
+// Start keeps a Socket Mode connection open until Stop is called, reconnecting with backoff
+func (b *SlackReplyBridge) Start() error {
+	backoff := time.Second
+	for {
+		connected, err := b.run()
+		if b.isStopped() {
+			return nil
+		}
+		if connected {
+			backoff = time.Second
+		}
+		if err != nil {
+			log.Printf("Slack Socket Mode connection lost: %v (reconnecting in %s)", err, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, SlackSocketMaxBackoff)
+		}
+	}
+}
+
+// Stop closes the connection and ends Start
+func (b *SlackReplyBridge) Stop() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stopped = true
+	if b.conn != nil {
+		return b.conn.Close()
+	}
+	return nil
+}
+
+// isStopped reports whether Stop was called
+func (b *SlackReplyBridge) isStopped() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.stopped
+}
+
+// run serves one Socket Mode connection. A nil error means Slack asked us to reconnect
+func (b *SlackReplyBridge) run() (connected bool, err error) {
+	var opened struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		URL   string `json:"url"`
+	}
+	if err := b.Slack.callAPIWithToken(context.Background(), b.AppToken, "POST", "apps.connections.open", nil, &opened); err != nil {
+		return false, err
+	}
+	if !opened.OK {
+		return false, fmt.Errorf("slack API error: %s", opened.Error)
+	}
+
+	conn, err := DialWebSocket(opened.URL)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	b.mutex.Lock()
+	if b.stopped {
+		b.mutex.Unlock()
+		return false, nil
+	}
+	b.conn = conn
+	b.mutex.Unlock()
+
+	for {
+		data, err := conn.ReadMessage(SlackSocketReadTimeout)
+		if err != nil {
+			return connected, err
+		}
+
+		var envelope slackSocketEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			log.Printf("Warning: ignoring malformed Socket Mode message: %v", err)
+			continue
+		}
+
+		// Slack redelivers events that are not acknowledged within three seconds. Slash commands
+		// are answered in the acknowledgement, which a search of the history easily makes
+		if envelope.EnvelopeID != "" {
+			response := map[string]interface{}{"envelope_id": envelope.EnvelopeID}
+			if envelope.Type == "slash_commands" {
+				if answer := b.handleCommand(envelope.Payload); answer != nil {
+					response["payload"] = answer
+				}
+			}
+			ack, _ := json.Marshal(response)
+			if err := conn.WriteText(ack); err != nil {
+				return connected, err
+			}
+		}
+
+		switch envelope.Type {
+		case "hello":
+			connected = true
+			log.Println("Slack Socket Mode connected, listening for thread replies and commands")
+		case "disconnect":
+			log.Printf("Slack Socket Mode asked to reconnect (%s)", envelope.Reason)
+			return connected, nil
+		case "events_api":
+			var payload struct {
+				Event slackMessageEvent `json:"event"`
+			}
+			if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+				log.Printf("Warning: ignoring malformed Slack event: %v", err)
+				continue
+			}
+			go b.handleMessage(payload.Event)
+		}
+	}
+}
+
+// handleMessage emails a human reply in a bridged thread back to the original sender
+func (b *SlackReplyBridge) handleMessage(event slackMessageEvent) {
+	// Only plain replies by people; edits, joins and the bridge's own posts carry a subtype or bot_id
+	if event.Type != "message" || event.Subtype != "" || event.BotID != "" {
+		return
+	}
+	if event.ThreadTS == "" || event.ThreadTS == event.TS || b.Relay == nil {
+		return
+	}
+
+	original, replyFrom := b.Replies.Lookup(event.ThreadTS)
+	if original == nil {
+		return
+	}
+
+	name := event.User
+	if userName, err := b.Slack.UserName(event.User); err == nil {
+		name = userName
+	} else {
+		log.Printf("Warning: could not look up Slack user %s: %v", event.User, err)
+	}
+
+	body := slackTextToPlain(event.Text) + "\n\n" + fmt.Sprintf(SlackReplySignatureLine, name)
+	reply := NewReplyEmail(original, b.Relay.FromWithName(name+" via Slack"), body)
+
+	// The tag names the conversation, so mail filters can route answers to the reply back to it
+	if replyFrom != "" {
+		if !b.Relay.AllowsSender(replyFrom) {
+			log.Printf("Warning: reply address %s is outside the domain of SMTP_RELAY_FROM, sending from %s", replyFrom, b.Relay.From)
+		} else if err := reply.UseReplyAddress(replyFrom, event.Channel); err != nil {
+			log.Printf("Warning: %v, sending from %s", err, b.Relay.From)
+		}
+	}
+
+	if err := b.Relay.Send(reply); err != nil {
+		log.Printf("Failed to email Slack reply from %s in %s to %s: %v", name, event.Channel, original.From, err)
+		return
+	}
+	log.Printf("Emailed Slack reply from %s in %s to %s", name, event.Channel, original.From)
+}
+
+// handleCommand answers a /search slash command with the matching alerts sent to the channel it
+// was used in, or to the user in their DM with the bot. Other commands get no answer
+func (b *SlackReplyBridge) handleCommand(payload json.RawMessage) map[string]interface{} {
+	var command slackSlashCommand
+	if err := json.Unmarshal(payload, &command); err != nil {
+		log.Printf("Warning: ignoring malformed Slack command: %v", err)
+		return nil
+	}
+	if b.History == nil || command.Command != "/search" {
+		return nil
+	}
+
+	term := strings.TrimSpace(command.Text)
+	if len([]rune(term)) < SearchMinTermLen {
+		return map[string]interface{}{"response_type": "ephemeral", "text": escapeSlackMrkdwn(searchUsage)}
+	}
+
+	// Alerts to a user were addressed by user ID, and are searched from the DM
+	chats := []string{command.ChannelID}
+	if strings.HasPrefix(command.ChannelID, "D") {
+		chats = append(chats, command.UserID)
+	}
+	log.Printf("Slack search for %q in %s by %s", term, command.ChannelID, command.UserID)
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          formatSearchResultsSlack(term, b.History.Search("slack", "", chats, term)),
+	}
+}
+
+// formatSearchResultsSlack lists search results in Slack mrkdwn
+func formatSearchResultsSlack(term string, results []HistoryEntry) string {
+	if len(results) == 0 {
+		return fmt.Sprintf(":mag: No recent alerts in this channel match *%s*", escapeSlackMrkdwn(term))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, ":mag: %d recent alert(s) matching *%s*:\n", len(results), escapeSlackMrkdwn(term))
+	for _, entry := range results {
+		fmt.Fprintf(&sb, "\n%s <!date^%d^{date_short_pretty} {time}|%s> *%s*", entry.Severity.SlackEmoji(),
+			entry.Time.Unix(), entry.Time.UTC().Format("Jan 02 15:04 UTC"), escapeSlackMrkdwn(entry.Subject))
+		if entry.Summary != "" {
+			fmt.Fprintf(&sb, "\n_%s_", escapeSlackMrkdwn(entry.Summary))
+		}
+	}
+	return sb.String()
+}
+
+// slackTextToPlain turns Slack message markup into plain text for an email body
+func slackTextToPlain(text string) string {
+	text = slackLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := slackLinkPattern.FindStringSubmatch(match)
+		target, label := parts[1], parts[2]
+
+		switch {
+		case strings.HasPrefix(target, "@"), strings.HasPrefix(target, "#"):
+			if label != "" {
+				return target[:1] + label
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			if label != "" {
+				return label
+			}
+			return "@" + strings.TrimPrefix(strings.SplitN(target, "^", 2)[0], "!")
+		default:
+			target = strings.TrimPrefix(target, "mailto:")
+			if label != "" && label != target {
+				return label + " (" + target + ")"
+			}
+			return target
+		}
+	})
+
+	// Slack escapes only &, < and >
+	return html.UnescapeString(text)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slack Threading Configuration
+const (
+	DefaultSlackThreadTTL  = 24 * time.Hour
+	SlackThreadCacheMaxLen = 10000 // Default entries kept before expired ones are pruned
+)
+
+// replyPrefixPattern matches reply and forward markers in front of a subject (Re:, Fwd:, AW:, WG:, Re[2]:)
+var replyPrefixPattern = regexp.MustCompile(`(?i)^\s*((re|fwd?|aw|wg)(\[\d+\])?\s*:\s*)+`)
+
+// slackThreadEntry is a cached thread root
+type slackThreadEntry struct {
+	threadTS string
+	expires  time.Time
+}
+
+// SlackThreadCache remembers the root message ts of conversations per channel,
+// keyed by Message-ID and normalized subject
+type SlackThreadCache struct {
+	TTL           time.Duration
+	MatchSubjects bool // Thread messages that only share a subject, not just reply chains
+	MaxEntries    int  // Entries kept before the oldest are evicted
+
+	mutex   sync.Mutex
+	entries map[string]slackThreadEntry
+}
+
+// NewSlackThreadCache creates a new thread cache
+func NewSlackThreadCache(ttl time.Duration, matchSubjects bool) *SlackThreadCache {
+	return &SlackThreadCache{
+		TTL:           ttl,
+		MatchSubjects: matchSubjects,
+		MaxEntries:    SlackThreadCacheMaxLen,
+		entries:       make(map[string]slackThreadEntry),
+	}
+}
+
+// persistedThread is a thread root as stored in the state file
+type persistedThread struct {
+	ThreadTS string    `json:"thread_ts"`
+	Expires  time.Time `json:"expires"`
+}
+
+// saveState implements persistentCache, keeping only live entries
+func (c *SlackThreadCache) saveState() (json.RawMessage, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	threads := make(map[string]persistedThread, len(c.entries))
+	for key, entry := range c.entries {
+		if now.Before(entry.expires) {
+			threads[key] = persistedThread{ThreadTS: entry.threadTS, Expires: entry.expires}
+		}
+	}
+	return json.Marshal(threads)
+}
+
+// loadState implements persistentCache, skipping entries that expired while the bridge was down
+func (c *SlackThreadCache) loadState(data json.RawMessage) error {
+	var threads map[string]persistedThread
+	if err := json.Unmarshal(data, &threads); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, thread := range threads {
+		if len(c.entries) >= c.MaxEntries {
+			break
+		}
+		if now.Before(thread.Expires) {
+			c.entries[key] = slackThreadEntry{threadTS: thread.ThreadTS, expires: thread.Expires}
+		}
+	}
+	return nil
+}
+
+// normalizeThreadSubject strips reply markers and folds case and whitespace so replies share the key
+func normalizeThreadSubject(subject string) string {
+	subject = replyPrefixPattern.ReplaceAllString(subject, "")
+	return strings.ToLower(strings.Join(strings.Fields(subject), " "))
+}
+
+// lookupKeys lists the keys that may point at an existing thread, most specific first
+func (c *SlackThreadCache) lookupKeys(email *ProcessedEmail) []string {
+	var keys []string
+	if email.InReplyTo != "" {
+		keys = append(keys, "id:"+email.InReplyTo)
+	}
+	for i := len(email.References) - 1; i >= 0; i-- {
+		keys = append(keys, "id:"+email.References[i])
+	}
+	if c.MatchSubjects {
+		if subject := normalizeThreadSubject(email.Subject); subject != "" {
+			keys = append(keys, "subject:"+subject)
+		}
+	}
+	return keys
+}
+
+// Lookup returns the ts of the thread the email continues in the channel, or "" for a new conversation
+func (c *SlackThreadCache) Lookup(channelID string, email *ProcessedEmail) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for _, key := range c.lookupKeys(email) {
+		if entry, exists := c.entries[channelID+"|"+key]; exists && now.Before(entry.expires) {
+			return entry.threadTS
+		}
+	}
+	return ""
+}
+
+// Remember records the thread an email was posted in so later replies and repeats can join it
+func (c *SlackThreadCache) Remember(channelID string, email *ProcessedEmail, threadTS string) {
+	if threadTS == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.MaxEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+
+	// Still full: drop the entry closest to expiry
+	if len(c.entries) >= c.MaxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = key, entry.expires
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+
+	entry := slackThreadEntry{threadTS: threadTS, expires: now.Add(c.TTL)}
+	if email.MessageID != "" {
+		c.entries[channelID+"|id:"+email.MessageID] = entry
+	}
+	if c.MatchSubjects {
+		if subject := normalizeThreadSubject(email.Subject); subject != "" {
+			c.entries[channelID+"|subject:"+subject] = entry
+		}
+	}
+}
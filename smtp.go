@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
 )
 
@@ -18,21 +26,37 @@ const (
 	SMTPDomain      = "localhost"
 	ReadTimeout     = 10 * time.Second
 	WriteTimeout    = 10 * time.Second
-	MaxMessageBytes = 1024 * 1024 // 1MB
 	MaxRecipients   = 50
+
+	DefaultMaxMessageBytes = 1024 * 1024 // 1MB, advertised with the SIZE extension
 )
 
+// errSMTPTLSRequired answers MAIL FROM on an unencrypted session under SMTP_REQUIRE_TLS (RFC 3207)
+var errSMTPTLSRequired = &smtp.SMTPError{
+	Code:         530,
+	EnhancedCode: smtp.EnhancedCode{5, 7, 0},
+	Message:      "Must issue a STARTTLS command first",
+}
+
 // SMTPServer wraps the SMTP server functionality
 type SMTPServer struct {
 	server          *smtp.Server
 	emailProcessor  *EmailProcessor
 	listenAddr      string
+	smtpsAddr       string       // Implicit-TLS listener, "" when disabled
+	lmtpServer      *smtp.Server // LMTP listener on a Unix socket, nil when disabled
+	lmtpMode        fs.FileMode
+	connLimiter     *ConnectionLimiter // nil allows any number of connections
 	allowedNetworks []*net.IPNet
 	tlsConfig       *tls.Config
+	backend         *SMTPBackend
+
+	mutex     sync.Mutex
+	listeners []net.Listener // Closed by Shutdown before it waits for messages in progress
 }
 
-// NewSMTPServer creates a new SMTP server instance
-func NewSMTPServer(emailProcessor *EmailProcessor, listenHost string, port int, allowedNetworks []string, tlsConfig *tls.Config) *SMTPServer {
+// NewSMTPServer creates a new SMTP server instance; a nil auth offers no SMTP AUTH
+func NewSMTPServer(emailProcessor *EmailProcessor, listenHost string, port int, allowedNetworks []string, tlsConfig *tls.Config, auth *SMTPAuthenticator) *SMTPServer {
 	if listenHost == "" {
 		listenHost = DefaultSMTPHost
 	}
@@ -64,14 +88,16 @@ func NewSMTPServer(emailProcessor *EmailProcessor, listenHost string, port int,
 	backend := &SMTPBackend{
 		EmailProcessor:  emailProcessor,
 		AllowedNetworks: ipNets,
+		Auth:            auth,
 	}
 
+	smtpServer.backend = backend
 	server := smtp.NewServer(backend)
 	server.Addr = smtpServer.listenAddr
 	server.Domain = SMTPDomain
 	server.ReadTimeout = ReadTimeout
 	server.WriteTimeout = WriteTimeout
-	server.MaxMessageBytes = MaxMessageBytes
+	server.MaxMessageBytes = DefaultMaxMessageBytes
 	server.MaxRecipients = MaxRecipients
 	server.AllowInsecureAuth = true
 
@@ -89,20 +115,87 @@ func NewSMTPServer(emailProcessor *EmailProcessor, listenHost string, port int,
 
 // Start starts the SMTP server
 func (s *SMTPServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
 	log.Printf("Starting SMTP server on %s", s.server.Addr)
-	return s.server.ListenAndServe()
+	return s.serve(s.server, s.limitListener(listener, true))
+}
+
+// SetMaxMessageBytes changes the largest message accepted. SIZE advertises it, so clients that
+// declare a larger size with MAIL FROM are refused before sending the message
+func (s *SMTPServer) SetMaxMessageBytes(size int64) {
+	s.server.MaxMessageBytes = size
+	if s.lmtpServer != nil {
+		s.lmtpServer.MaxMessageBytes = size
+	}
+	log.Printf("Maximum message size: %s", formatByteSize(size))
+}
+
+// RequireTLS refuses mail on sessions that did not start TLS, and stops offering AUTH before it
+func (s *SMTPServer) RequireTLS() {
+	s.backend.RequireTLS = true
+	s.server.AllowInsecureAuth = false
+	log.Printf("TLS required: MAIL FROM is refused until STARTTLS")
 }
 
-// Stop stops the SMTP server
+// EnableSMTPS adds a listener on port that starts every connection with the TLS handshake
+// (SMTPS), for clients that do not speak STARTTLS. It needs the TLS configuration
+func (s *SMTPServer) EnableSMTPS(listenHost string, port int) {
+	if listenHost == "" {
+		listenHost = DefaultSMTPHost
+	}
+	s.smtpsAddr = fmt.Sprintf("%s:%d", listenHost, port)
+}
+
+// StartSMTPS accepts implicit-TLS connections; the sessions are the same as on the main listener
+func (s *SMTPServer) StartSMTPS() error {
+	if s.tlsConfig == nil {
+		return errors.New("SMTPS requires TLS to be configured")
+	}
+	listener, err := net.Listen("tcp", s.smtpsAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting SMTPS server on %s", s.smtpsAddr)
+	return s.serve(s.server, tls.NewListener(s.limitListener(listener, false), s.tlsConfig))
+}
+
+// SMTPSAddress returns the address of the implicit-TLS listener, or "" when it is disabled
+func (s *SMTPServer) SMTPSAddress() string {
+	return s.smtpsAddr
+}
+
+// Serve accepts SMTP connections on an existing listener
+func (s *SMTPServer) Serve(listener net.Listener) error {
+	log.Printf("Starting SMTP server on %s", listener.Addr())
+	return s.serve(s.server, s.limitListener(listener, true))
+}
+
+// Stop closes the listeners and every connection at once, dropping messages in progress; see
+// Shutdown for a graceful stop
 func (s *SMTPServer) Stop() error {
 	log.Println("Stopping SMTP server...")
-	return s.server.Close()
+	if s.lmtpServer != nil {
+		if err := ignoreClosed(s.lmtpServer.Close()); err != nil {
+			log.Printf("Error stopping LMTP server: %v", err)
+		}
+		os.Remove(s.lmtpServer.Addr)
+	}
+	return ignoreClosed(s.server.Close())
 }
 
 // SMTPBackend implements the SMTP backend interface
 type SMTPBackend struct {
 	EmailProcessor  *EmailProcessor
 	AllowedNetworks []*net.IPNet
+	Auth            *SMTPAuthenticator // nil offers no SMTP AUTH
+	RequireTLS      bool               // Refuse MAIL FROM before STARTTLS
+	RateLimiter     *SMTPRateLimiter   // nil accepts any number of messages
+	Greylist        *Greylist          // nil accepts first attempts
+
+	drain sessionDrain
 }
 
 // isIPAllowed checks if an IP address is in the allowed networks
@@ -139,16 +232,53 @@ func (sb *SMTPBackend) isIPAllowed(remoteAddr string) bool {
 func (sb *SMTPBackend) NewSession(conn *smtp.Conn) (smtp.Session, error) {
 	remoteAddr := conn.Conn().RemoteAddr().String()
 
+	// LMTP clients on the Unix socket have no IP; the socket's permissions control access
+	if socket, ok := conn.Conn().LocalAddr().(*net.UnixAddr); ok {
+		log.Printf("New LMTP session on: %s", socket.Name)
+		if sb.drain.closing() {
+			return nil, errSMTPShuttingDown
+		}
+		return &SMTPSession{
+			EmailProcessor: sb.EmailProcessor,
+			RemoteAddr:     "unix:" + socket.Name,
+			rateLimiter:    sb.RateLimiter,
+			drain:          &sb.drain,
+			conn:           conn,
+		}, nil
+	}
+
 	// Check IP ACL if configured
 	if !sb.isIPAllowed(remoteAddr) {
 		log.Printf("Connection rejected from %s (not in allowed networks)", remoteAddr)
+		sb.EmailProcessor.Metrics.Reject(RejectACL)
 		return nil, fmt.Errorf("connection not allowed from %s", remoteAddr)
 	}
 
+	if sb.drain.closing() {
+		return nil, errSMTPShuttingDown
+	}
+
+	// Turn away clients that already used up their messages
+	clientIP := SessionInfo{RemoteAddr: remoteAddr}.ClientIP()
+	if sb.RateLimiter != nil {
+		if err := sb.RateLimiter.Check(clientIP); err != nil {
+			log.Printf("Connection rejected from %s: %v", remoteAddr, err)
+			sb.EmailProcessor.Metrics.Reject(RejectRateLimit)
+			return nil, err
+		}
+	}
+
 	log.Printf("New SMTP session from: %s", remoteAddr)
 	return &SMTPSession{
 		EmailProcessor: sb.EmailProcessor,
 		RemoteAddr:     remoteAddr,
+		auth:           sb.Auth,
+		requireTLS:     sb.RequireTLS,
+		rateLimiter:    sb.RateLimiter,
+		greylist:       sb.Greylist,
+		drain:          &sb.drain,
+		clientIP:       clientIP,
+		conn:           conn,
 	}, nil
 }
 
@@ -158,26 +288,162 @@ type SMTPSession struct {
 	From           string
 	To             []string
 	RemoteAddr     string
+	AuthUser       string // Username of a successful AUTH
+	Size           int64  // Message size declared with MAIL FROM SIZE=, 0 when unknown
+	SPF            SPFResult
+	SPFDetail      string
+
+	auth        *SMTPAuthenticator
+	requireTLS  bool
+	rateLimiter *SMTPRateLimiter
+	greylist    *Greylist // nil on the LMTP socket
+	clientIP    string    // Key of the per-IP rate limit, "" on the LMTP socket
+	conn        *smtp.Conn
+
+	drain         *sessionDrain
+	inTransaction bool // Counted by drain since MAIL FROM
+}
+
+// AuthMechanisms lists the SASL mechanisms offered; none without SMTP AUTH credentials
+func (s *SMTPSession) AuthMechanisms() []string {
+	if s.auth == nil {
+		return nil
+	}
+	return s.auth.Mechanisms()
+}
+
+// Auth starts a SASL exchange for AUTH
+func (s *SMTPSession) Auth(mech string) (sasl.Server, error) {
+	if s.auth == nil || !slices.Contains(s.auth.Mechanisms(), mech) {
+		return nil, smtp.ErrAuthUnknownMechanism
+	}
+	switch mech {
+	case sasl.Plain:
+		return sasl.NewPlainServer(func(identity, username, password string) error {
+			if identity != "" && identity != username {
+				return smtp.ErrAuthFailed
+			}
+			return s.AuthPlain(username, password)
+		}), nil
+	case sasl.Login:
+		return &loginServer{authenticate: s.AuthPlain}, nil
+	case smtpAuthCRAMMD5:
+		challenge := newCRAMMD5Challenge()
+		return &cramMD5Server{challenge: challenge, verify: func(username string, digest []byte) error {
+			return s.authResult(username, s.auth.CheckCRAMMD5(username, challenge, digest))
+		}}, nil
+	default:
+		return nil, smtp.ErrAuthUnknownMechanism
+	}
 }
 
-// AuthPlain handles PLAIN authentication
+// AuthPlain checks PLAIN and LOGIN credentials against SMTP_AUTH_USERS
 func (s *SMTPSession) AuthPlain(username, password string) error {
-	log.Printf("SMTP Auth attempt - Username: %s", username)
-	// Accept any authentication for simplicity
-	// In production, you might want to implement proper authentication
+	return s.authResult(username, s.auth != nil && s.auth.Check(username, password))
+}
+
+// authResult logs an AUTH attempt and records the user of a successful one
+func (s *SMTPSession) authResult(username string, ok bool) error {
+	if !ok {
+		log.Printf("SMTP AUTH failed for %s from %s", username, s.RemoteAddr)
+		s.EmailProcessor.Metrics.Reject(RejectAuth)
+		return smtp.ErrAuthFailed
+	}
+	log.Printf("SMTP AUTH succeeded for %s from %s", username, s.RemoteAddr)
+	s.AuthUser = username
 	return nil
 }
 
 // Mail handles the MAIL FROM command
 func (s *SMTPSession) Mail(from string, opts *smtp.MailOptions) error {
 	log.Printf("MAIL FROM: %s", from)
+	if s.drain.closing() {
+		log.Printf("Rejecting MAIL FROM %s from %s: shutting down", from, s.RemoteAddr)
+		return errSMTPShuttingDown
+	}
+	if s.requireTLS {
+		if _, encrypted := s.conn.TLSConnectionState(); !encrypted {
+			log.Printf("Rejecting MAIL FROM %s from %s: STARTTLS required", from, s.RemoteAddr)
+			s.EmailProcessor.Metrics.Reject(RejectTLS)
+			return errSMTPTLSRequired
+		}
+	}
+	if s.auth != nil && s.auth.Required && s.AuthUser == "" {
+		log.Printf("Rejecting MAIL FROM %s from %s: not authenticated", from, s.RemoteAddr)
+		s.EmailProcessor.Metrics.Reject(RejectAuth)
+		return errSMTPAuthRequired
+	}
+	if s.rateLimiter != nil {
+		if err := s.rateLimiter.Take(s.clientIP); err != nil {
+			log.Printf("Rejecting MAIL FROM %s from %s: %v", from, s.RemoteAddr, err)
+			s.EmailProcessor.Metrics.Reject(RejectRateLimit)
+			return err
+		}
+	}
+	// Check the sender's SPF record against the client; LMTP clients have already been checked by the MTA
+	if s.clientIP != "" {
+		s.SPF, s.SPFDetail = s.EmailProcessor.CheckSPF(SessionInfo{EnvelopeFrom: from, AuthUser: s.AuthUser, Helo: s.conn.Hostname(), RemoteAddr: s.RemoteAddr})
+		if s.SPF == SPFFail && s.EmailProcessor.Config.SPFPolicy == SPFPolicyReject {
+			log.Printf("Rejecting MAIL FROM %s from %s: SPF fail", from, s.RemoteAddr)
+			s.EmailProcessor.Metrics.Reject(RejectSPF)
+			return &smtp.SMTPError{
+				Code:         550,
+				EnhancedCode: smtp.EnhancedCode{5, 7, 23},
+				Message:      "SPF validation failed: " + s.SPFDetail,
+			}
+		}
+	}
+
+	// The server waits for the message from here on when it shuts down
+	if !s.beginTransaction() {
+		log.Printf("Rejecting MAIL FROM %s from %s: shutting down", from, s.RemoteAddr)
+		return errSMTPShuttingDown
+	}
 	s.From = from
+	if opts != nil {
+		s.Size = opts.Size
+	}
 	return nil
 }
 
 // Rcpt handles the RCPT TO command
 func (s *SMTPSession) Rcpt(to string, opts *smtp.RcptOptions) error {
 	log.Printf("RCPT TO: %s", to)
+
+	// Ask unauthenticated clients to retry each new sender and recipient later. This comes first,
+	// so senders that never retry cost no resolver or verification lookups
+	if s.greylist != nil && s.AuthUser == "" {
+		if wait := s.greylist.Check(s.clientIP, s.From, to); wait > 0 {
+			log.Printf("Greylisting RCPT TO %s from %s for %s", to, s.RemoteAddr, s.From)
+			s.EmailProcessor.Metrics.Reject(RejectGreylist)
+			return errGreylisted(wait)
+		}
+	}
+
+	// Turn away invalid addresses, and unknown destinations under RCPT_VERIFY, while the sender
+	// can still see why
+	if err := s.EmailProcessor.VerifyRecipient(context.Background(), to); err != nil {
+		log.Printf("Rejecting RCPT TO %s: %v", to, err)
+		s.EmailProcessor.Metrics.Reject(RejectDestination)
+		message := "Invalid destination: " + strings.TrimPrefix(err.Error(), ErrInvalidDestination.Error()+": ")
+		var notFound *DestinationNotFoundError
+		if errors.As(err, &notFound) {
+			message = fmt.Sprintf("No such destination: %v", notFound)
+		}
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+			Message:      message,
+		}
+	}
+
+	// Refuse destinations over their daily size quota before the message is sent
+	if err := s.EmailProcessor.CheckSizeQuota(to, s.Size); err != nil {
+		log.Printf("Rejecting RCPT TO %s: %v", to, err)
+		s.EmailProcessor.Metrics.Reject(RejectQuota)
+		return sizeQuotaSMTPError(err)
+	}
+
 	s.To = append(s.To, to)
 	return nil
 }
@@ -190,31 +456,92 @@ func (s *SMTPSession) Data(r io.Reader) error {
 	data, err := io.ReadAll(r)
 	if err != nil {
 		log.Printf("Error reading email data: %v", err)
+		if errors.Is(err, smtp.ErrDataTooLarge) {
+			s.EmailProcessor.Metrics.Reject(RejectSize)
+		}
 		return fmt.Errorf("failed to read email data: %w", err)
 	}
 
 	log.Printf("Received %d bytes of email data", len(data))
 
+	// Refuse mail that fails the DMARC policy of its From domain
+	info := s.sessionInfo()
+	if s.clientIP != "" {
+		if err := s.EmailProcessor.CheckDMARC(data, &info); err != nil {
+			log.Printf("Rejecting email from %s: %v", s.RemoteAddr, err)
+			return err
+		}
+	}
+
 	// Process the email through the email processor
-	if err := s.EmailProcessor.ProcessEmail(data, s.From, s.To, s.RemoteAddr); err != nil {
+	if err := s.EmailProcessor.ProcessSessionEmail(data, s.To, info); err != nil {
 		log.Printf("Error processing email: %v", err)
-		return fmt.Errorf("failed to process email: %w", err)
+		return smtpDataError(err)
 	}
 
 	log.Println("Email successfully processed and forwarded")
 	return nil
 }
 
+// smtpDataError is the reply to a message that could not be delivered
+func smtpDataError(err error) error {
+	// Some recipients have the message; a failure reply would make the sender repeat it to them
+	var partialErr *PartialDeliveryError
+	if errors.As(err, &partialErr) {
+		return &smtp.SMTPError{
+			Code:         250,
+			EnhancedCode: smtp.EnhancedCode{2, 0, 0},
+			Message:      "OK: " + partialErr.Error(),
+		}
+	}
+
+	// Reject messages that exceed parser limits with a permanent, specific code
+	var limitErr *ParseLimitError
+	if errors.As(err, &limitErr) {
+		return &smtp.SMTPError{
+			Code:         limitErr.Code,
+			EnhancedCode: smtp.EnhancedCode(limitErr.EnhancedCode),
+			Message:      limitErr.Message,
+		}
+	}
+	var quotaErr *SizeQuotaError
+	if errors.As(err, &quotaErr) {
+		return sizeQuotaSMTPError(quotaErr)
+	}
+
+	return fmt.Errorf("failed to process email: %w", err)
+}
+
+// sessionInfo describes the session for templates and the sender banner
+func (s *SMTPSession) sessionInfo() SessionInfo {
+	info := SessionInfo{
+		EnvelopeFrom: s.From,
+		AuthUser:     s.AuthUser,
+		RemoteAddr:   s.RemoteAddr,
+		SPF:          string(s.SPF),
+		SPFDetail:    s.SPFDetail,
+	}
+	if s.conn != nil {
+		info.Helo = s.conn.Hostname()
+		_, info.TLS = s.conn.TLSConnectionState()
+	}
+	return info
+}
+
 // Reset resets the session state
 func (s *SMTPSession) Reset() {
 	log.Println("SMTP session reset")
 	s.From = ""
 	s.To = nil
+	s.Size = 0
+	s.SPF, s.SPFDetail = "", ""
+	s.endTransaction()
 }
 
 // Logout handles session termination
 func (s *SMTPSession) Logout() error {
 	log.Println("SMTP session logout")
+	s.endTransaction()
 	return nil
 }
 
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errSMTPAuthRequired answers MAIL FROM before AUTH when authentication is required (RFC 4954)
+var errSMTPAuthRequired = &smtp.SMTPError{
+	Code:         530,
+	EnhancedCode: smtp.EnhancedCode{5, 7, 0},
+	Message:      "Authentication required",
+}
+
+// smtpAuthCRAMMD5 names the CRAM-MD5 SASL mechanism (RFC 2195)
+const smtpAuthCRAMMD5 = "CRAM-MD5"
+
+// errCRAMMD5InitialResponse answers AUTH CRAM-MD5 with an initial response, which the mechanism does not have
+var errCRAMMD5InitialResponse = &smtp.SMTPError{
+	Code:         501,
+	EnhancedCode: smtp.EnhancedCode{5, 5, 2},
+	Message:      "CRAM-MD5 takes no initial response",
+}
+
+// smtpAuthDummyHash is compared for unknown users, so a failed login takes as long either way
+var smtpAuthDummyHash = []byte("$2a$10$WhwDVuMMFXxh/zBGigOtOuph1dwdt5GmO5oBBg72COliBZaUjQTtq")
+
+// SMTPAuthenticator checks SMTP AUTH credentials against the bcrypt hashes of SMTP_AUTH_USERS
+// and the CRAM-MD5 shared secrets of SMTP_AUTH_CRAM_SECRETS
+type SMTPAuthenticator struct {
+	Required bool // Refuse MAIL FROM before a successful AUTH
+
+	users       map[string][]byte // Username -> bcrypt hash
+	cramSecrets map[string][]byte // Username -> CRAM-MD5 shared secret
+}
+
+// readSMTPAuthEntries returns the user:value entries of a setting: comma-separated, or one per
+// line of the file at an absolute path, skipping blank lines and # comments. The second result
+// names where the entries came from, for errors
+func readSMTPAuthEntries(name, value string) ([]string, string, error) {
+	if !strings.HasPrefix(value, "/") {
+		var entries []string
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries, name, nil
+	}
+
+	file, err := os.Open(value)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s: %w", name, err)
+	}
+	defer file.Close()
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return entries, value, nil
+}
+
+// parseSMTPAuth reads SMTP_AUTH_USERS and SMTP_AUTH_CRAM_SECRETS, each comma-separated user:value
+// pairs or the absolute path of a file with one user:value per line. Users take bcrypt hashes
+// only; CRAM-MD5 needs the shared secret itself. Returns nil when neither is set
+func parseSMTPAuth(usersValue, cramValue string) (*SMTPAuthenticator, error) {
+	usersValue, cramValue = strings.TrimSpace(usersValue), strings.TrimSpace(cramValue)
+	if usersValue == "" && cramValue == "" {
+		return nil, nil
+	}
+	auth := &SMTPAuthenticator{users: make(map[string][]byte), cramSecrets: make(map[string][]byte)}
+
+	if usersValue != "" {
+		entries, source, err := readSMTPAuthEntries("SMTP_AUTH_USERS", usersValue)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			username, hash, found := strings.Cut(entry, ":")
+			if !found || username == "" {
+				return nil, fmt.Errorf("invalid entry in %s: use user:bcrypt-hash", source)
+			}
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("invalid password hash for SMTP user '%s' in %s: only bcrypt hashes ($2y$...) are supported, create one with 'email2dm hash-password' or 'htpasswd -nB %s'", username, source, username)
+			}
+			auth.users[username] = []byte(hash)
+		}
+		if len(auth.users) == 0 {
+			return nil, fmt.Errorf("no users in %s", source)
+		}
+	}
+
+	if cramValue != "" {
+		entries, source, err := readSMTPAuthEntries("SMTP_AUTH_CRAM_SECRETS", cramValue)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			username, secret, found := strings.Cut(entry, ":")
+			if !found || username == "" || secret == "" {
+				return nil, fmt.Errorf("invalid entry in %s: use user:shared-secret", source)
+			}
+			auth.cramSecrets[username] = []byte(secret)
+		}
+		if len(auth.cramSecrets) == 0 {
+			return nil, fmt.Errorf("no users in %s", source)
+		}
+	}
+	return auth, nil
+}
+
+// Check reports whether a username and password match a configured user
+func (a *SMTPAuthenticator) Check(username, password string) bool {
+	hash, exists := a.users[username]
+	if !exists {
+		bcrypt.CompareHashAndPassword(smtpAuthDummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+// Mechanisms lists the SASL mechanisms the configured credentials allow
+func (a *SMTPAuthenticator) Mechanisms() []string {
+	var mechanisms []string
+	if len(a.users) > 0 {
+		mechanisms = append(mechanisms, sasl.Plain, sasl.Login)
+	}
+	if len(a.cramSecrets) > 0 {
+		mechanisms = append(mechanisms, smtpAuthCRAMMD5)
+	}
+	return mechanisms
+}
+
+// CheckCRAMMD5 reports whether digest is the HMAC-MD5 of the challenge keyed with the user's shared secret
+func (a *SMTPAuthenticator) CheckCRAMMD5(username, challenge string, digest []byte) bool {
+	secret, exists := a.cramSecrets[username]
+	mac := hmac.New(md5.New, secret)
+	mac.Write([]byte(challenge))
+	return hmac.Equal(mac.Sum(nil), digest) && exists
+}
+
+// cramMD5Server is the server side of CRAM-MD5, for appliances that will not send a password in
+// the clear: the client answers a one-time challenge with its username and the HMAC-MD5 of the
+// challenge keyed with their shared secret
+type cramMD5Server struct {
+	challenge string
+	verify    func(username string, digest []byte) error
+	sent      bool
+}
+
+// newCRAMMD5Challenge returns a challenge in the <random.timestamp@host> form of RFC 2195
+func newCRAMMD5Challenge() string {
+	var random [8]byte
+	rand.Read(random[:])
+	return fmt.Sprintf("<%d.%d@%s>", binary.BigEndian.Uint64(random[:]), time.Now().Unix(), SMTPDomain)
+}
+
+// Next implements sasl.Server
+func (c *cramMD5Server) Next(response []byte) ([]byte, bool, error) {
+	if !c.sent {
+		if response != nil {
+			return nil, true, errCRAMMD5InitialResponse
+		}
+		c.sent = true
+		return []byte(c.challenge), false, nil
+	}
+
+	// The username may contain spaces, the hex digest cannot
+	separator := strings.LastIndexByte(string(response), ' ')
+	if separator <= 0 {
+		return nil, true, c.verify("", nil)
+	}
+	digest, err := hex.DecodeString(string(response[separator+1:]))
+	if err != nil {
+		digest = nil
+	}
+	return nil, true, c.verify(string(response[:separator]), digest)
+}
+
+// loginServer is the server side of the LOGIN mechanism, which printers, NAS boxes and UPS cards
+// often speak instead of PLAIN: the username and password answer a prompt each. A username sent
+// as the initial response skips the first prompt
+type loginServer struct {
+	authenticate func(username, password string) error
+	username     string
+	prompted     bool // Username prompt sent
+	haveUsername bool
+}
+
+// Next implements sasl.Server
+func (l *loginServer) Next(response []byte) ([]byte, bool, error) {
+	switch {
+	case l.haveUsername:
+		return nil, true, l.authenticate(l.username, string(response))
+	case response == nil && !l.prompted:
+		l.prompted = true
+		return []byte("Username:"), false, nil
+	default:
+		l.username, l.haveUsername = string(response), true
+		return []byte("Password:"), false, nil
+	}
+}
+
+// runHashPassword prints a bcrypt hash of the password read from stdin, for SMTP_AUTH_USERS
+func runHashPassword(args []string) error {
+	flags := flag.NewFlagSet("hash-password", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if err != nil && password == "" {
+		return errors.New("no password on stdin")
+	}
+	fmt.Fprintln(os.Stderr)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(hash))
+	return nil
+}
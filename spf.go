@@ -0,0 +1,615 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SPF Configuration
+const (
+	SPFPolicyOff      = "off"      // Do not check SPF (default)
+	SPFPolicyLog      = "log"      // Log the result only
+	SPFPolicyAnnotate = "annotate" // Log the result and show it below the message
+	SPFPolicyReject   = "reject"   // Refuse fail results at MAIL FROM, annotate the rest
+
+	SPFTimeout        = 10 * time.Second // For all DNS queries of one check
+	SPFMaxLookups     = 10               // Mechanisms and modifiers that query DNS (RFC 7208 4.6.4)
+	SPFMaxVoidLookups = 2                // Queries answered with no records
+	SPFMaxNames       = 10               // MX or PTR names looked at per mechanism
+)
+
+// SPFResult is the outcome of an SPF check (RFC 7208 2.6)
+type SPFResult string
+
+// SPF results
+const (
+	SPFNone      SPFResult = "none"
+	SPFNeutral   SPFResult = "neutral"
+	SPFPass      SPFResult = "pass"
+	SPFFail      SPFResult = "fail"
+	SPFSoftFail  SPFResult = "softfail"
+	SPFTempError SPFResult = "temperror"
+	SPFPermError SPFResult = "permerror"
+)
+
+// parseSPFPolicy validates SPF_POLICY
+func parseSPFPolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return SPFPolicyOff, nil
+	case SPFPolicyOff, SPFPolicyLog, SPFPolicyAnnotate, SPFPolicyReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid SPF_POLICY '%s': use off, log, annotate or reject", value)
+	}
+}
+
+// spfResolver is the part of net.Resolver an SPF check uses
+type spfResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// errSPFPermanent and errSPFTemporary end an evaluation with permerror and temperror
+var (
+	errSPFPermanent = errors.New("permanent SPF error")
+	errSPFTemporary = errors.New("temporary DNS error")
+)
+
+// spfCheck evaluates the SPF record of one sender for one client
+type spfCheck struct {
+	ctx      context.Context
+	resolver spfResolver
+	ip       net.IP
+	sender   string // local@domain, postmaster@helo for the null sender
+	helo     string
+	lookups  int
+	voids    int
+}
+
+// checkSPF checks whether ip may send mail for the MAIL FROM address, or for the HELO name when
+// the sender is empty. The detail explains the result for logs and the message annotation
+func checkSPF(ctx context.Context, resolver spfResolver, ip net.IP, from, helo string) (SPFResult, string) {
+	ctx, cancel := context.WithTimeout(ctx, SPFTimeout)
+	defer cancel()
+
+	sender := from
+	if sender == "" {
+		sender = "postmaster@" + helo
+	}
+	at := strings.LastIndex(sender, "@")
+	if at < 0 || at == len(sender)-1 {
+		return SPFNone, fmt.Sprintf("no domain in sender '%s'", sender)
+	}
+	domain := sender[at+1:]
+	if at == 0 {
+		sender = "postmaster" + sender
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	check := &spfCheck{ctx: ctx, resolver: resolver, ip: ip, sender: sender, helo: helo}
+	result, err := check.checkHost(domain, 0)
+	switch {
+	case errors.Is(err, errSPFTemporary):
+		return SPFTempError, err.Error()
+	case errors.Is(err, errSPFPermanent):
+		return SPFPermError, err.Error()
+	case result == SPFPass:
+		return result, fmt.Sprintf("%s is allowed to send for %s", ip, domain)
+	case result == SPFNone:
+		return result, fmt.Sprintf("%s has no SPF record", domain)
+	default:
+		return result, fmt.Sprintf("%s is not allowed to send for %s", ip, domain)
+	}
+}
+
+// checkHost is the check_host() function of RFC 7208 section 4
+func (c *spfCheck) checkHost(domain string, depth int) (SPFResult, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if !validSPFDomain(domain) {
+		return SPFNone, nil
+	}
+	if depth > SPFMaxLookups {
+		return "", fmt.Errorf("%w: too many nested includes", errSPFPermanent)
+	}
+
+	record, err := c.record(domain)
+	if err != nil || record == "" {
+		return SPFNone, err
+	}
+
+	var redirect string
+	for _, term := range strings.Fields(record)[1:] {
+		// Modifiers are name=value; the only one that changes the result is redirect
+		if name, value, isModifier := strings.Cut(term, "="); isModifier && validSPFModifierName(name) {
+			if strings.EqualFold(name, "redirect") {
+				if redirect != "" {
+					return "", fmt.Errorf("%w: more than one redirect in %s", errSPFPermanent, domain)
+				}
+				redirect = value
+			}
+			continue
+		}
+
+		result := SPFPass
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			result, term = SPFFail, term[1:]
+		case '~':
+			result, term = SPFSoftFail, term[1:]
+		case '?':
+			result, term = SPFNeutral, term[1:]
+		}
+		matched, err := c.mechanism(domain, term, depth)
+		if err != nil {
+			return "", err
+		}
+		if matched {
+			return result, nil
+		}
+	}
+
+	if redirect == "" {
+		return SPFNeutral, nil
+	}
+	if err := c.countLookup(); err != nil {
+		return "", err
+	}
+	target, err := c.expand(redirect, domain)
+	if err != nil {
+		return "", err
+	}
+	result, err := c.checkHost(target, depth+1)
+	if err == nil && result == SPFNone {
+		return "", fmt.Errorf("%w: redirect to %s without an SPF record", errSPFPermanent, target)
+	}
+	return result, err
+}
+
+// record returns the SPF record of domain, or "" when it has none
+func (c *spfCheck) record(domain string) (string, error) {
+	txts, err := c.resolver.LookupTXT(c.ctx, domain)
+	if err != nil {
+		if isDNSNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("%w: %v", errSPFTemporary, err)
+	}
+
+	var records []string
+	for _, txt := range txts {
+		if version, _, _ := strings.Cut(txt, " "); strings.EqualFold(version, "v=spf1") {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", nil
+	case 1:
+		return records[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s has %d SPF records", errSPFPermanent, domain, len(records))
+	}
+}
+
+// mechanism reports whether the client matches one mechanism of domain's record
+func (c *spfCheck) mechanism(domain, term string, depth int) (bool, error) {
+	name, arg, hasArg := strings.Cut(term, ":")
+	if !hasArg {
+		name, arg, _ = strings.Cut(term, "/")
+		if arg != "" {
+			arg = "/" + arg
+		}
+	}
+
+	switch strings.ToLower(name) {
+	case "all":
+		return arg == "", c.syntaxError(arg != "", term)
+
+	case "ip4", "ip6":
+		if !hasArg {
+			return false, c.syntaxError(true, term)
+		}
+		network := arg
+		if !strings.Contains(network, "/") {
+			network += map[string]string{"ip4": "/32", "ip6": "/128"}[strings.ToLower(name)]
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil || (strings.EqualFold(name, "ip4") != (ipNet.IP.To4() != nil)) {
+			return false, c.syntaxError(true, term)
+		}
+		return ipNet.Contains(c.ip), nil
+
+	case "a", "mx":
+		target, ip4Prefix, ip6Prefix, err := c.domainAndPrefixes(arg, domain)
+		if err != nil {
+			return false, err
+		}
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		hosts := []string{target}
+		if strings.EqualFold(name, "mx") {
+			mxs, err := c.lookup(func() (int, error) {
+				records, err := c.resolver.LookupMX(c.ctx, target)
+				hosts = hosts[:0]
+				for _, mx := range records {
+					hosts = append(hosts, mx.Host)
+				}
+				return len(records), err
+			})
+			if err != nil {
+				return false, err
+			}
+			if mxs > SPFMaxNames {
+				return false, fmt.Errorf("%w: %s has more than %d MX records", errSPFPermanent, target, SPFMaxNames)
+			}
+		}
+		for _, host := range hosts {
+			if matched, err := c.matchAddresses(host, ip4Prefix, ip6Prefix); matched || err != nil {
+				return matched, err
+			}
+		}
+		return false, nil
+
+	case "ptr":
+		target := domain
+		if hasArg {
+			expanded, err := c.expand(arg, domain)
+			if err != nil {
+				return false, err
+			}
+			target = expanded
+		}
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		names, err := c.resolver.LookupAddr(c.ctx, c.ip.String())
+		if err != nil {
+			return false, nil // A failed reverse lookup only means no match (RFC 7208 5.5)
+		}
+		for i, name := range names {
+			if i == SPFMaxNames {
+				break
+			}
+			name = strings.TrimSuffix(strings.ToLower(name), ".")
+			if name != target && !strings.HasSuffix(name, "."+target) {
+				continue
+			}
+			if matched, _ := c.matchAddresses(name, -1, -1); matched {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "include", "exists":
+		if !hasArg {
+			return false, c.syntaxError(true, term)
+		}
+		target, err := c.expand(arg, domain)
+		if err != nil {
+			return false, err
+		}
+		if err := c.countLookup(); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, "exists") {
+			found, err := c.lookup(func() (int, error) {
+				addrs, err := c.resolver.LookupIPAddr(c.ctx, target)
+				count := 0
+				for _, addr := range addrs {
+					if addr.IP.To4() != nil {
+						count++
+					}
+				}
+				return count, err
+			})
+			return found > 0, err
+		}
+		result, err := c.checkHost(target, depth+1)
+		switch {
+		case err != nil:
+			return false, err
+		case result == SPFNone:
+			return false, fmt.Errorf("%w: include of %s without an SPF record", errSPFPermanent, target)
+		default:
+			return result == SPFPass, nil
+		}
+
+	default:
+		return false, c.syntaxError(true, term)
+	}
+}
+
+// domainAndPrefixes splits the [:domain][/ip4-prefix][//ip6-prefix] argument of a and mx
+func (c *spfCheck) domainAndPrefixes(arg, domain string) (string, int, int, error) {
+	ip4Prefix, ip6Prefix := 32, 128
+	if spec, prefix, found := strings.Cut(arg, "//"); found {
+		bits, err := strconv.Atoi(prefix)
+		if err != nil || bits < 0 || bits > 128 {
+			return "", 0, 0, fmt.Errorf("%w: invalid prefix length in '%s'", errSPFPermanent, arg)
+		}
+		arg, ip6Prefix = spec, bits
+	}
+	if slash := strings.LastIndex(arg, "/"); slash >= 0 {
+		bits, err := strconv.Atoi(arg[slash+1:])
+		if err != nil || bits < 0 || bits > 32 {
+			return "", 0, 0, fmt.Errorf("%w: invalid prefix length in '%s'", errSPFPermanent, arg)
+		}
+		arg, ip4Prefix = arg[:slash], bits
+	}
+	if arg == "" {
+		return domain, ip4Prefix, ip6Prefix, nil
+	}
+	target, err := c.expand(arg, domain)
+	return target, ip4Prefix, ip6Prefix, err
+}
+
+// matchAddresses reports whether an address of host is in the client's network; a negative
+// prefix requires the exact address
+func (c *spfCheck) matchAddresses(host string, ip4Prefix, ip6Prefix int) (bool, error) {
+	var addrs []net.IPAddr
+	_, err := c.lookup(func() (int, error) {
+		var err error
+		addrs, err = c.resolver.LookupIPAddr(c.ctx, host)
+		return len(addrs), err
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, addr := range addrs {
+		ip, bits, prefix := addr.IP.To4(), 32, ip4Prefix
+		if ip == nil {
+			ip, bits, prefix = addr.IP, 128, ip6Prefix
+		}
+		if len(ip) != len(c.ip) {
+			continue
+		}
+		if prefix < 0 {
+			prefix = bits
+		}
+		network := net.IPNet{IP: ip, Mask: net.CIDRMask(prefix, bits)}
+		if network.Contains(c.ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lookup runs a DNS query, counting empty answers towards the void lookup limit
+func (c *spfCheck) lookup(query func() (int, error)) (int, error) {
+	count, err := query()
+	if err != nil && !isDNSNotFound(err) {
+		return 0, fmt.Errorf("%w: %v", errSPFTemporary, err)
+	}
+	if err != nil || count == 0 {
+		if c.voids++; c.voids > SPFMaxVoidLookups {
+			return 0, fmt.Errorf("%w: more than %d lookups without an answer", errSPFPermanent, SPFMaxVoidLookups)
+		}
+		return 0, nil
+	}
+	return count, nil
+}
+
+// countLookup counts a term that queries DNS against the limit of 10
+func (c *spfCheck) countLookup() error {
+	if c.lookups++; c.lookups > SPFMaxLookups {
+		return fmt.Errorf("%w: more than %d DNS lookups", errSPFPermanent, SPFMaxLookups)
+	}
+	return nil
+}
+
+// syntaxError fails the check with permerror for an invalid term when invalid is true
+func (c *spfCheck) syntaxError(invalid bool, term string) error {
+	if !invalid {
+		return nil
+	}
+	return fmt.Errorf("%w: invalid term '%s'", errSPFPermanent, term)
+}
+
+// expand replaces the macros of a domain-spec (RFC 7208 section 7), e.g. %{i}.%{h}._spf.%{d}
+func (c *spfCheck) expand(spec, domain string) (string, error) {
+	var expanded strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			expanded.WriteByte(spec[i])
+			continue
+		}
+		if i+1 == len(spec) {
+			return "", fmt.Errorf("%w: invalid macro in '%s'", errSPFPermanent, spec)
+		}
+		i++
+		switch spec[i] {
+		case '%':
+			expanded.WriteByte('%')
+			continue
+		case '_':
+			expanded.WriteByte(' ')
+			continue
+		case '-':
+			expanded.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", fmt.Errorf("%w: invalid macro in '%s'", errSPFPermanent, spec)
+		}
+
+		end := strings.IndexByte(spec[i:], '}')
+		if end < 2 {
+			return "", fmt.Errorf("%w: invalid macro in '%s'", errSPFPermanent, spec)
+		}
+		macro := spec[i+1 : i+end]
+		i += end
+
+		value, err := c.macroValue(macro[0], domain)
+		if err != nil {
+			return "", fmt.Errorf("%w in '%s'", err, spec)
+		}
+		value, err = transformSPFMacro(value, macro[1:])
+		if err != nil {
+			return "", fmt.Errorf("%w in '%s'", err, spec)
+		}
+		if macro[0] >= 'A' && macro[0] <= 'Z' {
+			value = url.PathEscape(value)
+		}
+		expanded.WriteString(value)
+	}
+
+	// Overlong names keep their rightmost labels (RFC 7208 7.3)
+	result := strings.TrimSuffix(expanded.String(), ".")
+	for len(result) > 253 {
+		_, rest, found := strings.Cut(result, ".")
+		if !found {
+			break
+		}
+		result = rest
+	}
+	return result, nil
+}
+
+// macroValue returns the value of a macro letter before transformers are applied
+func (c *spfCheck) macroValue(letter byte, domain string) (string, error) {
+	local, senderDomain, _ := strings.Cut(c.sender, "@")
+	switch letter | 0x20 {
+	case 's':
+		return c.sender, nil
+	case 'l':
+		return local, nil
+	case 'o':
+		return senderDomain, nil
+	case 'd':
+		return domain, nil
+	case 'i':
+		if c.ip.To4() != nil {
+			return c.ip.String(), nil
+		}
+		nibbles := make([]string, 0, 32)
+		for _, b := range c.ip.To16() {
+			nibbles = append(nibbles, strconv.FormatUint(uint64(b>>4), 16), strconv.FormatUint(uint64(b&0xf), 16))
+		}
+		return strings.Join(nibbles, "."), nil
+	case 'p':
+		return "unknown", nil // Validated reverse names cost lookups the RFC discourages
+	case 'v':
+		if c.ip.To4() != nil {
+			return "in-addr", nil
+		}
+		return "ip6", nil
+	case 'h':
+		return c.helo, nil
+	default:
+		return "", fmt.Errorf("%w: unknown macro letter '%c'", errSPFPermanent, letter)
+	}
+}
+
+// transformSPFMacro applies the digits, reversal and delimiters of a macro to its value
+func transformSPFMacro(value, transformers string) (string, error) {
+	digits := 0
+	for len(transformers) > 0 && transformers[0] >= '0' && transformers[0] <= '9' {
+		digits = digits*10 + int(transformers[0]-'0')
+		transformers = transformers[1:]
+	}
+	reverse := false
+	if len(transformers) > 0 && (transformers[0] == 'r' || transformers[0] == 'R') {
+		reverse, transformers = true, transformers[1:]
+	}
+	if strings.Trim(transformers, ".-+,/_=") != "" {
+		return "", fmt.Errorf("%w: invalid macro delimiters '%s'", errSPFPermanent, transformers)
+	}
+	if transformers == "" {
+		transformers = "."
+	}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(transformers, r) })
+	if reverse {
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+	}
+	if digits > 0 && digits < len(parts) {
+		parts = parts[len(parts)-digits:]
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// validSPFDomain reports whether a domain can have an SPF record: a dotted name of valid length
+func validSPFDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
+
+// validSPFModifierName reports whether name can be a modifier: ALPHA *( ALPHA / DIGIT / "-" / "_" / "." )
+func validSPFModifierName(name string) bool {
+	for i, r := range name {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || !(r >= '0' && r <= '9') && r != '-' && r != '_' && r != '.') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// isDNSNotFound reports whether a lookup failed because the name or record does not exist
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// CheckSPF evaluates SPF for a session's MAIL FROM under SPF_POLICY, or for DMARC_POLICY, returning
+// "" when both are off. LMTP sessions and authenticated senders are not checked
+func (ep *EmailProcessor) CheckSPF(session SessionInfo) (SPFResult, string) {
+	if ep.Config == nil || session.AuthUser != "" {
+		return "", ""
+	}
+	spfOff := ep.Config.SPFPolicy == "" || ep.Config.SPFPolicy == SPFPolicyOff
+	dmarcOff := ep.Config.DMARCPolicy == "" || ep.Config.DMARCPolicy == DMARCOff
+	if spfOff && dmarcOff {
+		return "", ""
+	}
+	ip := net.ParseIP(session.ClientIP())
+	if ip == nil {
+		return "", ""
+	}
+	result, detail := checkSPF(context.Background(), net.DefaultResolver, ip, session.EnvelopeFrom, session.Helo)
+	log.Printf("SPF %s for %s from %s: %s", result, session.EnvelopeFrom, session.ClientIP(), detail)
+	return result, detail
+}
+
+// applySPFAnnotation adds the SPF result of the session below the body under SPF_POLICY=annotate
+// or reject, warning when the sender was not allowed to send
+func (ep *EmailProcessor) applySPFAnnotation(email *ProcessedEmail) {
+	if email.Session.SPF == "" || ep.Config == nil || (ep.Config.SPFPolicy != SPFPolicyAnnotate && ep.Config.SPFPolicy != SPFPolicyReject) {
+		return
+	}
+	note := fmt.Sprintf("SPF: %s (%s)", email.Session.SPF, email.Session.SPFDetail)
+	switch SPFResult(email.Session.SPF) {
+	case SPFFail, SPFSoftFail, SPFPermError:
+		note = "⚠️ " + note
+	}
+	if email.BodyHTML {
+		email.Body += "\n<p>" + html.EscapeString(note) + "</p>"
+	} else {
+		email.Body = strings.TrimLeft(strings.TrimRight(email.Body, " \n")+"\n\n"+note, "\n")
+	}
+}
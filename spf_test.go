@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// fakeResolver answers DNS queries from maps; names without an entry do not exist
+type fakeResolver struct {
+	txt  map[string][]string
+	ips  map[string][]string
+	mx   map[string][]string
+	ptr  map[string][]string
+	fail map[string]bool // Names whose queries time out
+}
+
+func (r *fakeResolver) answer(name string, records map[string][]string) ([]string, error) {
+	if r.fail[name] {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	if values, exists := records[name]; exists {
+		return values, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.answer(name, r.txt)
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	values, err := r.answer(host, r.ips)
+	addrs := make([]net.IPAddr, len(values))
+	for i, value := range values {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(value)}
+	}
+	return addrs, err
+}
+
+func (r *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	values, err := r.answer(name, r.mx)
+	mxs := make([]*net.MX, len(values))
+	for i, value := range values {
+		mxs[i] = &net.MX{Host: value, Pref: 10}
+	}
+	return mxs, err
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return r.answer(addr, r.ptr)
+}
+
+func TestCheckSPF(t *testing.T) {
+	resolver := &fakeResolver{
+		txt: map[string][]string{
+			"ip4.example":       {"v=spf1 ip4:192.0.2.0/24 -all"},
+			"ip6.example":       {"v=spf1 ip6:2001:db8::/32 -all"},
+			"a.example":         {"v=spf1 a -all"},
+			"a-prefix.example":  {"v=spf1 a/24 -all"},
+			"mx.example":        {"v=spf1 mx ~all"},
+			"ptr.example":       {"v=spf1 ptr ?all"},
+			"include.example":   {"v=spf1 include:ip4.example -all"},
+			"exists.example":    {"v=spf1 exists:%{i}.allow.example -all"},
+			"redirect.example":  {"v=spf1 redirect=ip4.example"},
+			"neutral.example":   {"v=spf1 ?ip4:192.0.2.1"},
+			"nothing.example":   {"v=spf1"},
+			"other.example":     {"google-site-verification=abc"},
+			"two.example":       {"v=spf1 -all", "v=spf1 +all"},
+			"syntax.example":    {"v=spf1 ip4:not-an-address -all"},
+			"loop.example":      {"v=spf1 include:loop.example -all"},
+			"void.example":      {"v=spf1 a:x1.example a:x2.example a:x3.example -all"},
+			"noinclude.example": {"v=spf1 include:missing.example -all"},
+			"timeout.example":   {"v=spf1 a:slow.example -all"},
+			"many.example": {"v=spf1 a:h1.example a:h2.example a:h3.example a:h4.example a:h5.example " +
+				"a:h6.example a:h7.example a:h8.example a:h9.example a:h10.example a:h11.example -all"},
+			"helo.example": {"v=spf1 ip4:192.0.2.1 -all"},
+		},
+		ips: map[string][]string{
+			"a.example":               {"192.0.2.1"},
+			"a-prefix.example":        {"192.0.2.200"},
+			"mail.mx.example":         {"192.0.2.2"},
+			"host.ptr.example":        {"192.0.2.3"},
+			"192.0.2.1.allow.example": {"127.0.0.2"},
+			"h1.example":              {"198.51.100.1"},
+			"h2.example":              {"198.51.100.1"},
+			"h3.example":              {"198.51.100.1"},
+			"h4.example":              {"198.51.100.1"},
+			"h5.example":              {"198.51.100.1"},
+			"h6.example":              {"198.51.100.1"},
+			"h7.example":              {"198.51.100.1"},
+			"h8.example":              {"198.51.100.1"},
+			"h9.example":              {"198.51.100.1"},
+			"h10.example":             {"198.51.100.1"},
+			"h11.example":             {"192.0.2.1"},
+		},
+		mx:   map[string][]string{"mx.example": {"mail.mx.example"}},
+		ptr:  map[string][]string{"192.0.2.3": {"host.ptr.example."}},
+		fail: map[string]bool{"slow.example": true},
+	}
+
+	tests := []struct {
+		name   string
+		ip     string
+		from   string
+		helo   string
+		result SPFResult
+	}{
+		{"ip4 match", "192.0.2.10", "a@ip4.example", "", SPFPass},
+		{"ip4 miss", "198.51.100.1", "a@ip4.example", "", SPFFail},
+		{"ip6 match", "2001:db8::1", "a@ip6.example", "", SPFPass},
+		{"ip6 record for ip4 client", "192.0.2.10", "a@ip6.example", "", SPFFail},
+		{"a match", "192.0.2.1", "a@a.example", "", SPFPass},
+		{"a miss", "192.0.2.2", "a@a.example", "", SPFFail},
+		{"a with prefix", "192.0.2.9", "a@a-prefix.example", "", SPFPass},
+		{"mx match", "192.0.2.2", "a@mx.example", "", SPFPass},
+		{"mx miss softfails", "192.0.2.9", "a@mx.example", "", SPFSoftFail},
+		{"ptr match", "192.0.2.3", "a@ptr.example", "", SPFPass},
+		{"ptr miss", "192.0.2.4", "a@ptr.example", "", SPFNeutral},
+		{"include pass", "192.0.2.10", "a@include.example", "", SPFPass},
+		{"include fail falls through", "198.51.100.1", "a@include.example", "", SPFFail},
+		{"exists with macro", "192.0.2.1", "a@exists.example", "", SPFPass},
+		{"exists miss", "192.0.2.5", "a@exists.example", "", SPFFail},
+		{"redirect", "192.0.2.10", "a@redirect.example", "", SPFPass},
+		{"neutral qualifier", "192.0.2.1", "a@neutral.example", "", SPFNeutral},
+		{"no match is neutral", "192.0.2.1", "a@nothing.example", "", SPFNeutral},
+		{"no record", "192.0.2.1", "a@missing.example", "", SPFNone},
+		{"no spf record among txt", "192.0.2.1", "a@other.example", "", SPFNone},
+		{"null sender checks helo", "192.0.2.1", "", "helo.example", SPFPass},
+		{"no domain", "192.0.2.1", "nobody", "", SPFNone},
+		{"two records", "192.0.2.1", "a@two.example", "", SPFPermError},
+		{"invalid ip4", "192.0.2.1", "a@syntax.example", "", SPFPermError},
+		{"include loop", "192.0.2.1", "a@loop.example", "", SPFPermError},
+		{"too many void lookups", "192.0.2.1", "a@void.example", "", SPFPermError},
+		{"include without record", "192.0.2.1", "a@noinclude.example", "", SPFPermError},
+		{"too many lookups", "192.0.2.1", "a@many.example", "", SPFPermError},
+		{"dns timeout", "192.0.2.1", "a@timeout.example", "", SPFTempError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, detail := checkSPF(context.Background(), resolver, net.ParseIP(tt.ip), tt.from, tt.helo)
+			if result != tt.result {
+				t.Errorf("checkSPF(%s, %q) = %s (%s), want %s", tt.ip, tt.from, result, detail, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Attachment Spool Configuration
+const (
+	DefaultAttachmentSpoolBytes = 256 * 1024 // Attachments larger than this are spooled when spooling is on
+)
+
+// AttachmentSpool writes large attachments to temporary files instead of keeping them in memory
+type AttachmentSpool struct {
+	Dir      string // "" uses the system temporary directory
+	MinBytes int    // Attachments up to this size stay in memory; 0 spools every attachment
+}
+
+// store reads an attachment body, keeping it in memory when it is small and spooling it to disk otherwise.
+// At most limit bytes are read
+func (s *AttachmentSpool) store(attachment *Attachment, r io.Reader, limit int64) error {
+	r = io.LimitReader(r, limit)
+
+	// Buffer up to the threshold; only content beyond it goes to disk
+	var head bytes.Buffer
+	n, err := io.CopyN(&head, r, int64(s.MinBytes)+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n <= int64(s.MinBytes) {
+		attachment.Data = head.Bytes()
+		attachment.Size = n
+		return nil
+	}
+
+	file, err := os.CreateTemp(s.Dir, "email2dm-attachment-*")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, io.MultiReader(&head, r))
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to spool attachment: %w", err)
+	}
+
+	attachment.SpoolPath = file.Name()
+	attachment.Size = size
+	return nil
+}
+
+// Content returns the attachment body, reading it back from the spool file if needed
+func (a Attachment) Content() ([]byte, error) {
+	if a.SpoolPath == "" {
+		return a.Data, nil
+	}
+	data, err := os.ReadFile(a.SpoolPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spooled attachment %s: %w", a.Filename, err)
+	}
+	return data, nil
+}
+
+// Cleanup removes the spool files of the email's attachments
+func (email *ProcessedEmail) Cleanup() {
+	removeSpooledAttachments(email.Attachments)
+	removeSpooledAttachments(email.InlineImages)
+}
+
+// removeSpooledAttachments deletes the spool files of attachments that were written to disk
+func removeSpooledAttachments(attachments []Attachment) {
+	for _, attachment := range attachments {
+		if attachment.SpoolPath != "" {
+			os.Remove(attachment.SpoolPath)
+		}
+	}
+}
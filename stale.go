@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MaxSentDateSkew is how far the Date header may be from the earliest Received stamp before the
+// sender's clock is considered wrong and Date is ignored
+const MaxSentDateSkew = 15 * time.Minute
+
+// Stale Message Policies
+const (
+	StaleMark = "mark" // Deliver with a note saying when the message was sent (default)
+	StaleDrop = "drop" // Accept the message but do not deliver it
+)
+
+// parseStalePolicy validates STALE_POLICY and the stale destination option
+func parseStalePolicy(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return StaleMark, nil
+	case StaleMark, StaleDrop:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid stale policy '%s': use mark or drop", value)
+	}
+}
+
+// StaleGuard is how old mail for a destination may be before STALE_POLICY applies
+type StaleGuard struct {
+	MaxAge time.Duration // 0 disables the guard
+	Policy string
+}
+
+// staleGuard combines MAX_MESSAGE_AGE and STALE_POLICY with the destination's options
+func (ep *EmailProcessor) staleGuard(options DestinationOptions) (StaleGuard, error) {
+	guard := StaleGuard{Policy: StaleMark}
+	if ep.Config != nil {
+		guard.MaxAge = ep.Config.MaxMessageAge
+		if ep.Config.StalePolicy != "" {
+			guard.Policy = ep.Config.StalePolicy
+		}
+	}
+	return staleGuardOptions(options, guard)
+}
+
+// staleGuardOptions applies the "maxage" and "stale" options of a destination to guard
+func staleGuardOptions(options DestinationOptions, guard StaleGuard) (StaleGuard, error) {
+	if options.Has("maxage") {
+		switch value := strings.ToLower(options.Get("maxage")); value {
+		case "off", "0":
+			guard.MaxAge = 0
+		default:
+			age, err := time.ParseDuration(value)
+			if err != nil || age < time.Minute {
+				return guard, fmt.Errorf("invalid maxage option '%s': use a duration of at least 1m such as 30m, or off", options.Get("maxage"))
+			}
+			guard.MaxAge = age
+		}
+	}
+	if options.Has("stale") {
+		policy, err := parseStalePolicy(options.Get("stale"))
+		if err != nil {
+			return guard, err
+		}
+		guard.Policy = policy
+	}
+	return guard, nil
+}
+
+// messageSentTime returns when a message was sent. The earliest Received stamp, written by an
+// MTA, is trusted over the Date header, which the sender's clock sets: Date is only used within
+// MaxSentDateSkew of that stamp, or when no Received header can be read. It is zero when neither
+// can be read
+func messageSentTime(header mail.Header) time.Time {
+	var received time.Time
+	for _, field := range header["Received"] {
+		if _, stamp, found := strings.Cut(field, ";"); found {
+			if stamped, err := mail.ParseDate(strings.TrimSpace(stamp)); err == nil && (received.IsZero() || stamped.Before(received)) {
+				received = stamped
+			}
+		}
+	}
+
+	date, err := mail.ParseDate(header.Get("Date"))
+	if err != nil {
+		return received
+	}
+	if !received.IsZero() {
+		if skew := date.Sub(received); skew > MaxSentDateSkew || skew < -MaxSentDateSkew {
+			return received
+		}
+	}
+	return date
+}
+
+// applyStaleGuard checks the age of an email against the destination's guard. It returns false
+// when the email is too old and should be dropped; under the mark policy, and for pages, a note
+// with the time the email was sent goes above the body instead
+func (ep *EmailProcessor) applyStaleGuard(email *ProcessedEmail, guard StaleGuard) bool {
+	if guard.MaxAge <= 0 || email.Sent.IsZero() {
+		return true
+	}
+	age := time.Since(email.Sent)
+	if age <= guard.MaxAge {
+		return true
+	}
+	if guard.Policy == StaleDrop && !email.Page {
+		return false
+	}
+
+	note := fmt.Sprintf("⏱ Delayed: originally sent at %s, %s ago", email.Sent.UTC().Format("2006-01-02 15:04:05 UTC"), formatSnooze(age.Round(time.Minute)))
+	if email.BodyHTML {
+		email.Body = "<p>" + html.EscapeString(note) + "</p>\n" + email.Body
+	} else {
+		email.Body = strings.TrimSpace(note + "\n\n" + email.Body)
+	}
+	return true
+}
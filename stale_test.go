@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/mail"
+	"testing"
+	"time"
+)
+
+func TestMessageSentTime(t *testing.T) {
+	const (
+		firstHop = "from relay.example.com by mx.example.net; Sat, 17 Oct 2026 10:00:00 +0000"
+		lastHop  = "from mx.example.net by bridge.example.net; Sat, 17 Oct 2026 12:00:00 +0000"
+	)
+	firstHopTime := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		date     string
+		received []string
+		want     time.Time
+	}{
+		{"date close to first hop", "Sat, 17 Oct 2026 09:55:00 +0000", []string{lastHop, firstHop}, time.Date(2026, 10, 17, 9, 55, 0, 0, time.UTC)},
+		{"date from a slow clock", "Fri, 16 Oct 2026 10:00:00 +0000", []string{lastHop, firstHop}, firstHopTime},
+		{"date from a fast clock", "Sun, 18 Oct 2026 10:00:00 +0000", []string{lastHop, firstHop}, firstHopTime},
+		{"hops out of order", "", []string{firstHop, lastHop}, firstHopTime},
+		{"no date", "", []string{lastHop, firstHop}, firstHopTime},
+		{"no received", "Fri, 16 Oct 2026 10:00:00 +0000", nil, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)},
+		{"unreadable stamps", "Fri, 16 Oct 2026 10:00:00 +0000", []string{"from a by b", "from c by d; yesterday"}, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)},
+		{"nothing readable", "soon", nil, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := mail.Header{"Received": tt.received}
+			if tt.date != "" {
+				header["Date"] = []string{tt.date}
+			}
+			if got := messageSentTime(header); !got.Equal(tt.want) {
+				t.Errorf("messageSentTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+//go:build !minimal && !nobbolt
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultStateBackend is used when STATE_BACKEND is not set
+const DefaultStateBackend = StateBackendBolt
+
+var (
+	boltMetaBucket   = []byte("meta")
+	boltCachesBucket = []byte("caches")
+)
+
+// boltStateBackend keeps each cache under its own key of a bbolt file, so saves only rewrite
+// the pages that changed
+type boltStateBackend struct {
+	db *bolt.DB
+}
+
+// openBoltStateBackend opens or creates the bbolt file at path
+func openBoltStateBackend(path string) (stateBackend, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %s: %w", path, err)
+	}
+	return &boltStateBackend{db: db}, nil
+}
+
+func (b *boltStateBackend) load() (*stateFile, error) {
+	var state *stateFile
+	err := b.db.View(func(tx *bolt.Tx) error {
+		meta, caches := tx.Bucket(boltMetaBucket), tx.Bucket(boltCachesBucket)
+		if meta == nil || caches == nil {
+			return nil
+		}
+
+		state = &stateFile{Caches: make(map[string]json.RawMessage)}
+		version, err := strconv.Atoi(string(meta.Get([]byte("version"))))
+		if err != nil {
+			return fmt.Errorf("invalid version: %w", err)
+		}
+		state.Version = version
+		if err := state.Saved.UnmarshalText(meta.Get([]byte("saved"))); err != nil {
+			return fmt.Errorf("invalid save time: %w", err)
+		}
+		return caches.ForEach(func(name, raw []byte) error {
+			// Values are only valid during the transaction
+			state.Caches[string(name)] = append(json.RawMessage(nil), raw...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state database %s: %w", b, err)
+	}
+	return state, nil
+}
+
+func (b *boltStateBackend) save(state *stateFile) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		caches, err := tx.CreateBucketIfNotExists(boltCachesBucket)
+		if err != nil {
+			return err
+		}
+		saved, err := state.Saved.MarshalText()
+		if err != nil {
+			return err
+		}
+		if err := meta.Put([]byte("version"), []byte(strconv.Itoa(state.Version))); err != nil {
+			return err
+		}
+		if err := meta.Put([]byte("saved"), saved); err != nil {
+			return err
+		}
+		for name, raw := range state.Caches {
+			if err := caches.Put([]byte(name), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write state database %s: %w", b, err)
+	}
+	return nil
+}
+
+func (b *boltStateBackend) close() error {
+	return b.db.Close()
+}
+
+func (b *boltStateBackend) String() string {
+	return b.db.Path()
+}
@@ -0,0 +1,15 @@
+//go:build minimal || nobbolt
+
+package main
+
+func init() {
+	excludeFeature("bbolt", "nobbolt")
+}
+
+// DefaultStateBackend is used when STATE_BACKEND is not set
+const DefaultStateBackend = StateBackendJSON
+
+// openBoltStateBackend reports that bbolt support was compiled out
+func openBoltStateBackend(path string) (stateBackend, error) {
+	return nil, requireFeature("bbolt")
+}
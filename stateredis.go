@@ -0,0 +1,69 @@
+//go:build !minimal && !noredis
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StateRedisKey holds the state snapshot; bridges running at the same time use separate databases
+const StateRedisKey = "email2dm:state"
+
+// redisStateBackend keeps the snapshot in a Redis key, so a replacement instance on another host
+// picks up the same threads. The snapshot is written as a whole, so it serves one running bridge
+// at a time: two bridges on one key would overwrite each other's state
+type redisStateBackend struct {
+	client *RedisClient
+}
+
+// newRedisStateBackend connects to the server in REDIS_URL
+func newRedisStateBackend(options *RedisOptions) (stateBackend, error) {
+	if options == nil {
+		return nil, fmt.Errorf("STATE_BACKEND=redis requires REDIS_URL")
+	}
+	client := NewRedisClient(*options, "")
+	if err := client.TestConnection(); err != nil {
+		return nil, fmt.Errorf("failed to connect to the state server: %w", err)
+	}
+	return &redisStateBackend{client: client}, nil
+}
+
+func (b *redisStateBackend) load() (*stateFile, error) {
+	reply, err := b.client.do("GET", StateRedisKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state from %s: %w", b, err)
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return nil, nil
+	}
+
+	var state stateFile
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state from %s: %w", b, err)
+	}
+	return &state, nil
+}
+
+func (b *redisStateBackend) save(state *stateFile) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if _, err := b.client.do("SET", StateRedisKey, string(data)); err != nil {
+		return fmt.Errorf("failed to write state to %s: %w", b, err)
+	}
+	return nil
+}
+
+func (b *redisStateBackend) close() error {
+	b.client.connMutex.Lock()
+	defer b.client.connMutex.Unlock()
+	b.client.close()
+	return nil
+}
+
+func (b *redisStateBackend) String() string {
+	return fmt.Sprintf("redis://%s/%d (key %s)", b.client.Options.Addr, b.client.Options.DB, StateRedisKey)
+}
@@ -0,0 +1,105 @@
+//go:build cgo && !minimal && !nosqlite
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStateSchema creates the tables on first use
+const sqliteStateSchema = `
+CREATE TABLE IF NOT EXISTS state_meta (version INTEGER NOT NULL, saved TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS state_caches (name TEXT PRIMARY KEY, data BLOB NOT NULL);
+`
+
+// sqliteStateBackend keeps each cache in a row of a SQLite database, which other tools can
+// query and back up while the bridge runs
+type sqliteStateBackend struct {
+	db   *sql.DB
+	path string
+}
+
+// openSQLiteStateBackend opens or creates the SQLite database at path
+func openSQLiteStateBackend(path string) (stateBackend, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteStateSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open state database %s: %w", path, err)
+	}
+	return &sqliteStateBackend{db: db, path: path}, nil
+}
+
+func (b *sqliteStateBackend) load() (*stateFile, error) {
+	state := &stateFile{Caches: make(map[string]json.RawMessage)}
+	var saved string
+	err := b.db.QueryRow("SELECT version, saved FROM state_meta").Scan(&state.Version, &saved)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state database %s: %w", b.path, err)
+	}
+	if state.Saved, err = time.Parse(time.RFC3339Nano, saved); err != nil {
+		return nil, fmt.Errorf("failed to read state database %s: invalid save time: %w", b.path, err)
+	}
+
+	rows, err := b.db.Query("SELECT name, data FROM state_caches")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state database %s: %w", b.path, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var raw []byte
+		if err := rows.Scan(&name, &raw); err != nil {
+			return nil, fmt.Errorf("failed to read state database %s: %w", b.path, err)
+		}
+		state.Caches[name] = raw
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read state database %s: %w", b.path, err)
+	}
+	return state, nil
+}
+
+func (b *sqliteStateBackend) save(state *stateFile) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write state database %s: %w", b.path, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM state_meta"); err != nil {
+		return fmt.Errorf("failed to write state database %s: %w", b.path, err)
+	}
+	if _, err := tx.Exec("INSERT INTO state_meta (version, saved) VALUES (?, ?)", state.Version, state.Saved.Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("failed to write state database %s: %w", b.path, err)
+	}
+	for name, raw := range state.Caches {
+		if _, err := tx.Exec("INSERT OR REPLACE INTO state_caches (name, data) VALUES (?, ?)", name, []byte(raw)); err != nil {
+			return fmt.Errorf("failed to write state database %s: %w", b.path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write state database %s: %w", b.path, err)
+	}
+	return nil
+}
+
+func (b *sqliteStateBackend) close() error {
+	return b.db.Close()
+}
+
+func (b *sqliteStateBackend) String() string {
+	return b.path
+}
@@ -0,0 +1,12 @@
+//go:build !cgo || minimal || nosqlite
+
+package main
+
+func init() {
+	excludeFeature("sqlite", "nosqlite")
+}
+
+// openSQLiteStateBackend reports that SQLite support was compiled out
+func openSQLiteStateBackend(path string) (stateBackend, error) {
+	return nil, requireFeature("sqlite")
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State Store Configuration
+const (
+	StateFileVersion  = 1
+	StateSaveInterval = 1 * time.Minute // Crashes lose at most this much state
+)
+
+// State Backends
+const (
+	StateBackendBolt   = "bbolt"  // Embedded key/value file
+	StateBackendSQLite = "sqlite" // SQLite database file
+	StateBackendRedis  = "redis"  // Redis server, shared by several bridges
+	StateBackendJSON   = "json"   // JSON document, rewritten on every save
+)
+
+// persistentCache is an in-memory cache whose entries survive restarts through the StateStore
+type persistentCache interface {
+	saveState() (json.RawMessage, error)
+	loadState(data json.RawMessage) error
+}
+
+// stateFile is a snapshot of the registered caches, written as a JSON document by the json backend
+type stateFile struct {
+	Version int                        `json:"version"`
+	Saved   time.Time                  `json:"saved"`
+	Caches  map[string]json.RawMessage `json:"caches"`
+}
+
+// stateBackend is where the StateStore keeps its snapshots
+type stateBackend interface {
+	// load returns the last snapshot, or nil when nothing was saved yet
+	load() (*stateFile, error)
+	save(state *stateFile) error
+	close() error
+	String() string
+}
+
+// parseStateBackend validates STATE_BACKEND; the default depends on the build
+func parseStateBackend(value string) (string, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(value)); backend {
+	case "":
+		return DefaultStateBackend, nil
+	case StateBackendBolt, StateBackendSQLite, StateBackendRedis, StateBackendJSON:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("invalid STATE_BACKEND '%s': use bbolt, sqlite, redis or json", value)
+	}
+}
+
+// openStateBackend opens the configured backend; path is STATE_FILE for the file-based ones
+func openStateBackend(backend, path string, redisOptions *RedisOptions) (stateBackend, error) {
+	switch backend {
+	case StateBackendBolt:
+		return openBoltStateBackend(path)
+	case StateBackendSQLite:
+		return openSQLiteStateBackend(path)
+	case StateBackendRedis:
+		return newRedisStateBackend(redisOptions)
+	default:
+		return &jsonStateBackend{path: path}, nil
+	}
+}
+
+// isJSONStateFile reports whether path holds a state file written before STATE_BACKEND existed
+func isJSONStateFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, 64)
+	n, _ := file.Read(head)
+	return strings.HasPrefix(strings.TrimSpace(string(head[:n])), "{")
+}
+
+// StateStore keeps thread and coalescing caches in a backend, so a restart does not start new
+// threads for ongoing conversations or re-post alerts that were being folded
+type StateStore struct {
+	backend stateBackend
+
+	mutex  sync.Mutex
+	caches map[string]persistentCache
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewStateStore creates a store that keeps its snapshots in backend
+func NewStateStore(backend stateBackend) *StateStore {
+	return &StateStore{
+		backend: backend,
+		caches:  make(map[string]persistentCache),
+	}
+}
+
+// Register adds a cache under a stable name; caches are restored by that name
+func (s *StateStore) Register(name string, cache persistentCache) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.caches[name] = cache
+}
+
+// Load restores the registered caches from the backend. Nothing saved yet is a first start;
+// entries of caches that are no longer registered are ignored
+func (s *StateStore) Load() error {
+	state, err := s.backend.load()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+	if state.Version != StateFileVersion {
+		log.Printf("Warning: ignoring state in %s with unsupported version %d", s.backend, state.Version)
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for name, cache := range s.caches {
+		if raw, exists := state.Caches[name]; exists {
+			if err := cache.loadState(raw); err != nil {
+				return fmt.Errorf("failed to restore %s from %s: %w", name, s.backend, err)
+			}
+		}
+	}
+
+	log.Printf("Restored state saved at %s from %s", state.Saved.Format(time.RFC3339), s.backend)
+	return nil
+}
+
+// Save writes the registered caches to the backend
+func (s *StateStore) Save() error {
+	s.mutex.Lock()
+	state := stateFile{Version: StateFileVersion, Saved: time.Now().UTC(), Caches: make(map[string]json.RawMessage)}
+	for name, cache := range s.caches {
+		raw, err := cache.saveState()
+		if err != nil {
+			s.mutex.Unlock()
+			return fmt.Errorf("failed to save %s: %w", name, err)
+		}
+		state.Caches[name] = raw
+	}
+	s.mutex.Unlock()
+
+	return s.backend.save(&state)
+}
+
+// Start saves the state periodically until Stop is called
+func (s *StateStore) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(StateSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Save(); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic saving, writes the final state and closes the backend
+func (s *StateStore) Stop() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	err := s.Save()
+	if closeErr := s.backend.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// jsonStateBackend keeps the snapshot as a JSON document that is replaced on every save
+type jsonStateBackend struct {
+	path string
+}
+
+func (b *jsonStateBackend) load() (*stateFile, error) {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", b.path, err)
+	}
+	return &state, nil
+}
+
+func (b *jsonStateBackend) save(state *stateFile) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// A crash mid-write must not leave a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), b.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+func (b *jsonStateBackend) close() error {
+	return nil
+}
+
+func (b *jsonStateBackend) String() string {
+	return b.path
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Syslog Field Configuration
+const (
+	SyslogEscape            = "escape" // Write newlines and control characters as \n, \t, \x1b (default)
+	SyslogStrip             = "strip"  // Replace runs of them with a space
+	SyslogQuote             = "quote"  // Quote values with spaces, quotes, = or control characters, as logfmt does
+	DefaultSyslogFieldChars = 512      // Characters kept of each field value
+)
+
+// parseSyslogEscaping validates SYSLOG_FIELD_ESCAPING
+func parseSyslogEscaping(value string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(value)); policy {
+	case "":
+		return SyslogEscape, nil
+	case SyslogEscape, SyslogStrip, SyslogQuote:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid SYSLOG_FIELD_ESCAPING value '%s': use escape/strip/quote", value)
+	}
+}
+
+// syslogField makes a value safe for a key=value syslog line: a multi-line subject or error must
+// not start a line of its own that log parsers read as a new event
+func (ep *EmailProcessor) syslogField(value string) string {
+	policy, limit := SyslogEscape, DefaultSyslogFieldChars
+	if ep.Config != nil {
+		if ep.Config.SyslogEscaping != "" {
+			policy = ep.Config.SyslogEscaping
+		}
+		if ep.Config.SyslogFieldChars > 0 {
+			limit = ep.Config.SyslogFieldChars
+		}
+	}
+
+	if runes := []rune(value); len(runes) > limit {
+		value = string(runes[:limit]) + "..."
+	}
+
+	switch policy {
+	case SyslogStrip:
+		return strings.Join(strings.FieldsFunc(value, unicode.IsControl), " ")
+	case SyslogQuote:
+		if value != "" && !strings.ContainsFunc(value, func(r rune) bool {
+			return r == ' ' || r == '"' || r == '=' || unicode.IsControl(r)
+		}) {
+			return value
+		}
+		return strconv.Quote(value)
+	default:
+		return escapeSyslogValue(value)
+	}
+}
+
+// escapeSyslogValue writes control characters and backslashes as Go escapes, so a line can be
+// unescaped to the original value
+func escapeSyslogValue(value string) string {
+	if !strings.ContainsFunc(value, func(r rune) bool { return r == '\\' || unicode.IsControl(r) }) {
+		return value
+	}
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case unicode.IsControl(r):
+			quoted := strconv.QuoteRune(r)
+			b.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -2,56 +2,86 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Telegram Configuration
 const (
-	TelegramAPIURL     = "https://api.telegram.org/bot%s/sendMessage"
-	MaxMessageLength   = 4096                   // Telegram's message limit
-	MessageSendDelay   = 500 * time.Millisecond // Delay between message chunks
-	HTTPRequestTimeout = 10 * time.Second
+	TelegramAPIURL         = "https://api.telegram.org"
+	MaxMessageLength       = 4096 // Telegram's message limit
+	MaxCaptionLength       = 1024 // Telegram's media caption limit
+	DefaultTelegramRetries = 3    // Retries of a rate-limited API call
+	TelegramMaxRetryAfter  = 5 * time.Minute
+	TelegramMaxUploadBytes = 50 * 1024 * 1024       // Largest file a bot can send
+	TelegramMaxPhotoBytes  = 10 * 1024 * 1024       // Larger images are sent as documents
+	TelegramMaxUploads     = 10                     // Attachments uploaded per email
+	TelegramInlineImages   = 5                      // Embedded images sent as photos per email
+	TelegramMediaGroupMax  = 10                     // Photos per sendMediaGroup album
+	MessageSendDelay       = 500 * time.Millisecond // Delay between message chunks
+	HTTPRequestTimeout     = 10 * time.Second
 )
 
 // TelegramMessage represents a message payload for Telegram API
 type TelegramMessage struct {
-	ChatID    string `json:"chat_id"`
-	Text      string `json:"text"`
-	ParseMode string `json:"parse_mode"`
+	ChatID              string `json:"chat_id"`
+	MessageThreadID     int64  `json:"message_thread_id,omitempty"` // Forum topic in supergroups
+	Text                string `json:"text"`
+	ParseMode           string `json:"parse_mode"`
+	DisableNotification bool   `json:"disable_notification,omitempty"` // Deliver without a sound
+
+	ReplyMarkup *TelegramInlineKeyboard `json:"reply_markup,omitempty"` // Buttons below the message
 }
 
 // TelegramClient handles all Telegram API interactions
 type TelegramClient struct {
 	BotToken   string
-	APIUrl     string
+	APIURL     string // Bot API server, replaced by TELEGRAM_API_URL for tests against fake APIs
 	HTTPClient *http.Client
+
+	UploadAttachments  bool             // Send email attachments after the message
+	AttachmentMaxBytes int64            // Larger attachments are skipped
+	AttachmentTypes    []string         // Allowed content types such as "image/*"; empty allows all
+	InlineImages       int              // Embedded images sent as photos per email; 0 drops them
+	InlineMaxBytes     int64            // Larger embedded images are skipped
+	RateLimitRetries   int              // Retries of API calls answered with 429
+	Limiter            *TelegramLimiter // Spaces out messages per chat; nil sends immediately
 }
 
 // NewTelegramClient creates a new Telegram client
 func NewTelegramClient(botToken string) *TelegramClient {
 	return &TelegramClient{
 		BotToken: botToken,
-		APIUrl:   fmt.Sprintf(TelegramAPIURL, botToken),
+		APIURL:   TelegramAPIURL,
 		HTTPClient: &http.Client{
 			Timeout: HTTPRequestTimeout,
 		},
+		AttachmentMaxBytes: TelegramMaxUploadBytes,
+		InlineImages:       TelegramInlineImages,
+		InlineMaxBytes:     TelegramMaxPhotoBytes,
+		RateLimitRetries:   DefaultTelegramRetries,
+		Limiter:            NewTelegramLimiter(),
 	}
 }
 
-// SendLongMessageToChat handles long messages by splitting them into chunks for a specific chat
-func (tc *TelegramClient) SendLongMessageToChat(text, chatID string) error {
-	if len(text) <= MaxMessageLength {
-		return tc.SendMessageToChat(text, chatID)
+// SendLongMessageToChat handles long messages by splitting them into chunks for a specific chat,
+// keeping the HTML markup of each chunk well-formed
+func (tc *TelegramClient) SendLongMessageToChat(ctx context.Context, text, chatID string) error {
+	chunks := chunkHTMLForDestination(ctx, text, MaxMessageLength)
+	if len(chunks) == 1 {
+		return tc.SendMessageToChat(ctx, chunks[0], chatID)
 	}
 
-	log.Printf("Message too long (%d chars), splitting into chunks for chat %s", len(text), chatID)
-	chunks := tc.splitMessage(text)
+	log.Printf("Message too long (%d chars), splitting into %d chunks for chat %s", len(text), len(chunks), chatID)
 
 	for i, chunk := range chunks {
 		// Add part number for continuation messages
@@ -59,12 +89,18 @@ func (tc *TelegramClient) SendLongMessageToChat(text, chatID string) error {
 			chunk = fmt.Sprintf("[Part %d]\n%s", i+1, chunk)
 		}
 
-		if err := tc.SendMessageToChat(chunk, chatID); err != nil {
+		// Buttons go below the last part only
+		chunkCtx := ctx
+		if i < len(chunks)-1 {
+			chunkCtx = withTelegramKeyboard(ctx, nil)
+		}
+
+		if err := tc.SendMessageToChat(chunkCtx, chunk, chatID); err != nil {
 			return fmt.Errorf("failed to send chunk %d/%d to chat %s: %w", i+1, len(chunks), chatID, err)
 		}
 
-		// Add delay between messages to avoid rate limiting
-		if i < len(chunks)-1 {
+		// Without the limiter, a fixed delay between messages avoids rate limiting
+		if i < len(chunks)-1 && tc.Limiter == nil {
 			log.Printf("Sent chunk %d/%d to chat %s, waiting before next...", i+1, len(chunks), chatID)
 			time.Sleep(MessageSendDelay)
 		}
@@ -75,16 +111,19 @@ func (tc *TelegramClient) SendLongMessageToChat(text, chatID string) error {
 }
 
 // SendMessageToChat sends a message to a specific chat ID
-func (tc *TelegramClient) SendMessageToChat(text, chatID string) error {
-	return tc.SendMessageToChatWithParseMode(text, chatID, "HTML")
+func (tc *TelegramClient) SendMessageToChat(ctx context.Context, text, chatID string) error {
+	return tc.SendMessageToChatWithParseMode(ctx, text, chatID, "HTML")
 }
 
 // SendMessageToChatWithParseMode sends a message to a specific chat with specified parse mode
-func (tc *TelegramClient) SendMessageToChatWithParseMode(text, chatID, parseMode string) error {
+func (tc *TelegramClient) SendMessageToChatWithParseMode(ctx context.Context, text, chatID, parseMode string) error {
 	message := TelegramMessage{
-		ChatID:    chatID,
-		Text:      text,
-		ParseMode: parseMode,
+		ChatID:              chatID,
+		MessageThreadID:     telegramTopicFrom(ctx),
+		Text:                text,
+		ParseMode:           parseMode,
+		DisableNotification: telegramSilentFrom(ctx),
+		ReplyMarkup:         telegramKeyboardFrom(ctx),
 	}
 
 	jsonData, err := json.Marshal(message)
@@ -92,110 +131,299 @@ func (tc *TelegramClient) SendMessageToChatWithParseMode(text, chatID, parseMode
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
+	if tc.Limiter != nil {
+		if err := tc.Limiter.Wait(ctx, chatID); err != nil {
+			return fmt.Errorf("gave up waiting for Telegram rate limit: %w", err)
+		}
+	}
+
 	log.Printf("Sending message to Telegram chat %s (length: %d)", chatID, len(text))
 
-	resp, err := tc.HTTPClient.Post(tc.APIUrl, "application/json", bytes.NewBuffer(jsonData))
+	var result struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := tc.callAPI(ctx, tc.methodURL("sendMessage"), "application/json", jsonData, &result); err != nil {
+		return err
+	}
+	deliveryReceiptFrom(ctx).recordMessage(fmt.Sprintf("%d", result.MessageID))
+	recordTelegramSent(ctx, result.MessageID)
+
+	log.Printf("Message %d sent successfully to Telegram chat %s", result.MessageID, chatID)
+	return nil
+}
+
+// SendPlainMessage sends a message without HTML formatting to a specific chat
+func (tc *TelegramClient) SendPlainMessage(ctx context.Context, text, chatID string) error {
+	return tc.SendMessageToChatWithParseMode(ctx, text, chatID, "")
+}
+
+// SendDocumentToChat uploads a file to a specific chat via sendDocument
+func (tc *TelegramClient) SendDocumentToChat(ctx context.Context, filename string, data []byte, caption, chatID string) error {
+	return tc.sendFile(ctx, "sendDocument", "document", filename, data, caption, chatID)
+}
+
+// SendPhotoToChat uploads an image to a specific chat via sendPhoto, so it is shown inline
+func (tc *TelegramClient) SendPhotoToChat(ctx context.Context, filename string, data []byte, caption, chatID string) error {
+	return tc.sendFile(ctx, "sendPhoto", "photo", filename, data, caption, chatID)
+}
+
+// TelegramUpload is a file to send; photos may be sent alone or in a media group
+type TelegramUpload struct {
+	Filename string
+	Data     []byte
+	Caption  string // Shown when the file is sent on its own
+}
+
+// SendMediaGroupToChat uploads 2 to 10 images as one album via sendMediaGroup, with the caption on the first
+func (tc *TelegramClient) SendMediaGroupToChat(ctx context.Context, photos []TelegramUpload, caption, chatID string) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writeTelegramFileFields(ctx, writer, chatID)
+
+	// Each item refers to its file part by name
+	media := make([]map[string]string, len(photos))
+	size := 0
+	for i, photo := range photos {
+		name := fmt.Sprintf("photo%d", i)
+		media[i] = map[string]string{"type": "photo", "media": "attach://" + name}
+		part, err := writer.CreateFormFile(name, photo.Filename)
+		if err != nil {
+			return fmt.Errorf("failed to create form file: %w", err)
+		}
+		if _, err := part.Write(photo.Data); err != nil {
+			return fmt.Errorf("failed to write photo: %w", err)
+		}
+		size += len(photo.Data)
+	}
+	if caption = truncateTelegramCaption(caption); caption != "" {
+		media[0]["caption"] = caption
+	}
+	encoded, err := json.Marshal(media)
 	if err != nil {
-		return fmt.Errorf("failed to send HTTP request: %w", err)
+		return fmt.Errorf("failed to encode media group: %w", err)
+	}
+	writer.WriteField("media", string(encoded))
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish form: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("telegram API error: %d - %s", resp.StatusCode, string(body))
+	if tc.Limiter != nil {
+		if err := tc.Limiter.Wait(ctx, chatID); err != nil {
+			return fmt.Errorf("gave up waiting for Telegram rate limit: %w", err)
+		}
 	}
 
-	log.Printf("Message sent successfully to Telegram chat %s", chatID)
+	log.Printf("Sending media group of %d photos to Telegram chat %s (size: %d)", len(photos), chatID, size)
+	if err := tc.callAPI(ctx, tc.methodURL("sendMediaGroup"), writer.FormDataContentType(), body.Bytes(), nil); err != nil {
+		return err
+	}
+	log.Printf("Media group of %d photos sent successfully to Telegram chat %s", len(photos), chatID)
 	return nil
 }
 
-// SendPlainMessage sends a message without HTML formatting to a specific chat
-func (tc *TelegramClient) SendPlainMessage(text, chatID string) error {
-	return tc.SendMessageToChatWithParseMode(text, chatID, "")
-}
-func (tc *TelegramClient) splitMessage(text string) []string {
-	var chunks []string
-	lines := strings.Split(text, "\n")
-	var currentChunk strings.Builder
-
-	for _, line := range lines {
-		// Check if adding this line would exceed the limit
-		if currentChunk.Len()+len(line)+1 > MaxMessageLength {
-			// Save current chunk if it has content
-			if currentChunk.Len() > 0 {
-				chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
-				currentChunk.Reset()
-			}
+// truncateTelegramCaption shortens a caption to Telegram's limit
+func truncateTelegramCaption(caption string) string {
+	if len(caption) > MaxCaptionLength {
+		return caption[:MaxCaptionLength-3] + "..."
+	}
+	return caption
+}
 
-			// Handle very long lines by wrapping them
-			if len(line) > MaxMessageLength-100 {
-				wrappedLines := tc.wrapLongLine(line, MaxMessageLength-100)
-				for j, wrappedLine := range wrappedLines {
-					if j == 0 && currentChunk.Len() == 0 {
-						// First wrapped line can go in current chunk
-						currentChunk.WriteString(wrappedLine)
-					} else {
-						// Additional wrapped lines become separate chunks
-						if currentChunk.Len() > 0 {
-							chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
-							currentChunk.Reset()
-						}
-						currentChunk.WriteString(wrappedLine)
-					}
-				}
-			} else {
-				currentChunk.WriteString(line)
-			}
-		} else {
-			// Add line to current chunk
-			if currentChunk.Len() > 0 {
-				currentChunk.WriteString("\n")
-			}
-			currentChunk.WriteString(line)
+// writeTelegramFileFields writes the chat, forum topic and notification fields of an upload
+func writeTelegramFileFields(ctx context.Context, writer *multipart.Writer, chatID string) {
+	writer.WriteField("chat_id", chatID)
+	if topicID := telegramTopicFrom(ctx); topicID != 0 {
+		writer.WriteField("message_thread_id", strconv.FormatInt(topicID, 10))
+	}
+	if telegramSilentFrom(ctx) {
+		writer.WriteField("disable_notification", "true")
+	}
+}
+
+// sendFile uploads data as the named multipart field of a Bot API file method
+func (tc *TelegramClient) sendFile(ctx context.Context, method, field, filename string, data []byte, caption, chatID string) error {
+	caption = truncateTelegramCaption(caption)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writeTelegramFileFields(ctx, writer, chatID)
+	if caption != "" {
+		writer.WriteField("caption", caption)
+	}
+
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", field, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish form: %w", err)
+	}
+
+	if tc.Limiter != nil {
+		if err := tc.Limiter.Wait(ctx, chatID); err != nil {
+			return fmt.Errorf("gave up waiting for Telegram rate limit: %w", err)
 		}
 	}
 
-	// Don't forget the last chunk
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+	log.Printf("Sending %s %s to Telegram chat %s (size: %d)", field, filename, chatID, len(data))
+
+	url := tc.methodURL(method)
+	if err := tc.callAPI(ctx, url, writer.FormDataContentType(), body.Bytes(), nil); err != nil {
+		return err
 	}
 
-	return chunks
+	log.Printf("File %s sent successfully to Telegram chat %s", filename, chatID)
+	return nil
 }
 
-// wrapLongLine wraps a single long line into multiple lines
-func (tc *TelegramClient) wrapLongLine(line string, maxLength int) []string {
-	var wrapped []string
+// UseProxy sends the client's API calls through an HTTP(S) or SOCKS5 proxy, for networks
+// where api.telegram.org is blocked
+func (tc *TelegramClient) UseProxy(proxy *url.URL) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+	tc.HTTPClient.Transport = transport
+	log.Printf("Telegram API calls go through proxy %s", proxy.Redacted())
+}
 
-	for len(line) > maxLength {
-		// Try to break at a space near the limit
-		breakPoint := maxLength
+// methodURL returns the URL of a Bot API method for the client's bot
+func (tc *TelegramClient) methodURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", strings.TrimSuffix(tc.APIURL, "/"), tc.BotToken, method)
+}
+
+// telegramResponse is the envelope of every Bot API reply. Errors can arrive with any
+// HTTP status, including 200, so ok decides
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter      int   `json:"retry_after"`        // Seconds to wait after a 429
+		MigrateToChatID int64 `json:"migrate_to_chat_id"` // New ID of a group upgraded to a supergroup
+	} `json:"parameters"`
+}
+
+// TelegramAPIError is an error answer of the Bot API other than rate limiting
+type TelegramAPIError struct {
+	Code        int
+	Description string
+	Hint        string // Advice on fixing the destination, if any
+}
+
+// Error formats the answer as "telegram API error: <code> - <description>"
+func (e *TelegramAPIError) Error() string {
+	if e.Hint != "" {
+		return fmt.Sprintf("telegram API error: %d - %s (%s)", e.Code, e.Description, e.Hint)
+	}
+	return fmt.Sprintf("telegram API error: %d - %s", e.Code, e.Description)
+}
+
+// callAPI posts a request body to a Bot API method URL and decodes the result into result, if given.
+// Rate-limited calls (429) are retried after the retry_after delay Telegram asks for
+func (tc *TelegramClient) callAPI(ctx context.Context, url, contentType string, payload []byte, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := tc.HTTPClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send HTTP request: %w", err)
+		}
 
-		// Look for a space within the last 50 characters
-		for i := maxLength - 1; i >= maxLength-50 && i >= 0; i-- {
-			if line[i] == ' ' {
-				breakPoint = i
-				break
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		var response telegramResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			// Proxies and outages answer with HTML pages rather than the API envelope
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("telegram API error: %d - %s", resp.StatusCode, string(body))
 			}
+			return fmt.Errorf("failed to parse response: %w", err)
 		}
 
-		// Extract the chunk
-		chunk := line[:breakPoint]
-		wrapped = append(wrapped, chunk)
+		if !response.OK {
+			code := response.ErrorCode
+			if code == 0 {
+				code = resp.StatusCode
+			}
+
+			if code == http.StatusTooManyRequests {
+				delay := time.Duration(response.Parameters.RetryAfter) * time.Second
+				if delay < time.Second {
+					delay = time.Second
+				}
+				if attempt >= tc.RateLimitRetries {
+					return fmt.Errorf("telegram API rate limited after %d retries: %s", attempt, response.Description)
+				}
+				if delay > TelegramMaxRetryAfter {
+					return fmt.Errorf("telegram API rate limited for %s, longer than the %s we wait", delay, TelegramMaxRetryAfter)
+				}
+
+				log.Printf("Telegram API rate limited, retrying in %s (retry %d/%d)", delay, attempt+1, tc.RateLimitRetries)
+				deliveryReceiptFrom(ctx).recordRetry()
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				continue
+			}
+
+			apiErr := &TelegramAPIError{Code: code, Description: response.Description}
+			if id := response.Parameters.MigrateToChatID; id != 0 {
+				apiErr.Hint = fmt.Sprintf("the group is now supergroup %d, address it as g%d@telegram", id, -id)
+			}
+			return apiErr
+		}
 
-		// Update remaining line
-		line = line[breakPoint:]
-		if len(line) > 0 && line[0] == ' ' {
-			line = line[1:] // Remove leading space
+		if result != nil {
+			if err := json.Unmarshal(response.Result, result); err != nil {
+				return fmt.Errorf("failed to parse response: %w", err)
+			}
 		}
+		return nil
 	}
+}
+
+// telegramTopicKey carries the forum topic of the destination through a delivery
+type telegramTopicKey struct{}
 
-	// Add remaining text
-	if len(line) > 0 {
-		wrapped = append(wrapped, line)
+// withTelegramTopic returns a context posting to the forum topic; 0 leaves ctx unchanged
+func withTelegramTopic(ctx context.Context, topicID int64) context.Context {
+	if topicID == 0 {
+		return ctx
 	}
+	return context.WithValue(ctx, telegramTopicKey{}, topicID)
+}
+
+// telegramTopicFrom returns the forum topic carried by ctx, or 0 for the chat itself
+func telegramTopicFrom(ctx context.Context) int64 {
+	topicID, _ := ctx.Value(telegramTopicKey{}).(int64)
+	return topicID
+}
+
+// telegramSilentKey marks a delivery that must not play a notification sound
+type telegramSilentKey struct{}
+
+// withTelegramSilent returns a context whose messages are delivered silently
+func withTelegramSilent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, telegramSilentKey{}, true)
+}
 
-	return wrapped
+// telegramSilentFrom reports whether ctx asks for silent delivery
+func telegramSilentFrom(ctx context.Context) bool {
+	silent, _ := ctx.Value(telegramSilentKey{}).(bool)
+	return silent
 }
 
 // TestConnection validates the bot token by checking bot info
@@ -205,7 +433,7 @@ func (tc *TelegramClient) TestConnection() error {
 
 // GetBotInfo retrieves information about the bot (useful for debugging)
 func (tc *TelegramClient) GetBotInfo() error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/getMe", tc.BotToken)
+	url := tc.methodURL("getMe")
 
 	resp, err := tc.HTTPClient.Get(url)
 	if err != nil {
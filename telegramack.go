@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telegram Acknowledgement Configuration
+const (
+	DefaultTelegramSnooze     = 1 * time.Hour
+	TelegramAckWebhookTimeout = 5 * time.Second
+	TelegramSnoozeMaxLen      = 10000 // Snoozes kept before expired ones are pruned
+
+	telegramAckData     = "ack"
+	telegramSnoozeData  = "snooze:" // Followed by the alert key
+	telegramHandledData = "handled"
+)
+
+// TelegramInlineButton is a button of an inline keyboard
+type TelegramInlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// TelegramInlineKeyboard is the reply_markup of a message with buttons
+type TelegramInlineKeyboard struct {
+	InlineKeyboard [][]TelegramInlineButton `json:"inline_keyboard"`
+}
+
+// TelegramAckEvent is posted to TELEGRAM_ACK_WEBHOOK_URL for every button press
+type TelegramAckEvent struct {
+	Action      string     `json:"action"` // "ack" or "snooze"
+	ChatID      int64      `json:"chat_id"`
+	MessageID   int64      `json:"message_id"`
+	Text        string     `json:"text"` // Text of the alert message
+	UserID      int64      `json:"user_id"`
+	User        string     `json:"user"`
+	SnoozeUntil *time.Time `json:"snooze_until,omitempty"`
+}
+
+// TelegramAcks adds "Ack" and "Snooze" buttons to alerts and handles presses: the message is
+// edited to show who acted, and a snoozed alert's repeats to the chat arrive without a sound
+type TelegramAcks struct {
+	Snooze     time.Duration
+	WebhookURL string // Receives every press; "" handles presses in the bridge only
+	HTTPClient *http.Client
+
+	mutex   sync.Mutex
+	snoozes map[string]time.Time // Chat and alert key to the end of the snooze
+}
+
+// NewTelegramAcks creates the acknowledgement handler
+func NewTelegramAcks(snooze time.Duration, webhookURL string) *TelegramAcks {
+	return &TelegramAcks{
+		Snooze:     snooze,
+		WebhookURL: webhookURL,
+		HTTPClient: &http.Client{Timeout: TelegramAckWebhookTimeout},
+		snoozes:    make(map[string]time.Time),
+	}
+}
+
+// telegramAlertKey identifies repeats of an alert by their normalized subject; it fits in callback data
+func telegramAlertKey(subject string) string {
+	sum := sha256.Sum256([]byte(normalizeThreadSubject(subject)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Keyboard returns the buttons attached to an alert
+func (a *TelegramAcks) Keyboard(subject string) *TelegramInlineKeyboard {
+	return &TelegramInlineKeyboard{InlineKeyboard: [][]TelegramInlineButton{{
+		{Text: "✅ Ack", CallbackData: telegramAckData},
+		{Text: "💤 Snooze " + formatSnooze(a.Snooze), CallbackData: telegramSnoozeData + telegramAlertKey(subject)},
+	}}}
+}
+
+// Snoozed reports whether repeats of the alert are snoozed in the chat
+func (a *TelegramAcks) Snoozed(chatID, subject string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	until, exists := a.snoozes[chatID+"\n"+telegramAlertKey(subject)]
+	return exists && time.Now().Before(until)
+}
+
+// snoozeAlert starts a snooze of the alert in the chat
+func (a *TelegramAcks) snoozeAlert(chatID, key string, until time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.snoozes) >= TelegramSnoozeMaxLen {
+		now := time.Now()
+		for k, end := range a.snoozes {
+			if !now.Before(end) {
+				delete(a.snoozes, k)
+			}
+		}
+	}
+	a.snoozes[chatID+"\n"+key] = until
+}
+
+// HandleCallback handles a button press on an alert sent by client
+func (a *TelegramAcks) HandleCallback(ctx context.Context, client *TelegramClient, query *TelegramCallbackQuery) {
+	if query.Message == nil {
+		a.answer(ctx, client, query, "This alert is too old to update", false)
+		return
+	}
+	chatID := fmt.Sprintf("%d", query.Message.Chat.ID)
+	who := query.From.DisplayName()
+	now := time.Now().UTC()
+
+	event := TelegramAckEvent{
+		ChatID:    query.Message.Chat.ID,
+		MessageID: query.Message.MessageID,
+		Text:      query.Message.Text,
+		UserID:    query.From.ID,
+		User:      who,
+	}
+
+	var keyboard *TelegramInlineKeyboard
+	var answer string
+	switch {
+	case query.Data == telegramAckData:
+		event.Action = "ack"
+		keyboard = &TelegramInlineKeyboard{InlineKeyboard: [][]TelegramInlineButton{{
+			{Text: fmt.Sprintf("✅ Acked by %s at %s UTC", who, now.Format("15:04")), CallbackData: telegramHandledData},
+		}}}
+		answer = "Acknowledged"
+
+	case strings.HasPrefix(query.Data, telegramSnoozeData):
+		until := now.Add(a.Snooze)
+		event.Action = "snooze"
+		event.SnoozeUntil = &until
+		keyboard = &TelegramInlineKeyboard{InlineKeyboard: [][]TelegramInlineButton{
+			{{Text: "✅ Ack", CallbackData: telegramAckData}},
+			{{Text: fmt.Sprintf("💤 Snoozed by %s until %s UTC", who, until.Format("15:04")), CallbackData: telegramHandledData}},
+		}}
+		answer = "Repeats arrive silently for " + formatSnooze(a.Snooze)
+
+	default:
+		a.answer(ctx, client, query, "Already handled", false)
+		return
+	}
+
+	if a.WebhookURL != "" {
+		if err := a.notifyWebhook(ctx, event); err != nil {
+			log.Printf("Warning: Telegram %s by %s not confirmed by webhook: %v", event.Action, who, err)
+			a.answer(ctx, client, query, "Could not record the "+event.Action+", try again", true)
+			return
+		}
+	}
+	if event.Action == "snooze" {
+		a.snoozeAlert(chatID, strings.TrimPrefix(query.Data, telegramSnoozeData), *event.SnoozeUntil)
+	}
+
+	log.Printf("Telegram alert %d in chat %s: %s by %s", event.MessageID, chatID, event.Action, who)
+	if err := client.callMethod(ctx, "editMessageReplyMarkup", map[string]interface{}{
+		"chat_id":      query.Message.Chat.ID,
+		"message_id":   query.Message.MessageID,
+		"reply_markup": keyboard,
+	}, nil); err != nil {
+		log.Printf("Warning: failed to update Telegram alert %d: %v", event.MessageID, err)
+	}
+	a.answer(ctx, client, query, answer, false)
+}
+
+// answer ends the button's loading state, showing text as a toast or, with alert set, a dialog
+func (a *TelegramAcks) answer(ctx context.Context, client *TelegramClient, query *TelegramCallbackQuery, text string, alert bool) {
+	if err := client.callMethod(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": query.ID,
+		"text":              text,
+		"show_alert":        alert,
+	}, nil); err != nil {
+		log.Printf("Warning: failed to answer Telegram button press: %v", err)
+	}
+}
+
+// notifyWebhook posts a press to the acknowledgement webhook; any 2xx answer confirms it
+func (a *TelegramAcks) notifyWebhook(ctx context.Context, event TelegramAckEvent) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.WebhookURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook error: %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// formatSnooze renders a snooze duration compactly, e.g. "1h" or "30m"
+func formatSnooze(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// telegramAckOption reads the ack option of a destination: a plain "ack" or ack=on adds buttons to
+// every alert, ack=off to none; nil leaves the choice to the alert's severity
+func telegramAckOption(options DestinationOptions) (*bool, error) {
+	if options.Has("ack") && options.Get("ack") == "" {
+		enabled := true
+		return &enabled, nil
+	}
+	return parseSwitchOption(options, "ack")
+}
+
+// telegramKeyboardKey carries the inline keyboard of an alert through a delivery
+type telegramKeyboardKey struct{}
+
+// withTelegramKeyboard returns a context whose last message carries the keyboard
+func withTelegramKeyboard(ctx context.Context, keyboard *TelegramInlineKeyboard) context.Context {
+	return context.WithValue(ctx, telegramKeyboardKey{}, keyboard)
+}
+
+// telegramKeyboardFrom returns the keyboard carried by ctx, or nil
+func telegramKeyboardFrom(ctx context.Context) *TelegramInlineKeyboard {
+	keyboard, _ := ctx.Value(telegramKeyboardKey{}).(*TelegramInlineKeyboard)
+	return keyboard
+}
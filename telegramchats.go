@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chat Discovery Configuration
+const (
+	DefaultTelegramChatsWait = 1 * time.Minute
+)
+
+// telegramChatsUpdates lists the update types that reveal a chat the bot is in
+var telegramChatsUpdates = []string{"message", "channel_post", "my_chat_member"}
+
+// telegramSeenChat is a chat, or a forum topic in one, found in the bot's updates
+type telegramSeenChat struct {
+	Chat     TelegramChat
+	ThreadID int64 // Forum topic; 0 for the chat itself
+}
+
+// telegramSeenChats returns the chats and forum topics the updates happened in
+func telegramSeenChats(updates []TelegramUpdate) []telegramSeenChat {
+	var seen []telegramSeenChat
+	for _, update := range updates {
+		switch {
+		case update.Message != nil:
+			seen = append(seen, telegramSeenChat{Chat: update.Message.Chat})
+			if update.Message.IsTopicMessage && update.Message.ThreadID != 0 {
+				seen = append(seen, telegramSeenChat{Chat: update.Message.Chat, ThreadID: update.Message.ThreadID})
+			}
+		case update.ChannelPost != nil:
+			seen = append(seen, telegramSeenChat{Chat: update.ChannelPost.Chat})
+		case update.MyChatMember != nil:
+			seen = append(seen, telegramSeenChat{Chat: update.MyChatMember.Chat})
+		}
+	}
+	return seen
+}
+
+// address returns the email address that delivers to the chat through the named bot ("" for the default bot)
+func (c telegramSeenChat) address(bot string) string {
+	id := strconv.FormatInt(c.Chat.ID, 10)
+	if c.Chat.ID < 0 {
+		id = "g" + id[1:]
+	}
+	if c.ThreadID != 0 {
+		id += "." + strconv.FormatInt(c.ThreadID, 10)
+	}
+
+	domain := "telegram"
+	if bot != "" {
+		domain = bot + ".telegram"
+	}
+	return id + "@" + domain
+}
+
+// String describes the chat as its address, type and title or name
+func (c telegramSeenChat) String(bot string) string {
+	name := c.Chat.Title
+	if name == "" && c.Chat.Username != "" {
+		name = "@" + c.Chat.Username
+	}
+	kind := c.Chat.Type
+	if c.ThreadID != 0 {
+		kind = "topic"
+	}
+	return fmt.Sprintf("%-32s %-10s %s", c.address(bot), kind, name)
+}
+
+// runTelegramChats lists the chats a bot has seen: the pending updates first, then new ones
+// until the wait is over, so the IDs of groups and channels can be found by writing in them
+func runTelegramChats(args []string) error {
+	flags := flag.NewFlagSet("telegram-chats", flag.ContinueOnError)
+	bot := flags.String("bot", "", "named bot from TELEGRAM_BOT_TOKEN_<NAME> (default: TELEGRAM_BOT_TOKEN)")
+	wait := flags.Duration("wait", DefaultTelegramChatsWait, "how long to wait for new messages, 0 to only list pending ones")
+	verbose := flags.Bool("v", false, "show the bridge's log output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	*bot = strings.ToLower(*bot)
+	token := config.TelegramBotToken
+	if *bot != "" {
+		token = config.TelegramBots[*bot]
+	}
+	if token == "" {
+		if *bot != "" {
+			return fmt.Errorf("TELEGRAM_BOT_TOKEN_%s is not set", strings.ToUpper(strings.ReplaceAll(*bot, "-", "_")))
+		}
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN is not set")
+	}
+
+	// Long polls outlast the client's normal timeout
+	client := newTelegramBot(config, token)
+	client.HTTPClient = &http.Client{
+		Transport: client.HTTPClient.Transport,
+		Timeout:   TelegramPollTimeout + HTTPRequestTimeout,
+	}
+
+	fmt.Println("Write a message in each chat, or add the bot to it, to have it listed.")
+	fmt.Println("Bots in groups only see commands and mentions unless privacy mode is off; /start@botname always works.")
+	fmt.Println()
+
+	ctx := context.Background()
+	deadline := time.Now().Add(*wait)
+	listed := make(map[string]bool)
+	var offset int64
+	for {
+		timeout := time.Until(deadline).Truncate(time.Second)
+		if timeout > TelegramPollTimeout {
+			timeout = TelegramPollTimeout
+		}
+		if timeout < 0 {
+			timeout = 0
+		}
+
+		var updates []TelegramUpdate
+		err := client.callMethod(ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         int(timeout / time.Second),
+			"allowed_updates": telegramChatsUpdates,
+		}, &updates)
+		if err != nil {
+			return fmt.Errorf("getUpdates failed (a bot with a webhook, or one whose updates the bridge is polling, cannot be read here): %w", err)
+		}
+
+		for _, chat := range telegramSeenChats(updates) {
+			line := chat.String(*bot)
+			if !listed[line] {
+				listed[line] = true
+				fmt.Println(line)
+			}
+		}
+		if len(updates) > 0 {
+			offset = updates[len(updates)-1].UpdateID + 1
+		}
+
+		if timeout == 0 && len(updates) == 0 {
+			break
+		}
+	}
+
+	if len(listed) == 0 {
+		fmt.Println("No chats seen.")
+	}
+	return nil
+}
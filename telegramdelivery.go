@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sendToTelegram posts the message to a chat and sends the email's attachments after it when enabled
+func (ep *EmailProcessor) sendToTelegram(ctx context.Context, email *ProcessedEmail, message, userID string, options DestinationOptions) error {
+	bot, err := ep.telegramBot(options)
+	if err != nil {
+		return err
+	}
+
+	chatID := ep.telegramChatID(userID)
+	ctx, err = ep.telegramContext(ctx, email, userID, options)
+	if err != nil {
+		return err
+	}
+	var sent []int64
+	if ep.TelegramReplies != nil || ep.TelegramPins != nil {
+		ctx = withTelegramSent(ctx, &sent)
+	}
+	if err := bot.SendLongMessageToChat(ctx, message, chatID); err != nil {
+		return err
+	}
+	if ep.TelegramReplies != nil {
+		replyFrom, err := parseReplyAddress(options)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		ep.TelegramReplies.Remember(options.Get("bot"), chatID, sent, email, replyFrom)
+	}
+	if ep.TelegramPins != nil {
+		ep.pinTelegramAlert(ctx, bot, email, chatID, options, sent)
+	}
+
+	// Embedded and attached images go out together as one album, other attachments after them
+	var photos []TelegramUpload
+	if bot.InlineImages > 0 {
+		photos = ep.telegramInlinePhotos(bot, email)
+	}
+	var documents []TelegramUpload
+	if bot.UploadAttachments {
+		attached, other := ep.telegramAttachments(bot, email)
+		photos, documents = append(photos, attached...), other
+	}
+	ep.sendTelegramPhotos(ctx, bot, email.Subject, photos, chatID)
+	for _, document := range documents {
+		if err := bot.SendDocumentToChat(ctx, document.Filename, document.Data, document.Caption, chatID); err != nil {
+			log.Printf("Warning: failed to send attachment %s to Telegram: %v", document.Filename, err)
+		}
+	}
+	return nil
+}
+
+// telegramBot returns the client a destination is delivered with: the named bot of the
+// bot option, which addresses such as 12345@prod.telegram set, or the default bot
+func (ep *EmailProcessor) telegramBot(options DestinationOptions) (*TelegramClient, error) {
+	if name := options.Get("bot"); name != "" {
+		if bot := ep.TelegramBots[name]; bot != nil {
+			return bot, nil
+		}
+		return nil, fmt.Errorf("telegram bot '%s' not configured", name)
+	}
+	if ep.TelegramClient == nil {
+		return nil, fmt.Errorf("telegram client not configured")
+	}
+	return ep.TelegramClient, nil
+}
+
+// telegramUsernamePattern matches the username of a public Telegram channel or group, without the @
+var telegramUsernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{3,30}[A-Za-z0-9]$`)
+
+// telegramContext carries the destination's forum topic, notification setting and buttons to the client.
+// The silent option, an X-Silent header or a snooze delivers without a notification sound, unless the email is a page
+func (ep *EmailProcessor) telegramContext(ctx context.Context, email *ProcessedEmail, userID string, options DestinationOptions) (context.Context, error) {
+	ack, err := telegramAckOption(options)
+	if err != nil {
+		return ctx, err
+	}
+
+	ctx = withTelegramTopic(ctx, telegramTopicID(userID))
+	if (options.Has("silent") || email.Silent) && !email.Page {
+		ctx = withTelegramSilent(ctx)
+	}
+
+	// Critical alerts get acknowledgement buttons unless the destination says otherwise
+	if acks := ep.TelegramAcks; acks != nil {
+		if !email.Page && acks.Snoozed(ep.telegramChatID(userID), email.Subject) {
+			log.Printf("Alert '%s' is snoozed in chat %s, delivering silently", email.Subject, ep.telegramChatID(userID))
+			ctx = withTelegramSilent(ctx)
+		}
+		if (ack == nil && email.Severity == SeverityCritical) || (ack != nil && *ack) {
+			ctx = withTelegramKeyboard(ctx, acks.Keyboard(email.Subject))
+		}
+	}
+	return ctx, nil
+}
+
+// splitTelegramTopic separates the forum topic from an ID such as g123456.42; the topic is
+// 0 when the ID names the whole chat
+func splitTelegramTopic(id string) (string, int64, error) {
+	chatID, topic, found := strings.Cut(id, ".")
+	if !found {
+		return id, 0, nil
+	}
+	topicID, err := strconv.ParseInt(topic, 10, 64)
+	if err != nil || topicID <= 0 {
+		return "", 0, fmt.Errorf("invalid forum topic '%s': use a positive message thread ID", topic)
+	}
+	return chatID, topicID, nil
+}
+
+// telegramTopicID returns the forum topic addressed by a validated Telegram ID, or 0
+func telegramTopicID(userID string) int64 {
+	_, topicID, _ := splitTelegramTopic(userID)
+	return topicID
+}
+
+// telegramAttachments loads the email's attachments for the chat: images sendPhoto accepts as
+// photos and everything else as documents. Attachments that cannot be sent are logged and skipped
+func (ep *EmailProcessor) telegramAttachments(bot *TelegramClient, email *ProcessedEmail) (photos, documents []TelegramUpload) {
+	attachments := email.Attachments
+	if len(attachments) > TelegramMaxUploads {
+		log.Printf("Warning: email has %d attachments, sending the first %d to Telegram", len(attachments), TelegramMaxUploads)
+		attachments = attachments[:TelegramMaxUploads]
+	}
+
+	for _, attachment := range attachments {
+		if attachment.Size == 0 {
+			continue
+		}
+		if attachment.Size > bot.AttachmentMaxBytes {
+			log.Printf("Skipping attachment %s for Telegram: %d bytes exceeds limit of %d",
+				attachment.Filename, attachment.Size, bot.AttachmentMaxBytes)
+			continue
+		}
+		if !attachmentTypeAllowed(attachment.ContentType, bot.AttachmentTypes) {
+			log.Printf("Skipping attachment %s for Telegram: type %s is not allowed", attachment.Filename, attachment.ContentType)
+			continue
+		}
+
+		data, err := attachment.Content()
+		if err != nil {
+			log.Printf("Warning: failed to send attachment %s to Telegram: %v", attachment.Filename, err)
+			continue
+		}
+
+		// sendPhoto recompresses and shows the image inline; other images keep their original file
+		upload := TelegramUpload{Filename: attachment.Filename, Data: data, Caption: attachment.Filename}
+		if telegramPhotoType(attachment.ContentType) && attachment.Size <= TelegramMaxPhotoBytes {
+			photos = append(photos, upload)
+		} else {
+			documents = append(documents, upload)
+		}
+	}
+	return photos, documents
+}
+
+// telegramInlinePhotos loads the images embedded in the email body, captioned with the subject,
+// so camera and scanner snapshots are not lost. Images that cannot be sent are logged and skipped
+func (ep *EmailProcessor) telegramInlinePhotos(bot *TelegramClient, email *ProcessedEmail) []TelegramUpload {
+	var photos []TelegramUpload
+	images := email.InlineImages
+	if len(images) > bot.InlineImages {
+		log.Printf("Warning: email has %d embedded images, sending the first %d to Telegram", len(images), bot.InlineImages)
+		images = images[:bot.InlineImages]
+	}
+
+	for i, image := range images {
+		if image.Size == 0 {
+			continue
+		}
+		if !telegramPhotoType(image.ContentType) {
+			log.Printf("Skipping embedded image %s for Telegram: sendPhoto does not accept %s", image.Filename, image.ContentType)
+			continue
+		}
+		if image.Size > bot.InlineMaxBytes {
+			log.Printf("Skipping embedded image %s for Telegram: %d bytes exceeds limit of %d",
+				image.Filename, image.Size, bot.InlineMaxBytes)
+			continue
+		}
+
+		data, err := image.Content()
+		if err != nil {
+			log.Printf("Warning: failed to send embedded image %s to Telegram: %v", image.Filename, err)
+			continue
+		}
+
+		caption := email.Subject
+		if len(images) > 1 {
+			caption = fmt.Sprintf("%s (%d/%d)", caption, i+1, len(images))
+		}
+		photos = append(photos, TelegramUpload{Filename: image.Filename, Data: data, Caption: strings.TrimSpace(caption)})
+	}
+	return photos
+}
+
+// sendTelegramPhotos sends several photos as media groups of up to 10 with the subject on the
+// first, and a single photo on its own with its caption. An album the API refuses is sent photo
+// by photo. The message is already delivered, so failed uploads are logged rather than returned
+func (ep *EmailProcessor) sendTelegramPhotos(ctx context.Context, bot *TelegramClient, subject string, photos []TelegramUpload, chatID string) {
+	groups := (len(photos) + TelegramMediaGroupMax - 1) / TelegramMediaGroupMax
+	for group := 0; group < groups; group++ {
+		batch := photos[group*TelegramMediaGroupMax : min((group+1)*TelegramMediaGroupMax, len(photos))]
+		if len(batch) > 1 {
+			caption := subject
+			if groups > 1 {
+				caption = fmt.Sprintf("%s (%d/%d)", caption, group+1, groups)
+			}
+			err := bot.SendMediaGroupToChat(ctx, batch, strings.TrimSpace(caption), chatID)
+			if err == nil {
+				continue
+			}
+			log.Printf("Warning: failed to send %d photos to Telegram as a media group, sending them one by one: %v", len(batch), err)
+		}
+		for _, photo := range batch {
+			if err := bot.SendPhotoToChat(ctx, photo.Filename, photo.Data, photo.Caption, chatID); err != nil {
+				log.Printf("Warning: failed to send image %s to Telegram: %v", photo.Filename, err)
+			}
+		}
+	}
+}
+
+// telegramPhotoType reports whether sendPhoto accepts images of the content type
+func telegramPhotoType(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telegram Rate Limit Configuration
+const (
+	TelegramGlobalRate     = 30                     // Messages per second across all chats
+	TelegramChatInterval   = 1 * time.Second        // Between messages to one private chat
+	TelegramGroupInterval  = 3 * time.Second        // Between messages to one group (20 per minute)
+	TelegramChatBurst      = 3                      // Messages a quiet chat may receive at once
+	TelegramLimiterMaxLen  = 10000                  // Chats tracked before idle ones are dropped
+	TelegramLimiterLogWait = 500 * time.Millisecond // Longer waits are logged
+)
+
+// rateBucket is a token bucket kept as the theoretical arrival time of the next message,
+// so waiting senders are served in the order they reserved
+type rateBucket struct {
+	interval time.Duration
+	burst    int
+	tat      time.Time
+}
+
+// reserve takes a slot for a message sent no earlier than at, returning how long after at it may go out
+func (b *rateBucket) reserve(at time.Time) time.Duration {
+	if b.tat.Before(at) {
+		b.tat = at
+	}
+	allowed := b.tat.Add(-time.Duration(b.burst-1) * b.interval)
+	b.tat = b.tat.Add(b.interval)
+	if allowed.After(at) {
+		return allowed.Sub(at)
+	}
+	return 0
+}
+
+// available returns how long after at the next slot frees up, without taking it
+func (b *rateBucket) available(at time.Time) time.Duration {
+	allowed := b.tat.Add(-time.Duration(b.burst-1) * b.interval)
+	if allowed.After(at) {
+		return allowed.Sub(at)
+	}
+	return 0
+}
+
+// idle reports whether the bucket is full again at now
+func (b *rateBucket) idle(now time.Time) bool {
+	return !b.tat.After(now)
+}
+
+// TelegramLimiter spaces out Bot API calls to stay within Telegram's per-chat and global
+// limits, so bursts of mail queue up instead of failing with 429
+type TelegramLimiter struct {
+	mutex  sync.Mutex
+	global *rateBucket
+	chats  map[string]*rateBucket
+}
+
+// NewTelegramLimiter creates a limiter with Telegram's documented limits
+func NewTelegramLimiter() *TelegramLimiter {
+	return &TelegramLimiter{
+		global: &rateBucket{interval: time.Second / TelegramGlobalRate, burst: TelegramGlobalRate},
+		chats:  make(map[string]*rateBucket),
+	}
+}
+
+// Wait blocks until a message to the chat may be sent, or ctx is done
+func (l *TelegramLimiter) Wait(ctx context.Context, chatID string) error {
+	l.mutex.Lock()
+	now := time.Now()
+	chat := l.chats[chatID]
+	if chat == nil {
+		if len(l.chats) >= TelegramLimiterMaxLen {
+			for id, bucket := range l.chats {
+				if bucket.idle(now) {
+					delete(l.chats, id)
+				}
+			}
+		}
+
+		// Group and channel IDs are negative, or usernames of public chats; Telegram allows them fewer messages
+		interval := TelegramChatInterval
+		if strings.HasPrefix(chatID, "-") || strings.HasPrefix(chatID, "@") {
+			interval = TelegramGroupInterval
+		}
+		chat = &rateBucket{interval: interval, burst: TelegramChatBurst}
+		l.chats[chatID] = chat
+	}
+	delay := chat.reserve(now)
+	delay += l.global.reserve(now.Add(delay))
+	l.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if delay >= TelegramLimiterLogWait {
+		log.Printf("Rate limiting Telegram chat %s, waiting %s", chatID, delay.Round(time.Millisecond))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
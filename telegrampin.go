@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Telegram Pin Configuration
+const (
+	TelegramPinsMaxLen = 10000 // Pinned alerts remembered; the oldest are forgotten, not unpinned
+)
+
+// telegramPin is a pinned alert message
+type telegramPin struct {
+	chatID    string
+	messageID int64
+	emailID   string // Message-ID of the email, matched by the References of its recovery
+}
+
+// TelegramPins pins critical alerts to the top of their chat and unpins them when a recovery
+// for the same alert arrives. Pins are remembered in memory only
+type TelegramPins struct {
+	mutex  sync.Mutex
+	pinned map[string]telegramPin // Bot, chat and alert to the pinned message
+	order  []string               // Keys oldest first, for forgetting the oldest when full
+}
+
+// NewTelegramPins creates the pin handler
+func NewTelegramPins() *TelegramPins {
+	return &TelegramPins{pinned: make(map[string]telegramPin)}
+}
+
+// telegramPinKey identifies an alert in a chat by its subject without severity keywords, so
+// "CRITICAL: db1 down" and "RESOLVED: db1 down" name the same alert
+func telegramPinKey(botName, chatID, alert string) string {
+	return botName + "\n" + chatID + "\n" + alert
+}
+
+// remember records a pinned alert and returns the pin of an earlier repeat it replaces
+func (p *TelegramPins) remember(key string, pin telegramPin) (telegramPin, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, repeated := p.pinned[key]
+	if !repeated {
+		p.order = append(p.order, key)
+		if len(p.order) > TelegramPinsMaxLen {
+			delete(p.pinned, p.order[0])
+			p.order = p.order[1:]
+		}
+	}
+	p.pinned[key] = pin
+	return previous, repeated
+}
+
+// take forgets and returns the pins a recovery resolves: the alert with its key, and alerts in
+// the same chat whose email the recovery references
+func (p *TelegramPins) take(key string, references []string) []telegramPin {
+	chat := key[:strings.LastIndex(key, "\n")+1]
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var resolved []telegramPin
+	p.order = slices.DeleteFunc(p.order, func(candidate string) bool {
+		pin := p.pinned[candidate]
+		referenced := strings.HasPrefix(candidate, chat) && pin.emailID != "" && slices.Contains(references, pin.emailID)
+		if candidate != key && !referenced {
+			return false
+		}
+		resolved = append(resolved, pin)
+		delete(p.pinned, candidate)
+		return true
+	})
+	return resolved
+}
+
+// telegramPinOption reads the "pin" destination option: "pin" pins every alert to the
+// destination, "pin=off" none, and nil leaves it to the alert's severity
+func telegramPinOption(options DestinationOptions) (*bool, error) {
+	if options.Has("pin") && options.Get("pin") == "" {
+		enabled := true
+		return &enabled, nil
+	}
+	return parseSwitchOption(options, "pin")
+}
+
+// pinTelegramAlert pins a critical alert after it was sent, replacing the pin of an earlier
+// repeat, or unpins the alerts a recovery resolves
+func (ep *EmailProcessor) pinTelegramAlert(ctx context.Context, bot *TelegramClient, email *ProcessedEmail, chatID string, options DestinationOptions, sent []int64) {
+	key := telegramPinKey(options.Get("bot"), chatID, ep.severityClassifier().StripKeywords(email.Subject))
+	if email.Severity == SeverityRecovery {
+		references := append([]string{email.InReplyTo}, email.References...)
+		for _, pin := range ep.TelegramPins.take(key, references) {
+			unpinTelegramMessage(ctx, bot, pin)
+		}
+		return
+	}
+
+	pin, _ := telegramPinOption(options)
+	if len(sent) == 0 || !((pin == nil && email.Severity == SeverityCritical) || (pin != nil && *pin)) {
+		return
+	}
+
+	// The alert itself notified the chat, so the pin does not
+	request := map[string]interface{}{"chat_id": chatID, "message_id": sent[0], "disable_notification": true}
+	if err := bot.callMethod(ctx, "pinChatMessage", request, nil); err != nil {
+		log.Printf("Warning: failed to pin alert in Telegram chat %s (in groups the bot needs the right to pin messages): %v", chatID, err)
+		return
+	}
+	log.Printf("Pinned message %d in Telegram chat %s", sent[0], chatID)
+
+	// A repeat replaces the earlier pin, so a flapping alert keeps one message at the top
+	if previous, repeated := ep.TelegramPins.remember(key, telegramPin{chatID: chatID, messageID: sent[0], emailID: email.MessageID}); repeated {
+		unpinTelegramMessage(ctx, bot, previous)
+	}
+}
+
+// unpinTelegramMessage removes a pin; one already removed by hand only logs a warning
+func unpinTelegramMessage(ctx context.Context, bot *TelegramClient, pin telegramPin) {
+	request := map[string]interface{}{"chat_id": pin.chatID, "message_id": pin.messageID}
+	if err := bot.callMethod(ctx, "unpinChatMessage", request, nil); err != nil {
+		log.Printf("Warning: failed to unpin message %d in Telegram chat %s: %v", pin.messageID, pin.chatID, err)
+		return
+	}
+	log.Printf("Unpinned message %d in Telegram chat %s", pin.messageID, pin.chatID)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Telegram Reply Configuration
+const (
+	DefaultTelegramReplyTTL    = 24 * time.Hour
+	TelegramReplySignatureLine = "-- \nReplied in Telegram by %s"
+)
+
+// TelegramReplies emails replies to bridged messages back to the original sender through the relay
+type TelegramReplies struct {
+	Relay   *SMTPRelay
+	Replies *ReplyIndex
+}
+
+// NewTelegramReplies creates the reply handler, remembering posted messages for ttl
+func NewTelegramReplies(relay *SMTPRelay, ttl time.Duration) *TelegramReplies {
+	return &TelegramReplies{Relay: relay, Replies: NewReplyIndex(ttl)}
+}
+
+// telegramReplyKey identifies a message a bot posted; message IDs are only unique within a chat
+func telegramReplyKey(bot, chatID string, messageID int64) string {
+	return bot + ":" + chatID + ":" + strconv.FormatInt(messageID, 10)
+}
+
+// Remember records the messages an email was posted as, so a reply to any part of it reaches the sender
+func (r *TelegramReplies) Remember(bot, chatID string, messageIDs []int64, email *ProcessedEmail, replyFrom string) {
+	for _, messageID := range messageIDs {
+		r.Replies.Remember(telegramReplyKey(bot, chatID, messageID), email, replyFrom)
+	}
+}
+
+// HandleMessage emails a person's reply to a bridged message back to the original sender
+func (r *TelegramReplies) HandleMessage(bot string, message *TelegramIncomingMessage) {
+	if message.ReplyToMessage == nil || message.From.IsBot {
+		return
+	}
+	chatID := strconv.FormatInt(message.Chat.ID, 10)
+	original, replyFrom := r.Replies.Lookup(telegramReplyKey(bot, chatID, message.ReplyToMessage.MessageID))
+	if original == nil {
+		return
+	}
+
+	text := message.Text
+	if text == "" {
+		text = message.Caption
+	}
+	if strings.TrimSpace(text) == "" {
+		log.Printf("Ignoring Telegram reply without text in chat %s", chatID)
+		return
+	}
+
+	name := message.From.DisplayName()
+	body := text + "\n\n" + fmt.Sprintf(TelegramReplySignatureLine, name)
+	reply := NewReplyEmail(original, r.Relay.FromWithName(name+" via Telegram"), body)
+
+	// The tag names the chat, so mail filters can route answers to the reply back to it
+	if replyFrom != "" {
+		if !r.Relay.AllowsSender(replyFrom) {
+			log.Printf("Warning: reply address %s is outside the domain of SMTP_RELAY_FROM, sending from %s", replyFrom, r.Relay.From)
+		} else if err := reply.UseReplyAddress(replyFrom, chatID); err != nil {
+			log.Printf("Warning: %v, sending from %s", err, r.Relay.From)
+		}
+	}
+
+	if err := r.Relay.Send(reply); err != nil {
+		log.Printf("Failed to email Telegram reply from %s in %s to %s: %v", name, chatID, original.From, err)
+		return
+	}
+	log.Printf("Emailed Telegram reply from %s in %s to %s", name, chatID, original.From)
+}
+
+// telegramSentKey carries the list the IDs of posted messages are added to
+type telegramSentKey struct{}
+
+// withTelegramSent returns a context that adds the ID of every message posted with it to sent
+func withTelegramSent(ctx context.Context, sent *[]int64) context.Context {
+	return context.WithValue(ctx, telegramSentKey{}, sent)
+}
+
+// recordTelegramSent adds a posted message to the list carried by ctx, if any
+func recordTelegramSent(ctx context.Context, messageID int64) {
+	if sent, _ := ctx.Value(telegramSentKey{}).(*[]int64); sent != nil {
+		*sent = append(*sent, messageID)
+	}
+}
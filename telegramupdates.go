@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Telegram Updates Configuration
+const (
+	TelegramPollTimeout    = 25 * time.Second // Long-poll duration of getUpdates
+	TelegramPollMaxBackoff = 1 * time.Minute
+)
+
+// TelegramUser is the sender of an update
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+// DisplayName returns @username, or the user's name when they have none
+func (u TelegramUser) DisplayName() string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	if u.LastName != "" {
+		return u.FirstName + " " + u.LastName
+	}
+	return u.FirstName
+}
+
+// TelegramChat is the chat an update happened in
+type TelegramChat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Username string `json:"username"`
+}
+
+// TelegramIncomingMessage is a message received in an update
+type TelegramIncomingMessage struct {
+	MessageID      int64        `json:"message_id"`
+	Chat           TelegramChat `json:"chat"`
+	From           TelegramUser `json:"from"`
+	Text           string       `json:"text"`
+	Caption        string       `json:"caption"`           // Text of a photo or file
+	ThreadID       int64        `json:"message_thread_id"` // Forum topic of the message
+	IsTopicMessage bool         `json:"is_topic_message"`
+
+	ReplyToMessage *TelegramIncomingMessage `json:"reply_to_message"`
+}
+
+// TelegramChatMemberUpdated reports a change of the bot's membership, e.g. being added to a group
+type TelegramChatMemberUpdated struct {
+	Chat TelegramChat `json:"chat"`
+	From TelegramUser `json:"from"`
+}
+
+// TelegramCallbackQuery is a press of an inline keyboard button
+type TelegramCallbackQuery struct {
+	ID      string                   `json:"id"`
+	From    TelegramUser             `json:"from"`
+	Message *TelegramIncomingMessage `json:"message"`
+	Data    string                   `json:"data"`
+}
+
+// TelegramUpdate is one entry returned by getUpdates
+type TelegramUpdate struct {
+	UpdateID      int64                      `json:"update_id"`
+	CallbackQuery *TelegramCallbackQuery     `json:"callback_query"`
+	Message       *TelegramIncomingMessage   `json:"message"`
+	ChannelPost   *TelegramIncomingMessage   `json:"channel_post"`
+	MyChatMember  *TelegramChatMemberUpdated `json:"my_chat_member"`
+}
+
+// TelegramPoller receives updates for a bot with getUpdates long polling and hands them to handlers.
+// Telegram delivers updates to one consumer only, so the bot must not have a webhook set
+type TelegramPoller struct {
+	Name    string // Bot name for logs; "" for the default bot
+	Client  *TelegramClient
+	Acks    *TelegramAcks    // Handles inline button presses; nil ignores them
+	History *AlertHistory    // Answers /search commands; nil ignores them
+	Replies *TelegramReplies // Emails replies to bridged messages; nil ignores them
+
+	poll   *TelegramClient // Copy of Client with a timeout longer than the long poll
+	offset int64
+	cancel context.CancelFunc
+	done   chan struct{}
+	mutex  sync.Mutex
+}
+
+// NewTelegramPoller creates a poller for a bot's updates
+func NewTelegramPoller(name string, client *TelegramClient, acks *TelegramAcks, history *AlertHistory, replies *TelegramReplies) *TelegramPoller {
+	poll := *client
+	poll.HTTPClient = &http.Client{
+		Transport: client.HTTPClient.Transport,
+		Timeout:   TelegramPollTimeout + HTTPRequestTimeout,
+	}
+	return &TelegramPoller{Name: name, Client: client, Acks: acks, History: history, Replies: replies, poll: &poll}
+}
+
+// allowedUpdates lists the update types the poller has handlers for
+func (p *TelegramPoller) allowedUpdates() []string {
+	var types []string
+	if p.Acks != nil {
+		types = append(types, "callback_query")
+	}
+	if p.History != nil || p.Replies != nil {
+		types = append(types, "message")
+	}
+	if p.History != nil {
+		types = append(types, "channel_post")
+	}
+	return types
+}
+
+// Start polls for updates until Stop is called, backing off while the API fails
+func (p *TelegramPoller) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.mutex.Lock()
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	p.mutex.Unlock()
+	defer close(p.done)
+
+	log.Printf("Listening for Telegram updates%s (%v)", p.botLabel(), p.allowedUpdates())
+	backoff := time.Second
+	for ctx.Err() == nil {
+		updates, err := p.getUpdates(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Warning: Telegram getUpdates failed%s: %v (retrying in %s)", p.botLabel(), err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, TelegramPollMaxBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		for _, update := range updates {
+			p.offset = update.UpdateID + 1
+			p.handleUpdate(ctx, update)
+		}
+	}
+}
+
+// Stop ends polling and waits for the update being handled
+func (p *TelegramPoller) Stop() {
+	p.mutex.Lock()
+	cancel, done := p.cancel, p.done
+	p.mutex.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// getUpdates waits up to TelegramPollTimeout for updates after the last one handled
+func (p *TelegramPoller) getUpdates(ctx context.Context) ([]TelegramUpdate, error) {
+	request := map[string]interface{}{
+		"offset":          p.offset,
+		"timeout":         int(TelegramPollTimeout / time.Second),
+		"allowed_updates": p.allowedUpdates(),
+	}
+	var updates []TelegramUpdate
+	if err := p.poll.callMethod(ctx, "getUpdates", request, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// handleUpdate passes an update to the handler for its type
+func (p *TelegramPoller) handleUpdate(ctx context.Context, update TelegramUpdate) {
+	switch {
+	case update.CallbackQuery != nil && p.Acks != nil:
+		p.Acks.HandleCallback(ctx, p.Client, update.CallbackQuery)
+	case update.Message != nil:
+		p.handleMessage(ctx, update.Message)
+	case update.ChannelPost != nil && p.History != nil:
+		p.handleSearch(ctx, update.ChannelPost)
+	}
+}
+
+// handleMessage answers /search commands and emails other replies to bridged messages back.
+// Relaying a reply can take as long as the SMTP relay, so it does not hold up polling
+func (p *TelegramPoller) handleMessage(ctx context.Context, message *TelegramIncomingMessage) {
+	if _, ok := parseSearchCommand(message.Text); ok {
+		if p.History != nil {
+			p.handleSearch(ctx, message)
+		}
+		return
+	}
+	if p.Replies != nil {
+		go p.Replies.HandleMessage(p.Name, message)
+	}
+}
+
+// handleSearch answers a /search command with the matching alerts this bot sent to the chat
+func (p *TelegramPoller) handleSearch(ctx context.Context, message *TelegramIncomingMessage) {
+	term, ok := parseSearchCommand(message.Text)
+	if !ok {
+		return
+	}
+
+	text := html.EscapeString(searchUsage)
+	if len([]rune(term)) >= SearchMinTermLen {
+		chatID := strconv.FormatInt(message.Chat.ID, 10)
+		text = formatSearchResultsHTML(term, p.History.Search("telegram", p.Name, []string{chatID}, term))
+		log.Printf("Telegram search for %q in chat %s%s", term, chatID, p.botLabel())
+	}
+
+	request := map[string]interface{}{
+		"chat_id":                  message.Chat.ID,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+		"reply_to_message_id":      message.MessageID,
+	}
+	if message.IsTopicMessage && message.ThreadID != 0 {
+		request["message_thread_id"] = message.ThreadID
+	}
+	if err := p.Client.callMethod(ctx, "sendMessage", request, nil); err != nil {
+		log.Printf("Warning: failed to answer Telegram search in chat %d: %v", message.Chat.ID, err)
+	}
+}
+
+// botLabel names the bot in log messages
+func (p *TelegramPoller) botLabel() string {
+	if p.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" for bot %s", p.Name)
+}
+
+// callMethod calls a Bot API method with a JSON request and decodes its result into result, if given
+func (tc *TelegramClient) callMethod(ctx context.Context, method string, request, result interface{}) error {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+	return tc.callAPI(ctx, tc.methodURL(method), "application/json", jsonData, result)
+}
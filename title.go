@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// titlePlatforms lists the platforms with a native title that <PLATFORM>_TITLE_TEMPLATE can override
+var titlePlatforms = []string{"slack", "dingtalk", "victorops"}
+
+// TitleData is the data available to title and sender banner templates
+type TitleData struct {
+	Subject  string
+	From     string // Sender as shown in the message: the SENDER_NAMES name, or the address
+	To       string
+	Date     string
+	Severity string // critical, error, warning, info, recovery or empty
+	Emoji    string // Emoji of the severity
+	Platform string
+	ID       string // Destination ID on the platform
+
+	// How the message reached the bridge
+	FromAddress  string // Address of the From header, also when a name is shown
+	EnvelopeFrom string
+	AuthUser     string // Empty for unauthenticated senders
+	Helo         string
+	TLS          bool
+	ClientIP     string
+	SPF          string // SPF result of MAIL FROM, e.g. pass; empty when not checked
+	DMARC        string // DMARC result of the From domain; empty when not checked
+}
+
+// templateData collects the template fields of an email delivered to a destination
+func (ep *EmailProcessor) templateData(email *ProcessedEmail, platform, userID string) TitleData {
+	return TitleData{
+		Subject:      email.Subject,
+		From:         senderDisplay(email),
+		To:           email.To,
+		Date:         email.Date,
+		Severity:     string(email.Severity),
+		Emoji:        email.Severity.Emoji(),
+		Platform:     platform,
+		ID:           userID,
+		FromAddress:  email.From,
+		EnvelopeFrom: email.Session.EnvelopeFrom,
+		AuthUser:     email.Session.AuthUser,
+		Helo:         email.Session.Helo,
+		TLS:          email.Session.TLS,
+		ClientIP:     email.Session.ClientIP(),
+		SPF:          email.Session.SPF,
+		DMARC:        email.Session.DMARC.result(),
+	}
+}
+
+// parseTitleTemplates reads TITLE_TEMPLATE and the per-platform <PLATFORM>_TITLE_TEMPLATE variables.
+// The default template is stored under the empty key
+func parseTitleTemplates() (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+
+	names := map[string]string{"": "TITLE_TEMPLATE"}
+	for _, platform := range titlePlatforms {
+		names[platform] = strings.ToUpper(platform) + "_TITLE_TEMPLATE"
+	}
+
+	for platform, name := range names {
+		text := os.Getenv(name)
+		if text == "" {
+			continue
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+		// Catch references to unknown fields now rather than on the first email
+		if err := tmpl.Execute(&strings.Builder{}, TitleData{}); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+		templates[platform] = tmpl
+	}
+
+	return templates, nil
+}
+
+// renderTitle renders the title of an email for a platform with native titles,
+// falling back to the subject and then to "New Email"
+func (ep *EmailProcessor) renderTitle(email *ProcessedEmail, platform, userID string) string {
+	title := email.Subject
+
+	if ep.Config != nil {
+		tmpl := ep.Config.TitleTemplates[platform]
+		if tmpl == nil {
+			tmpl = ep.Config.TitleTemplates[""]
+		}
+
+		if tmpl != nil {
+			var rendered strings.Builder
+			err := tmpl.Execute(&rendered, ep.templateData(email, platform, userID))
+			if err != nil {
+				log.Printf("Warning: failed to render title template for %s: %v", platform, err)
+			} else {
+				title = strings.Join(strings.Fields(rendered.String()), " ")
+			}
+		}
+	}
+
+	if title == "" {
+		title = "New Email"
+	}
+	return title
+}
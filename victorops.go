@@ -0,0 +1,145 @@
+//go:build !minimal && !novictorops
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// VictorOps Configuration
+const (
+	VictorOpsAPIURL             = "https://alert.victorops.com/integrations/generic/20131114/alert"
+	VictorOpsMaxStateMessage    = 20000 // Keep alert payloads well below the 200KB limit
+	VictorOpsHTTPRequestTimeout = 10 * time.Second
+)
+
+// VictorOps message types
+const (
+	VictorOpsCritical        = "CRITICAL"
+	VictorOpsWarning         = "WARNING"
+	VictorOpsInfo            = "INFO"
+	VictorOpsAcknowledgement = "ACKNOWLEDGEMENT"
+	VictorOpsRecovery        = "RECOVERY"
+)
+
+// victorOpsAckPattern marks subjects of acknowledgements, which are not a severity of their own
+var victorOpsAckPattern = regexp.MustCompile(`(?i)\b(ack(nowledged?)?)\b`)
+
+// victorOpsMessageTypes maps detected severities to message types
+var victorOpsMessageTypes = map[Severity]string{
+	SeverityRecovery: VictorOpsRecovery,
+	SeverityCritical: VictorOpsCritical,
+	SeverityError:    VictorOpsCritical,
+	SeverityWarning:  VictorOpsWarning,
+	SeverityInfo:     VictorOpsInfo,
+}
+
+// VictorOpsAlert represents an alert payload for the VictorOps REST endpoint
+type VictorOpsAlert struct {
+	MessageType       string `json:"message_type"`
+	EntityID          string `json:"entity_id"`
+	EntityDisplayName string `json:"entity_display_name"`
+	StateMessage      string `json:"state_message"`
+	MonitoringTool    string `json:"monitoring_tool"`
+}
+
+// VictorOpsClient handles all VictorOps (Splunk On-Call) REST endpoint interactions
+type VictorOpsClient struct {
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewVictorOpsClient creates a new VictorOps client
+func NewVictorOpsClient(apiKey string) *VictorOpsClient {
+	return &VictorOpsClient{
+		APIKey: apiKey,
+		HTTPClient: &http.Client{
+			Timeout: VictorOpsHTTPRequestTimeout,
+		},
+	}
+}
+
+// MessageTypeForSeverity derives the alert message type from the detected severity,
+// treating alerts without any keyword as critical so they always open an incident
+func (vc *VictorOpsClient) MessageTypeForSeverity(severity Severity, subject string) string {
+	if severity != SeverityRecovery && victorOpsAckPattern.MatchString(subject) {
+		return VictorOpsAcknowledgement
+	}
+	if messageType, exists := victorOpsMessageTypes[severity]; exists {
+		return messageType
+	}
+	return VictorOpsCritical
+}
+
+// EntityID derives a stable entity ID from a subject stripped of severity keywords,
+// so recoveries resolve the incident the problem opened
+func (vc *VictorOpsClient) EntityID(subject string) string {
+	entityID := strings.Join(strings.Fields(victorOpsAckPattern.ReplaceAllString(subject, "")), "-")
+
+	if entityID == "" {
+		return "email2dm"
+	}
+	return entityID
+}
+
+// SendAlert creates or updates an incident for the given routing key
+func (vc *VictorOpsClient) SendAlert(ctx context.Context, alert VictorOpsAlert, routingKey string) error {
+	if len(alert.StateMessage) > VictorOpsMaxStateMessage {
+		alert.StateMessage = alert.StateMessage[:VictorOpsMaxStateMessage] + "\n[truncated]"
+	}
+
+	jsonData, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	log.Printf("Sending %s alert to VictorOps routing key %s (entity: %s)", alert.MessageType, routingKey, alert.EntityID)
+
+	url := fmt.Sprintf("%s/%s/%s", VictorOpsAPIURL, vc.APIKey, routingKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := vc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("victorops API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Result   string `json:"result"`
+		EntityID string `json:"entity_id,omitempty"`
+		Message  string `json:"message,omitempty"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if response.Result != "success" {
+		return fmt.Errorf("victorops API error: %s", response.Message)
+	}
+	deliveryReceiptFrom(ctx).recordMessage(response.EntityID)
+
+	log.Printf("Alert sent successfully to VictorOps routing key %s", routingKey)
+	return nil
+}
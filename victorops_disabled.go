@@ -0,0 +1,46 @@
+//go:build minimal || novictorops
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func init() {
+	excludeFeature("victorops", "novictorops")
+}
+
+// VictorOpsAlert represents an alert for the VictorOps REST endpoint
+type VictorOpsAlert struct {
+	MessageType       string
+	EntityID          string
+	EntityDisplayName string
+	StateMessage      string
+	MonitoringTool    string
+}
+
+// VictorOpsClient is a placeholder for builds without VictorOps support
+type VictorOpsClient struct {
+	HTTPClient *http.Client
+}
+
+// NewVictorOpsClient creates a placeholder client whose calls all fail
+func NewVictorOpsClient(apiKey string) *VictorOpsClient {
+	return &VictorOpsClient{HTTPClient: &http.Client{}}
+}
+
+// MessageTypeForSeverity is unused without VictorOps support
+func (vc *VictorOpsClient) MessageTypeForSeverity(severity Severity, subject string) string {
+	return ""
+}
+
+// EntityID is unused without VictorOps support
+func (vc *VictorOpsClient) EntityID(subject string) string {
+	return ""
+}
+
+// SendAlert reports that VictorOps support was compiled out
+func (vc *VictorOpsClient) SendAlert(ctx context.Context, alert VictorOpsAlert, routingKey string) error {
+	return requireFeature("victorops")
+}
@@ -0,0 +1,259 @@
+//go:build !minimal && !noslack
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WebSocket Configuration
+const (
+	WebSocketDialTimeout    = 10 * time.Second
+	WebSocketMaxMessageSize = 1024 * 1024
+	webSocketGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WebSocket opcodes (RFC 6455 §5.2)
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// WebSocketConn is a minimal RFC 6455 client connection: text messages in both directions,
+// with pings answered automatically
+type WebSocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+}
+
+// DialWebSocket opens a WebSocket connection to a ws:// or wss:// URL
+func DialWebSocket(rawURL string) (*WebSocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket URL: %w", err)
+	}
+
+	host := u.Host
+	dialer := &net.Dialer{Timeout: WebSocketDialTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported WebSocket scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	ws, err := handshakeWebSocket(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshakeWebSocket performs the HTTP upgrade on an established connection
+func handshakeWebSocket(conn net.Conn, u *url.URL) (*WebSocketConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+
+	conn.SetDeadline(time.Now().Add(WebSocketDialTimeout))
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("failed to send upgrade request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upgrade response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("WebSocket upgrade refused: %s", resp.Status)
+	}
+
+	digest := sha1.Sum([]byte(key + webSocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(digest[:]) {
+		return nil, errors.New("WebSocket upgrade returned an invalid Sec-WebSocket-Accept")
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &WebSocketConn{conn: conn, reader: reader}, nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings while it waits.
+// A close frame from the server is reported as io.EOF
+func (ws *WebSocketConn) ReadMessage(timeout time.Duration) ([]byte, error) {
+	var message []byte
+	for {
+		if timeout > 0 {
+			ws.conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			ws.writeFrame(wsOpClose, payload)
+			return nil, io.EOF
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			message = append(message, payload...)
+			if len(message) > WebSocketMaxMessageSize {
+				return nil, fmt.Errorf("WebSocket message larger than %d bytes", WebSocketMaxMessageSize)
+			}
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unexpected WebSocket opcode %d", opcode)
+		}
+	}
+}
+
+// WriteText sends a text message
+func (ws *WebSocketConn) WriteText(data []byte) error {
+	return ws.writeFrame(wsOpText, data)
+}
+
+// Close closes the underlying connection
+func (ws *WebSocketConn) Close() error {
+	return ws.conn.Close()
+}
+
+// readFrame reads a single frame; server frames are never masked
+func (ws *WebSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > WebSocketMaxMessageSize {
+		return false, 0, nil, fmt.Errorf("WebSocket frame larger than %d bytes", WebSocketMaxMessageSize)
+	}
+
+	var mask [4]byte
+	masked := header[1]&0x80 != 0
+	if masked {
+		if _, err = io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends a single masked frame, as clients must (RFC 6455 §5.3)
+func (ws *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	ws.conn.SetWriteDeadline(time.Now().Add(WebSocketDialTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,240 @@
+//go:build !minimal && !nowecom
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WeCom Configuration
+const (
+	WeComAPIURL             = "https://qyapi.weixin.qq.com/cgi-bin"
+	WeComMaxMessageLength   = 2000                   // Text and markdown content are limited to 2048 bytes
+	WeComMessageSendDelay   = 500 * time.Millisecond // Delay between message chunks
+	WeComHTTPRequestTimeout = 10 * time.Second
+	WeComTokenRefreshMargin = 5 * time.Minute // Refresh the access token this long before it expires
+)
+
+// WeCom error codes that mean the cached access token must be refreshed
+const (
+	WeComErrInvalidToken = 40014
+	WeComErrExpiredToken = 42001
+)
+
+// WeComContent represents the text or markdown section of a WeCom message
+type WeComContent struct {
+	Content string `json:"content"`
+}
+
+// WeComMessage represents a message payload for the WeCom application message API
+type WeComMessage struct {
+	ToUser   string        `json:"touser"`
+	MsgType  string        `json:"msgtype"`
+	AgentID  int           `json:"agentid"`
+	Text     *WeComContent `json:"text,omitempty"`
+	Markdown *WeComContent `json:"markdown,omitempty"`
+}
+
+// WeComClient handles all WeCom (WeChat Work) API interactions
+type WeComClient struct {
+	CorpID      string
+	AgentID     int
+	Secret      string
+	MessageType string // "markdown" or "text"
+	HTTPClient  *http.Client
+
+	tokenMutex  sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// NewWeComClient creates a new WeCom client
+func NewWeComClient(corpID string, agentID int, secret, messageType string) *WeComClient {
+	return &WeComClient{
+		CorpID:      corpID,
+		AgentID:     agentID,
+		Secret:      secret,
+		MessageType: messageType,
+		HTTPClient: &http.Client{
+			Timeout: WeComHTTPRequestTimeout,
+		},
+	}
+}
+
+// getAccessToken returns a cached access token, fetching a new one when it is missing or about to expire
+func (wc *WeComClient) getAccessToken(forceRefresh bool) (string, error) {
+	wc.tokenMutex.Lock()
+	defer wc.tokenMutex.Unlock()
+
+	if !forceRefresh && wc.accessToken != "" && time.Now().Before(wc.tokenExpiry) {
+		return wc.accessToken, nil
+	}
+
+	params := url.Values{}
+	params.Set("corpid", wc.CorpID)
+	params.Set("corpsecret", wc.Secret)
+
+	resp, err := wc.HTTPClient.Get(fmt.Sprintf("%s/gettoken?%s", WeComAPIURL, params.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("wecom API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if response.ErrCode != 0 {
+		return "", fmt.Errorf("wecom token error: %d - %s", response.ErrCode, response.ErrMsg)
+	}
+
+	wc.accessToken = response.AccessToken
+	wc.tokenExpiry = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - WeComTokenRefreshMargin)
+
+	log.Printf("Obtained WeCom access token (expires in %ds)", response.ExpiresIn)
+	return wc.accessToken, nil
+}
+
+// SendLongMessageToUser handles long messages by splitting them into chunks for a specific user
+func (wc *WeComClient) SendLongMessageToUser(ctx context.Context, text, userID string) error {
+	chunks := chunkForDestination(ctx, text, WeComMaxMessageLength)
+	if len(chunks) == 1 {
+		return wc.SendMessageToUser(ctx, chunks[0], userID)
+	}
+
+	log.Printf("Message too long (%d chars), splitting into %d chunks for WeCom user %s", len(text), len(chunks), userID)
+
+	for i, chunk := range chunks {
+		// Add part number for continuation messages
+		if i > 0 {
+			chunk = fmt.Sprintf("[Part %d]\n%s", i+1, chunk)
+		}
+
+		if err := wc.SendMessageToUser(ctx, chunk, userID); err != nil {
+			return fmt.Errorf("failed to send chunk %d/%d to WeCom user %s: %w", i+1, len(chunks), userID, err)
+		}
+
+		// Add delay between messages to avoid rate limiting
+		if i < len(chunks)-1 {
+			log.Printf("Sent chunk %d/%d to WeCom user %s, waiting before next...", i+1, len(chunks), userID)
+			time.Sleep(WeComMessageSendDelay)
+		}
+	}
+
+	log.Printf("Successfully sent all %d message chunks to WeCom user %s", len(chunks), userID)
+	return nil
+}
+
+// SendMessageToUser sends a message to a specific WeCom user, refreshing the access token once if it was rejected
+func (wc *WeComClient) SendMessageToUser(ctx context.Context, text, userID string) error {
+	errCode, err := wc.sendMessage(ctx, text, userID, false)
+	if errCode == WeComErrInvalidToken || errCode == WeComErrExpiredToken {
+		log.Printf("WeCom access token rejected (errcode %d), refreshing and retrying", errCode)
+		deliveryReceiptFrom(ctx).recordRetry()
+		_, err = wc.sendMessage(ctx, text, userID, true)
+	}
+	return err
+}
+
+// sendMessage performs a single message/send call and returns the WeCom errcode alongside any error
+func (wc *WeComClient) sendMessage(ctx context.Context, text, userID string, forceRefresh bool) (int, error) {
+	accessToken, err := wc.getAccessToken(forceRefresh)
+	if err != nil {
+		return 0, err
+	}
+
+	message := WeComMessage{
+		ToUser:  userID,
+		MsgType: wc.MessageType,
+		AgentID: wc.AgentID,
+	}
+	if wc.MessageType == "markdown" {
+		message.Markdown = &WeComContent{Content: text}
+	} else {
+		message.Text = &WeComContent{Content: text}
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	log.Printf("Sending message to WeCom user %s (length: %d)", userID, len(text))
+
+	sendURL := fmt.Sprintf("%s/message/send?access_token=%s", WeComAPIURL, url.QueryEscape(accessToken))
+	req, err := http.NewRequestWithContext(ctx, "POST", sendURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := wc.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("wecom API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	// WeCom reports failures with HTTP 200 and a non-zero errcode
+	var response struct {
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+		InvalidUser string `json:"invaliduser,omitempty"`
+		MsgID       string `json:"msgid,omitempty"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if response.ErrCode != 0 {
+		return response.ErrCode, fmt.Errorf("wecom API error: %d - %s", response.ErrCode, response.ErrMsg)
+	}
+
+	// Unknown users are reported as a partial success
+	if response.InvalidUser != "" {
+		return 0, fmt.Errorf("wecom user '%s' not found", response.InvalidUser)
+	}
+
+	deliveryReceiptFrom(ctx).recordMessage(response.MsgID)
+
+	log.Printf("Message sent successfully to WeCom user %s", userID)
+	return 0, nil
+}
+
+// TestConnection validates the credentials by fetching an access token
+func (wc *WeComClient) TestConnection() error {
+	_, err := wc.getAccessToken(true)
+	return err
+}
@@ -0,0 +1,33 @@
+//go:build minimal || nowecom
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func init() {
+	excludeFeature("wecom", "nowecom")
+}
+
+// WeComClient is a placeholder for builds without WeCom support
+type WeComClient struct {
+	MessageType string
+	HTTPClient  *http.Client
+}
+
+// NewWeComClient creates a placeholder client whose calls all fail
+func NewWeComClient(corpID string, agentID int, secret, messageType string) *WeComClient {
+	return &WeComClient{MessageType: messageType, HTTPClient: &http.Client{}}
+}
+
+// SendLongMessageToUser reports that WeCom support was compiled out
+func (wc *WeComClient) SendLongMessageToUser(ctx context.Context, text, userID string) error {
+	return requireFeature("wecom")
+}
+
+// TestConnection reports that WeCom support was compiled out
+func (wc *WeComClient) TestConnection() error {
+	return requireFeature("wecom")
+}
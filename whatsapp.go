@@ -0,0 +1,243 @@
+//go:build !minimal && !nowhatsapp
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WhatsApp Configuration
+const (
+	WhatsAppAPIURL             = "https://graph.facebook.com/v21.0"
+	WhatsAppMaxMessageLength   = 4096                    // Text message body limit
+	WhatsAppMaxTemplateParam   = 1000                    // Practical limit for a single template parameter
+	WhatsAppMessageSendDelay   = 1000 * time.Millisecond // Delay between message chunks
+	WhatsAppHTTPRequestTimeout = 10 * time.Second
+)
+
+// whatsAppWhitespace matches the runs of whitespace template parameters may not contain
+var whatsAppWhitespace = regexp.MustCompile(`[\t\n\r]+| {4,}`)
+
+// WhatsAppText represents the text section of a WhatsApp session message
+type WhatsAppText struct {
+	Body       string `json:"body"`
+	PreviewURL bool   `json:"preview_url"`
+}
+
+// WhatsAppTemplateParameter represents a single template parameter
+type WhatsAppTemplateParameter struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// WhatsAppTemplateComponent represents a template component with its parameters
+type WhatsAppTemplateComponent struct {
+	Type       string                      `json:"type"`
+	Parameters []WhatsAppTemplateParameter `json:"parameters"`
+}
+
+// WhatsAppTemplateLanguage represents the language of a template
+type WhatsAppTemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+// WhatsAppTemplate represents the template section of a WhatsApp template message
+type WhatsAppTemplate struct {
+	Name       string                      `json:"name"`
+	Language   WhatsAppTemplateLanguage    `json:"language"`
+	Components []WhatsAppTemplateComponent `json:"components"`
+}
+
+// WhatsAppMessage represents a message payload for the WhatsApp Cloud API
+type WhatsAppMessage struct {
+	MessagingProduct string            `json:"messaging_product"`
+	To               string            `json:"to"`
+	Type             string            `json:"type"`
+	Text             *WhatsAppText     `json:"text,omitempty"`
+	Template         *WhatsAppTemplate `json:"template,omitempty"`
+}
+
+// WhatsAppClient handles all WhatsApp Cloud API interactions
+type WhatsAppClient struct {
+	AccessToken      string
+	PhoneNumberID    string
+	TemplateName     string // When set, messages are sent as this template instead of session text
+	TemplateLanguage string
+	HTTPClient       *http.Client
+}
+
+// NewWhatsAppClient creates a new WhatsApp client
+func NewWhatsAppClient(accessToken, phoneNumberID, templateName, templateLanguage string) *WhatsAppClient {
+	return &WhatsAppClient{
+		AccessToken:      accessToken,
+		PhoneNumberID:    phoneNumberID,
+		TemplateName:     templateName,
+		TemplateLanguage: templateLanguage,
+		HTTPClient: &http.Client{
+			Timeout: WhatsAppHTTPRequestTimeout,
+		},
+	}
+}
+
+// SendLongTextToNumber handles long session messages by splitting them into chunks for a specific number
+func (wc *WhatsAppClient) SendLongTextToNumber(ctx context.Context, text, number string) error {
+	chunks := chunkForDestination(ctx, text, WhatsAppMaxMessageLength)
+	if len(chunks) == 1 {
+		return wc.SendTextToNumber(ctx, chunks[0], number)
+	}
+
+	log.Printf("Message too long (%d chars), splitting into %d chunks for WhatsApp number %s", len(text), len(chunks), number)
+
+	for i, chunk := range chunks {
+		// Add part number for continuation messages
+		if i > 0 {
+			chunk = fmt.Sprintf("*[Part %d]*\n%s", i+1, chunk)
+		}
+
+		if err := wc.SendTextToNumber(ctx, chunk, number); err != nil {
+			return fmt.Errorf("failed to send chunk %d/%d to WhatsApp number %s: %w", i+1, len(chunks), number, err)
+		}
+
+		// Add delay between messages to avoid rate limiting
+		if i < len(chunks)-1 {
+			log.Printf("Sent chunk %d/%d to WhatsApp number %s, waiting before next...", i+1, len(chunks), number)
+			time.Sleep(WhatsAppMessageSendDelay)
+		}
+	}
+
+	log.Printf("Successfully sent all %d message chunks to WhatsApp number %s", len(chunks), number)
+	return nil
+}
+
+// SendTextToNumber sends a session text message (only delivered inside the 24h customer service window)
+func (wc *WhatsAppClient) SendTextToNumber(ctx context.Context, text, number string) error {
+	return wc.sendMessage(ctx, WhatsAppMessage{
+		MessagingProduct: "whatsapp",
+		To:               number,
+		Type:             "text",
+		Text:             &WhatsAppText{Body: text},
+	})
+}
+
+// SendTemplateToNumber sends the configured template with the subject and body as its two body parameters
+func (wc *WhatsAppClient) SendTemplateToNumber(ctx context.Context, subject, body, number string) error {
+	return wc.sendMessage(ctx, WhatsAppMessage{
+		MessagingProduct: "whatsapp",
+		To:               number,
+		Type:             "template",
+		Template: &WhatsAppTemplate{
+			Name:     wc.TemplateName,
+			Language: WhatsAppTemplateLanguage{Code: wc.TemplateLanguage},
+			Components: []WhatsAppTemplateComponent{{
+				Type: "body",
+				Parameters: []WhatsAppTemplateParameter{
+					{Type: "text", Text: wc.templateParameter(subject)},
+					{Type: "text", Text: wc.templateParameter(body)},
+				},
+			}},
+		},
+	})
+}
+
+// templateParameter flattens and truncates text so it is accepted as a template parameter
+func (wc *WhatsAppClient) templateParameter(text string) string {
+	text = strings.TrimSpace(whatsAppWhitespace.ReplaceAllString(text, " ⏎ "))
+	if text == "" {
+		text = "-"
+	}
+	if len(text) > WhatsAppMaxTemplateParam {
+		// Cut at a rune boundary; half a character is rejected as invalid UTF-8
+		cut := WhatsAppMaxTemplateParam - 3
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut] + "..."
+	}
+	return text
+}
+
+// sendMessage posts a message payload to the Cloud API
+func (wc *WhatsAppClient) sendMessage(ctx context.Context, message WhatsAppMessage) error {
+	url := fmt.Sprintf("%s/%s/messages", WhatsAppAPIURL, wc.PhoneNumberID)
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	log.Printf("Sending %s message to WhatsApp number %s", message.Type, message.To)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", wc.AccessToken))
+
+	resp, err := wc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("whatsapp API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	messageID := ""
+	if len(response.Messages) > 0 {
+		messageID = response.Messages[0].ID
+	}
+	deliveryReceiptFrom(ctx).recordMessage(messageID)
+
+	log.Printf("Message sent successfully to WhatsApp number %s", message.To)
+	return nil
+}
+
+// TestConnection validates the access token by reading the phone number details
+func (wc *WhatsAppClient) TestConnection() error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", WhatsAppAPIURL, wc.PhoneNumberID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", wc.AccessToken))
+
+	resp, err := wc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get phone number info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("whatsapp API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build minimal || nowhatsapp
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func init() {
+	excludeFeature("whatsapp", "nowhatsapp")
+}
+
+// WhatsAppClient is a placeholder for builds without WhatsApp support
+type WhatsAppClient struct {
+	TemplateName string
+	HTTPClient   *http.Client
+}
+
+// NewWhatsAppClient creates a placeholder client whose calls all fail
+func NewWhatsAppClient(accessToken, phoneNumberID, templateName, templateLanguage string) *WhatsAppClient {
+	return &WhatsAppClient{TemplateName: templateName, HTTPClient: &http.Client{}}
+}
+
+// SendLongTextToNumber reports that WhatsApp support was compiled out
+func (wc *WhatsAppClient) SendLongTextToNumber(ctx context.Context, text, number string) error {
+	return requireFeature("whatsapp")
+}
+
+// SendTemplateToNumber reports that WhatsApp support was compiled out
+func (wc *WhatsAppClient) SendTemplateToNumber(ctx context.Context, subject, body, number string) error {
+	return requireFeature("whatsapp")
+}
+
+// TestConnection reports that WhatsApp support was compiled out
+func (wc *WhatsAppClient) TestConnection() error {
+	return requireFeature("whatsapp")
+}
@@ -0,0 +1,210 @@
+//go:build !minimal && !nozoom
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Zoom Configuration
+const (
+	ZoomAPIURL             = "https://api.zoom.us/v2"
+	ZoomOAuthURL           = "https://zoom.us/oauth/token"
+	ZoomMaxMessageLength   = 4096                    // Team Chat message limit
+	ZoomMessageSendDelay   = 1000 * time.Millisecond // Delay between message chunks
+	ZoomHTTPRequestTimeout = 10 * time.Second
+	ZoomTokenRefreshMargin = 5 * time.Minute // Refresh the access token this long before it expires
+)
+
+// ZoomChatMessage represents a message payload for the Team Chat API
+type ZoomChatMessage struct {
+	Message   string `json:"message"`
+	ToChannel string `json:"to_channel"`
+}
+
+// ZoomClient handles all Zoom Team Chat API interactions using a server-to-server OAuth app
+type ZoomClient struct {
+	AccountID    string
+	ClientID     string
+	ClientSecret string
+	UserID       string // User the messages are posted as ("me" for the app owner)
+	HTTPClient   *http.Client
+
+	tokenMutex  sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// NewZoomClient creates a new Zoom client
+func NewZoomClient(accountID, clientID, clientSecret, userID string) *ZoomClient {
+	return &ZoomClient{
+		AccountID:    accountID,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		UserID:       userID,
+		HTTPClient: &http.Client{
+			Timeout: ZoomHTTPRequestTimeout,
+		},
+	}
+}
+
+// getAccessToken returns a cached access token, requesting a new one when it is missing or about to expire
+func (zc *ZoomClient) getAccessToken(forceRefresh bool) (string, error) {
+	zc.tokenMutex.Lock()
+	defer zc.tokenMutex.Unlock()
+
+	if !forceRefresh && zc.accessToken != "" && time.Now().Before(zc.tokenExpiry) {
+		return zc.accessToken, nil
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "account_credentials")
+	params.Set("account_id", zc.AccountID)
+
+	req, err := http.NewRequest("POST", ZoomOAuthURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(zc.ClientID, zc.ClientSecret)
+
+	resp, err := zc.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("zoom OAuth error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	zc.accessToken = response.AccessToken
+	zc.tokenExpiry = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - ZoomTokenRefreshMargin)
+
+	log.Printf("Obtained Zoom access token (expires in %ds)", response.ExpiresIn)
+	return zc.accessToken, nil
+}
+
+// SendLongMessageToChannel handles long messages by splitting them into chunks for a specific channel
+func (zc *ZoomClient) SendLongMessageToChannel(ctx context.Context, text, channelID string) error {
+	chunks := chunkForDestination(ctx, text, ZoomMaxMessageLength)
+	if len(chunks) == 1 {
+		return zc.SendMessageToChannel(ctx, chunks[0], channelID)
+	}
+
+	log.Printf("Message too long (%d chars), splitting into %d chunks for Zoom channel %s", len(text), len(chunks), channelID)
+
+	for i, chunk := range chunks {
+		// Add part number for continuation messages
+		if i > 0 {
+			chunk = fmt.Sprintf("[Part %d]\n%s", i+1, chunk)
+		}
+
+		if err := zc.SendMessageToChannel(ctx, chunk, channelID); err != nil {
+			return fmt.Errorf("failed to send chunk %d/%d to Zoom channel %s: %w", i+1, len(chunks), channelID, err)
+		}
+
+		// Add delay between messages to avoid rate limiting
+		if i < len(chunks)-1 {
+			log.Printf("Sent chunk %d/%d to Zoom channel %s, waiting before next...", i+1, len(chunks), channelID)
+			time.Sleep(ZoomMessageSendDelay)
+		}
+	}
+
+	log.Printf("Successfully sent all %d message chunks to Zoom channel %s", len(chunks), channelID)
+	return nil
+}
+
+// SendMessageToChannel sends a message to a specific channel, refreshing the access token once if it was rejected
+func (zc *ZoomClient) SendMessageToChannel(ctx context.Context, text, channelID string) error {
+	status, err := zc.sendMessage(ctx, text, channelID, false)
+	if status == http.StatusUnauthorized {
+		log.Printf("Zoom access token rejected, refreshing and retrying")
+		deliveryReceiptFrom(ctx).recordRetry()
+		_, err = zc.sendMessage(ctx, text, channelID, true)
+	}
+	return err
+}
+
+// sendMessage performs a single chat message call and returns the HTTP status alongside any error
+func (zc *ZoomClient) sendMessage(ctx context.Context, text, channelID string, forceRefresh bool) (int, error) {
+	accessToken, err := zc.getAccessToken(forceRefresh)
+	if err != nil {
+		return 0, err
+	}
+
+	message := ZoomChatMessage{
+		Message:   text,
+		ToChannel: channelID,
+	}
+
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	log.Printf("Sending message to Zoom channel %s (length: %d)", channelID, len(text))
+
+	endpoint := fmt.Sprintf("%s/chat/users/%s/messages", ZoomAPIURL, url.PathEscape(zc.UserID))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := zc.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Zoom answers 201 Created for new messages
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("zoom API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to parse response: %w", err)
+	}
+	deliveryReceiptFrom(ctx).recordMessage(response.ID)
+
+	log.Printf("Message sent successfully to Zoom channel %s", channelID)
+	return resp.StatusCode, nil
+}
+
+// TestConnection validates the OAuth credentials by requesting an access token
+func (zc *ZoomClient) TestConnection() error {
+	_, err := zc.getAccessToken(true)
+	return err
+}
@@ -0,0 +1,32 @@
+//go:build minimal || nozoom
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func init() {
+	excludeFeature("zoom", "nozoom")
+}
+
+// ZoomClient is a placeholder for builds without Zoom support
+type ZoomClient struct {
+	HTTPClient *http.Client
+}
+
+// NewZoomClient creates a placeholder client whose calls all fail
+func NewZoomClient(accountID, clientID, clientSecret, userID string) *ZoomClient {
+	return &ZoomClient{HTTPClient: &http.Client{}}
+}
+
+// SendLongMessageToChannel reports that Zoom support was compiled out
+func (zc *ZoomClient) SendLongMessageToChannel(ctx context.Context, text, channelID string) error {
+	return requireFeature("zoom")
+}
+
+// TestConnection reports that Zoom support was compiled out
+func (zc *ZoomClient) TestConnection() error {
+	return requireFeature("zoom")
+}